@@ -11,9 +11,10 @@ import (
 
 type Server struct {
 	router *gin.Engine
+	store  *services.MetadataStore
 }
 
-func NewServer() *Server {
+func NewServer() (*Server, error) {
 	router := gin.Default()
 
 	// Configure CORS
@@ -24,25 +25,78 @@ func NewServer() *Server {
 	config.AllowCredentials = true
 	router.Use(cors.New(config))
 
+	// Open the metadata store
+	store, err := services.NewMetadataStore()
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the master key used to encrypt saved credentials
+	keyRing, err := services.NewKeyRing()
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	// Configure where snapshots are kept
+	snapshotStores, err := services.NewSnapshotStores()
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	// Configure snapshot encryption
+	snapshotKeys, err := services.NewSnapshotKeys(keyRing)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
 	// Initialize services
-	dbService := services.NewDatabaseService()
-	snapshotService := services.NewSnapshotService(dbService)
+	dbService := services.NewDatabaseService(store, keyRing)
+	jobManager := services.NewJobManager()
+	eventBus := services.NewEventBus()
+	snapshotService := services.NewSnapshotService(dbService, store, snapshotStores, snapshotKeys, jobManager, eventBus)
+	scheduleService := services.NewScheduleService(store, dbService, snapshotService)
+	retentionService := services.NewRetentionService(store, dbService, snapshotService)
+	physicalService := services.NewPhysicalBackupService(store, dbService, snapshotStores, jobManager, eventBus)
+	restoreAsOfService := services.NewRestoreAsOfService(dbService, snapshotService, physicalService)
 
 	// Initialize controllers
 	dbController := controllers.NewDatabaseController(dbService)
-	snapshotController := controllers.NewSnapshotController(snapshotService)
+	connectionController := controllers.NewConnectionController(dbService)
+	snapshotController := controllers.NewSnapshotController(snapshotService, dbService)
+	restoreController := controllers.NewRestoreController(snapshotService, dbService)
+	drillController := controllers.NewDrillController(snapshotService)
+	scheduleController := controllers.NewScheduleController(scheduleService)
+	retentionController := controllers.NewRetentionController(retentionService)
+	physicalController := controllers.NewPhysicalBackupController(physicalService)
+	restoreAsOfController := controllers.NewRestoreAsOfController(restoreAsOfService)
+	jobController := controllers.NewJobController(jobManager)
+	eventController := controllers.NewEventController(eventBus)
 	systemController := controllers.NewSystemController()
 
 	// Setup routes
 	routes.SetupDatabaseRoutes(router, dbController)
+	routes.SetupConnectionRoutes(router, connectionController)
 	routes.SetupSnapshotRoutes(router, snapshotController)
+	routes.SetupRestoreRoutes(router, restoreController)
+	routes.SetupDrillRoutes(router, drillController)
+	routes.SetupScheduleRoutes(router, scheduleController)
+	routes.SetupRetentionRoutes(router, retentionController)
+	routes.SetupPhysicalBackupRoutes(router, physicalController)
+	routes.SetupRestoreAsOfRoutes(router, restoreAsOfController)
+	routes.SetupJobRoutes(router, jobController)
+	routes.SetupEventRoutes(router, eventController)
 	routes.SetupSystemRoutes(router, systemController)
 
 	return &Server{
 		router: router,
-	}
+		store:  store,
+	}, nil
 }
 
 func (s *Server) Run(addr string) error {
+	defer s.store.Close()
 	return s.router.Run(addr)
 }
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"net/http"
+
+	"PGTimeMachine-Backend/internal/models"
+	"PGTimeMachine-Backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ConnectionController struct {
+	dbService *services.DatabaseService
+}
+
+func NewConnectionController(dbService *services.DatabaseService) *ConnectionController {
+	return &ConnectionController{
+		dbService: dbService,
+	}
+}
+
+// CreateConnection tests and saves a new database connection
+func (cc *ConnectionController) CreateConnection(c *gin.Context) {
+	var config models.DatabaseConnection
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	saved, err := cc.dbService.SaveConnection(&config)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Failed to save connection",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Connection saved successfully",
+		Data:    saved,
+	})
+}
+
+// ListConnections lists all saved connections
+func (cc *ConnectionController) ListConnections(c *gin.Context) {
+	connections, err := cc.dbService.ListConnections()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to list connections",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Connections retrieved successfully",
+		Data:    connections,
+	})
+}
+
+// GetConnection retrieves a saved connection
+func (cc *ConnectionController) GetConnection(c *gin.Context) {
+	connection, err := cc.dbService.GetSavedConnection(c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Connection not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Connection retrieved successfully",
+		Data:    connection,
+	})
+}
+
+// UpdateConnection updates a saved connection
+func (cc *ConnectionController) UpdateConnection(c *gin.Context) {
+	var update models.ConnectionUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	connection, err := cc.dbService.UpdateConnection(c.Param("id"), &update)
+	if err != nil {
+		status := statusForError(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.APIResponse{
+			Success: false,
+			Message: "Failed to update connection",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Connection updated successfully",
+		Data:    connection,
+	})
+}
+
+// DeleteConnection deletes a saved connection
+func (cc *ConnectionController) DeleteConnection(c *gin.Context) {
+	if err := cc.dbService.DeleteConnection(c.Param("id")); err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to delete connection",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Connection deleted successfully",
+	})
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net/http"
+
+	"PGTimeMachine-Backend/internal/models"
+	"PGTimeMachine-Backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DrillController struct {
+	snapshotService *services.SnapshotService
+}
+
+func NewDrillController(snapshotService *services.SnapshotService) *DrillController {
+	return &DrillController{
+		snapshotService: snapshotService,
+	}
+}
+
+// ListDrills lists restore drills, optionally filtered by snapshot or database
+func (dc *DrillController) ListDrills(c *gin.Context) {
+	filter := services.RestoreFilter{
+		SnapshotID: c.Query("snapshot_id"),
+		DatabaseID: c.Query("database_id"),
+	}
+
+	drills, err := dc.snapshotService.ListDrills(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to list restore drills",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Restore drills retrieved successfully",
+		Data:    drills,
+	})
+}
+
+// GetDrill retrieves the report of a restore drill
+func (dc *DrillController) GetDrill(c *gin.Context) {
+	drill, err := dc.snapshotService.GetDrill(c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Restore drill not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Restore drill retrieved successfully",
+		Data:    drill,
+	})
+}
+
+// CancelDrill cancels a restore drill that is still running
+func (dc *DrillController) CancelDrill(c *gin.Context) {
+	if err := dc.snapshotService.CancelDrill(c.Param("id")); err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to cancel restore drill",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Message: "Restore drill cancellation requested",
+	})
+}
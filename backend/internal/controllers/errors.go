@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"PGTimeMachine-Backend/internal/services"
+)
+
+var errMissingConnection = errors.New("either connection_id or database_config is required")
+
+// statusForError maps service errors to HTTP status codes
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSnapshotNotFound),
+		errors.Is(err, services.ErrConnectionNotFound),
+		errors.Is(err, services.ErrRestoreNotFound),
+		errors.Is(err, services.ErrDrillNotFound),
+		errors.Is(err, services.ErrScheduleNotFound),
+		errors.Is(err, services.ErrRetentionPolicyNotFound),
+		errors.Is(err, services.ErrBaseBackupNotFound),
+		errors.Is(err, services.ErrWALArchiveNotFound),
+		errors.Is(err, services.ErrPointInTimeRestoreNotFound),
+		errors.Is(err, services.ErrNoRecoverySource):
+		return http.StatusNotFound
+	case errors.Is(err, errMissingConnection),
+		errors.Is(err, services.ErrInvalidOptions):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrJobNotRunning),
+		errors.Is(err, services.ErrSnapshotBusy),
+		errors.Is(err, services.ErrBaseBackupBusy),
+		errors.Is(err, services.ErrNoSafetyCopy),
+		errors.Is(err, services.ErrSnapshotNotRestorable):
+		return http.StatusConflict
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"io"
+	"time"
+
+	"PGTimeMachine-Backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keepAliveInterval keeps idle event streams open through proxies
+const keepAliveInterval = 15 * time.Second
+
+type EventController struct {
+	eventBus *services.EventBus
+}
+
+func NewEventController(eventBus *services.EventBus) *EventController {
+	return &EventController{
+		eventBus: eventBus,
+	}
+}
+
+// StreamEvents streams the events of all snapshot and restore jobs as Server-Sent Events
+func (ec *EventController) StreamEvents(c *gin.Context) {
+	ec.stream(c, "")
+}
+
+// StreamJobEvents streams the events of a single job, ending once it finishes
+func (ec *EventController) StreamJobEvents(c *gin.Context) {
+	ec.stream(c, c.Param("id"))
+}
+
+func (ec *EventController) stream(c *gin.Context, jobID string) {
+	events, unsubscribe := ec.eventBus.Subscribe(jobID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return jobID == "" || event.Type != "state" || !isTerminalStatus(event.Status)
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// isTerminalStatus reports whether a job in this status will not change again
+func isTerminalStatus(status string) bool {
+	switch status {
+	case "completed", "failed", "cancelled":
+		return true
+	}
+	return false
+}
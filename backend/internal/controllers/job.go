@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"net/http"
+
+	"PGTimeMachine-Backend/internal/models"
+	"PGTimeMachine-Backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobController struct {
+	jobManager *services.JobManager
+}
+
+func NewJobController(jobManager *services.JobManager) *JobController {
+	return &JobController{
+		jobManager: jobManager,
+	}
+}
+
+// ListJobs lists the running and queued snapshot/restore jobs
+func (jc *JobController) ListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Jobs retrieved successfully",
+		Data:    jc.jobManager.List(),
+	})
+}
@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"net/http"
+
+	"PGTimeMachine-Backend/internal/models"
+	"PGTimeMachine-Backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PhysicalBackupController struct {
+	physicalService *services.PhysicalBackupService
+}
+
+func NewPhysicalBackupController(physicalService *services.PhysicalBackupService) *PhysicalBackupController {
+	return &PhysicalBackupController{
+		physicalService: physicalService,
+	}
+}
+
+// CreateBaseBackup queues a base backup of a connection's cluster
+func (pc *PhysicalBackupController) CreateBaseBackup(c *gin.Context) {
+	var request models.BaseBackupRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid request body",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	backup, err := pc.physicalService.CreateBaseBackup(c.Param("id"), &request)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to start base backup",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Base backup queued",
+		Data:    backup,
+	})
+}
+
+// ListBaseBackups lists the base backups of a connection, or all of them
+func (pc *PhysicalBackupController) ListBaseBackups(c *gin.Context) {
+	connectionID := c.Param("id")
+	if connectionID == "" {
+		connectionID = c.Query("connection_id")
+	}
+
+	backups, err := pc.physicalService.ListBaseBackups(connectionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to list base backups",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Base backups retrieved successfully",
+		Data:    backups,
+	})
+}
+
+// GetBaseBackup retrieves a base backup
+func (pc *PhysicalBackupController) GetBaseBackup(c *gin.Context) {
+	backup, err := pc.physicalService.GetBaseBackup(c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Base backup not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Base backup retrieved successfully",
+		Data:    backup,
+	})
+}
+
+// CancelBaseBackup cancels a base backup that is still running
+func (pc *PhysicalBackupController) CancelBaseBackup(c *gin.Context) {
+	if err := pc.physicalService.CancelBaseBackup(c.Param("id")); err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to cancel base backup",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Message: "Base backup cancellation requested",
+	})
+}
+
+// DeleteBaseBackup removes a base backup and its files
+func (pc *PhysicalBackupController) DeleteBaseBackup(c *gin.Context) {
+	if err := pc.physicalService.DeleteBaseBackup(c.Param("id")); err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to delete base backup",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Base backup deleted successfully",
+	})
+}
+
+// GetWALArchive reports the state of a connection's WAL archive
+func (pc *PhysicalBackupController) GetWALArchive(c *gin.Context) {
+	archive, err := pc.physicalService.GetWALArchive(c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "WAL archive not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "WAL archive retrieved successfully",
+		Data:    archive,
+	})
+}
+
+// StartWALArchiving starts archiving a connection's WAL
+func (pc *PhysicalBackupController) StartWALArchiving(c *gin.Context) {
+	var request models.WALArchiveRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid request body",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	archive, err := pc.physicalService.StartWALArchiving(c.Param("id"), &request)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to start WAL archiving",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "WAL archiving started",
+		Data:    archive,
+	})
+}
+
+// StopWALArchiving stops archiving a connection's WAL and drops its replication slot
+func (pc *PhysicalBackupController) StopWALArchiving(c *gin.Context) {
+	archive, err := pc.physicalService.StopWALArchiving(c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to stop WAL archiving",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "WAL archiving stopped",
+		Data:    archive,
+	})
+}
+
+// StartRestore queues the recovery of a connection's cluster to a point in time
+func (pc *PhysicalBackupController) StartRestore(c *gin.Context) {
+	var request models.PointInTimeRestoreRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	restore, err := pc.physicalService.StartPointInTimeRestore(c.Param("id"), &request)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to start point-in-time restore",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Point-in-time restore queued",
+		Data:    restore,
+	})
+}
+
+// ListRestores lists point-in-time restores, optionally of one connection
+func (pc *PhysicalBackupController) ListRestores(c *gin.Context) {
+	restores, err := pc.physicalService.ListRestores(c.Query("connection_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to list point-in-time restores",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Point-in-time restores retrieved successfully",
+		Data:    restores,
+	})
+}
+
+// GetRestore retrieves a point-in-time restore
+func (pc *PhysicalBackupController) GetRestore(c *gin.Context) {
+	restore, err := pc.physicalService.GetRestore(c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Point-in-time restore not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Point-in-time restore retrieved successfully",
+		Data:    restore,
+	})
+}
+
+// CancelRestore cancels a point-in-time restore that is still running
+func (pc *PhysicalBackupController) CancelRestore(c *gin.Context) {
+	if err := pc.physicalService.CancelRestore(c.Param("id")); err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to cancel point-in-time restore",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Message: "Point-in-time restore cancellation requested",
+	})
+}
+
+// StopRestoredCluster stops the cluster a point-in-time restore left running
+func (pc *PhysicalBackupController) StopRestoredCluster(c *gin.Context) {
+	restore, err := pc.physicalService.StopRestoredCluster(c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to stop the restored cluster",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Restored cluster stopped",
+		Data:    restore,
+	})
+}
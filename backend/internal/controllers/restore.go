@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"net/http"
+
+	"PGTimeMachine-Backend/internal/models"
+	"PGTimeMachine-Backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RestoreController struct {
+	snapshotService *services.SnapshotService
+	dbService       *services.DatabaseService
+}
+
+func NewRestoreController(snapshotService *services.SnapshotService, dbService *services.DatabaseService) *RestoreController {
+	return &RestoreController{
+		snapshotService: snapshotService,
+		dbService:       dbService,
+	}
+}
+
+// ListRestores lists restore operations, optionally filtered by snapshot or database
+func (rc *RestoreController) ListRestores(c *gin.Context) {
+	filter := services.RestoreFilter{
+		SnapshotID: c.Query("snapshot_id"),
+		DatabaseID: c.Query("database_id"),
+	}
+
+	operations, err := rc.snapshotService.ListRestores(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to list restore operations",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Restore operations retrieved successfully",
+		Data:    operations,
+	})
+}
+
+// GetRestore retrieves a specific restore operation
+func (rc *RestoreController) GetRestore(c *gin.Context) {
+	operation, err := rc.snapshotService.GetRestore(c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Restore operation not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Restore operation retrieved successfully",
+		Data:    operation,
+	})
+}
+
+// CancelRestore cancels a restore operation that is still running
+func (rc *RestoreController) CancelRestore(c *gin.Context) {
+	if err := rc.snapshotService.CancelRestore(c.Param("id")); err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to cancel restore operation",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Message: "Restore cancellation requested",
+	})
+}
+
+// RollbackRestore swaps the database a replace restore replaced back in
+func (rc *RestoreController) RollbackRestore(c *gin.Context) {
+	config, ok := rc.bindSwapConnection(c)
+	if !ok {
+		return
+	}
+
+	operation, err := rc.snapshotService.RollbackRestore(config, c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to roll back restore operation",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Restore rolled back",
+		Data:    operation,
+	})
+}
+
+// DiscardSafetyCopy drops the database a replace restore set aside
+func (rc *RestoreController) DiscardSafetyCopy(c *gin.Context) {
+	config, ok := rc.bindSwapConnection(c)
+	if !ok {
+		return
+	}
+
+	operation, err := rc.snapshotService.DiscardSafetyCopy(config, c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to discard safety copy",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Safety copy discarded",
+		Data:    operation,
+	})
+}
+
+// bindSwapConnection reads the optional connection_id or database_config to
+// rename databases with; without either the service uses the saved
+// connection the restore was made through. It answers the request itself
+// and returns false when the body is invalid.
+func (rc *RestoreController) bindSwapConnection(c *gin.Context) (*models.DatabaseConnection, bool) {
+	var request struct {
+		ConnectionID   string                     `json:"connection_id"`
+		DatabaseConfig *models.DatabaseConnection `json:"database_config"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid request body",
+				Error:   err.Error(),
+			})
+			return nil, false
+		}
+	}
+
+	if request.ConnectionID == "" {
+		return request.DatabaseConfig, true
+	}
+	config, err := rc.dbService.ResolveConnection(request.ConnectionID)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Invalid database connection",
+			Error:   err.Error(),
+		})
+		return nil, false
+	}
+	return config, true
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"net/http"
+
+	"PGTimeMachine-Backend/internal/models"
+	"PGTimeMachine-Backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RestoreAsOfController struct {
+	restoreAsOfService *services.RestoreAsOfService
+}
+
+func NewRestoreAsOfController(restoreAsOfService *services.RestoreAsOfService) *RestoreAsOfController {
+	return &RestoreAsOfController{
+		restoreAsOfService: restoreAsOfService,
+	}
+}
+
+// RestoreAsOf restores a database as it was at a point in time from the
+// best snapshot or base backup, or explains the choice on a dry run
+func (rc *RestoreAsOfController) RestoreAsOf(c *gin.Context) {
+	var request models.RestoreAsOfRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	plan, err := rc.restoreAsOfService.RestoreAsOf(c.Param("id"), &request)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to restore database as of the requested time",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if plan.DryRun {
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: plan.Explanation,
+			Data:    plan,
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: plan.Explanation,
+		Data:    plan,
+	})
+}
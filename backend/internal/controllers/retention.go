@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"net/http"
+
+	"PGTimeMachine-Backend/internal/models"
+	"PGTimeMachine-Backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RetentionController struct {
+	retentionService *services.RetentionService
+}
+
+func NewRetentionController(retentionService *services.RetentionService) *RetentionController {
+	return &RetentionController{
+		retentionService: retentionService,
+	}
+}
+
+// GetPolicy retrieves the retention policy of a connection
+func (rc *RetentionController) GetPolicy(c *gin.Context) {
+	policy, err := rc.retentionService.GetPolicy(c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Retention policy not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Retention policy retrieved successfully",
+		Data:    policy,
+	})
+}
+
+// SetPolicy creates or replaces the retention policy of a connection
+func (rc *RetentionController) SetPolicy(c *gin.Context) {
+	var policy models.RetentionPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	saved, err := rc.retentionService.SetPolicy(c.Param("id"), &policy)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to save retention policy",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Retention policy saved successfully",
+		Data:    saved,
+	})
+}
+
+// DeletePolicy removes the retention policy of a connection
+func (rc *RetentionController) DeletePolicy(c *gin.Context) {
+	if err := rc.retentionService.DeletePolicy(c.Param("id")); err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to delete retention policy",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Retention policy deleted successfully",
+	})
+}
+
+// DryRun shows which snapshots the saved policy, or the policy in the request
+// body, would delete and why, without deleting anything
+func (rc *RetentionController) DryRun(c *gin.Context) {
+	var policy *models.RetentionPolicy
+	if c.Request.ContentLength != 0 {
+		policy = &models.RetentionPolicy{}
+		if err := c.ShouldBindJSON(policy); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid request body",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	plan, err := rc.retentionService.DryRun(c.Param("id"), policy)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to evaluate retention policy",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Retention policy evaluated successfully",
+		Data:    plan,
+	})
+}
+
+// Prune applies the retention policy of a connection now
+func (rc *RetentionController) Prune(c *gin.Context) {
+	plan, err := rc.retentionService.Prune(c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to prune snapshots",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Snapshots pruned successfully",
+		Data:    plan,
+	})
+}
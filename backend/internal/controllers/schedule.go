@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"net/http"
+
+	"PGTimeMachine-Backend/internal/models"
+	"PGTimeMachine-Backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduleController struct {
+	scheduleService *services.ScheduleService
+}
+
+func NewScheduleController(scheduleService *services.ScheduleService) *ScheduleController {
+	return &ScheduleController{
+		scheduleService: scheduleService,
+	}
+}
+
+// CreateSchedule creates a snapshot schedule for a saved connection
+func (sc *ScheduleController) CreateSchedule(c *gin.Context) {
+	var request models.ScheduleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	schedule, err := sc.scheduleService.CreateSchedule(&request)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to create schedule",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Schedule created successfully",
+		Data:    schedule,
+	})
+}
+
+// ListSchedules lists schedules, optionally filtered by connection
+func (sc *ScheduleController) ListSchedules(c *gin.Context) {
+	schedules, err := sc.scheduleService.ListSchedules(c.Query("connection_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to list schedules",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Schedules retrieved successfully",
+		Data:    schedules,
+	})
+}
+
+// GetSchedule retrieves a schedule
+func (sc *ScheduleController) GetSchedule(c *gin.Context) {
+	schedule, err := sc.scheduleService.GetSchedule(c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Schedule not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Schedule retrieved successfully",
+		Data:    schedule,
+	})
+}
+
+// UpdateSchedule updates a schedule
+func (sc *ScheduleController) UpdateSchedule(c *gin.Context) {
+	var update models.ScheduleUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	schedule, err := sc.scheduleService.UpdateSchedule(c.Param("id"), &update)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to update schedule",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Schedule updated successfully",
+		Data:    schedule,
+	})
+}
+
+// DeleteSchedule deletes a schedule
+func (sc *ScheduleController) DeleteSchedule(c *gin.Context) {
+	if err := sc.scheduleService.DeleteSchedule(c.Param("id")); err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to delete schedule",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Schedule deleted successfully",
+	})
+}
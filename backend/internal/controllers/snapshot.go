@@ -11,19 +11,22 @@ import (
 
 type SnapshotController struct {
 	snapshotService *services.SnapshotService
+	dbService       *services.DatabaseService
 }
 
-func NewSnapshotController(snapshotService *services.SnapshotService) *SnapshotController {
+func NewSnapshotController(snapshotService *services.SnapshotService, dbService *services.DatabaseService) *SnapshotController {
 	return &SnapshotController{
 		snapshotService: snapshotService,
+		dbService:       dbService,
 	}
 }
 
 // CreateSnapshot creates a new database snapshot
 func (sc *SnapshotController) CreateSnapshot(c *gin.Context) {
 	var request struct {
-		DatabaseConfig  models.DatabaseConnection `json:"database_config" binding:"required"`
-		SnapshotRequest models.SnapshotRequest    `json:"snapshot_request" binding:"required"`
+		ConnectionID    string                     `json:"connection_id"`
+		DatabaseConfig  *models.DatabaseConnection `json:"database_config"`
+		SnapshotRequest models.SnapshotRequest     `json:"snapshot_request" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -35,9 +38,22 @@ func (sc *SnapshotController) CreateSnapshot(c *gin.Context) {
 		return
 	}
 
-	snapshot, err := sc.snapshotService.CreateSnapshot(&request.DatabaseConfig, &request.SnapshotRequest)
+	config, err := sc.resolveDatabaseConfig(request.ConnectionID, request.DatabaseConfig)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Invalid database connection",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if request.SnapshotRequest.DatabaseID == "" {
+		request.SnapshotRequest.DatabaseID = config.ID
+	}
+
+	snapshot, err := sc.snapshotService.CreateSnapshot(config, &request.SnapshotRequest)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
 			Success: false,
 			Message: "Failed to create snapshot",
 			Error:   err.Error(),
@@ -55,8 +71,9 @@ func (sc *SnapshotController) CreateSnapshot(c *gin.Context) {
 // RestoreSnapshot restores a database from a snapshot
 func (sc *SnapshotController) RestoreSnapshot(c *gin.Context) {
 	var request struct {
-		DatabaseConfig models.DatabaseConnection `json:"database_config" binding:"required"`
-		RestoreRequest models.RestoreRequest     `json:"restore_request" binding:"required"`
+		ConnectionID   string                     `json:"connection_id"`
+		DatabaseConfig *models.DatabaseConnection `json:"database_config"`
+		RestoreRequest models.RestoreRequest      `json:"restore_request" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -68,9 +85,22 @@ func (sc *SnapshotController) RestoreSnapshot(c *gin.Context) {
 		return
 	}
 
-	operation, err := sc.snapshotService.RestoreSnapshot(&request.DatabaseConfig, &request.RestoreRequest)
+	config, err := sc.resolveDatabaseConfig(request.ConnectionID, request.DatabaseConfig)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Invalid database connection",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if request.RestoreRequest.DatabaseID == "" {
+		request.RestoreRequest.DatabaseID = config.ID
+	}
+
+	operation, err := sc.snapshotService.RestoreSnapshot(config, &request.RestoreRequest)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
 			Success: false,
 			Message: "Failed to start restore operation",
 			Error:   err.Error(),
@@ -154,7 +184,7 @@ func (sc *SnapshotController) DeleteSnapshot(c *gin.Context) {
 
 	err := sc.snapshotService.DeleteSnapshot(snapshotID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+		c.JSON(statusForError(err), models.APIResponse{
 			Success: false,
 			Message: "Failed to delete snapshot",
 			Error:   err.Error(),
@@ -168,6 +198,240 @@ func (sc *SnapshotController) DeleteSnapshot(c *gin.Context) {
 	})
 }
 
+// CancelSnapshot cancels a snapshot that is still being created
+func (sc *SnapshotController) CancelSnapshot(c *gin.Context) {
+	if err := sc.snapshotService.CancelSnapshot(c.Param("id")); err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to cancel snapshot",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, models.APIResponse{
+		Success: true,
+		Message: "Snapshot cancellation requested",
+	})
+}
+
+// VerifySnapshot re-hashes a stored snapshot and reports whether it is intact
+func (sc *SnapshotController) VerifySnapshot(c *gin.Context) {
+	verification, err := sc.snapshotService.VerifySnapshot(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to verify snapshot",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Snapshot " + verification.Result,
+		Data:    verification,
+	})
+}
+
+// GetSnapshotContents lists the objects in a snapshot and the size of each table's data
+func (sc *SnapshotController) GetSnapshotContents(c *gin.Context) {
+	contents, err := sc.snapshotService.GetSnapshotContents(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to read snapshot contents",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Snapshot contents retrieved successfully",
+		Data:    contents,
+	})
+}
+
+// DiffSnapshots reports the schema changes between the snapshots named by the from and to query parameters
+func (sc *SnapshotController) DiffSnapshots(c *gin.Context) {
+	fromID, toID := c.Query("from"), c.Query("to")
+	if fromID == "" || toID == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "from and to query parameters are required",
+		})
+		return
+	}
+
+	diff, err := sc.snapshotService.DiffSnapshots(c.Request.Context(), fromID, toID)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to compare snapshots",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Snapshots compared successfully",
+		Data:    diff,
+	})
+}
+
+// CompareSnapshot reports the schema drift and table changes of a live database since a snapshot
+func (sc *SnapshotController) CompareSnapshot(c *gin.Context) {
+	var request struct {
+		ConnectionID   string                     `json:"connection_id"`
+		DatabaseConfig *models.DatabaseConnection `json:"database_config"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	config, err := sc.resolveDatabaseConfig(request.ConnectionID, request.DatabaseConfig)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Invalid database connection",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	comparison, err := sc.snapshotService.CompareWithLive(c.Request.Context(), config, c.Param("id"))
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to compare snapshot with the live database",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Snapshot compared with the live database successfully",
+		Data:    comparison,
+	})
+}
+
+// PinSnapshot exempts a snapshot from retention pruning
+func (sc *SnapshotController) PinSnapshot(c *gin.Context) {
+	sc.setPinned(c, true)
+}
+
+// UnpinSnapshot makes a snapshot subject to retention pruning again
+func (sc *SnapshotController) UnpinSnapshot(c *gin.Context) {
+	sc.setPinned(c, false)
+}
+
+func (sc *SnapshotController) setPinned(c *gin.Context, pinned bool) {
+	snapshot, err := sc.snapshotService.SetSnapshotPinned(c.Param("id"), pinned)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to update snapshot",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	message := "Snapshot unpinned"
+	if pinned {
+		message = "Snapshot pinned"
+	}
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    snapshot,
+	})
+}
+
+// DrillSnapshot starts a restore drill of a snapshot into a scratch database
+func (sc *SnapshotController) DrillSnapshot(c *gin.Context) {
+	var request struct {
+		ConnectionID   string                     `json:"connection_id"`
+		DatabaseConfig *models.DatabaseConnection `json:"database_config"`
+		DrillRequest   models.DrillRequest        `json:"drill_request"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request body",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	config, err := sc.resolveDatabaseConfig(request.ConnectionID, request.DatabaseConfig)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Invalid database connection",
+			Error:   err.Error(),
+		})
+		return
+	}
+	if request.DrillRequest.DatabaseID == "" {
+		request.DrillRequest.DatabaseID = config.ID
+	}
+
+	drill, err := sc.snapshotService.StartRestoreDrill(config, c.Param("id"), &request.DrillRequest)
+	if err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Failed to start restore drill",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Restore drill started",
+		Data:    drill,
+	})
+}
+
+// ListSnapshotRestores lists the restore history of a snapshot
+func (sc *SnapshotController) ListSnapshotRestores(c *gin.Context) {
+	snapshotID := c.Param("id")
+	if _, err := sc.snapshotService.GetSnapshot(snapshotID); err != nil {
+		c.JSON(statusForError(err), models.APIResponse{
+			Success: false,
+			Message: "Snapshot not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	operations, err := sc.snapshotService.ListRestores(services.RestoreFilter{SnapshotID: snapshotID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to list restore operations",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Restore history retrieved successfully",
+		Data:    operations,
+	})
+}
+
 // GetSnapshotProgress gets the progress of a snapshot operation
 func (sc *SnapshotController) GetSnapshotProgress(c *gin.Context) {
 	snapshotID := c.Param("id")
@@ -195,3 +459,15 @@ func (sc *SnapshotController) GetSnapshotProgress(c *gin.Context) {
 		Data:    progress,
 	})
 }
+
+// resolveDatabaseConfig returns the saved connection when connectionID is
+// set, otherwise the inline database_config from the request
+func (sc *SnapshotController) resolveDatabaseConfig(connectionID string, inline *models.DatabaseConnection) (*models.DatabaseConnection, error) {
+	if connectionID != "" {
+		return sc.dbService.ResolveConnection(connectionID)
+	}
+	if inline == nil {
+		return nil, errMissingConnection
+	}
+	return inline, nil
+}
@@ -71,8 +71,9 @@ func (sc *SystemController) GetSystemInfo(c *gin.Context) {
 			"available": false,
 			"error":     err.Error(),
 			"paths": map[string]string{
-				"pg_dump": sc.toolsService.GetPgDumpPath(),
-				"psql":    sc.toolsService.GetPsqlPath(),
+				"pg_dump":    sc.toolsService.GetPgDumpPath(),
+				"psql":       sc.toolsService.GetPsqlPath(),
+				"pg_restore": sc.toolsService.GetPgRestorePath(),
 			},
 		}
 	} else {
@@ -82,8 +83,9 @@ func (sc *SystemController) GetSystemInfo(c *gin.Context) {
 			"available": true,
 			"versions":  versions,
 			"paths": map[string]string{
-				"pg_dump": sc.toolsService.GetPgDumpPath(),
-				"psql":    sc.toolsService.GetPsqlPath(),
+				"pg_dump":    sc.toolsService.GetPgDumpPath(),
+				"psql":       sc.toolsService.GetPsqlPath(),
+				"pg_restore": sc.toolsService.GetPgRestorePath(),
 			},
 		}
 	}
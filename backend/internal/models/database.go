@@ -12,36 +12,392 @@ type DatabaseConnection struct {
 	Port      int       `json:"port" db:"port" binding:"required"`
 	Database  string    `json:"database" db:"database" binding:"required"`
 	Username  string    `json:"username" db:"username" binding:"required"`
-	Password  string    `json:"password" db:"password" binding:"required"`
+	Password  string    `json:"password,omitempty" db:"password" binding:"required"`
 	SSLMode   string    `json:"ssl_mode" db:"ssl_mode"`
+	Storage   string    `json:"storage,omitempty" db:"storage" binding:"omitempty,oneof=local s3"` // where snapshots of this database are kept; defaults to local
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// ConnectionUpdate represents a partial update of a saved connection;
+// omitted fields keep their current value
+type ConnectionUpdate struct {
+	Name     *string `json:"name"`
+	Host     *string `json:"host"`
+	Port     *int    `json:"port"`
+	Database *string `json:"database"`
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+	SSLMode  *string `json:"ssl_mode"`
+	Storage  *string `json:"storage" binding:"omitempty,oneof=local s3"`
+}
+
 // Snapshot represents a database snapshot/backup
 type Snapshot struct {
-	ID           string     `json:"id" db:"id"`
-	DatabaseID   string     `json:"database_id" db:"database_id" binding:"required"`
-	Name         string     `json:"name" db:"name" binding:"required"`
-	Description  string     `json:"description" db:"description"`
-	FilePath     string     `json:"file_path" db:"file_path"`
-	FileSize     int64      `json:"file_size" db:"file_size"`
-	Status       string     `json:"status" db:"status"` // creating, completed, failed, restoring
-	ErrorMessage string     `json:"error_message" db:"error_message"`
-	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
-	CompletedAt  *time.Time `json:"completed_at" db:"completed_at"`
+	ID               string              `json:"id" db:"id"`
+	DatabaseID       string              `json:"database_id" db:"database_id" binding:"required"`
+	DatabaseName     string              `json:"database_name" db:"database_name"`
+	Name             string              `json:"name" db:"name" binding:"required"`
+	Description      string              `json:"description" db:"description"`
+	Format           string              `json:"format" db:"format"`       // plain, custom, directory, tar
+	Mode             string              `json:"mode,omitempty" db:"mode"` // full, schema_only, data_only
+	Filters          *SnapshotFilters    `json:"filters,omitempty" db:"filters"`
+	ParallelJobs     int                 `json:"parallel_jobs,omitempty" db:"parallel_jobs"`
+	Compression      string              `json:"compression,omitempty" db:"compression"` // none, gzip, zstd
+	CompressionLevel int                 `json:"compression_level,omitempty" db:"compression_level"`
+	Encryption       *SnapshotEncryption `json:"encryption,omitempty" db:"encryption"`
+	Storage          string              `json:"storage,omitempty" db:"storage"`         // local, s3
+	StorageKey       string              `json:"storage_key,omitempty" db:"storage_key"` // object key within the storage backend
+	FilePath         string              `json:"file_path" db:"file_path"`               // path or URL of the snapshot, for display
+	FileSize         int64               `json:"file_size" db:"file_size"`               // bytes on disk
+	LogicalSize      int64               `json:"logical_size" db:"logical_size"`         // bytes produced by pg_dump, before compression
+	SHA256           string              `json:"sha256,omitempty" db:"sha256"`           // digest of the stored bytes, recorded at backup time
+	CountRows        bool                `json:"count_rows,omitempty" db:"count_rows"`   // row_counts were requested
+	RowCounts        map[string]int64    `json:"row_counts,omitempty" db:"row_counts"`   // exact rows per schema.table (a part holding a dot is double-quoted), counted in the snapshot pg_dump used
+	TableSizes       map[string]int64    `json:"table_sizes,omitempty" db:"table_sizes"` // on-disk bytes per schema.table when the dump started
+	ScheduleID       string              `json:"schedule_id,omitempty" db:"schedule_id"` // schedule that took the snapshot
+	Pinned           bool                `json:"pinned" db:"pinned"`                     // exempt from retention pruning
+	Status           string              `json:"status" db:"status"`                     // queued, creating, completed, failed, cancelled, corrupt, missing
+	ErrorMessage     string              `json:"error_message" db:"error_message"`
+	CreatedAt        time.Time           `json:"created_at" db:"created_at"`
+	CompletedAt      *time.Time          `json:"completed_at" db:"completed_at"`
+	ConsistentAt     *time.Time          `json:"consistent_at,omitempty" db:"consistent_at"` // when the database state in the dump was captured
+	VerifiedAt       *time.Time          `json:"verified_at,omitempty" db:"verified_at"`
+	QueuePosition    int                 `json:"queue_position,omitempty" db:"-"` // set while waiting for a worker
+}
+
+// SnapshotFilters narrows what a snapshot dumps using pg_dump's pattern
+// switches. Patterns use psql wildcards (* and ?); table patterns may be
+// qualified with a schema pattern, and double quotes match a name exactly.
+type SnapshotFilters struct {
+	Schemas          []string `json:"schemas,omitempty"`            // -n: only these schemas
+	ExcludeSchemas   []string `json:"exclude_schemas,omitempty"`    // -N
+	Tables           []string `json:"tables,omitempty"`             // -t: only these tables, regardless of schema filters
+	ExcludeTables    []string `json:"exclude_tables,omitempty"`     // -T
+	ExcludeTableData []string `json:"exclude_table_data,omitempty"` // --exclude-table-data: definition only, no rows
+}
+
+// SnapshotEncryption describes how a snapshot file is encrypted. The file is
+// encrypted with a per-snapshot data key, stored here wrapped by a master key
+// or for age recipients.
+type SnapshotEncryption struct {
+	Method     string   `json:"method"`      // master, age
+	Cipher     string   `json:"cipher"`      // aes-256-gcm
+	KeyIDs     []string `json:"key_ids"`     // master key ID or age recipients that can unwrap the data key
+	WrappedKey string   `json:"wrapped_key"` // data key, encrypted
+}
+
+// SnapshotVerification reports whether a stored snapshot still matches the
+// digest and length recorded when it was taken
+type SnapshotVerification struct {
+	SnapshotID     string    `json:"snapshot_id"`
+	Result         string    `json:"result"` // verified, corrupt, missing
+	Message        string    `json:"message"`
+	ExpectedSHA256 string    `json:"expected_sha256"`
+	ActualSHA256   string    `json:"actual_sha256,omitempty"`
+	ExpectedSize   int64     `json:"expected_size"`
+	ActualSize     int64     `json:"actual_size"`
+	VerifiedAt     time.Time `json:"verified_at"`
+}
+
+// SnapshotContents lists what a snapshot contains, read from the dump itself
+type SnapshotContents struct {
+	SnapshotID string           `json:"snapshot_id"`
+	Schemas    []string         `json:"schemas"`
+	Extensions []string         `json:"extensions"`
+	Tables     []SnapshotTable  `json:"tables"`
+	Views      []SnapshotObject `json:"views"`     // views and materialized views
+	Functions  []SnapshotObject `json:"functions"` // functions, procedures and aggregates, named with their arguments
+	Sequences  []SnapshotObject `json:"sequences"`
+	DataBytes  int64            `json:"data_bytes"` // total of the tables' data_bytes
+	ReadAt     time.Time        `json:"read_at"`
+}
+
+// SnapshotObject is a schema object found in a snapshot
+type SnapshotObject struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"` // object type as pg_dump names it, such as VIEW or FUNCTION
+}
+
+// SnapshotTable is a table found in a snapshot with the size of its data
+type SnapshotTable struct {
+	Schema    string `json:"schema"`
+	Name      string `json:"name"`
+	HasData   bool   `json:"has_data"`   // false when the snapshot holds only the definition
+	Rows      int64  `json:"rows"`       // rows in the dump
+	DataBytes int64  `json:"data_bytes"` // size of the rows as COPY text, before compression
+}
+
+// SnapshotDiff reports the structural differences between two snapshots
+type SnapshotDiff struct {
+	FromSnapshotID string         `json:"from_snapshot_id"`
+	ToSnapshotID   string         `json:"to_snapshot_id"`
+	Added          []SchemaChange `json:"added"`
+	Removed        []SchemaChange `json:"removed"`
+	Changed        []SchemaChange `json:"changed"`
+}
+
+// SchemaChange is an object that was added, removed or changed between two
+// snapshots, with its normalised definition on either side
+type SchemaChange struct {
+	Kind           string `json:"kind"` // table, column, type, default, constraint, index, view, function, grant, ...
+	Schema         string `json:"schema"`
+	Table          string `json:"table,omitempty"` // table of a column, default, constraint or trigger
+	Name           string `json:"name"`
+	FromDefinition string `json:"from_definition,omitempty"`
+	ToDefinition   string `json:"to_definition,omitempty"`
+	Diff           string `json:"diff,omitempty"` // unified diff of the definitions of a changed object
+}
+
+// LiveComparison reports how a live database has changed since a snapshot
+type LiveComparison struct {
+	SnapshotID        string        `json:"snapshot_id"`
+	Database          string        `json:"database"`
+	SnapshotCreatedAt time.Time     `json:"snapshot_created_at"`
+	ComparedAt        time.Time     `json:"compared_at"`
+	Schema            *SnapshotDiff `json:"schema"` // from the snapshot to the live database; null for data_only snapshots
+	Tables            []TableDelta  `json:"tables"`
+}
+
+// TableDelta compares the rows and size of a table when a snapshot was taken
+// with the live database. A side is null when the table is missing there or
+// was not measured, and the deltas are then zero.
+type TableDelta struct {
+	Schema        string `json:"schema"`
+	Name          string `json:"name"`
+	Status        string `json:"status"` // added, removed, changed, unchanged, unknown (the snapshot recorded nothing)
+	SnapshotRows  *int64 `json:"snapshot_rows"`
+	LiveRows      *int64 `json:"live_rows"`
+	RowDelta      int64  `json:"row_delta"`
+	SnapshotBytes *int64 `json:"snapshot_bytes"`
+	LiveBytes     *int64 `json:"live_bytes"`
+	ByteDelta     int64  `json:"byte_delta"`
 }
 
 // RestoreOperation represents a database restore operation
 type RestoreOperation struct {
-	ID           string     `json:"id" db:"id"`
-	SnapshotID   string     `json:"snapshot_id" db:"snapshot_id" binding:"required"`
-	DatabaseID   string     `json:"database_id" db:"database_id" binding:"required"`
-	TargetDBName string     `json:"target_db_name" db:"target_db_name"`
-	Status       string     `json:"status" db:"status"` // pending, in_progress, completed, failed
-	ErrorMessage string     `json:"error_message" db:"error_message"`
-	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
-	CompletedAt  *time.Time `json:"completed_at" db:"completed_at"`
+	ID               string          `json:"id" db:"id"`
+	SnapshotID       string          `json:"snapshot_id" db:"snapshot_id" binding:"required"`
+	DatabaseID       string          `json:"database_id" db:"database_id" binding:"required"`
+	TargetDBName     string          `json:"target_db_name" db:"target_db_name"`
+	ParallelJobs     int             `json:"parallel_jobs,omitempty" db:"parallel_jobs"`
+	SchemaSnapshotID string          `json:"schema_snapshot_id,omitempty" db:"schema_snapshot_id"` // schema loaded before a data-only snapshot
+	Objects          *RestoreObjects `json:"objects,omitempty" db:"objects"`                       // restore only these objects
+	ExistingTarget   bool            `json:"existing_target,omitempty" db:"existing_target"`       // target database existed before the restore
+	Mode             string          `json:"mode,omitempty" db:"mode"`                             // new, replace
+	StagingDBName    string          `json:"staging_db_name,omitempty" db:"staging_db_name"`       // replace: database the snapshot is loaded into before the swap
+	SafetyDBName     string          `json:"safety_db_name,omitempty" db:"safety_db_name"`         // replace: name the replaced database is kept under
+	SwapStatus       string          `json:"swap_status,omitempty" db:"swap_status"`               // replace: swapped, rolled_back, discarded
+	SwappedAt        *time.Time      `json:"swapped_at,omitempty" db:"swapped_at"`                 // replace: when the restored database took the target's name
+	RolledBackAt     *time.Time      `json:"rolled_back_at,omitempty" db:"rolled_back_at"`         // replace: when the replaced database was swapped back
+	Status           string          `json:"status" db:"status"`                                   // queued, in_progress, swapping, completed, failed, cancelled
+	ErrorMessage     string          `json:"error_message" db:"error_message"`
+	Output           string          `json:"output,omitempty" db:"output"` // full psql output of a failed restore
+	CreatedAt        time.Time       `json:"created_at" db:"created_at"`
+	StartedAt        *time.Time      `json:"started_at" db:"started_at"`
+	CompletedAt      *time.Time      `json:"completed_at" db:"completed_at"`
+	QueuePosition    int             `json:"queue_position,omitempty" db:"-"` // set while waiting for a worker
+}
+
+// RestoreDrill is a test restore of a snapshot into a scratch database that is
+// checked for consistency and dropped again. RestoreSeconds is the measured
+// time to recover from the snapshot.
+type RestoreDrill struct {
+	ID             string       `json:"id" db:"id"`
+	SnapshotID     string       `json:"snapshot_id" db:"snapshot_id"`
+	DatabaseID     string       `json:"database_id" db:"database_id"`
+	ScratchDBName  string       `json:"scratch_db_name" db:"scratch_db_name"`
+	ScratchDropped bool         `json:"scratch_dropped" db:"scratch_dropped"`
+	ParallelJobs   int          `json:"parallel_jobs,omitempty" db:"parallel_jobs"`
+	Status         string       `json:"status" db:"status"` // queued, running, passed, failed, cancelled
+	ErrorMessage   string       `json:"error_message,omitempty" db:"error_message"`
+	Output         string       `json:"output,omitempty" db:"output"` // full restore tool output of a failed load
+	Checks         []DrillCheck `json:"checks" db:"checks"`
+	RestoreSeconds float64      `json:"restore_seconds" db:"restore_seconds"` // loading the snapshot
+	CheckSeconds   float64      `json:"check_seconds" db:"check_seconds"`     // running the checks
+	TotalSeconds   float64      `json:"total_seconds" db:"total_seconds"`     // start to scratch database dropped
+	CreatedAt      time.Time    `json:"created_at" db:"created_at"`
+	StartedAt      *time.Time   `json:"started_at" db:"started_at"`
+	CompletedAt    *time.Time   `json:"completed_at" db:"completed_at"`
+	QueuePosition  int          `json:"queue_position,omitempty" db:"-"` // set while waiting for a worker
+}
+
+// DrillCheck is the outcome of one sanity check of a restore drill
+type DrillCheck struct {
+	Name     string   `json:"name"`   // tables_exist, row_counts, sequences, indexes
+	Status   string   `json:"status"` // passed, failed, skipped
+	Message  string   `json:"message"`
+	Failures []string `json:"failures,omitempty"` // objects that failed the check
+}
+
+// RetentionPolicy decides which completed snapshots of a connection are kept.
+// A snapshot is kept if any rule keeps it: one of the newest KeepLast, or the
+// newest of its day, week or month within the last KeepDaily days, KeepWeekly
+// weeks or KeepMonthly months. MaxBytes then caps the total size of what is
+// kept by deleting the oldest. Pinned snapshots are always kept.
+type RetentionPolicy struct {
+	ConnectionID string     `json:"connection_id" db:"connection_id"`
+	KeepLast     int        `json:"keep_last" db:"keep_last" binding:"min=0"`
+	KeepDaily    int        `json:"keep_daily" db:"keep_daily" binding:"min=0"`
+	KeepWeekly   int        `json:"keep_weekly" db:"keep_weekly" binding:"min=0"`
+	KeepMonthly  int        `json:"keep_monthly" db:"keep_monthly" binding:"min=0"`
+	MaxBytes     int64      `json:"max_bytes" db:"max_bytes" binding:"min=0"` // 0 means no limit
+	Timezone     string     `json:"timezone" db:"timezone"`                   // where days, weeks and months begin; defaults to UTC
+	LastPrunedAt *time.Time `json:"last_pruned_at,omitempty" db:"last_pruned_at"`
+	LastDeleted  int        `json:"last_deleted" db:"last_deleted"` // snapshots deleted by the last prune
+	LastError    string     `json:"last_error,omitempty" db:"last_error"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// RetentionDecision says whether a retention policy keeps a snapshot and why
+type RetentionDecision struct {
+	SnapshotID string    `json:"snapshot_id"`
+	Name       string    `json:"name"`
+	CreatedAt  time.Time `json:"created_at"`
+	FileSize   int64     `json:"file_size"`
+	Action     string    `json:"action"` // keep, delete
+	Reasons    []string  `json:"reasons"`
+}
+
+// RetentionPlan is the outcome of evaluating a retention policy
+type RetentionPlan struct {
+	ConnectionID string              `json:"connection_id"`
+	Policy       *RetentionPolicy    `json:"policy"`
+	EvaluatedAt  time.Time           `json:"evaluated_at"`
+	Decisions    []RetentionDecision `json:"decisions"` // newest first
+	KeptBytes    int64               `json:"kept_bytes"`
+	FreedBytes   int64               `json:"freed_bytes"`
+}
+
+// BaseBackup is a physical copy of a whole PostgreSQL cluster taken with
+// pg_basebackup. With the WAL archived after it, the cluster can be recovered
+// to any moment from CompletedAt on.
+type BaseBackup struct {
+	ID            string     `json:"id" db:"id"`
+	ConnectionID  string     `json:"connection_id" db:"connection_id"`
+	Host          string     `json:"host" db:"host"` // host:port of the cluster
+	Label         string     `json:"label" db:"label"`
+	Directory     string     `json:"directory" db:"directory"` // holds base.tar.gz, pg_wal.tar.gz and backup_manifest
+	Size          int64      `json:"size" db:"size"`
+	StartLSN      string     `json:"start_lsn,omitempty" db:"start_lsn"`
+	EndLSN        string     `json:"end_lsn,omitempty" db:"end_lsn"` // the backup is consistent once recovery reaches this point
+	Timeline      int        `json:"timeline,omitempty" db:"timeline"`
+	Status        string     `json:"status" db:"status"` // queued, running, completed, failed, cancelled
+	ErrorMessage  string     `json:"error_message,omitempty" db:"error_message"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	StartedAt     *time.Time `json:"started_at" db:"started_at"`
+	CompletedAt   *time.Time `json:"completed_at" db:"completed_at"`
+	QueuePosition int        `json:"queue_position,omitempty" db:"-"` // set while waiting for a worker
+}
+
+// BaseBackupRequest represents a request to take a base backup
+type BaseBackupRequest struct {
+	Label    string `json:"label"`
+	Priority int    `json:"priority"` // higher priority jobs leave the queue first
+}
+
+// WALArchive is the continuous archiving of a connection's write-ahead log
+// with pg_receivewal through a replication slot
+type WALArchive struct {
+	ConnectionID  string     `json:"connection_id" db:"connection_id"`
+	SlotName      string     `json:"slot_name" db:"slot_name"`
+	Directory     string     `json:"directory" db:"directory"`
+	Enabled       bool       `json:"enabled" db:"enabled"`
+	Running       bool       `json:"running" db:"-"`         // pg_receivewal is connected
+	Restarts      int        `json:"restarts" db:"restarts"` // times pg_receivewal was restarted after exiting
+	LastError     string     `json:"last_error,omitempty" db:"last_error"`
+	StartedAt     time.Time  `json:"started_at" db:"started_at"`
+	Segments      int        `json:"segments" db:"-"` // WAL segments in the archive
+	ArchivedBytes int64      `json:"archived_bytes" db:"-"`
+	LatestSegment string     `json:"latest_segment,omitempty" db:"-"` // segment being received, or the last one completed
+	LatestWriteAt *time.Time `json:"latest_write_at,omitempty" db:"-"`
+}
+
+// WALArchiveRequest represents a request to start archiving WAL
+type WALArchiveRequest struct {
+	SlotName string `json:"slot_name"` // defaults to pgtm_ and the start of the connection ID
+}
+
+// RecoveryTarget is where point-in-time recovery stops: a moment, a WAL
+// location or a restore point created with pg_create_restore_point. With none
+// set, recovery replays all archived WAL.
+type RecoveryTarget struct {
+	Time *time.Time `json:"time,omitempty"`
+	LSN  string     `json:"lsn,omitempty"`
+	Name string     `json:"name,omitempty"`
+}
+
+// PointInTimeRestore materialises a new data directory from a base backup and
+// archived WAL, recovered to Target
+type PointInTimeRestore struct {
+	ID            string         `json:"id" db:"id"`
+	ConnectionID  string         `json:"connection_id" db:"connection_id"`
+	BaseBackupID  string         `json:"base_backup_id" db:"base_backup_id"`
+	Target        RecoveryTarget `json:"target" db:"target"`
+	DataDir       string         `json:"data_dir" db:"data_dir"`
+	Port          int            `json:"port,omitempty" db:"port"`
+	Start         bool           `json:"start" db:"start"`     // start the cluster and wait for recovery to finish
+	Running       bool           `json:"running" db:"running"` // the recovered cluster was left running
+	Status        string         `json:"status" db:"status"`   // queued, restoring, recovering, completed, failed, cancelled
+	ErrorMessage  string         `json:"error_message,omitempty" db:"error_message"`
+	Output        string         `json:"output,omitempty" db:"output"` // end of the server log of a failed recovery
+	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
+	StartedAt     *time.Time     `json:"started_at" db:"started_at"`
+	CompletedAt   *time.Time     `json:"completed_at" db:"completed_at"`
+	QueuePosition int            `json:"queue_position,omitempty" db:"-"` // set while waiting for a worker
+}
+
+// PointInTimeRestoreRequest represents a request to recover a connection's
+// cluster to a point in time
+type PointInTimeRestoreRequest struct {
+	Target       RecoveryTarget `json:"target"`
+	BaseBackupID string         `json:"base_backup_id"` // defaults to the latest base backup before the target
+	DataDir      string         `json:"data_dir"`       // must not exist or be empty; defaults to a directory under PITR_DATA_DIR
+	Port         int            `json:"port" binding:"omitempty,min=1,max=65535"`
+	Start        bool           `json:"start"`
+	Priority     int            `json:"priority"` // higher priority jobs leave the queue first
+}
+
+// RestoreAsOfRequest asks for a database as it was at a moment. Source picks
+// what to recover from: auto (default) takes whichever loses the least,
+// snapshot restores the latest snapshot from before Time into a new database
+// and pitr recovers the cluster from a base backup and archived WAL.
+type RestoreAsOfRequest struct {
+	Time         time.Time `json:"time" binding:"required"`
+	Source       string    `json:"source" binding:"omitempty,oneof=auto snapshot pitr"`
+	TargetDBName string    `json:"target_db_name"` // snapshot restores; defaults to <database>_restored_<timestamp>
+	ParallelJobs int       `json:"parallel_jobs" binding:"omitempty,min=1,max=64"`
+	DataDir      string    `json:"data_dir"` // point-in-time restores, as in PointInTimeRestoreRequest
+	Port         int       `json:"port" binding:"omitempty,min=1,max=65535"`
+	Start        bool      `json:"start"`
+	DryRun       bool      `json:"dry_run"`  // only explain which source would be used
+	Priority     int       `json:"priority"` // higher priority jobs leave the queue first
+}
+
+// RecoverySource is a snapshot or a base backup with archived WAL considered
+// for a restore to a point in time
+type RecoverySource struct {
+	Source          string     `json:"source"` // snapshot, pitr
+	SnapshotID      string     `json:"snapshot_id,omitempty"`
+	BaseBackupID    string     `json:"base_backup_id,omitempty"`
+	RecoveredTo     *time.Time `json:"recovered_to,omitempty"` // the moment the restored data reflects
+	DataLossSeconds float64    `json:"data_loss_seconds"`      // from recovered_to to the requested time; changes made then are not restored
+	Usable          bool       `json:"usable"`
+	Reason          string     `json:"reason"`
+}
+
+// RestoreAsOfPlan explains which source a restore to a point in time uses and
+// how much it loses; once started it carries the restore it queued
+type RestoreAsOfPlan struct {
+	DatabaseID         string              `json:"database_id"`
+	RequestedTime      time.Time           `json:"requested_time"`
+	Chosen             *RecoverySource     `json:"chosen"`
+	Considered         []RecoverySource    `json:"considered"`
+	Explanation        string              `json:"explanation"`
+	DryRun             bool                `json:"dry_run"`
+	Restore            *RestoreOperation   `json:"restore,omitempty"`      // snapshot restores
+	PointInTimeRestore *PointInTimeRestore `json:"pitr_restore,omitempty"` // point-in-time restores
 }
 
 // DatabaseInfo represents basic database information
@@ -52,28 +408,177 @@ type DatabaseInfo struct {
 	Schemas []string `json:"schemas"`
 }
 
+// TableStats represents the size of a table as reported by the live database
+type TableStats struct {
+	Schema        string `json:"schema"`
+	Name          string `json:"name"`
+	SizeBytes     int64  `json:"size_bytes"`
+	EstimatedRows int64  `json:"estimated_rows"`
+}
+
 // SnapshotRequest represents a request to create a snapshot
 type SnapshotRequest struct {
-	DatabaseID  string `json:"database_id" binding:"required"`
+	DatabaseID  string `json:"database_id"`
 	Name        string `json:"name" binding:"required"`
 	Description string `json:"description"`
+	Format      string `json:"format" binding:"omitempty,oneof=plain custom directory tar"` // defaults to plain
+	Mode        string `json:"mode" binding:"omitempty,oneof=full schema_only data_only"`   // defaults to full
+	Priority    int    `json:"priority"`                                                    // higher priority jobs leave the queue first
+	// ParallelJobs dumps that many tables at once with pg_dump -j; requires the
+	// directory format, which is selected when format is omitted
+	ParallelJobs int `json:"parallel_jobs" binding:"omitempty,min=1,max=64"`
+	// Compression pipes the dump through gzip or zstd as it is written; level 0
+	// uses the method's default
+	Compression      string `json:"compression" binding:"omitempty,oneof=none gzip zstd"`
+	CompressionLevel int    `json:"compression_level" binding:"omitempty,min=1,max=22"`
+	// Encryption encrypts the dump with a data key wrapped by the master key or
+	// for AgeRecipients; defaults to SNAPSHOT_ENCRYPTION
+	Encryption    string   `json:"encryption" binding:"omitempty,oneof=none master age"`
+	AgeRecipients []string `json:"age_recipients"`
+	// Filters includes or excludes schemas, tables and table data; every
+	// pattern must match the live database when the snapshot is requested
+	Filters *SnapshotFilters `json:"filters"`
+	// CountRows counts the rows of every dumped table exactly, in the snapshot
+	// pg_dump uses, so restore drills can check them; it reads every table
+	// once more than the dump does
+	CountRows bool `json:"count_rows"`
+	// ScheduleID is set by the scheduler for the snapshots it takes
+	ScheduleID string `json:"-"`
+}
+
+// Schedule takes snapshots of a saved connection at the times matched by a
+// cron expression, evaluated in Timezone
+type Schedule struct {
+	ID             string            `json:"id" db:"id"`
+	Name           string            `json:"name" db:"name"`
+	ConnectionID   string            `json:"connection_id" db:"connection_id"`
+	Cron           string            `json:"cron" db:"cron"`         // five fields or @hourly, @daily, @weekly, @monthly, @yearly
+	Timezone       string            `json:"timezone" db:"timezone"` // IANA name; defaults to UTC
+	Enabled        bool              `json:"enabled" db:"enabled"`
+	MissedRuns     string            `json:"missed_runs" db:"missed_runs"` // run_once, skip: what to do with runs missed while the server was down
+	Snapshot       ScheduledSnapshot `json:"snapshot" db:"snapshot"`
+	LastRunAt      *time.Time        `json:"last_run_at,omitempty" db:"last_run_at"`
+	LastSnapshotID string            `json:"last_snapshot_id,omitempty" db:"last_snapshot_id"`
+	LastError      string            `json:"last_error,omitempty" db:"last_error"`
+	NextRunAt      *time.Time        `json:"next_run_at,omitempty" db:"next_run_at"`
+	CreatedAt      time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// ScheduledSnapshot holds the options of the snapshots a schedule takes; see
+// SnapshotRequest
+type ScheduledSnapshot struct {
+	Description      string           `json:"description,omitempty"`
+	Format           string           `json:"format,omitempty" binding:"omitempty,oneof=plain custom directory tar"`
+	Mode             string           `json:"mode,omitempty" binding:"omitempty,oneof=full schema_only data_only"`
+	Priority         int              `json:"priority,omitempty"`
+	ParallelJobs     int              `json:"parallel_jobs,omitempty" binding:"omitempty,min=1,max=64"`
+	Compression      string           `json:"compression,omitempty" binding:"omitempty,oneof=none gzip zstd"`
+	CompressionLevel int              `json:"compression_level,omitempty" binding:"omitempty,min=1,max=22"`
+	Encryption       string           `json:"encryption,omitempty" binding:"omitempty,oneof=none master age"`
+	AgeRecipients    []string         `json:"age_recipients,omitempty"`
+	Filters          *SnapshotFilters `json:"filters,omitempty"`
+	CountRows        bool             `json:"count_rows,omitempty"`
+}
+
+// ScheduleRequest represents a request to create a schedule
+type ScheduleRequest struct {
+	Name         string            `json:"name" binding:"required"`
+	ConnectionID string            `json:"connection_id" binding:"required"`
+	Cron         string            `json:"cron" binding:"required"`
+	Timezone     string            `json:"timezone"`
+	Enabled      *bool             `json:"enabled"`                                             // defaults to true
+	MissedRuns   string            `json:"missed_runs" binding:"omitempty,oneof=run_once skip"` // defaults to run_once
+	Snapshot     ScheduledSnapshot `json:"snapshot"`
+}
+
+// ScheduleUpdate represents a partial update of a schedule; omitted fields
+// keep their current value
+type ScheduleUpdate struct {
+	Name       *string            `json:"name"`
+	Cron       *string            `json:"cron"`
+	Timezone   *string            `json:"timezone"`
+	Enabled    *bool              `json:"enabled"`
+	MissedRuns *string            `json:"missed_runs" binding:"omitempty,oneof=run_once skip"`
+	Snapshot   *ScheduledSnapshot `json:"snapshot"`
 }
 
 // RestoreRequest represents a request to restore from a snapshot
 type RestoreRequest struct {
 	SnapshotID   string `json:"snapshot_id" binding:"required"`
-	DatabaseID   string `json:"database_id" binding:"required"`
+	DatabaseID   string `json:"database_id"`
 	TargetDBName string `json:"target_db_name"`
+	Priority     int    `json:"priority"`                                       // higher priority jobs leave the queue first
+	ParallelJobs int    `json:"parallel_jobs" binding:"omitempty,min=1,max=64"` // pg_restore -j; custom and directory snapshots only
+	// SchemaSnapshotID names a schema-only snapshot, or a full archive, whose
+	// schema is loaded first; required to restore a data-only snapshot
+	SchemaSnapshotID string `json:"schema_snapshot_id"`
+	// Objects restores only the listed tables and schemas, with their
+	// indexes, constraints and sequences; custom and directory snapshots only
+	Objects *RestoreObjects `json:"objects"`
+	// ExistingTarget restores the objects into TargetDBName, which defaults to
+	// the connection's database, instead of a new database; requires Objects
+	ExistingTarget bool `json:"existing_target"`
+	// Mode replace restores into a staging database and then swaps it in for
+	// TargetDBName, which defaults to the connection's database, keeping the
+	// replaced database as a safety copy until it is discarded
+	Mode string `json:"mode" binding:"omitempty,oneof=new replace"`
+}
+
+// RestoreObjects selects the objects of a selective restore. Names are
+// patterns as in SnapshotFilters; tables may be schema-qualified.
+type RestoreObjects struct {
+	Schemas []string `json:"schemas,omitempty"`
+	Tables  []string `json:"tables,omitempty"`
+}
+
+// DrillRequest represents a request to run a restore drill of a snapshot
+type DrillRequest struct {
+	DatabaseID   string `json:"database_id"`
+	Priority     int    `json:"priority"`                                       // higher priority jobs leave the queue first
+	ParallelJobs int    `json:"parallel_jobs" binding:"omitempty,min=1,max=64"` // pg_restore -j; custom and directory snapshots only
 }
 
 // SnapshotProgress represents the progress of a snapshot operation
 type SnapshotProgress struct {
-	SnapshotID string     `json:"snapshot_id"`
-	Status     string     `json:"status"`   // in_progress, completed, failed, not_found
-	Progress   int        `json:"progress"` // 0-100
-	Message    string     `json:"message"`
-	FileSize   int64      `json:"file_size,omitempty"`
-	StartedAt  *time.Time `json:"started_at,omitempty"`
+	SnapshotID     string     `json:"snapshot_id"`
+	Status         string     `json:"status"`   // queued, in_progress, completed, failed, cancelled, not_found
+	Progress       int        `json:"progress"` // 0-100
+	Message        string     `json:"message"`
+	FileSize       int64      `json:"file_size,omitempty"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	CurrentTable   string     `json:"current_table,omitempty"`
+	TablesDone     int        `json:"tables_done"`
+	TablesTotal    int        `json:"tables_total"`
+	BytesWritten   int64      `json:"bytes_written"`
+	EstimatedBytes int64      `json:"estimated_bytes,omitempty"` // on-disk size of the source tables
+	ETASeconds     *int64     `json:"eta_seconds,omitempty"`
+}
+
+// JobInfo describes a queued or running snapshot/restore job
+type JobInfo struct {
+	ID            string     `json:"id"`
+	Kind          string     `json:"kind"`   // snapshot, restore, drill, base_backup, pitr_restore
+	Status        string     `json:"status"` // queued, running
+	Host          string     `json:"host"`
+	Database      string     `json:"database"`
+	Priority      int        `json:"priority"`
+	Connections   int        `json:"connections"`
+	QueuePosition int        `json:"queue_position,omitempty"`
+	EnqueuedAt    time.Time  `json:"enqueued_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+}
+
+// JobEvent is pushed to event stream subscribers as snapshot and restore jobs run
+type JobEvent struct {
+	Type      string            `json:"type"` // state, progress, log
+	JobID     string            `json:"job_id"`
+	Kind      string            `json:"kind"` // snapshot, restore, drill, base_backup, pitr_restore
+	Status    string            `json:"status,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	Progress  *SnapshotProgress `json:"progress,omitempty"`
+	Line      string            `json:"line,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
 }
 
 // API Response models
@@ -18,6 +18,20 @@ func SetupDatabaseRoutes(router *gin.Engine, controller *controllers.DatabaseCon
 	}
 }
 
+func SetupConnectionRoutes(router *gin.Engine, controller *controllers.ConnectionController) {
+	api := router.Group("/api/v1")
+	{
+		connections := api.Group("/connections")
+		{
+			connections.POST("", controller.CreateConnection)
+			connections.GET("", controller.ListConnections)
+			connections.GET("/:id", controller.GetConnection)
+			connections.PUT("/:id", controller.UpdateConnection)
+			connections.DELETE("/:id", controller.DeleteConnection)
+		}
+	}
+}
+
 func SetupSnapshotRoutes(router *gin.Engine, controller *controllers.SnapshotController) {
 	api := router.Group("/api/v1")
 	{
@@ -26,13 +40,135 @@ func SetupSnapshotRoutes(router *gin.Engine, controller *controllers.SnapshotCon
 			snapshots.POST("/create", controller.CreateSnapshot)
 			snapshots.POST("/restore", controller.RestoreSnapshot)
 			snapshots.GET("/", controller.ListSnapshots)
+			snapshots.GET("/diff", controller.DiffSnapshots)
 			snapshots.GET("/:id", controller.GetSnapshot)
 			snapshots.GET("/:id/progress", controller.GetSnapshotProgress)
+			snapshots.GET("/:id/contents", controller.GetSnapshotContents)
+			snapshots.GET("/:id/restores", controller.ListSnapshotRestores)
+			snapshots.POST("/:id/cancel", controller.CancelSnapshot)
+			snapshots.POST("/:id/verify", controller.VerifySnapshot)
+			snapshots.POST("/:id/drill", controller.DrillSnapshot)
+			snapshots.POST("/:id/compare", controller.CompareSnapshot)
+			snapshots.POST("/:id/pin", controller.PinSnapshot)
+			snapshots.POST("/:id/unpin", controller.UnpinSnapshot)
 			snapshots.DELETE("/:id", controller.DeleteSnapshot)
 		}
 	}
 }
 
+func SetupRestoreRoutes(router *gin.Engine, controller *controllers.RestoreController) {
+	api := router.Group("/api/v1")
+	{
+		restores := api.Group("/restores")
+		{
+			restores.GET("", controller.ListRestores)
+			restores.GET("/:id", controller.GetRestore)
+			restores.POST("/:id/cancel", controller.CancelRestore)
+			restores.POST("/:id/rollback", controller.RollbackRestore)
+			restores.POST("/:id/discard", controller.DiscardSafetyCopy)
+		}
+	}
+}
+
+func SetupDrillRoutes(router *gin.Engine, controller *controllers.DrillController) {
+	api := router.Group("/api/v1")
+	{
+		drills := api.Group("/drills")
+		{
+			drills.GET("", controller.ListDrills)
+			drills.GET("/:id", controller.GetDrill)
+			drills.POST("/:id/cancel", controller.CancelDrill)
+		}
+	}
+}
+
+func SetupScheduleRoutes(router *gin.Engine, controller *controllers.ScheduleController) {
+	api := router.Group("/api/v1")
+	{
+		schedules := api.Group("/schedules")
+		{
+			schedules.POST("", controller.CreateSchedule)
+			schedules.GET("", controller.ListSchedules)
+			schedules.GET("/:id", controller.GetSchedule)
+			schedules.PUT("/:id", controller.UpdateSchedule)
+			schedules.DELETE("/:id", controller.DeleteSchedule)
+		}
+	}
+}
+
+func SetupRetentionRoutes(router *gin.Engine, controller *controllers.RetentionController) {
+	api := router.Group("/api/v1")
+	{
+		retention := api.Group("/connections/:id/retention")
+		{
+			retention.GET("", controller.GetPolicy)
+			retention.PUT("", controller.SetPolicy)
+			retention.DELETE("", controller.DeletePolicy)
+			retention.POST("/dry-run", controller.DryRun)
+			retention.POST("/prune", controller.Prune)
+		}
+	}
+}
+
+func SetupPhysicalBackupRoutes(router *gin.Engine, controller *controllers.PhysicalBackupController) {
+	api := router.Group("/api/v1")
+	{
+		connections := api.Group("/connections/:id")
+		{
+			connections.POST("/base-backups", controller.CreateBaseBackup)
+			connections.GET("/base-backups", controller.ListBaseBackups)
+			connections.GET("/wal-archive", controller.GetWALArchive)
+			connections.POST("/wal-archive", controller.StartWALArchiving)
+			connections.DELETE("/wal-archive", controller.StopWALArchiving)
+			connections.POST("/pitr-restores", controller.StartRestore)
+		}
+
+		baseBackups := api.Group("/base-backups")
+		{
+			baseBackups.GET("", controller.ListBaseBackups)
+			baseBackups.GET("/:id", controller.GetBaseBackup)
+			baseBackups.POST("/:id/cancel", controller.CancelBaseBackup)
+			baseBackups.DELETE("/:id", controller.DeleteBaseBackup)
+		}
+
+		restores := api.Group("/pitr-restores")
+		{
+			restores.GET("", controller.ListRestores)
+			restores.GET("/:id", controller.GetRestore)
+			restores.POST("/:id/cancel", controller.CancelRestore)
+			restores.POST("/:id/stop", controller.StopRestoredCluster)
+		}
+	}
+}
+
+func SetupRestoreAsOfRoutes(router *gin.Engine, controller *controllers.RestoreAsOfController) {
+	api := router.Group("/api/v1")
+	{
+		databases := api.Group("/databases/:id")
+		{
+			databases.POST("/restore-as-of", controller.RestoreAsOf)
+		}
+	}
+}
+
+func SetupJobRoutes(router *gin.Engine, controller *controllers.JobController) {
+	api := router.Group("/api/v1")
+	{
+		jobs := api.Group("/jobs")
+		{
+			jobs.GET("", controller.ListJobs)
+		}
+	}
+}
+
+func SetupEventRoutes(router *gin.Engine, controller *controllers.EventController) {
+	api := router.Group("/api/v1")
+	{
+		api.GET("/events", controller.StreamEvents)
+		api.GET("/jobs/:id/events", controller.StreamJobEvents)
+	}
+}
+
 func SetupSystemRoutes(router *gin.Engine, controller *controllers.SystemController) {
 	api := router.Group("/api/v1")
 	{
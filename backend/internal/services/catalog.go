@@ -0,0 +1,192 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// ErrSnapshotNotFound is returned when a snapshot is not present in the catalog
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// SnapshotCatalog is the single source of truth for snapshot metadata
+type SnapshotCatalog interface {
+	Create(snapshot *models.Snapshot) error
+	Update(snapshot *models.Snapshot) error
+	Get(id string) (*models.Snapshot, error)
+	List(databaseID string) ([]*models.Snapshot, error)
+	Delete(id string) error
+}
+
+type boltSnapshotCatalog struct {
+	store *MetadataStore
+}
+
+// NewSnapshotCatalog creates a snapshot catalog backed by the metadata store
+func NewSnapshotCatalog(store *MetadataStore) SnapshotCatalog {
+	return &boltSnapshotCatalog{store: store}
+}
+
+// Create records a new snapshot
+func (c *boltSnapshotCatalog) Create(snapshot *models.Snapshot) error {
+	found, err := c.store.exists(snapshotsBucket, snapshot.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check snapshot: %w", err)
+	}
+	if found {
+		return fmt.Errorf("snapshot already exists: %s", snapshot.ID)
+	}
+	if err := c.store.put(snapshotsBucket, snapshot.ID, snapshot); err != nil {
+		return fmt.Errorf("failed to record snapshot: %w", err)
+	}
+	return nil
+}
+
+// Update replaces the stored metadata of an existing snapshot
+func (c *boltSnapshotCatalog) Update(snapshot *models.Snapshot) error {
+	found, err := c.store.exists(snapshotsBucket, snapshot.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check snapshot: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, snapshot.ID)
+	}
+	if err := c.store.put(snapshotsBucket, snapshot.ID, snapshot); err != nil {
+		return fmt.Errorf("failed to update snapshot: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a snapshot by ID
+func (c *boltSnapshotCatalog) Get(id string) (*models.Snapshot, error) {
+	var snapshot models.Snapshot
+	found, err := c.store.get(snapshotsBucket, id, &snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	return &snapshot, nil
+}
+
+// List returns the snapshots of a database, newest first. Imported snapshots
+// have no database ID and are listed for every database.
+func (c *boltSnapshotCatalog) List(databaseID string) ([]*models.Snapshot, error) {
+	snapshots := []*models.Snapshot{}
+	err := c.store.forEach(snapshotsBucket, func(data []byte) error {
+		var snapshot models.Snapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return err
+		}
+		if databaseID == "" || snapshot.DatabaseID == "" || snapshot.DatabaseID == databaseID {
+			snapshots = append(snapshots, &snapshot)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+
+	return snapshots, nil
+}
+
+// Delete removes a snapshot from the catalog
+func (c *boltSnapshotCatalog) Delete(id string) error {
+	if err := c.store.delete(snapshotsBucket, id); err != nil {
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+	return nil
+}
+
+// legacySnapshotPattern matches files written before the catalog existed:
+// <database>_<YYYYMMDD_HHMMSS>_<first 8 chars of snapshot ID>.sql
+var legacySnapshotPattern = regexp.MustCompile(`^(.+)_(\d{8}_\d{6})_([0-9a-f]{8})\.sql$`)
+
+const legacyImportKey = "legacy_import_completed_at"
+
+// ImportLegacySnapshots adopts backup files that predate the catalog so they
+// remain listable and restorable. It runs once per metadata store.
+func ImportLegacySnapshots(store *MetadataStore, catalog SnapshotCatalog, backupDir string) error {
+	done, err := store.exists(metaBucket, legacyImportKey)
+	if err != nil {
+		return err
+	}
+	if done {
+		return nil
+	}
+
+	files, err := os.ReadDir(backupDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	imported := 0
+	for _, file := range files {
+		matches := legacySnapshotPattern.FindStringSubmatch(file.Name())
+		if file.IsDir() || matches == nil {
+			continue
+		}
+
+		if _, err := catalog.Get(matches[3]); err == nil {
+			continue
+		}
+
+		fileInfo, err := file.Info()
+		if err != nil {
+			log.Printf("Failed to get file info for %s: %v", file.Name(), err)
+			continue
+		}
+
+		createdAt, err := time.ParseInLocation("20060102_150405", matches[2], time.Local)
+		if err != nil {
+			createdAt = fileInfo.ModTime()
+		}
+		completedAt := fileInfo.ModTime()
+
+		snapshot := &models.Snapshot{
+			ID:           matches[3],
+			DatabaseName: matches[1],
+			Name:         fmt.Sprintf("Backup of %s", matches[1]),
+			Description:  fmt.Sprintf("Imported backup created on %s", createdAt.Format("2006-01-02 15:04:05")),
+			Storage:      StorageLocal,
+			StorageKey:   file.Name(),
+			FilePath:     filepath.Join(backupDir, file.Name()),
+			FileSize:     fileInfo.Size(),
+			LogicalSize:  fileInfo.Size(),
+			Status:       "completed",
+			CreatedAt:    createdAt,
+			CompletedAt:  &completedAt,
+		}
+
+		// Files this small cannot hold a real dump
+		if fileInfo.Size() < 100 {
+			snapshot.Status = "failed"
+			snapshot.ErrorMessage = "Backup file appears to be incomplete or corrupted"
+			snapshot.CompletedAt = nil
+		}
+
+		if err := catalog.Create(snapshot); err != nil {
+			return err
+		}
+		imported++
+	}
+
+	if imported > 0 {
+		log.Printf("Imported %d existing backup file(s) into the snapshot catalog", imported)
+	}
+
+	return store.put(metaBucket, legacyImportKey, time.Now())
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+func TestSnapshotCatalogRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.db")
+	store, err := OpenMetadataStore(path)
+	if err != nil {
+		t.Fatalf("OpenMetadataStore: %v", err)
+	}
+	catalog := NewSnapshotCatalog(store)
+
+	created := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	snapshot := &models.Snapshot{
+		ID:         "snap-1",
+		DatabaseID: "conn-a",
+		Name:       "nightly",
+		Status:     "completed",
+		FileSize:   1234,
+		RowCounts:  map[string]int64{"public.orders": 5},
+		CreatedAt:  created,
+	}
+	if err := catalog.Create(snapshot); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := catalog.Create(snapshot); err == nil {
+		t.Error("creating the same snapshot twice succeeded")
+	}
+
+	snapshot.Pinned = true
+	if err := catalog.Update(snapshot); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := catalog.Update(&models.Snapshot{ID: "missing"}); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Update of a missing snapshot: error = %v, want ErrSnapshotNotFound", err)
+	}
+
+	// Everything survives reopening the store
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if store, err = OpenMetadataStore(path); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	catalog = NewSnapshotCatalog(store)
+
+	got, err := catalog.Get("snap-1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Name != "nightly" || !got.Pinned || got.FileSize != 1234 || got.RowCounts["public.orders"] != 5 || !got.CreatedAt.Equal(created) {
+		t.Errorf("Get = %+v, want the snapshot as updated", got)
+	}
+
+	if err := catalog.Delete("snap-1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := catalog.Get("snap-1"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Get after Delete: error = %v, want ErrSnapshotNotFound", err)
+	}
+}
+
+func TestSnapshotCatalogList(t *testing.T) {
+	catalog := NewSnapshotCatalog(newTestStore(t))
+	now := time.Now()
+	for i, snapshot := range []*models.Snapshot{
+		{ID: "a-old", DatabaseID: "conn-a"},
+		{ID: "b", DatabaseID: "conn-b"},
+		{ID: "imported", DatabaseID: ""},
+		{ID: "a-new", DatabaseID: "conn-a"},
+	} {
+		snapshot.CreatedAt = now.Add(time.Duration(i) * time.Hour)
+		if err := catalog.Create(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		databaseID string
+		want       []string
+	}{
+		// Newest first; imported snapshots belong to every database
+		{"conn-a", []string{"a-new", "imported", "a-old"}},
+		{"conn-b", []string{"imported", "b"}},
+		{"", []string{"a-new", "imported", "b", "a-old"}},
+	}
+	for _, tt := range tests {
+		snapshots, err := catalog.List(tt.databaseID)
+		if err != nil {
+			t.Fatalf("List(%q): %v", tt.databaseID, err)
+		}
+		var got []string
+		for _, snapshot := range snapshots {
+			got = append(got, snapshot.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("List(%q) = %v, want %v", tt.databaseID, got, tt.want)
+		}
+	}
+}
+
+func TestImportLegacySnapshots(t *testing.T) {
+	store := newTestStore(t)
+	catalog := NewSnapshotCatalog(store)
+	backupDir := t.TempDir()
+
+	files := map[string]string{
+		"shop_20250102_030405_0123abcd.sql":    strings.Repeat("-- dump\n", 50),
+		"my_shop_20250103_000000_89abcdef.sql": "-- cut",
+		"notes.txt":                            "not a backup",
+		"shop_20250102_030405_0123ABCD.sql":    "uppercase IDs were never written",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(backupDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ImportLegacySnapshots(store, catalog, backupDir); err != nil {
+		t.Fatalf("ImportLegacySnapshots: %v", err)
+	}
+	snapshots, err := catalog.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("imported %d snapshots, want 2", len(snapshots))
+	}
+
+	complete, err := catalog.Get("0123abcd")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	wantCreated := time.Date(2025, 1, 2, 3, 4, 5, 0, time.Local)
+	if complete.DatabaseName != "shop" || complete.Status != "completed" || !complete.CreatedAt.Equal(wantCreated) || complete.Storage != StorageLocal {
+		t.Errorf("imported %+v, want a completed local snapshot of shop created %s", complete, wantCreated)
+	}
+
+	// Too small to be a dump; the database name may hold underscores
+	truncated, err := catalog.Get("89abcdef")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if truncated.DatabaseName != "my_shop" || truncated.Status != "failed" {
+		t.Errorf("imported %q with status %q, want my_shop failed", truncated.DatabaseName, truncated.Status)
+	}
+
+	// The import runs once per store
+	if err := os.WriteFile(filepath.Join(backupDir, "shop_20250104_000000_fedcba98.sql"), []byte(files["shop_20250102_030405_0123abcd.sql"]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportLegacySnapshots(store, catalog, backupDir); err != nil {
+		t.Fatalf("second ImportLegacySnapshots: %v", err)
+	}
+	if _, err := catalog.Get("fedcba98"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("second import adopted a new file: error = %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// ErrSnapshotBusy is returned for operations that need a snapshot to be
+// finished, or deletions of a snapshot a restore or drill is reading
+var ErrSnapshotBusy = errors.New("snapshot is busy")
+
+// Outcomes of a snapshot verification; corrupt and missing are also recorded
+// as the snapshot's status
+const (
+	VerificationVerified = "verified"
+	VerificationCorrupt  = "corrupt"
+	VerificationMissing  = "missing"
+)
+
+// hashSnapshotObject reads the stored dump of a snapshot and returns its
+// SHA-256 digest and length. A directory-format dump is hashed as the
+// sequence of its file names and contents in lexical order.
+func (ss *SnapshotService) hashSnapshotObject(ctx context.Context, snapshot *models.Snapshot) (string, int64, error) {
+	store, key, err := ss.snapshotObject(snapshot)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if local, ok := store.(*LocalStore); ok {
+		path := local.Path(key)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return hashDirectory(ctx, path)
+		}
+	}
+
+	object, err := store.Get(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	defer object.Close()
+
+	digest := sha256.New()
+	size, err := io.Copy(digest, contextReader{ctx: ctx, r: object})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	return hex.EncodeToString(digest.Sum(nil)), size, nil
+}
+
+// hashDirectory hashes the files below dir
+func hashDirectory(ctx context.Context, dir string) (string, int64, error) {
+	digest := sha256.New()
+	var total int64
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		io.WriteString(digest, filepath.ToSlash(rel)+"\x00")
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		size, err := io.Copy(digest, contextReader{ctx: ctx, r: file})
+		total += size
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", 0, fmt.Errorf("%w: %s", ErrObjectNotFound, dir)
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	return hex.EncodeToString(digest.Sum(nil)), total, nil
+}
+
+// contextReader stops reading once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// VerifySnapshot re-hashes the stored dump of a snapshot and compares it with
+// the digest and length recorded at backup time. A corrupt or missing dump is
+// recorded as the snapshot's status, and a snapshot that verifies again is
+// marked completed. Snapshots recorded before checksums existed get the
+// current digest as their baseline.
+func (ss *SnapshotService) VerifySnapshot(ctx context.Context, snapshotID string) (*models.SnapshotVerification, error) {
+	snapshot, err := ss.catalog.Get(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch snapshot.Status {
+	case "completed", VerificationCorrupt, VerificationMissing:
+	case "queued", "creating":
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotBusy, snapshotID)
+	default:
+		return nil, fmt.Errorf("%w: snapshot %s has no dump to verify (status: %s)", ErrInvalidOptions, snapshotID, snapshot.Status)
+	}
+
+	verification := &models.SnapshotVerification{
+		SnapshotID:     snapshot.ID,
+		ExpectedSHA256: snapshot.SHA256,
+		ExpectedSize:   snapshot.FileSize,
+		VerifiedAt:     time.Now(),
+	}
+
+	digest, size, err := ss.hashSnapshotObject(ctx, snapshot)
+	switch {
+	case errors.Is(err, ErrObjectNotFound):
+		verification.Result = VerificationMissing
+		verification.Message = "Snapshot file is missing from storage"
+	case err != nil:
+		return nil, err
+	default:
+		verification.ActualSHA256 = digest
+		verification.ActualSize = size
+		switch {
+		case snapshot.SHA256 == "":
+			verification.Result = VerificationVerified
+			verification.Message = "No checksum was recorded for this snapshot; the current digest is kept as its baseline"
+			snapshot.SHA256 = digest
+			snapshot.FileSize = size
+		case digest != snapshot.SHA256 || size != snapshot.FileSize:
+			verification.Result = VerificationCorrupt
+			verification.Message = fmt.Sprintf("Snapshot file does not match its checksum (%d bytes, expected %d)", size, snapshot.FileSize)
+		default:
+			verification.Result = VerificationVerified
+			verification.Message = "Snapshot file matches its checksum"
+		}
+	}
+
+	verifiedAt := verification.VerifiedAt
+	snapshot.VerifiedAt = &verifiedAt
+	if verification.Result == VerificationVerified {
+		if snapshot.Status != "completed" {
+			snapshot.ErrorMessage = ""
+		}
+		snapshot.Status = "completed"
+	} else {
+		snapshot.Status = verification.Result
+		snapshot.ErrorMessage = verification.Message
+	}
+	ss.saveSnapshot(snapshot)
+
+	log.Printf("Verified snapshot %s: %s", snapshot.ID, verification.Result)
+	return verification, nil
+}
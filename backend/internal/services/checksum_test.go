@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// storeTestSnapshot writes dump through the snapshot pipeline into the local
+// store and records the snapshot with the checksum taken at backup time
+func storeTestSnapshot(t *testing.T, ss *SnapshotService, snapshot *models.Snapshot, dump string) {
+	t.Helper()
+	sink, err := ss.storage.Local().Put(context.Background(), snapshot.StorageKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := newDumpOutput(sink, snapshot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(output, dump); err != nil {
+		t.Fatal(err)
+	}
+	if err := output.Close(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot.SHA256 = output.Sum()
+	snapshot.FileSize = output.stored.Count()
+	if err := ss.catalog.Create(snapshot); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	ctx := context.Background()
+	dump := strings.Repeat("INSERT INTO public.orders VALUES (1);\n", 100)
+	snapshot := &models.Snapshot{ID: "snap-1", Status: "completed", Storage: StorageLocal, StorageKey: "shop.sql.gz", Compression: CompressionGzip}
+	storeTestSnapshot(t, ss, snapshot, dump)
+	path := ss.storage.Local().Path(snapshot.StorageKey)
+	stored, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(wantResult, wantStatus string) {
+		t.Helper()
+		verification, err := ss.VerifySnapshot(ctx, "snap-1")
+		if err != nil {
+			t.Fatalf("VerifySnapshot: %v", err)
+		}
+		if verification.Result != wantResult {
+			t.Errorf("result = %s (%s), want %s", verification.Result, verification.Message, wantResult)
+		}
+		recorded, err := ss.catalog.Get("snap-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recorded.Status != wantStatus || recorded.VerifiedAt == nil {
+			t.Errorf("recorded status %s verified at %v, want %s", recorded.Status, recorded.VerifiedAt, wantStatus)
+		}
+	}
+
+	// The digest covers the compressed bytes in the store
+	verify(VerificationVerified, "completed")
+
+	corrupted := append([]byte(nil), stored...)
+	corrupted[len(corrupted)/2] ^= 0xff
+	if err := os.WriteFile(path, corrupted, 0600); err != nil {
+		t.Fatal(err)
+	}
+	verify(VerificationCorrupt, VerificationCorrupt)
+
+	// A repaired file makes the snapshot usable again
+	if err := os.WriteFile(path, stored, 0600); err != nil {
+		t.Fatal(err)
+	}
+	verify(VerificationVerified, "completed")
+	if recorded, _ := ss.catalog.Get("snap-1"); recorded.ErrorMessage != "" {
+		t.Errorf("error message %q kept after verifying again", recorded.ErrorMessage)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	verify(VerificationMissing, VerificationMissing)
+}
+
+func TestVerifySnapshotAdoptsBaseline(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	snapshot := &models.Snapshot{ID: "legacy", Status: "completed", StorageKey: "shop.sql"}
+	storeTestSnapshot(t, ss, snapshot, "-- dump")
+	wantSHA := snapshot.SHA256
+	snapshot.SHA256 = ""
+	if err := ss.catalog.Update(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	verification, err := ss.VerifySnapshot(context.Background(), "legacy")
+	if err != nil || verification.Result != VerificationVerified {
+		t.Fatalf("VerifySnapshot = %+v, %v, want verified", verification, err)
+	}
+	if recorded, _ := ss.catalog.Get("legacy"); recorded.SHA256 != wantSHA || recorded.FileSize != 7 {
+		t.Errorf("recorded %s (%d bytes), want %s (7 bytes)", recorded.SHA256, recorded.FileSize, wantSHA)
+	}
+}
+
+func TestVerifySnapshotRefusesUnfinished(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	for _, tt := range []struct {
+		status string
+		want   error
+	}{
+		{"queued", ErrSnapshotBusy},
+		{"creating", ErrSnapshotBusy},
+		{"failed", ErrInvalidOptions},
+	} {
+		if err := ss.catalog.Create(&models.Snapshot{ID: tt.status, Status: tt.status}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ss.VerifySnapshot(context.Background(), tt.status); !errors.Is(err, tt.want) {
+			t.Errorf("VerifySnapshot of a %s snapshot: error = %v, want %v", tt.status, err, tt.want)
+		}
+	}
+}
+
+func TestHashDirectory(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	local := ss.storage.Local()
+	for name, content := range map[string]string{"toc.dat": "toc", "3402.dat": "rows"} {
+		putObject(t, local, "shop/"+name, content)
+	}
+	snapshot := &models.Snapshot{StorageKey: "shop", Format: FormatDirectory}
+
+	digest, size, err := ss.hashSnapshotObject(context.Background(), snapshot)
+	if err != nil || size != 7 {
+		t.Fatalf("hashSnapshotObject = %s, %d, %v, want 7 bytes", digest, size, err)
+	}
+
+	// File names are part of the digest
+	if err := os.Rename(local.Path("shop/3402.dat"), local.Path("shop/3403.dat")); err != nil {
+		t.Fatal(err)
+	}
+	if renamed, _, err := ss.hashSnapshotObject(context.Background(), snapshot); err != nil || renamed == digest {
+		t.Errorf("digest after renaming a file = %s, %v, want a different digest", renamed, err)
+	}
+}
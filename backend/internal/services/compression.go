@@ -0,0 +1,119 @@
+package services
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression methods accepted in snapshot requests
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// compressionExtensions maps each compression method to the suffix appended
+// to the snapshot path
+var compressionExtensions = map[string]string{
+	CompressionNone: "",
+	CompressionGzip: ".gz",
+	CompressionZstd: ".zst",
+}
+
+// compressionLevels holds the accepted level range of each method; level 0
+// selects the method's default
+var compressionLevels = map[string][2]int{
+	CompressionGzip: {gzip.BestSpeed, gzip.BestCompression},
+	CompressionZstd: {1, 22},
+}
+
+// normalizeCompression defaults an empty method to none and checks that the
+// method and level can be used with the dump format. Directory-format dumps
+// are a tree of files written by pg_dump itself, so they cannot be piped
+// through a compressor.
+func normalizeCompression(compression string, level int, format string) (string, error) {
+	if compression == "" || compression == CompressionNone {
+		if level != 0 {
+			return "", fmt.Errorf("%w: compression_level requires a compression method", ErrInvalidOptions)
+		}
+		return CompressionNone, nil
+	}
+
+	levels, ok := compressionLevels[compression]
+	if !ok {
+		return "", fmt.Errorf("%w: unsupported compression: %s", ErrInvalidOptions, compression)
+	}
+	if level != 0 && (level < levels[0] || level > levels[1]) {
+		return "", fmt.Errorf("%w: %s compression_level must be between %d and %d", ErrInvalidOptions, compression, levels[0], levels[1])
+	}
+	if format == FormatDirectory {
+		return "", fmt.Errorf("%w: compression is not supported for directory format snapshots", ErrInvalidOptions)
+	}
+	return compression, nil
+}
+
+// isCompressed reports whether a snapshot was written through a compressor;
+// snapshots recorded before compression existed are not
+func isCompressed(compression string) bool {
+	return compression != "" && compression != CompressionNone
+}
+
+// newCompressor wraps w so that everything written is compressed with the
+// given method; closing it flushes the compressor but not w
+func newCompressor(w io.Writer, compression string, level int) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case CompressionZstd:
+		options := []zstd.EOption{}
+		if level != 0 {
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, options...)
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", compression)
+}
+
+// newDecompressor wraps r so that reads return the decompressed snapshot
+func newDecompressor(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported compression: %s", compression)
+}
+
+// countingWriter counts the bytes passing through it; the count may be read
+// while writes are in flight
+type countingWriter struct {
+	w io.Writer
+	n atomic.Int64
+}
+
+func newCountingWriter(w io.Writer) *countingWriter {
+	return &countingWriter{w: w}
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n.Add(int64(n))
+	return n, err
+}
+
+// Count returns the number of bytes written so far
+func (cw *countingWriter) Count() int64 {
+	return cw.n.Load()
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCompression(t *testing.T) {
+	tests := []struct {
+		compression string
+		level       int
+		format      string
+		want        string
+	}{
+		{"", 0, FormatPlain, CompressionNone},
+		{CompressionNone, 0, FormatDirectory, CompressionNone},
+		{CompressionGzip, 0, FormatPlain, CompressionGzip},
+		{CompressionGzip, 9, FormatCustom, CompressionGzip},
+		{CompressionZstd, 22, FormatTar, CompressionZstd},
+	}
+	for _, tt := range tests {
+		got, err := normalizeCompression(tt.compression, tt.level, tt.format)
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeCompression(%q, %d, %q) = %q, %v, want %q", tt.compression, tt.level, tt.format, got, err, tt.want)
+		}
+	}
+
+	invalid := []struct {
+		compression string
+		level       int
+		format      string
+	}{
+		{"", 3, FormatPlain},
+		{"lz4", 0, FormatPlain},
+		{CompressionGzip, 10, FormatPlain},
+		{CompressionZstd, 23, FormatPlain},
+		{CompressionGzip, 0, FormatDirectory},
+	}
+	for _, tt := range invalid {
+		if _, err := normalizeCompression(tt.compression, tt.level, tt.format); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("normalizeCompression(%q, %d, %q) error = %v, want ErrInvalidOptions", tt.compression, tt.level, tt.format, err)
+		}
+	}
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	dump := strings.Repeat("INSERT INTO public.orders VALUES (1, 'shipped');\n", 1000)
+	for _, tt := range []struct {
+		compression string
+		level       int
+	}{
+		{CompressionGzip, 0},
+		{CompressionGzip, 1},
+		{CompressionZstd, 0},
+		{CompressionZstd, 19},
+	} {
+		var compressed bytes.Buffer
+		counter := newCountingWriter(&compressed)
+		compressor, err := newCompressor(counter, tt.compression, tt.level)
+		if err != nil {
+			t.Fatalf("newCompressor(%s, %d): %v", tt.compression, tt.level, err)
+		}
+		if _, err := io.WriteString(compressor, dump); err != nil {
+			t.Fatal(err)
+		}
+		if err := compressor.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if counter.Count() != int64(compressed.Len()) || compressed.Len() >= len(dump) {
+			t.Errorf("%s level %d: counted %d bytes, wrote %d of %d", tt.compression, tt.level, counter.Count(), compressed.Len(), len(dump))
+		}
+
+		decompressor, err := newDecompressor(&compressed, tt.compression)
+		if err != nil {
+			t.Fatalf("newDecompressor(%s): %v", tt.compression, err)
+		}
+		got, err := io.ReadAll(decompressor)
+		decompressor.Close()
+		if err != nil {
+			t.Fatalf("%s: reading back: %v", tt.compression, err)
+		}
+		if string(got) != dump {
+			t.Errorf("%s level %d: read back %d bytes, want the %d written", tt.compression, tt.level, len(got), len(dump))
+		}
+	}
+
+	if _, err := newCompressor(io.Discard, CompressionNone, 0); err == nil {
+		t.Error("newCompressor(none) succeeded")
+	}
+}
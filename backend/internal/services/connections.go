@@ -0,0 +1,235 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrConnectionNotFound is returned when a saved connection does not exist
+var ErrConnectionNotFound = errors.New("connection not found")
+
+// storedConnection is the persisted form of a connection; the password only
+// ever exists encrypted under the server master key
+type storedConnection struct {
+	models.DatabaseConnection
+	EncryptedPassword string `json:"encrypted_password"`
+}
+
+// SaveConnection tests and persists a new database connection
+func (ds *DatabaseService) SaveConnection(config *models.DatabaseConnection) (*models.DatabaseConnection, error) {
+	// IDs are always assigned here, so saving can never overwrite an existing connection
+	config.ID = uuid.New().String()
+	config.CreatedAt = time.Now()
+	config.UpdatedAt = time.Now()
+
+	// Test connection before saving
+	if err := ds.TestConnection(config); err != nil {
+		return nil, fmt.Errorf("connection test failed: %w", err)
+	}
+
+	if err := ds.storeConnection(config); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Saved database connection: %s", config.Name)
+
+	return redactConnection(config), nil
+}
+
+// ListConnections returns all saved connections without their passwords
+func (ds *DatabaseService) ListConnections() ([]*models.DatabaseConnection, error) {
+	connections := []*models.DatabaseConnection{}
+	err := ds.store.forEach(connectionsBucket, func(data []byte) error {
+		var stored storedConnection
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		connections = append(connections, redactConnection(&stored.DatabaseConnection))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connections: %w", err)
+	}
+
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].Name < connections[j].Name
+	})
+
+	return connections, nil
+}
+
+// GetSavedConnection returns a saved connection without its password
+func (ds *DatabaseService) GetSavedConnection(id string) (*models.DatabaseConnection, error) {
+	stored, err := ds.loadConnection(id)
+	if err != nil {
+		return nil, err
+	}
+	return redactConnection(&stored.DatabaseConnection), nil
+}
+
+// ResolveConnection returns a saved connection with its decrypted password,
+// for use by services that need to connect to the database
+func (ds *DatabaseService) ResolveConnection(id string) (*models.DatabaseConnection, error) {
+	stored, err := ds.loadConnection(id)
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := ds.keyRing.Open(stored.EncryptedPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt password for connection %s: %w", id, err)
+	}
+
+	config := stored.DatabaseConnection
+	config.Password = string(password)
+	return &config, nil
+}
+
+// UpdateConnection applies a partial update to a saved connection and re-tests it
+func (ds *DatabaseService) UpdateConnection(id string, update *models.ConnectionUpdate) (*models.DatabaseConnection, error) {
+	config, err := ds.ResolveConnection(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		config.Name = *update.Name
+	}
+	if update.Host != nil {
+		config.Host = *update.Host
+	}
+	if update.Port != nil {
+		config.Port = *update.Port
+	}
+	if update.Database != nil {
+		config.Database = *update.Database
+	}
+	if update.Username != nil {
+		config.Username = *update.Username
+	}
+	if update.Password != nil {
+		config.Password = *update.Password
+	}
+	if update.SSLMode != nil {
+		config.SSLMode = *update.SSLMode
+	}
+	if update.Storage != nil {
+		config.Storage = *update.Storage
+	}
+	config.UpdatedAt = time.Now()
+
+	if err := ds.TestConnection(config); err != nil {
+		return nil, fmt.Errorf("connection test failed: %w", err)
+	}
+
+	if err := ds.storeConnection(config); err != nil {
+		return nil, err
+	}
+
+	// Drop any pooled connection built from the old settings
+	if err := ds.CloseConnection(id); err != nil {
+		log.Printf("Error closing connection %s: %v", id, err)
+	}
+
+	log.Printf("Updated database connection: %s", config.Name)
+
+	return redactConnection(config), nil
+}
+
+// DeleteConnection removes a saved connection
+func (ds *DatabaseService) DeleteConnection(id string) error {
+	if _, err := ds.loadConnection(id); err != nil {
+		return err
+	}
+
+	if err := ds.store.delete(connectionsBucket, id); err != nil {
+		return fmt.Errorf("failed to delete connection: %w", err)
+	}
+
+	if err := ds.CloseConnection(id); err != nil {
+		log.Printf("Error closing connection %s: %v", id, err)
+	}
+
+	log.Printf("Deleted database connection %s", id)
+	return nil
+}
+
+// storeConnection encrypts the password and persists the connection
+func (ds *DatabaseService) storeConnection(config *models.DatabaseConnection) error {
+	encrypted, err := ds.keyRing.Seal([]byte(config.Password))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt password: %w", err)
+	}
+
+	stored := storedConnection{
+		DatabaseConnection: *config,
+		EncryptedPassword:  encrypted,
+	}
+	stored.Password = ""
+
+	if err := ds.store.put(connectionsBucket, config.ID, &stored); err != nil {
+		return fmt.Errorf("failed to save connection: %w", err)
+	}
+	return nil
+}
+
+// resealConnections moves the passwords of saved connections onto the current
+// master key, so retired keys are only needed until the next start
+func (ds *DatabaseService) resealConnections() {
+	var stale []storedConnection
+	err := ds.store.forEach(connectionsBucket, func(data []byte) error {
+		var stored storedConnection
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		if sealedKeyID(stored.EncryptedPassword) != ds.keyRing.CurrentKeyID() {
+			stale = append(stale, stored)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to check connection keys: %v", err)
+		return
+	}
+
+	for _, stored := range stale {
+		password, err := ds.keyRing.Open(stored.EncryptedPassword)
+		if err != nil {
+			log.Printf("Warning: Failed to reseal password of connection %s: %v", stored.ID, err)
+			continue
+		}
+		config := stored.DatabaseConnection
+		config.Password = string(password)
+		if err := ds.storeConnection(&config); err != nil {
+			log.Printf("Failed to update password of connection %s: %v", stored.ID, err)
+		}
+	}
+}
+
+// loadConnection reads the persisted form of a connection
+func (ds *DatabaseService) loadConnection(id string) (*storedConnection, error) {
+	var stored storedConnection
+	found, err := ds.store.get(connectionsBucket, id, &stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connection: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrConnectionNotFound, id)
+	}
+	return &stored, nil
+}
+
+// redactConnection returns a copy of config that is safe to return from the API
+func redactConnection(config *models.DatabaseConnection) *models.DatabaseConnection {
+	redacted := *config
+	redacted.Password = ""
+	return &redacted
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+const (
+	testMasterKey      = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	testRotatedKey     = "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	testConnectionPass = "s3cret: with spaces"
+)
+
+// newTestKeyRing loads a key ring from the given MASTER_KEY and
+// MASTER_KEY_PREVIOUS
+func newTestKeyRing(t *testing.T, current, previous string) *KeyRing {
+	t.Helper()
+	t.Setenv("MASTER_KEY", current)
+	t.Setenv("MASTER_KEY_PREVIOUS", previous)
+	keyRing, err := NewKeyRing()
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	return keyRing
+}
+
+func newTestStore(t *testing.T) *MetadataStore {
+	t.Helper()
+	store, err := OpenMetadataStore(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatalf("OpenMetadataStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestConnectionPasswordSurvivesKeyRotation(t *testing.T) {
+	store := newTestStore(t)
+
+	// Saved under the original key; storeConnection skips the connection test
+	original := NewDatabaseService(store, newTestKeyRing(t, testMasterKey, ""))
+	config := &models.DatabaseConnection{ID: "conn-1", Name: "shop", Host: "db", Port: 5432, Database: "shop", Username: "app", Password: testConnectionPass, CreatedAt: time.Now()}
+	if err := original.storeConnection(config); err != nil {
+		t.Fatalf("storeConnection: %v", err)
+	}
+
+	// One start with the old key kept as previous reseals the password
+	rotated := newTestKeyRing(t, testRotatedKey, testMasterKey)
+	NewDatabaseService(store, rotated)
+	stored, err := original.loadConnection("conn-1")
+	if err != nil {
+		t.Fatalf("loadConnection: %v", err)
+	}
+	if got := sealedKeyID(stored.EncryptedPassword); got != rotated.CurrentKeyID() {
+		t.Errorf("password is sealed with key %s, want the rotated key %s", got, rotated.CurrentKeyID())
+	}
+
+	// The old key is no longer needed
+	resolved, err := NewDatabaseService(store, newTestKeyRing(t, testRotatedKey, "")).ResolveConnection("conn-1")
+	if err != nil {
+		t.Fatalf("ResolveConnection after dropping the old key: %v", err)
+	}
+	if resolved.Password != testConnectionPass || resolved.Name != "shop" {
+		t.Errorf("resolved connection %q with password %q, want %q with %q", resolved.Name, resolved.Password, "shop", testConnectionPass)
+	}
+}
+
+func TestResealConnectionsKeepsWhatItCannotOpen(t *testing.T) {
+	store := newTestStore(t)
+	original := NewDatabaseService(store, newTestKeyRing(t, testMasterKey, ""))
+	if err := original.storeConnection(&models.DatabaseConnection{ID: "conn-1", Password: testConnectionPass}); err != nil {
+		t.Fatalf("storeConnection: %v", err)
+	}
+
+	// Rotated without keeping the old key: the password cannot be resealed,
+	// and is left as it was so that restarting with the old key recovers it
+	NewDatabaseService(store, newTestKeyRing(t, testRotatedKey, ""))
+	resolved, err := NewDatabaseService(store, newTestKeyRing(t, testMasterKey, "")).ResolveConnection("conn-1")
+	if err != nil {
+		t.Fatalf("ResolveConnection with the original key: %v", err)
+	}
+	if resolved.Password != testConnectionPass {
+		t.Errorf("password = %q, want %q", resolved.Password, testConnectionPass)
+	}
+}
+
+func TestConnectionRegistry(t *testing.T) {
+	ds := NewDatabaseService(newTestStore(t), newTestKeyRing(t, testMasterKey, ""))
+	for _, config := range []*models.DatabaseConnection{
+		{ID: "conn-b", Name: "warehouse", Password: "b-secret"},
+		{ID: "conn-a", Name: "shop", Password: testConnectionPass},
+	} {
+		if err := ds.storeConnection(config); err != nil {
+			t.Fatalf("storeConnection: %v", err)
+		}
+	}
+
+	// The password is only ever stored sealed
+	stored, err := ds.loadConnection("conn-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Password != "" || stored.EncryptedPassword == "" || stored.EncryptedPassword == testConnectionPass {
+		t.Errorf("stored password %q, encrypted %q", stored.Password, stored.EncryptedPassword)
+	}
+
+	connections, err := ds.ListConnections()
+	if err != nil {
+		t.Fatalf("ListConnections: %v", err)
+	}
+	if len(connections) != 2 || connections[0].Name != "shop" || connections[1].Name != "warehouse" {
+		t.Fatalf("ListConnections = %+v, want shop and warehouse by name", connections)
+	}
+	for _, connection := range connections {
+		if connection.Password != "" {
+			t.Errorf("listed connection %s with its password", connection.ID)
+		}
+	}
+	if saved, err := ds.GetSavedConnection("conn-a"); err != nil || saved.Password != "" {
+		t.Errorf("GetSavedConnection = %+v, %v, want the connection without its password", saved, err)
+	}
+	if resolved, err := ds.ResolveConnection("conn-a"); err != nil || resolved.Password != testConnectionPass {
+		t.Errorf("ResolveConnection = %+v, %v, want the decrypted password", resolved, err)
+	}
+
+	if err := ds.DeleteConnection("conn-a"); err != nil {
+		t.Fatalf("DeleteConnection: %v", err)
+	}
+	for _, err := range []error{
+		ds.DeleteConnection("conn-a"),
+		func() error { _, err := ds.ResolveConnection("conn-a"); return err }(),
+		func() error { _, err := ds.GetSavedConnection("conn-a"); return err }(),
+	} {
+		if !errors.Is(err, ErrConnectionNotFound) {
+			t.Errorf("after delete: error = %v, want ErrConnectionNotFound", err)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// inspect bounds reading a snapshot on behalf of a request by
+// INSPECT_TIMEOUT (default 10m); the read also stops when the request's
+// context ends, such as when the client goes away
+func (ss *SnapshotService) inspect(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, ss.inspectTimeout)
+}
+
+// inspectionError reports a read that inspect stopped as such rather than
+// as the failure of the tool it killed
+func inspectionError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%w: %v", ctxErr, err)
+	}
+	return err
+}
+
+// GetSnapshotContents lists the schemas, tables, views, functions, sequences
+// and extensions in a snapshot along with the size of each table's data.
+// Archives are listed with pg_restore -l and plain dumps are parsed as SQL;
+// table data is measured by streaming it. Snapshots never change, so the
+// result is kept and later calls return it straight away.
+func (ss *SnapshotService) GetSnapshotContents(ctx context.Context, snapshotID string) (*models.SnapshotContents, error) {
+	snapshot, err := ss.catalog.Get(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch snapshot.Status {
+	case "completed":
+	case "queued", "creating":
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotBusy, snapshotID)
+	default:
+		return nil, fmt.Errorf("%w: snapshot %s has no dump to read (status: %s)", ErrInvalidOptions, snapshotID, snapshot.Status)
+	}
+
+	if contents, err := ss.contents.Get(snapshotID); err != nil {
+		return nil, err
+	} else if contents != nil {
+		return contents, nil
+	}
+
+	ctx, cancel := ss.inspect(ctx)
+	defer cancel()
+
+	builder := newContentsBuilder()
+	if isArchiveFormat(snapshot.Format) {
+		err = ss.readArchiveContents(ctx, snapshot, builder)
+	} else {
+		err = ss.readPlainContents(ctx, snapshot, builder)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot contents: %w", inspectionError(ctx, err))
+	}
+
+	contents := builder.finish(snapshot.ID)
+	if err := ss.contents.Save(contents); err != nil {
+		log.Printf("Failed to keep contents of snapshot %s: %v", snapshot.ID, err)
+	}
+	return contents, nil
+}
+
+// readArchiveContents takes the objects of an archive from its table of
+// contents and measures table data in pg_restore's data-only script
+func (ss *SnapshotService) readArchiveContents(ctx context.Context, snapshot *models.Snapshot, builder *contentsBuilder) error {
+	list, err := ss.runPgRestore(ctx, snapshot, "--list")
+	if err != nil {
+		return err
+	}
+	for _, entry := range parseTocList(list) {
+		builder.addObject(entry.desc, entry.schema, entry.tag)
+	}
+
+	return ss.readPgRestore(ctx, snapshot, func(r io.Reader) error {
+		return readDumpScript(r, builder, false)
+	}, "--data-only", "--file=-")
+}
+
+// readPlainContents parses a plain SQL dump for both objects and table data
+func (ss *SnapshotService) readPlainContents(ctx context.Context, snapshot *models.Snapshot, builder *contentsBuilder) error {
+	input, cleanup, err := ss.openSnapshotInput(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	return readDumpScript(input, builder, true)
+}
+
+// readDumpScript reads a SQL script written by pg_dump or pg_restore. Every
+// object is announced by a comment such as
+//
+//	-- Name: users; Type: TABLE; Schema: public; Owner: postgres
+//
+// and table data by a "-- Data for Name:" comment followed by a COPY block,
+// whose lines are counted as rows and measured. The objects are added to
+// builder only when withObjects is set.
+func readDumpScript(r io.Reader, builder *contentsBuilder, withObjects bool) error {
+	var table *models.SnapshotTable
+	inCopy := false
+
+	return scanDumpLines(r, func(line string, size int64, long bool) {
+		switch {
+		case inCopy:
+			if !long && line == `\.` {
+				inCopy = false
+			} else if table != nil {
+				table.Rows++
+				table.DataBytes += size
+			}
+		case long:
+		case strings.HasPrefix(line, "-- Data for Name: "):
+			table = nil
+			if name, desc, schema, ok := parseScriptHeader(strings.TrimPrefix(line, "-- Data for Name: ")); ok && desc == "TABLE DATA" {
+				table = builder.table(schema, name)
+				table.HasData = true
+			}
+		case strings.HasPrefix(line, "-- Name: "):
+			if name, desc, schema, ok := parseScriptHeader(strings.TrimPrefix(line, "-- Name: ")); ok && withObjects {
+				builder.addObject(desc, schema, name)
+			}
+		case isCopyStart(line):
+			inCopy = true
+		}
+	})
+}
+
+// scanDumpLines calls fn with every line of a SQL script, without its line
+// ending, and the line's size in bytes. Lines longer than the read buffer,
+// which only rows of table data reach, are passed as long with no text.
+func scanDumpLines(r io.Reader, fn func(line string, size int64, long bool)) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := reader.ReadSlice('\n')
+		size := int64(len(line))
+		long := errors.Is(err, bufio.ErrBufferFull)
+		for errors.Is(err, bufio.ErrBufferFull) {
+			var more []byte
+			more, err = reader.ReadSlice('\n')
+			size += int64(len(more))
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if size == 0 && err == io.EOF {
+			return nil
+		}
+
+		if long {
+			fn("", size, true)
+		} else {
+			fn(string(bytes.TrimRight(line, "\r\n")), size, false)
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// isCopyStart reports whether a line starts the rows of a COPY block
+func isCopyStart(line string) bool {
+	return strings.HasPrefix(line, "COPY ") && strings.HasSuffix(line, "FROM stdin;")
+}
+
+// parseScriptHeader splits the rest of a "-- Name:" comment into the object's
+// name, type and schema
+func parseScriptHeader(header string) (name, desc, schema string, ok bool) {
+	name, rest, ok1 := strings.Cut(header, "; Type: ")
+	desc, rest, ok2 := strings.Cut(rest, "; Schema: ")
+	schema, _, _ = strings.Cut(rest, "; ")
+	return name, desc, schema, ok1 && ok2
+}
+
+// contentsBuilder collects the objects found in a snapshot
+type contentsBuilder struct {
+	contents *models.SnapshotContents
+	schemas  map[string]bool
+	tables   map[string]*models.SnapshotTable
+}
+
+func newContentsBuilder() *contentsBuilder {
+	return &contentsBuilder{
+		contents: &models.SnapshotContents{
+			Schemas:    []string{},
+			Extensions: []string{},
+			Tables:     []models.SnapshotTable{},
+			Views:      []models.SnapshotObject{},
+			Functions:  []models.SnapshotObject{},
+			Sequences:  []models.SnapshotObject{},
+		},
+		schemas: map[string]bool{},
+		tables:  map[string]*models.SnapshotTable{},
+	}
+}
+
+// addObject records an object of the given pg_dump type; types the contents
+// do not list, such as indexes and comments, are ignored
+func (b *contentsBuilder) addObject(desc, schema, name string) {
+	if schema != "" && schema != "-" {
+		b.schemas[schema] = true
+	}
+
+	object := models.SnapshotObject{Schema: schema, Name: name, Kind: desc}
+	switch desc {
+	case "SCHEMA":
+		b.schemas[name] = true
+	case "EXTENSION":
+		b.contents.Extensions = append(b.contents.Extensions, name)
+	case "TABLE":
+		b.table(schema, name)
+	case "VIEW", "MATERIALIZED VIEW":
+		b.contents.Views = append(b.contents.Views, object)
+	case "FUNCTION", "PROCEDURE", "AGGREGATE":
+		b.contents.Functions = append(b.contents.Functions, object)
+	case "SEQUENCE":
+		b.contents.Sequences = append(b.contents.Sequences, object)
+	}
+}
+
+// table returns the entry of a table, creating it when first seen
+func (b *contentsBuilder) table(schema, name string) *models.SnapshotTable {
+	key := schema + "." + name
+	if table, ok := b.tables[key]; ok {
+		return table
+	}
+	table := &models.SnapshotTable{Schema: schema, Name: name}
+	b.tables[key] = table
+	b.schemas[schema] = true
+	return table
+}
+
+// finish sorts the collected objects by schema and name
+func (b *contentsBuilder) finish(snapshotID string) *models.SnapshotContents {
+	contents := b.contents
+	contents.SnapshotID = snapshotID
+	contents.ReadAt = time.Now()
+
+	for schema := range b.schemas {
+		contents.Schemas = append(contents.Schemas, schema)
+	}
+	sort.Strings(contents.Schemas)
+	sort.Strings(contents.Extensions)
+
+	for _, table := range b.tables {
+		contents.Tables = append(contents.Tables, *table)
+		contents.DataBytes += table.DataBytes
+	}
+	sort.Slice(contents.Tables, func(i, j int) bool {
+		if contents.Tables[i].Schema != contents.Tables[j].Schema {
+			return contents.Tables[i].Schema < contents.Tables[j].Schema
+		}
+		return contents.Tables[i].Name < contents.Tables[j].Name
+	})
+	for _, objects := range [][]models.SnapshotObject{contents.Views, contents.Functions, contents.Sequences} {
+		sort.Slice(objects, func(i, j int) bool {
+			if objects[i].Schema != objects[j].Schema {
+				return objects[i].Schema < objects[j].Schema
+			}
+			return objects[i].Name < objects[j].Name
+		})
+	}
+	return contents
+}
+
+// contentsCache keeps the contents read from snapshots in the metadata store
+type contentsCache struct {
+	store *MetadataStore
+}
+
+// Get returns the kept contents of a snapshot, or nil if they were not read yet
+func (c *contentsCache) Get(snapshotID string) (*models.SnapshotContents, error) {
+	var contents models.SnapshotContents
+	found, err := c.store.get(contentsBucket, snapshotID, &contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot contents: %w", err)
+	}
+	if !found {
+		return nil, nil
+	}
+	return &contents, nil
+}
+
+// Save keeps the contents of a snapshot
+func (c *contentsCache) Save(contents *models.SnapshotContents) error {
+	return c.store.put(contentsBucket, contents.SnapshotID, contents)
+}
+
+// Delete forgets the contents of a deleted snapshot
+func (c *contentsCache) Delete(snapshotID string) error {
+	return c.store.delete(contentsBucket, snapshotID)
+}
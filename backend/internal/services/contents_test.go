@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// samplePlainDump is a plain pg_dump script of a small database
+var samplePlainDump = `--
+-- PostgreSQL database dump
+--
+
+SET statement_timeout = 0;
+
+--
+-- Name: sales; Type: SCHEMA; Schema: -; Owner: postgres
+--
+
+CREATE SCHEMA sales;
+
+--
+-- Name: pgcrypto; Type: EXTENSION; Schema: -; Owner: -
+--
+
+CREATE EXTENSION IF NOT EXISTS pgcrypto WITH SCHEMA public;
+
+--
+-- Name: touch_updated_at(); Type: FUNCTION; Schema: sales; Owner: postgres
+--
+
+CREATE FUNCTION sales.touch_updated_at() RETURNS trigger LANGUAGE plpgsql AS $$ BEGIN RETURN NEW; END $$;
+
+--
+-- Name: orders; Type: TABLE; Schema: sales; Owner: postgres
+--
+
+CREATE TABLE sales.orders (id integer, note text);
+
+--
+-- Name: orders_id_seq; Type: SEQUENCE; Schema: sales; Owner: postgres
+--
+
+CREATE SEQUENCE sales.orders_id_seq;
+
+--
+-- Name: Order Items; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public."Order Items" (id integer);
+
+--
+-- Name: order_totals; Type: VIEW; Schema: public; Owner: postgres
+--
+
+CREATE VIEW public.order_totals AS SELECT 1;
+
+--
+-- Data for Name: orders; Type: TABLE DATA; Schema: sales; Owner: postgres
+--
+
+COPY sales.orders (id, note) FROM stdin;
+1	-- Name: not a header; Type: TABLE; Schema: public; Owner: x
+2	` + strings.Repeat("x", 100*1024) + `
+\.
+
+--
+-- Data for Name: Order Items; Type: TABLE DATA; Schema: public; Owner: postgres
+--
+
+COPY public."Order Items" (id) FROM stdin;
+\.
+
+--
+-- Name: orders_pkey; Type: CONSTRAINT; Schema: sales; Owner: postgres
+--
+
+ALTER TABLE ONLY sales.orders ADD CONSTRAINT orders_pkey PRIMARY KEY (id);
+`
+
+func TestParseScriptHeader(t *testing.T) {
+	tests := []struct {
+		header             string
+		name, desc, schema string
+		ok                 bool
+	}{
+		{"orders; Type: TABLE; Schema: sales; Owner: postgres", "orders", "TABLE", "sales", true},
+		{"Order Items; Type: TABLE DATA; Schema: public; Owner: postgres", "Order Items", "TABLE DATA", "public", true},
+		{"pgcrypto; Type: EXTENSION; Schema: -; Owner: -", "pgcrypto", "EXTENSION", "-", true},
+		{"orders; Type: TABLE; Schema: sales", "orders", "TABLE", "sales", true},
+		{"orders; Schema: sales", "", "", "", false},
+	}
+	for _, tt := range tests {
+		name, desc, schema, ok := parseScriptHeader(tt.header)
+		if ok != tt.ok || (ok && (name != tt.name || desc != tt.desc || schema != tt.schema)) {
+			t.Errorf("parseScriptHeader(%q) = %q, %q, %q, %v, want %q, %q, %q, %v", tt.header, name, desc, schema, ok, tt.name, tt.desc, tt.schema, tt.ok)
+		}
+	}
+}
+
+func TestReadDumpScript(t *testing.T) {
+	builder := newContentsBuilder()
+	if err := readDumpScript(strings.NewReader(samplePlainDump), builder, true); err != nil {
+		t.Fatalf("readDumpScript: %v", err)
+	}
+	contents := builder.finish("snap-1")
+
+	if got := strings.Join(contents.Schemas, ","); got != "public,sales" {
+		t.Errorf("schemas = %s, want public,sales", got)
+	}
+	if got := strings.Join(contents.Extensions, ","); got != "pgcrypto" {
+		t.Errorf("extensions = %s, want pgcrypto", got)
+	}
+	for kind, objects := range map[string][]models.SnapshotObject{
+		"view":     contents.Views,
+		"function": contents.Functions,
+		"sequence": contents.Sequences,
+	} {
+		if len(objects) != 1 {
+			t.Errorf("found %d %ss, want 1: %+v", len(objects), kind, objects)
+		}
+	}
+
+	// Rows are counted in COPY blocks, including rows longer than the read
+	// buffer and rows that look like headers
+	wantRowBytes := int64(len("1\t-- Name: not a header; Type: TABLE; Schema: public; Owner: x\n") + len("2\t\n") + 100*1024)
+	want := []models.SnapshotTable{
+		{Schema: "public", Name: "Order Items", HasData: true},
+		{Schema: "sales", Name: "orders", HasData: true, Rows: 2, DataBytes: wantRowBytes},
+	}
+	if len(contents.Tables) != len(want) {
+		t.Fatalf("tables = %+v, want %+v", contents.Tables, want)
+	}
+	for i := range want {
+		if contents.Tables[i] != want[i] {
+			t.Errorf("table %d = %+v, want %+v", i, contents.Tables[i], want[i])
+		}
+	}
+	if contents.DataBytes != wantRowBytes {
+		t.Errorf("DataBytes = %d, want %d", contents.DataBytes, wantRowBytes)
+	}
+}
+
+func TestReadDumpScriptDataOnly(t *testing.T) {
+	// pg_restore's data-only script only contributes table data
+	builder := newContentsBuilder()
+	if err := readDumpScript(strings.NewReader(samplePlainDump), builder, false); err != nil {
+		t.Fatal(err)
+	}
+	contents := builder.finish("snap-1")
+	if len(contents.Tables) != 2 || len(contents.Extensions) != 0 || len(contents.Views) != 0 {
+		t.Errorf("contents = %+v, want only the two tables with data", contents)
+	}
+}
+
+func TestGetSnapshotContents(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	ctx := context.Background()
+	snapshot := &models.Snapshot{ID: "snap-1", Status: "completed", StorageKey: "shop.sql.zst", Compression: CompressionZstd}
+	storeTestSnapshot(t, ss, snapshot, samplePlainDump)
+
+	contents, err := ss.GetSnapshotContents(ctx, "snap-1")
+	if err != nil {
+		t.Fatalf("GetSnapshotContents: %v", err)
+	}
+	if contents.SnapshotID != "snap-1" || len(contents.Tables) != 2 || contents.Tables[1].Rows != 2 {
+		t.Errorf("contents = %+v, want the two tables of the dump", contents)
+	}
+
+	// Contents are kept, so the dump is not read again
+	if err := os.Remove(ss.storage.Local().Path(snapshot.StorageKey)); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := ss.GetSnapshotContents(ctx, "snap-1")
+	if err != nil || len(kept.Tables) != 2 {
+		t.Errorf("second GetSnapshotContents = %+v, %v, want the kept contents", kept, err)
+	}
+
+	if err := ss.catalog.Create(&models.Snapshot{ID: "creating", Status: "creating"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ss.GetSnapshotContents(ctx, "creating"); !errors.Is(err, ErrSnapshotBusy) {
+		t.Errorf("GetSnapshotContents of a running snapshot: error = %v, want ErrSnapshotBusy", err)
+	}
+}
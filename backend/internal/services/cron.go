@@ -0,0 +1,217 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMacros are the shorthand expressions accepted in place of five fields
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronWeekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// cronField is the set of values a field matches, one bit per value
+type cronField uint64
+
+// everyHour is the hour field of a schedule that runs in every hour
+const everyHour cronField = 1<<24 - 1
+
+func (f cronField) has(value int) bool {
+	return f&(1<<uint(value)) != 0
+}
+
+// cronSchedule is a parsed standard five-field cron expression: minute, hour,
+// day of month, month and day of week
+type cronSchedule struct {
+	minute, hour, dom, month, dow cronField
+	// When both day fields are restricted a day matches either of them, as in
+	// Vixie cron
+	domAny, dowAny bool
+}
+
+// parseCron parses a five-field cron expression or one of the @ macros.
+// Fields accept *, values, ranges (a-b), steps (*/n, a-b/n), comma separated
+// lists, and month and weekday names; weekday 7 is Sunday.
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: cron expression %q must have 5 fields", ErrInvalidOptions, expr)
+	}
+
+	schedule := &cronSchedule{
+		domAny: fields[2] == "*" || fields[2] == "?",
+		dowAny: fields[4] == "*" || fields[4] == "?",
+	}
+	var err error
+	if schedule.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = parseCronField(fields[4], 0, 7, cronWeekdayNames); err != nil {
+		return nil, err
+	}
+	if schedule.dow.has(7) {
+		schedule.dow |= 1
+	}
+	return schedule, nil
+}
+
+// parseCronField parses one comma separated field whose values lie in [min, max]
+func parseCronField(field string, min, max int, names map[string]int) (cronField, error) {
+	var set cronField
+	for _, part := range strings.Split(field, ",") {
+		invalid := fmt.Errorf("%w: invalid cron field %q", ErrInvalidOptions, field)
+
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, invalid
+			}
+			rangePart = part[:i]
+		}
+
+		low, high := min, max
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			low, err1 = parseCronValue(bounds[0], names)
+			high, err2 = parseCronValue(bounds[1], names)
+			if err1 != nil || err2 != nil {
+				return 0, invalid
+			}
+		default:
+			value, err := parseCronValue(rangePart, names)
+			if err != nil {
+				return 0, invalid
+			}
+			low = value
+			// a/n means every n-th value starting at a
+			if step == 1 {
+				high = value
+			}
+		}
+
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%w: cron field %q is out of range %d-%d", ErrInvalidOptions, field, min, max)
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if number, ok := names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// dayMatches reports whether the day of t matches the day fields
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := c.dom.has(t.Day())
+	dowMatch := c.dow.has(int(t.Weekday()))
+	if c.domAny || c.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// next returns the first time after t, in t's location, that matches the
+// schedule, or the zero time if there is none within five years (such as
+// February 30th). A time in a daylight saving gap does not exist and is
+// skipped that day.
+func (c *cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	// Truncate works on absolute time, so it cannot move back into the first
+	// pass of an hour that repeats when clocks go back
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + 5
+
+	// Advance the largest mismatching field, resetting the smaller ones, and
+	// start over whenever a field wraps around
+wrap:
+	if t.Year() > limit {
+		return time.Time{}
+	}
+
+	for !c.month.has(int(t.Month())) {
+		t = cronAdvance(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !c.dayMatches(t) {
+		t = cronAdvance(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for !c.hour.has(t.Hour()) {
+		t = cronAdvance(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for !c.minute.has(t.Minute()) {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	// An hour that repeats when clocks go back is run in twice only by
+	// schedules that run every hour, as in Vixie cron
+	if c.hour != everyHour && t.Add(-time.Hour).Hour() == t.Hour() {
+		t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		goto wrap
+	}
+
+	return t
+}
+
+// cronAdvance returns next, unless next falls in a daylight saving gap that
+// time.Date resolved to a time not after t; then it steps an hour past t
+func cronAdvance(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Hour)
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fieldValues lists the values a field matches between min and max
+func fieldValues(f cronField, min, max int) []int {
+	var values []int
+	for value := min; value <= max; value++ {
+		if f.has(value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr                          string
+		minute, hour, dom, month, dow []int
+		domAny, dowAny                bool
+	}{
+		{
+			expr:   "30 2 * * *",
+			minute: []int{30}, hour: []int{2}, dom: cronRange(1, 31), month: cronRange(1, 12), dow: cronRange(0, 6),
+			domAny: true, dowAny: true,
+		},
+		{
+			expr:   "*/15 9-17 * jan,JUL mon-fri",
+			minute: []int{0, 15, 30, 45}, hour: cronRange(9, 17), dom: cronRange(1, 31), month: []int{1, 7}, dow: cronRange(1, 5),
+			domAny: true,
+		},
+		{
+			expr:   "5/20 0-12/6 1,15 * ?",
+			minute: []int{5, 25, 45}, hour: []int{0, 6, 12}, dom: []int{1, 15}, month: cronRange(1, 12), dow: cronRange(0, 6),
+			dowAny: true,
+		},
+		{
+			// 7 is Sunday as well as 0
+			expr:   "0 0 * * 7",
+			minute: []int{0}, hour: []int{0}, dom: cronRange(1, 31), month: cronRange(1, 12), dow: []int{0},
+			domAny: true,
+		},
+		{
+			expr:   "  @WEEKLY ",
+			minute: []int{0}, hour: []int{0}, dom: cronRange(1, 31), month: cronRange(1, 12), dow: []int{0},
+			domAny: true,
+		},
+		{
+			expr:   "@hourly",
+			minute: []int{0}, hour: cronRange(0, 23), dom: cronRange(1, 31), month: cronRange(1, 12), dow: cronRange(0, 6),
+			domAny: true, dowAny: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron: %v", err)
+			}
+			for _, field := range []struct {
+				name string
+				got  []int
+				want []int
+			}{
+				{"minute", fieldValues(schedule.minute, 0, 59), tt.minute},
+				{"hour", fieldValues(schedule.hour, 0, 23), tt.hour},
+				{"day of month", fieldValues(schedule.dom, 1, 31), tt.dom},
+				{"month", fieldValues(schedule.month, 1, 12), tt.month},
+				{"day of week", fieldValues(schedule.dow, 0, 6), tt.dow},
+			} {
+				if !equalInts(field.got, field.want) {
+					t.Errorf("%s = %v, want %v", field.name, field.got, field.want)
+				}
+			}
+			if schedule.domAny != tt.domAny || schedule.dowAny != tt.dowAny {
+				t.Errorf("domAny, dowAny = %v, %v, want %v, %v", schedule.domAny, schedule.dowAny, tt.domAny, tt.dowAny)
+			}
+		})
+	}
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@fortnightly",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"10-5 * * * *",
+		"1-x * * * *",
+		"abc * * * *",
+		"* * * foo *",
+		"* * * * monday",
+		"1,,2 * * * *",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := parseCron(expr); !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("parseCron(%q) error = %v, want ErrInvalidOptions", expr, err)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	utc := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	// New York clocks go forward from 02:00 to 03:00 on 2026-03-08 and back
+	// from 02:00 to 01:00 on 2026-11-01
+	est := time.FixedZone("EST", -5*3600)
+	edt := time.FixedZone("EDT", -4*3600)
+	inNewYork := func(t time.Time) time.Time {
+		return t.In(newYork)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"next minute", "* * * * *", utc(2026, 5, 10, 8, 15).Add(30 * time.Second), utc(2026, 5, 10, 8, 16)},
+		{"strictly after", "30 2 * * *", utc(2026, 5, 10, 2, 30), utc(2026, 5, 11, 2, 30)},
+		{"across a month end", "59 23 * * *", utc(2026, 1, 31, 23, 59), utc(2026, 2, 1, 23, 59)},
+		{"across a year end", "0 0 1 * *", utc(2026, 12, 15, 0, 0), utc(2027, 1, 1, 0, 0)},
+		{"skips months without the day", "0 0 31 * *", utc(2026, 1, 31, 0, 0), utc(2026, 3, 31, 0, 0)},
+		{"the 30th after February", "0 6 30 * *", utc(2026, 2, 1, 0, 0), utc(2026, 3, 30, 6, 0)},
+		{"leap day", "0 12 29 2 *", utc(2026, 3, 1, 0, 0), utc(2028, 2, 29, 12, 0)},
+		{"day that never comes", "0 0 30 2 *", utc(2026, 1, 1, 0, 0), time.Time{}},
+		{"day of month or week", "0 0 13 * fri", utc(2026, 10, 16, 0, 0), utc(2026, 10, 23, 0, 0)},
+		{"day of month and any weekday", "0 0 13 * *", utc(2026, 10, 16, 0, 0), utc(2026, 11, 13, 0, 0)},
+		{"weekdays", "0 9 * * mon-fri", utc(2026, 10, 16, 10, 0), utc(2026, 10, 19, 9, 0)},
+		{"keeps the location", "0 0 * * *", time.Date(2026, 6, 1, 12, 0, 0, 0, newYork), time.Date(2026, 6, 2, 0, 0, 0, 0, edt)},
+		{"into daylight saving time", "0 0 * * *", time.Date(2026, 3, 7, 12, 0, 0, 0, newYork), time.Date(2026, 3, 8, 0, 0, 0, 0, est)},
+		{"out of daylight saving time", "0 3 * * *", time.Date(2026, 10, 31, 12, 0, 0, 0, newYork), time.Date(2026, 11, 1, 3, 0, 0, 0, est)},
+		{"hourly across the gap", "0 * * * *", time.Date(2026, 3, 8, 1, 30, 0, 0, newYork), time.Date(2026, 3, 8, 3, 0, 0, 0, edt)},
+		{"time in the gap", "30 2 * * *", time.Date(2026, 3, 7, 12, 0, 0, 0, newYork), time.Date(2026, 3, 9, 2, 30, 0, 0, edt)},
+		{"hourly through the repeated hour", "0 * * * *", inNewYork(time.Date(2026, 11, 1, 0, 30, 0, 0, edt)), time.Date(2026, 11, 1, 1, 0, 0, 0, edt)},
+		{"second pass of the repeated hour", "0 * * * *", inNewYork(time.Date(2026, 11, 1, 1, 30, 0, 0, edt)), time.Date(2026, 11, 1, 1, 0, 0, 0, est)},
+		{"time in the repeated hour", "30 1 * * *", time.Date(2026, 10, 31, 12, 0, 0, 0, newYork), time.Date(2026, 11, 1, 1, 30, 0, 0, edt)},
+		{"time in the repeated hour runs once", "30 1 * * *", inNewYork(time.Date(2026, 11, 1, 1, 30, 0, 0, edt)), time.Date(2026, 11, 2, 1, 30, 0, 0, est)},
+		{"every minute of the repeated hour runs once", "* 1 * * *", inNewYork(time.Date(2026, 11, 1, 1, 59, 0, 0, edt)), time.Date(2026, 11, 2, 1, 0, 0, 0, est)},
+		{"after the repeated hour", "0 * * * *", inNewYork(time.Date(2026, 11, 1, 1, 30, 0, 0, est)), time.Date(2026, 11, 1, 2, 0, 0, 0, est)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron: %v", err)
+			}
+			got := schedule.next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+			if !got.IsZero() && got.Location() != tt.from.Location() {
+				t.Errorf("next(%s) is in %s, want %s", tt.from, got.Location(), tt.from.Location())
+			}
+		})
+	}
+}
+
+func cronRange(low, high int) []int {
+	var values []int
+	for value := low; value <= high; value++ {
+		values = append(values, value)
+	}
+	return values
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -5,22 +5,28 @@ import (
 	"fmt"
 	"log"
 	"strings"
-	"time"
+	"sync"
 
 	"PGTimeMachine-Backend/internal/models"
 
-	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 )
 
 type DatabaseService struct {
+	mu          sync.Mutex
 	connections map[string]*sql.DB
+	store       *MetadataStore
+	keyRing     *KeyRing
 }
 
-func NewDatabaseService() *DatabaseService {
-	return &DatabaseService{
+func NewDatabaseService(store *MetadataStore, keyRing *KeyRing) *DatabaseService {
+	ds := &DatabaseService{
 		connections: make(map[string]*sql.DB),
+		store:       store,
+		keyRing:     keyRing,
 	}
+	ds.resealConnections()
+	return ds
 }
 
 // TestConnection tests if a database connection is valid
@@ -40,28 +46,11 @@ func (ds *DatabaseService) TestConnection(config *models.DatabaseConnection) err
 	return nil
 }
 
-// SaveConnection saves a database connection configuration
-func (ds *DatabaseService) SaveConnection(config *models.DatabaseConnection) (*models.DatabaseConnection, error) {
-	if config.ID == "" {
-		config.ID = uuid.New().String()
-	}
-	config.CreatedAt = time.Now()
-	config.UpdatedAt = time.Now()
-
-	// Test connection before saving
-	if err := ds.TestConnection(config); err != nil {
-		return nil, fmt.Errorf("connection test failed: %w", err)
-	}
-
-	// In a real application, you would save this to a configuration database
-	// For now, we'll just validate and return
-	log.Printf("Saved database connection: %s", config.Name)
-
-	return config, nil
-}
-
 // GetConnection retrieves a database connection
 func (ds *DatabaseService) GetConnection(id string) (*sql.DB, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
 	if db, exists := ds.connections[id]; exists {
 		return db, nil
 	}
@@ -69,11 +58,30 @@ func (ds *DatabaseService) GetConnection(id string) (*sql.DB, error) {
 	return nil, fmt.Errorf("connection not found: %s", id)
 }
 
-// EstablishConnection creates and caches a database connection
+// EstablishConnection creates and caches a database connection, closing the
+// one it replaces
 func (ds *DatabaseService) EstablishConnection(config *models.DatabaseConnection) (*sql.DB, error) {
-	connStr := ds.buildConnectionString(config)
+	db, err := ds.openConnection(config)
+	if err != nil {
+		return nil, err
+	}
 
-	db, err := sql.Open("postgres", connStr)
+	// Cache the connection
+	ds.mu.Lock()
+	previous := ds.connections[config.ID]
+	ds.connections[config.ID] = db
+	ds.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+
+	return db, nil
+}
+
+// openConnection opens and pings a database connection without caching it;
+// the caller closes it
+func (ds *DatabaseService) openConnection(config *models.DatabaseConnection) (*sql.DB, error) {
+	db, err := sql.Open("postgres", ds.buildConnectionString(config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open connection: %w", err)
 	}
@@ -82,19 +90,16 @@ func (ds *DatabaseService) EstablishConnection(config *models.DatabaseConnection
 		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
-
-	// Cache the connection
-	ds.connections[config.ID] = db
-
 	return db, nil
 }
 
 // GetDatabaseInfo retrieves basic information about the database
 func (ds *DatabaseService) GetDatabaseInfo(config *models.DatabaseConnection) (*models.DatabaseInfo, error) {
-	db, err := ds.EstablishConnection(config)
+	db, err := ds.openConnection(config)
 	if err != nil {
 		return nil, err
 	}
+	defer db.Close()
 
 	info := &models.DatabaseInfo{
 		Name: config.Database,
@@ -150,8 +155,85 @@ func (ds *DatabaseService) GetDatabaseInfo(config *models.DatabaseConnection) (*
 	return info, nil
 }
 
+// GetTableStats lists the user tables of the database with their on-disk size
+// and planner row estimate
+func (ds *DatabaseService) GetTableStats(config *models.DatabaseConnection) ([]models.TableStats, error) {
+	db, err := ds.openConnection(config)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+		SELECT n.nspname, c.relname, pg_relation_size(c.oid), GREATEST(c.reltuples, 0)::bigint
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'r'
+		  AND n.nspname NOT IN ('information_schema', 'pg_catalog')
+		  AND n.nspname NOT LIKE 'pg_toast%'
+		  AND n.nspname NOT LIKE 'pg_temp%'
+		ORDER BY n.nspname, c.relname
+	`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table sizes: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []models.TableStats
+	for rows.Next() {
+		var table models.TableStats
+		if err := rows.Scan(&table.Schema, &table.Name, &table.SizeBytes, &table.EstimatedRows); err != nil {
+			return nil, fmt.Errorf("failed to read table sizes: %w", err)
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, rows.Err()
+}
+
+// listRelations lists the relations of the database that pg_dump's table
+// patterns can select: tables, partitioned tables, views, materialized views,
+// sequences and foreign tables
+func (ds *DatabaseService) listRelations(config *models.DatabaseConnection) ([]tableKey, error) {
+	db, err := ds.openConnection(config)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+		SELECT n.nspname, c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p', 'v', 'm', 'S', 'f')
+		  AND n.nspname NOT IN ('information_schema', 'pg_catalog')
+		  AND n.nspname NOT LIKE 'pg_toast%'
+		  AND n.nspname NOT LIKE 'pg_temp%'
+		ORDER BY n.nspname, c.relname
+	`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list relations: %w", err)
+	}
+	defer rows.Close()
+
+	var relations []tableKey
+	for rows.Next() {
+		var relation tableKey
+		if err := rows.Scan(&relation.schema, &relation.name); err != nil {
+			return nil, fmt.Errorf("failed to read relations: %w", err)
+		}
+		relations = append(relations, relation)
+	}
+	return relations, rows.Err()
+}
+
 // CloseConnection closes and removes a cached connection
 func (ds *DatabaseService) CloseConnection(id string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
 	if db, exists := ds.connections[id]; exists {
 		if err := db.Close(); err != nil {
 			return err
@@ -163,6 +245,9 @@ func (ds *DatabaseService) CloseConnection(id string) error {
 
 // CloseAllConnections closes all cached connections
 func (ds *DatabaseService) CloseAllConnections() {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
 	for id, db := range ds.connections {
 		if err := db.Close(); err != nil {
 			log.Printf("Error closing connection %s: %v", id, err)
@@ -0,0 +1,469 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Outcomes of a single drill check
+const (
+	checkPassed  = "passed"
+	checkFailed  = "failed"
+	checkSkipped = "skipped"
+)
+
+// StartRestoreDrill queues a restore drill: the snapshot is restored into a
+// scratch database on the server of config, checked, and dropped again
+func (ss *SnapshotService) StartRestoreDrill(config *models.DatabaseConnection, snapshotID string, request *models.DrillRequest) (*models.RestoreDrill, error) {
+	snapshot, err := ss.catalog.Get(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Status != "completed" {
+		return nil, fmt.Errorf("%w: snapshot %s has status %s", ErrSnapshotNotRestorable, snapshot.ID, snapshot.Status)
+	}
+	if request.ParallelJobs > 1 && !supportsParallelRestore(snapshot) {
+		return nil, fmt.Errorf("%w: parallel_jobs requires an uncompressed, unencrypted custom or directory format snapshot", ErrInvalidOptions)
+	}
+	// A data-only snapshot has no tables of its own to load into
+	if snapshotMode(snapshot) == ModeDataOnly {
+		return nil, fmt.Errorf("%w: snapshot %s is data_only and cannot be restored into an empty scratch database", ErrInvalidOptions, snapshot.ID)
+	}
+
+	drill := &models.RestoreDrill{
+		ID:           uuid.New().String(),
+		SnapshotID:   snapshot.ID,
+		DatabaseID:   request.DatabaseID,
+		ParallelJobs: request.ParallelJobs,
+		Status:       "queued",
+		Checks:       []models.DrillCheck{},
+		CreatedAt:    time.Now(),
+	}
+	// A fixed prefix keeps scratch databases recognisable and short enough
+	// that PostgreSQL never truncates their name
+	drill.ScratchDBName = "pgtm_drill_" + drill.ID[:8]
+
+	if err := ss.drills.Save(drill); err != nil {
+		return nil, err
+	}
+
+	// Queue the drill on a private copy
+	record := *drill
+	ss.jobs.Submit(&Job{
+		ID:          drill.ID,
+		Kind:        "drill",
+		Host:        fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Database:    drill.ScratchDBName,
+		Priority:    request.Priority,
+		Connections: max(drill.ParallelJobs, 1),
+		Run: func(ctx context.Context) {
+			ss.performDrill(ctx, config, &record, snapshot)
+		},
+		OnCancel: func() {
+			ss.finishDrill(&record, "cancelled", "Restore drill was cancelled")
+		},
+	})
+	drill.QueuePosition = ss.jobs.QueuePosition(drill.ID)
+	ss.events.Publish(models.JobEvent{Type: "state", JobID: drill.ID, Kind: "drill", Status: "queued"})
+
+	return drill, nil
+}
+
+// performDrill restores the snapshot into the scratch database, checks it and
+// drops it again, recording how long each part took
+func (ss *SnapshotService) performDrill(ctx context.Context, config *models.DatabaseConnection, drill *models.RestoreDrill, snapshot *models.Snapshot) {
+	log.Printf("Starting restore drill %s of snapshot %s", drill.ID, snapshot.ID)
+	drill.Status = "running"
+	startedAt := time.Now()
+	drill.StartedAt = &startedAt
+	ss.saveDrill(drill)
+
+	created, err := ss.runDrill(ctx, config, drill, snapshot)
+
+	if created {
+		if dropErr := ss.dropDatabase(config, drill.ScratchDBName); dropErr != nil {
+			log.Printf("Failed to drop scratch database %s of drill %s: %v", drill.ScratchDBName, drill.ID, dropErr)
+		} else {
+			drill.ScratchDropped = true
+		}
+	}
+	drill.TotalSeconds = time.Since(startedAt).Seconds()
+
+	switch {
+	case ctx.Err() != nil:
+		ss.finishDrill(drill, "cancelled", "Restore drill was cancelled")
+	case err != nil:
+		ss.finishDrill(drill, "failed", fmt.Sprintf("Restore drill failed: %v", err))
+	case drillFailed(drill.Checks):
+		ss.finishDrill(drill, "failed", "One or more checks failed")
+	default:
+		ss.finishDrill(drill, "passed", "")
+	}
+
+	log.Printf("Restore drill %s %s (restore %.1fs, checks %.1fs)", drill.ID, drill.Status, drill.RestoreSeconds, drill.CheckSeconds)
+}
+
+// runDrill loads the snapshot into the scratch database and runs the checks
+// against it, reporting whether the scratch database was created
+func (ss *SnapshotService) runDrill(ctx context.Context, config *models.DatabaseConnection, drill *models.RestoreDrill, snapshot *models.Snapshot) (bool, error) {
+	if err := ss.checkSnapshotObject(ctx, snapshot); err != nil {
+		return false, fmt.Errorf("snapshot file not found for ID: %s: %w", snapshot.ID, err)
+	}
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	if err := ss.createDatabase(config, drill.ScratchDBName); err != nil {
+		return false, fmt.Errorf("failed to create scratch database: %w", err)
+	}
+
+	// The drill goes through the same restore path as a real restore
+	operation := &models.RestoreOperation{
+		ID:           drill.ID,
+		SnapshotID:   drill.SnapshotID,
+		DatabaseID:   drill.DatabaseID,
+		TargetDBName: drill.ScratchDBName,
+		ParallelJobs: drill.ParallelJobs,
+	}
+	cmd, tool, cleanup, err := ss.restoreCommand(ctx, config, operation, snapshot)
+	if err != nil {
+		return true, fmt.Errorf("failed to prepare restore: %w", err)
+	}
+	defer cleanup()
+
+	output := newLineWriter(func(line string) {
+		ss.events.Publish(models.JobEvent{Type: "log", JobID: drill.ID, Kind: "drill", Line: line})
+	})
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	restoreStarted := time.Now()
+	err = cmd.Run()
+	drill.RestoreSeconds = time.Since(restoreStarted).Seconds()
+	if err != nil {
+		drill.Output = output.String()
+		return true, fmt.Errorf("%s restore failed: %w", tool, err)
+	}
+
+	scratchConfig := *config
+	scratchConfig.Database = drill.ScratchDBName
+	db, err := ss.dbService.openConnection(&scratchConfig)
+	if err != nil {
+		return true, fmt.Errorf("failed to connect to scratch database: %w", err)
+	}
+	// Sessions must be gone before the scratch database can be dropped
+	defer db.Close()
+
+	checksStarted := time.Now()
+	drill.Checks = runDrillChecks(ctx, db, snapshot)
+	drill.CheckSeconds = time.Since(checksStarted).Seconds()
+	ss.saveDrill(drill)
+
+	return true, nil
+}
+
+// runDrillChecks runs the sanity checks of a drill against the restored database
+func runDrillChecks(ctx context.Context, db *sql.DB, snapshot *models.Snapshot) []models.DrillCheck {
+	tables, rows := checkRowCounts(ctx, db, snapshot)
+	return []models.DrillCheck{
+		tables,
+		rows,
+		checkSequences(ctx, db),
+		checkIndexes(ctx, db),
+	}
+}
+
+// checkRowCounts confirms that every table recorded at snapshot time exists
+// in the restored database and, when rows were counted, holds the same number
+// of rows. Without row counts the tables are those whose sizes were recorded.
+func checkRowCounts(ctx context.Context, db *sql.DB, snapshot *models.Snapshot) (models.DrillCheck, models.DrillCheck) {
+	if len(snapshot.RowCounts) == 0 && len(snapshot.TableSizes) == 0 {
+		return compareRowCounts(nil, nil, nil)
+	}
+
+	var actual map[tableKey]int64
+	var err error
+	if len(snapshot.RowCounts) > 0 {
+		actual, err = countRows(ctx, db)
+	} else {
+		var tables []tableKey
+		tables, err = listTables(ctx, db)
+		actual = make(map[tableKey]int64, len(tables))
+		for _, table := range tables {
+			actual[table] = 0
+		}
+	}
+	if err != nil {
+		tables := models.DrillCheck{Name: "tables_exist", Status: checkFailed, Message: err.Error()}
+		rows := models.DrillCheck{Name: "row_counts", Status: checkFailed, Message: err.Error()}
+		return tables, rows
+	}
+	return compareRowCounts(snapshot.RowCounts, snapshot.TableSizes, actual)
+}
+
+// compareRowCounts checks the tables of a restored database against the row
+// counts recorded with a snapshot, or against the tables whose sizes were
+// recorded when rows were not counted
+func compareRowCounts(expected, sizes map[string]int64, actual map[tableKey]int64) (models.DrillCheck, models.DrillCheck) {
+	tables := models.DrillCheck{Name: "tables_exist"}
+	rows := models.DrillCheck{Name: "row_counts"}
+
+	recorded := expected
+	if len(expected) == 0 {
+		rows.Status, rows.Message = checkSkipped, "No row counts were recorded with this snapshot"
+		recorded = sizes
+	}
+	if len(recorded) == 0 {
+		tables.Status, tables.Message = checkSkipped, "No tables were recorded with this snapshot"
+		return tables, rows
+	}
+
+	names := make([]string, 0, len(recorded))
+	for name := range recorded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		count, ok := actual[parseTableKey(name)]
+		if !ok {
+			tables.Failures = append(tables.Failures, name)
+			continue
+		}
+		if len(expected) > 0 && count != expected[name] {
+			rows.Failures = append(rows.Failures, fmt.Sprintf("%s: %d rows, expected %d", name, count, expected[name]))
+		}
+	}
+
+	if len(tables.Failures) > 0 {
+		tables.Status = checkFailed
+		tables.Message = fmt.Sprintf("%d of %d tables are missing", len(tables.Failures), len(names))
+	} else {
+		tables.Status = checkPassed
+		tables.Message = fmt.Sprintf("All %d tables exist", len(names))
+	}
+	switch {
+	case rows.Status == checkSkipped:
+	case len(rows.Failures) > 0:
+		rows.Status = checkFailed
+		rows.Message = fmt.Sprintf("%d tables have a different row count", len(rows.Failures))
+	default:
+		rows.Status = checkPassed
+		rows.Message = "Row counts match the snapshot"
+	}
+	return tables, rows
+}
+
+// checkSequences confirms that every ascending sequence owned by a column
+// would hand out a value above the column's current maximum
+func checkSequences(ctx context.Context, db *sql.DB) models.DrillCheck {
+	check := models.DrillCheck{Name: "sequences"}
+
+	query := `
+		SELECT sn.nspname, s.relname, tn.nspname, t.relname, a.attname
+		FROM pg_depend d
+		JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_sequence ps ON ps.seqrelid = s.oid AND ps.seqincrement > 0
+		JOIN pg_class t ON t.oid = d.refobjid
+		JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+		WHERE d.classid = 'pg_class'::regclass
+		  AND d.refclassid = 'pg_class'::regclass
+		  AND d.deptype IN ('a', 'i')
+		ORDER BY sn.nspname, s.relname
+	`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		check.Status, check.Message = checkFailed, fmt.Sprintf("failed to list sequences: %v", err)
+		return check
+	}
+	type ownedSequence struct {
+		schema, name, tableSchema, table, column string
+	}
+	var sequences []ownedSequence
+	for rows.Next() {
+		var seq ownedSequence
+		if err := rows.Scan(&seq.schema, &seq.name, &seq.tableSchema, &seq.table, &seq.column); err != nil {
+			rows.Close()
+			check.Status, check.Message = checkFailed, fmt.Sprintf("failed to list sequences: %v", err)
+			return check
+		}
+		sequences = append(sequences, seq)
+	}
+	rows.Close()
+
+	for _, seq := range sequences {
+		name := seq.schema + "." + seq.name
+
+		var lastValue int64
+		var isCalled bool
+		query := fmt.Sprintf("SELECT last_value, is_called FROM %s.%s", pq.QuoteIdentifier(seq.schema), pq.QuoteIdentifier(seq.name))
+		if err := db.QueryRowContext(ctx, query).Scan(&lastValue, &isCalled); err != nil {
+			check.Failures = append(check.Failures, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+
+		var maxValue sql.NullInt64
+		query = fmt.Sprintf("SELECT max(%s)::bigint FROM %s.%s", pq.QuoteIdentifier(seq.column), pq.QuoteIdentifier(seq.tableSchema), pq.QuoteIdentifier(seq.table))
+		if err := db.QueryRowContext(ctx, query).Scan(&maxValue); err != nil {
+			check.Failures = append(check.Failures, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if !maxValue.Valid {
+			continue
+		}
+
+		next := lastValue
+		if isCalled {
+			next++
+		}
+		if next <= maxValue.Int64 {
+			check.Failures = append(check.Failures, fmt.Sprintf("%s: next value %d, but %s.%s.%s reaches %d", name, next, seq.tableSchema, seq.table, seq.column, maxValue.Int64))
+		}
+	}
+
+	if len(check.Failures) > 0 {
+		check.Status = checkFailed
+		check.Message = fmt.Sprintf("%d of %d sequences are behind their column", len(check.Failures), len(sequences))
+	} else {
+		check.Status = checkPassed
+		check.Message = fmt.Sprintf("All %d owned sequences are ahead of their column", len(sequences))
+	}
+	return check
+}
+
+// checkIndexes confirms that no index was left invalid by the restore
+func checkIndexes(ctx context.Context, db *sql.DB) models.DrillCheck {
+	check := models.DrillCheck{Name: "indexes"}
+
+	query := `
+		SELECT n.nspname || '.' || c.relname
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE NOT i.indisvalid
+		ORDER BY 1
+	`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		check.Status, check.Message = checkFailed, fmt.Sprintf("failed to list indexes: %v", err)
+		return check
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			check.Status, check.Message = checkFailed, fmt.Sprintf("failed to list indexes: %v", err)
+			return check
+		}
+		check.Failures = append(check.Failures, name)
+	}
+
+	if len(check.Failures) > 0 {
+		check.Status = checkFailed
+		check.Message = fmt.Sprintf("%d indexes are invalid", len(check.Failures))
+	} else {
+		check.Status = checkPassed
+		check.Message = "No invalid indexes"
+	}
+	return check
+}
+
+// drillFailed reports whether any check of a drill failed
+func drillFailed(checks []models.DrillCheck) bool {
+	for _, check := range checks {
+		if check.Status == checkFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// saveDrill records the current state of a restore drill and announces it to event subscribers
+func (ss *SnapshotService) saveDrill(drill *models.RestoreDrill) {
+	if err := ss.drills.Save(drill); err != nil {
+		log.Printf("Failed to record restore drill %s: %v", drill.ID, err)
+	}
+	ss.events.Publish(models.JobEvent{
+		Type:    "state",
+		JobID:   drill.ID,
+		Kind:    "drill",
+		Status:  drill.Status,
+		Message: drill.ErrorMessage,
+	})
+}
+
+// finishDrill records the final status of a restore drill
+func (ss *SnapshotService) finishDrill(drill *models.RestoreDrill, status, message string) {
+	drill.Status = status
+	drill.ErrorMessage = message
+	now := time.Now()
+	drill.CompletedAt = &now
+	ss.saveDrill(drill)
+}
+
+// CancelDrill stops a restore drill that is queued or still running; a
+// running drill still drops its scratch database
+func (ss *SnapshotService) CancelDrill(drillID string) error {
+	if _, err := ss.drills.Get(drillID); err != nil {
+		return err
+	}
+	return ss.jobs.Cancel(drillID)
+}
+
+// failInterruptedDrills marks drills left running by a previous run as failed
+func (ss *SnapshotService) failInterruptedDrills() {
+	drills, err := ss.drills.List(RestoreFilter{})
+	if err != nil {
+		log.Printf("Warning: Failed to check for interrupted restore drills: %v", err)
+		return
+	}
+
+	for _, drill := range drills {
+		if drill.Status != "queued" && drill.Status != "running" {
+			continue
+		}
+		message := "Restore drill was interrupted by a server restart"
+		if drill.Status == "running" {
+			message += fmt.Sprintf("; scratch database %s may need to be dropped by hand", drill.ScratchDBName)
+		}
+		ss.finishDrill(drill, "failed", message)
+	}
+}
+
+// ListDrills returns the restore drills matching filter, newest first
+func (ss *SnapshotService) ListDrills(filter RestoreFilter) ([]*models.RestoreDrill, error) {
+	drills, err := ss.drills.List(filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, drill := range drills {
+		if drill.Status == "queued" {
+			drill.QueuePosition = ss.jobs.QueuePosition(drill.ID)
+		}
+	}
+	return drills, nil
+}
+
+// GetDrill retrieves a restore drill by ID
+func (ss *SnapshotService) GetDrill(drillID string) (*models.RestoreDrill, error) {
+	drill, err := ss.drills.Get(drillID)
+	if err != nil {
+		return nil, err
+	}
+	if drill.Status == "queued" {
+		drill.QueuePosition = ss.jobs.QueuePosition(drill.ID)
+	}
+	return drill, nil
+}
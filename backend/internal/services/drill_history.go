@@ -0,0 +1,78 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// ErrDrillNotFound is returned when a restore drill is not present in the history
+var ErrDrillNotFound = errors.New("restore drill not found")
+
+// DrillHistory persists restore drills and their reports
+type DrillHistory interface {
+	Save(drill *models.RestoreDrill) error
+	Get(id string) (*models.RestoreDrill, error)
+	List(filter RestoreFilter) ([]*models.RestoreDrill, error)
+}
+
+type boltDrillHistory struct {
+	store *MetadataStore
+}
+
+// NewDrillHistory creates a drill history backed by the metadata store
+func NewDrillHistory(store *MetadataStore) DrillHistory {
+	return &boltDrillHistory{store: store}
+}
+
+// Save records the current state of a restore drill
+func (h *boltDrillHistory) Save(drill *models.RestoreDrill) error {
+	if err := h.store.put(drillsBucket, drill.ID, drill); err != nil {
+		return fmt.Errorf("failed to record restore drill: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a restore drill by ID
+func (h *boltDrillHistory) Get(id string) (*models.RestoreDrill, error) {
+	var drill models.RestoreDrill
+	found, err := h.store.get(drillsBucket, id, &drill)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read restore drill: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrDrillNotFound, id)
+	}
+	return &drill, nil
+}
+
+// List returns the restore drills matching filter, newest first
+func (h *boltDrillHistory) List(filter RestoreFilter) ([]*models.RestoreDrill, error) {
+	drills := []*models.RestoreDrill{}
+	err := h.store.forEach(drillsBucket, func(data []byte) error {
+		var drill models.RestoreDrill
+		if err := json.Unmarshal(data, &drill); err != nil {
+			return err
+		}
+		if filter.SnapshotID != "" && drill.SnapshotID != filter.SnapshotID {
+			return nil
+		}
+		if filter.DatabaseID != "" && drill.DatabaseID != filter.DatabaseID {
+			return nil
+		}
+		drills = append(drills, &drill)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list restore drills: %w", err)
+	}
+
+	sort.Slice(drills, func(i, j int) bool {
+		return drills[i].CreatedAt.After(drills[j].CreatedAt)
+	})
+
+	return drills, nil
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompareRowCounts(t *testing.T) {
+	restored := map[tableKey]int64{
+		{"public", "customers"}:  2,
+		{"public", "orders"}:     5,
+		{"sales.eu", "invoices"}: 1,
+	}
+
+	tests := []struct {
+		name          string
+		counts, sizes map[string]int64
+		actual        map[tableKey]int64
+		tables, rows  string
+		tableFailures []string
+		rowFailures   []string
+	}{
+		{
+			name:   "counts match",
+			counts: map[string]int64{"public.customers": 2, "public.orders": 5, `"sales.eu".invoices`: 1},
+			sizes:  map[string]int64{"public.customers": 8192},
+			actual: restored,
+			tables: checkPassed, rows: checkPassed,
+		},
+		{
+			name:   "counts differ",
+			counts: map[string]int64{"public.customers": 2, "public.orders": 7},
+			actual: restored,
+			tables: checkPassed, rows: checkFailed,
+			rowFailures: []string{"public.orders: 5 rows, expected 7"},
+		},
+		{
+			name:   "table missing",
+			counts: map[string]int64{"public.customers": 2, "public.refunds": 0},
+			actual: restored,
+			tables: checkFailed, rows: checkPassed,
+			tableFailures: []string{"public.refunds"},
+		},
+		{
+			// count_rows is off by default; the tables whose sizes were
+			// recorded must still exist
+			name:   "only sizes recorded",
+			sizes:  map[string]int64{"public.customers": 8192, "public.orders": 16384},
+			actual: restored,
+			tables: checkPassed, rows: checkSkipped,
+		},
+		{
+			name:   "nothing restored",
+			sizes:  map[string]int64{"public.customers": 8192, "public.orders": 16384},
+			actual: map[tableKey]int64{},
+			tables: checkFailed, rows: checkSkipped,
+			tableFailures: []string{"public.customers", "public.orders"},
+		},
+		{
+			name:   "nothing recorded",
+			actual: restored,
+			tables: checkSkipped, rows: checkSkipped,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tables, rows := compareRowCounts(tt.counts, tt.sizes, tt.actual)
+			if tables.Status != tt.tables || !slices.Equal(tables.Failures, tt.tableFailures) {
+				t.Errorf("tables_exist = %s %q, want %s %q", tables.Status, tables.Failures, tt.tables, tt.tableFailures)
+			}
+			if rows.Status != tt.rows || !slices.Equal(rows.Failures, tt.rowFailures) {
+				t.Errorf("row_counts = %s %q, want %s %q", rows.Status, rows.Failures, tt.rows, tt.rowFailures)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// namePattern is a pg_dump name pattern compiled to anchored regular
+// expressions; schema is nil when a table pattern is not schema-qualified
+type namePattern struct {
+	text   string
+	schema *regexp.Regexp
+	name   *regexp.Regexp
+}
+
+// matches reports whether the pattern matches a table, or a schema when the
+// pattern is a schema pattern
+func (p namePattern) matches(schema, name string) bool {
+	if p.schema != nil && !p.schema.MatchString(schema) {
+		return false
+	}
+	return p.name.MatchString(name)
+}
+
+// compileNamePattern translates a pattern the way pg_dump does: outside double
+// quotes letters fold to lower case, * and ? are wildcards and a dot separates
+// the schema from the table; inside them every character is literal and ""
+// stands for a quote. Unqualified table patterns match tables in any schema,
+// a little more than pg_dump, which only looks at the search path.
+func compileNamePattern(pattern string, qualified bool) (namePattern, error) {
+	invalid := fmt.Errorf("%w: invalid name pattern %q", ErrInvalidOptions, pattern)
+
+	parts := []*strings.Builder{{}}
+	quoted := false
+	runes := []rune(strings.TrimSpace(pattern))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		current := parts[len(parts)-1]
+		switch {
+		case r == '"':
+			if quoted && i+1 < len(runes) && runes[i+1] == '"' {
+				current.WriteString(`"`)
+				i++
+				continue
+			}
+			quoted = !quoted
+		case quoted:
+			current.WriteString(regexp.QuoteMeta(string(r)))
+		case r == '.':
+			parts = append(parts, &strings.Builder{})
+		case r == '*':
+			current.WriteString(".*")
+		case r == '?':
+			current.WriteString(".")
+		default:
+			current.WriteString(regexp.QuoteMeta(strings.ToLower(string(r))))
+		}
+	}
+	if quoted || len(runes) == 0 {
+		return namePattern{}, invalid
+	}
+	if len(parts) > 2 || (len(parts) == 2 && !qualified) {
+		return namePattern{}, invalid
+	}
+
+	compiled := namePattern{text: pattern}
+	var err error
+	if compiled.name, err = regexp.Compile("^(?:" + parts[len(parts)-1].String() + ")$"); err != nil {
+		return namePattern{}, invalid
+	}
+	if len(parts) == 2 {
+		if compiled.schema, err = regexp.Compile("^(?:" + parts[0].String() + ")$"); err != nil {
+			return namePattern{}, invalid
+		}
+	}
+	return compiled, nil
+}
+
+// dumpFilters is a compiled SnapshotFilters
+type dumpFilters struct {
+	schemas          []namePattern
+	excludeSchemas   []namePattern
+	tables           []namePattern
+	excludeTables    []namePattern
+	excludeTableData []namePattern
+}
+
+// normalizeFilters trims the patterns of a filter set and drops empty and
+// repeated ones, returning nil when no filter remains
+func normalizeFilters(filters *models.SnapshotFilters) *models.SnapshotFilters {
+	if filters == nil {
+		return nil
+	}
+	normalized := &models.SnapshotFilters{
+		Schemas:          normalizePatterns(filters.Schemas),
+		ExcludeSchemas:   normalizePatterns(filters.ExcludeSchemas),
+		Tables:           normalizePatterns(filters.Tables),
+		ExcludeTables:    normalizePatterns(filters.ExcludeTables),
+		ExcludeTableData: normalizePatterns(filters.ExcludeTableData),
+	}
+	if len(normalized.Schemas)+len(normalized.ExcludeSchemas)+len(normalized.Tables)+
+		len(normalized.ExcludeTables)+len(normalized.ExcludeTableData) == 0 {
+		return nil
+	}
+	return normalized
+}
+
+func normalizePatterns(patterns []string) []string {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || seen[pattern] {
+			continue
+		}
+		seen[pattern] = true
+		normalized = append(normalized, pattern)
+	}
+	return normalized
+}
+
+// compileFilters compiles the patterns of a filter set; a nil set compiles to
+// one that keeps everything
+func compileFilters(filters *models.SnapshotFilters) (*dumpFilters, error) {
+	compiled := &dumpFilters{}
+	if filters == nil {
+		return compiled, nil
+	}
+
+	lists := []struct {
+		patterns  []string
+		qualified bool
+		into      *[]namePattern
+	}{
+		{filters.Schemas, false, &compiled.schemas},
+		{filters.ExcludeSchemas, false, &compiled.excludeSchemas},
+		{filters.Tables, true, &compiled.tables},
+		{filters.ExcludeTables, true, &compiled.excludeTables},
+		{filters.ExcludeTableData, true, &compiled.excludeTableData},
+	}
+	for _, list := range lists {
+		for _, pattern := range list.patterns {
+			p, err := compileNamePattern(pattern, list.qualified)
+			if err != nil {
+				return nil, err
+			}
+			*list.into = append(*list.into, p)
+		}
+	}
+	return compiled, nil
+}
+
+func matchesAny(patterns []namePattern, schema, name string) bool {
+	for _, p := range patterns {
+		if p.matches(schema, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// includesTable reports whether pg_dump dumps a table, and whether it dumps
+// its rows. As in pg_dump, table patterns select tables regardless of the
+// schema patterns.
+func (f *dumpFilters) includesTable(schema, name string) (included, withData bool) {
+	if len(f.tables) > 0 {
+		included = matchesAny(f.tables, schema, name)
+	} else {
+		included = (len(f.schemas) == 0 || matchesAny(f.schemas, "", schema)) &&
+			!matchesAny(f.excludeSchemas, "", schema)
+	}
+	if !included || matchesAny(f.excludeTables, schema, name) {
+		return false, false
+	}
+	return true, !matchesAny(f.excludeTableData, schema, name)
+}
+
+// filterArgs returns the pg_dump switches for a filter set
+func filterArgs(filters *models.SnapshotFilters) []string {
+	if filters == nil {
+		return nil
+	}
+
+	var args []string
+	add := func(flag string, patterns []string) {
+		for _, pattern := range patterns {
+			args = append(args, fmt.Sprintf("%s=%s", flag, pattern))
+		}
+	}
+	add("--schema", filters.Schemas)
+	add("--exclude-schema", filters.ExcludeSchemas)
+	add("--table", filters.Tables)
+	add("--exclude-table", filters.ExcludeTables)
+	add("--exclude-table-data", filters.ExcludeTableData)
+	return args
+}
+
+// validateFilters checks that every pattern of a filter set matches a schema
+// or relation of the live database, so a misspelt name fails the request
+// instead of silently dumping too much or too little
+func (ss *SnapshotService) validateFilters(config *models.DatabaseConnection, filters *models.SnapshotFilters) error {
+	compiled, err := compileFilters(filters)
+	if err != nil {
+		return err
+	}
+
+	info, err := ss.dbService.GetDatabaseInfo(config)
+	if err != nil {
+		return fmt.Errorf("failed to read the catalog to check filters: %w", err)
+	}
+	relations, err := ss.dbService.listRelations(config)
+	if err != nil {
+		return fmt.Errorf("failed to read the catalog to check filters: %w", err)
+	}
+	return checkFilterMatches(compiled, config.Database, info.Schemas, relations)
+}
+
+// checkFilterMatches checks the patterns of a filter set against the schemas
+// and relations of a database. Like pg_dump, table patterns match any
+// relation it can dump, not only plain tables.
+func checkFilterMatches(compiled *dumpFilters, database string, schemas []string, relations []tableKey) error {
+	for _, p := range slices.Concat(compiled.schemas, compiled.excludeSchemas) {
+		found := false
+		for _, schema := range schemas {
+			if p.matches("", schema) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: schema pattern %q matches no schema in %s", ErrInvalidOptions, p.text, database)
+		}
+	}
+
+	for _, p := range slices.Concat(compiled.tables, compiled.excludeTables, compiled.excludeTableData) {
+		found := false
+		for _, relation := range relations {
+			if p.matches(relation.schema, relation.name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: table pattern %q matches no table in %s", ErrInvalidOptions, p.text, database)
+		}
+	}
+
+	return nil
+}
+
+// filterRowCounts drops the tables a filter set leaves out of the dump from
+// row counts taken over the whole database; tables dumped without their data
+// are expected to restore empty
+func filterRowCounts(counts map[tableKey]int64, filters *dumpFilters) {
+	for key := range counts {
+		included, withData := filters.includesTable(key.schema, key.name)
+		switch {
+		case !included:
+			delete(counts, key)
+		case !withData:
+			counts[key] = 0
+		}
+	}
+}
+
+// dumpedTableSizes returns the sizes of the tables a filter set keeps in the
+// dump, or nil when no sizes were read
+func dumpedTableSizes(tables []models.TableStats, filters *dumpFilters) map[tableKey]int64 {
+	if len(tables) == 0 {
+		return nil
+	}
+	sizes := make(map[tableKey]int64, len(tables))
+	for _, table := range tables {
+		if included, _ := filters.includesTable(table.Schema, table.Name); included {
+			sizes[tableKey{schema: table.Schema, name: table.Name}] = table.SizeBytes
+		}
+	}
+	return sizes
+}
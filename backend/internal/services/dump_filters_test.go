@@ -0,0 +1,197 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+func TestCompileNamePattern(t *testing.T) {
+	type name struct{ schema, name string }
+	tests := []struct {
+		pattern   string
+		qualified bool
+		match     []name
+		noMatch   []name
+	}{
+		{
+			pattern: "orders", qualified: true,
+			match:   []name{{"public", "orders"}, {"sales", "orders"}},
+			noMatch: []name{{"public", "Orders"}, {"public", "orders2"}, {"public", "my_orders"}},
+		},
+		{
+			pattern: "Orders", qualified: true,
+			match:   []name{{"public", "orders"}},
+			noMatch: []name{{"public", "Orders"}},
+		},
+		{
+			pattern: `"Orders"`, qualified: true,
+			match:   []name{{"public", "Orders"}},
+			noMatch: []name{{"public", "orders"}},
+		},
+		{
+			pattern: "  public.orders ", qualified: true,
+			match:   []name{{"public", "orders"}},
+			noMatch: []name{{"sales", "orders"}, {"public", "public.orders"}},
+		},
+		{
+			pattern: `Sales."Order Items"`, qualified: true,
+			match:   []name{{"sales", "Order Items"}},
+			noMatch: []name{{"Sales", "Order Items"}, {"sales", "order items"}},
+		},
+		{
+			// A dot inside quotes is part of the name
+			pattern: `"my.schema"."my table"`, qualified: true,
+			match:   []name{{"my.schema", "my table"}},
+			noMatch: []name{{"my", "schema"}},
+		},
+		{
+			pattern: `"orders.2024"`, qualified: true,
+			match:   []name{{"public", "orders.2024"}},
+			noMatch: []name{{"orders", "2024"}},
+		},
+		{
+			pattern: `"say ""hi"""`, qualified: true,
+			match:   []name{{"public", `say "hi"`}},
+			noMatch: []name{{"public", "say hi"}, {"public", `say ""hi""`}},
+		},
+		{
+			pattern: `"a""b"c`, qualified: true,
+			match:   []name{{"public", `a"bc`}},
+			noMatch: []name{{"public", `a"bC`}},
+		},
+		{
+			pattern: "order?", qualified: true,
+			match:   []name{{"public", "orders"}, {"public", "order_"}},
+			noMatch: []name{{"public", "order"}, {"public", "orders2"}},
+		},
+		{
+			pattern: "*.ORD*", qualified: true,
+			match:   []name{{"public", "ord"}, {"sales", "ordinal"}, {"", "orders"}},
+			noMatch: []name{{"public", "words"}, {"public", "Orders"}},
+		},
+		{
+			pattern: "public.*", qualified: true,
+			match:   []name{{"public", "orders"}, {"public", "Order Items"}},
+			noMatch: []name{{"sales", "orders"}, {"public2", "orders"}},
+		},
+		{
+			// Wildcards and regular expression characters are literal inside quotes
+			pattern: `"ord*"`, qualified: true,
+			match:   []name{{"public", "ord*"}},
+			noMatch: []name{{"public", "orders"}},
+		},
+		{
+			pattern: "a+b|c", qualified: true,
+			match:   []name{{"public", "a+b|c"}},
+			noMatch: []name{{"public", "aab"}, {"public", "c"}},
+		},
+		{
+			pattern: "Sales", qualified: false,
+			match:   []name{{"", "sales"}},
+			noMatch: []name{{"", "Sales"}, {"", "sales2"}},
+		},
+		{
+			pattern: `"Sales"`, qualified: false,
+			match:   []name{{"", "Sales"}},
+			noMatch: []name{{"", "sales"}},
+		},
+		{
+			pattern: "tenant_*", qualified: false,
+			match:   []name{{"", "tenant_1"}, {"", "tenant_"}},
+			noMatch: []name{{"", "tenant"}, {"", "my_tenant_1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			p, err := compileNamePattern(tt.pattern, tt.qualified)
+			if err != nil {
+				t.Fatalf("compileNamePattern: %v", err)
+			}
+			if p.text != tt.pattern {
+				t.Errorf("text = %q, want %q", p.text, tt.pattern)
+			}
+			for _, n := range tt.match {
+				if !p.matches(n.schema, n.name) {
+					t.Errorf("does not match %q.%q", n.schema, n.name)
+				}
+			}
+			for _, n := range tt.noMatch {
+				if p.matches(n.schema, n.name) {
+					t.Errorf("matches %q.%q", n.schema, n.name)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileNamePatternRejectsInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		qualified bool
+	}{
+		{"", true},
+		{"   ", true},
+		{`"unterminated`, true},
+		{`public."orders`, true},
+		{`"say ""hi""`, true},
+		{"db.public.orders", true},
+		{`a.b."c.d".e`, true},
+		{"public.orders", false},
+		{`"public".orders`, false},
+	}
+	for _, tt := range tests {
+		if _, err := compileNamePattern(tt.pattern, tt.qualified); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("compileNamePattern(%q, %v) error = %v, want ErrInvalidOptions", tt.pattern, tt.qualified, err)
+		}
+	}
+}
+
+func TestCheckFilterMatches(t *testing.T) {
+	schemas := []string{"public", "audit"}
+	// Everything pg_dump's table patterns select, as listRelations reads it
+	relations := []tableKey{
+		{"public", "orders"},        // table
+		{"audit", "events"},         // partitioned table
+		{"audit", "events_2026_10"}, // one of its partitions
+		{"public", "order_totals"},  // view
+		{"public", "daily_sales"},   // materialized view
+		{"public", "orders_id_seq"}, // sequence
+		{"public", "remote_stock"},  // foreign table
+	}
+
+	tests := []struct {
+		name    string
+		filters models.SnapshotFilters
+		valid   bool
+	}{
+		{"table", models.SnapshotFilters{Tables: []string{"public.orders"}}, true},
+		{"partitioned parent without data", models.SnapshotFilters{ExcludeTableData: []string{"audit.events"}}, true},
+		{"view", models.SnapshotFilters{ExcludeTables: []string{"order_totals"}}, true},
+		{"materialized view", models.SnapshotFilters{ExcludeTableData: []string{"public.daily_sales"}}, true},
+		{"sequence", models.SnapshotFilters{Tables: []string{"orders_id_seq"}}, true},
+		{"foreign table", models.SnapshotFilters{ExcludeTables: []string{"remote_stock"}}, true},
+		{"schema", models.SnapshotFilters{Schemas: []string{"audit"}, ExcludeSchemas: []string{"pub*"}}, true},
+		{"missing table", models.SnapshotFilters{Tables: []string{"public.events"}}, false},
+		{"missing schema", models.SnapshotFilters{ExcludeSchemas: []string{"sales"}}, false},
+		{"one pattern of several missing", models.SnapshotFilters{ExcludeTableData: []string{"audit.events", "audit.logins"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := compileFilters(&tt.filters)
+			if err != nil {
+				t.Fatalf("compileFilters: %v", err)
+			}
+			err = checkFilterMatches(compiled, "shop", schemas, relations)
+			if tt.valid && err != nil {
+				t.Errorf("checkFilterMatches: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("checkFilterMatches error = %v, want ErrInvalidOptions", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// ErrInvalidOptions is returned when the options of a snapshot or restore
+// request cannot be combined
+var ErrInvalidOptions = errors.New("invalid options")
+
+// Dump formats accepted in snapshot requests, matching pg_dump --format
+const (
+	FormatPlain     = "plain"
+	FormatCustom    = "custom"
+	FormatDirectory = "directory"
+	FormatTar       = "tar"
+)
+
+// dumpFormatExtensions maps each format to the suffix of its snapshot path;
+// directory-format snapshots are a directory without a suffix
+var dumpFormatExtensions = map[string]string{
+	FormatPlain:     ".sql",
+	FormatCustom:    ".dump",
+	FormatDirectory: "",
+	FormatTar:       ".tar",
+}
+
+// normalizeFormat defaults an empty format to plain and rejects unknown ones
+func normalizeFormat(format string) (string, error) {
+	if format == "" {
+		return FormatPlain, nil
+	}
+	if _, ok := dumpFormatExtensions[format]; !ok {
+		return "", fmt.Errorf("%w: unsupported dump format: %s", ErrInvalidOptions, format)
+	}
+	return format, nil
+}
+
+// dumpFormatForJobs resolves the format of a dump run with the given number of
+// parallel jobs: pg_dump -j only writes directory-format archives, so that
+// format is picked when none was requested and any other one is rejected
+func dumpFormatForJobs(format string, jobs int) (string, error) {
+	if jobs <= 1 {
+		return normalizeFormat(format)
+	}
+	if format != "" && format != FormatDirectory {
+		return "", fmt.Errorf("%w: parallel_jobs requires the directory format, got %s", ErrInvalidOptions, format)
+	}
+	return FormatDirectory, nil
+}
+
+// Dump modes accepted in snapshot requests
+const (
+	ModeFull       = "full"        // schema and data
+	ModeSchemaOnly = "schema_only" // pg_dump --schema-only
+	ModeDataOnly   = "data_only"   // pg_dump --data-only
+)
+
+// dumpModeFlags maps each mode to the pg_dump flag that selects it
+var dumpModeFlags = map[string]string{
+	ModeFull:       "",
+	ModeSchemaOnly: "--schema-only",
+	ModeDataOnly:   "--data-only",
+}
+
+// normalizeMode defaults an empty mode to full and rejects unknown ones
+func normalizeMode(mode string) (string, error) {
+	if mode == "" {
+		return ModeFull, nil
+	}
+	if _, ok := dumpModeFlags[mode]; !ok {
+		return "", fmt.Errorf("%w: unsupported dump mode: %s", ErrInvalidOptions, mode)
+	}
+	return mode, nil
+}
+
+// snapshotMode returns the mode of a snapshot; snapshots recorded before
+// modes existed hold schema and data
+func snapshotMode(snapshot *models.Snapshot) string {
+	if snapshot.Mode == "" {
+		return ModeFull
+	}
+	return snapshot.Mode
+}
+
+// isSchemaSource reports whether the schema of a database can be restored
+// from a snapshot on its own: schema-only snapshots, and full archives, which
+// pg_restore --schema-only can read the schema from
+func isSchemaSource(snapshot *models.Snapshot) bool {
+	switch snapshotMode(snapshot) {
+	case ModeSchemaOnly:
+		return true
+	case ModeFull:
+		return isArchiveFormat(snapshot.Format)
+	}
+	return false
+}
+
+// supportsParallelRestore reports whether pg_restore can load a snapshot with
+// several jobs; it needs random access to the archive, which tar and plain
+// SQL dumps do not offer and streamed snapshots lose
+func supportsParallelRestore(snapshot *models.Snapshot) bool {
+	format := snapshotFormat(snapshot.Format)
+	return (format == FormatCustom || format == FormatDirectory) && !isStreamed(snapshot)
+}
+
+// snapshotFormat returns the format of a snapshot; snapshots recorded before
+// formats existed are plain SQL
+func snapshotFormat(format string) string {
+	if format == "" {
+		return FormatPlain
+	}
+	return format
+}
+
+// isArchiveFormat reports whether a format is restored with pg_restore rather than psql
+func isArchiveFormat(format string) bool {
+	return snapshotFormat(format) != FormatPlain
+}
+
+// pathSize returns the size of a file, or the total size of the files in a directory
+func pathSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if !info.IsDir() {
+		return info.Size(), nil
+	}
+
+	var total int64
+	err = filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+func TestNormalizeFormat(t *testing.T) {
+	tests := []struct {
+		format, want string
+		archive      bool
+	}{
+		{"", FormatPlain, false},
+		{FormatPlain, FormatPlain, false},
+		{FormatCustom, FormatCustom, true},
+		{FormatDirectory, FormatDirectory, true},
+		{FormatTar, FormatTar, true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeFormat(tt.format)
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeFormat(%q) = %q, %v, want %q", tt.format, got, err, tt.want)
+		}
+		if archive := isArchiveFormat(tt.format); archive != tt.archive {
+			t.Errorf("isArchiveFormat(%q) = %v, want %v", tt.format, archive, tt.archive)
+		}
+	}
+
+	if _, err := normalizeFormat("zip"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("normalizeFormat(zip) error = %v, want ErrInvalidOptions", err)
+	}
+}
+
+func TestDumpFormatForJobs(t *testing.T) {
+	tests := []struct {
+		format string
+		jobs   int
+		want   string
+	}{
+		{"", 0, FormatPlain},
+		{FormatCustom, 1, FormatCustom},
+		// pg_dump -j only writes directory archives
+		{"", 4, FormatDirectory},
+		{FormatDirectory, 4, FormatDirectory},
+	}
+	for _, tt := range tests {
+		got, err := dumpFormatForJobs(tt.format, tt.jobs)
+		if err != nil || got != tt.want {
+			t.Errorf("dumpFormatForJobs(%q, %d) = %q, %v, want %q", tt.format, tt.jobs, got, err, tt.want)
+		}
+	}
+
+	for _, format := range []string{FormatPlain, FormatCustom, FormatTar} {
+		if _, err := dumpFormatForJobs(format, 4); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("dumpFormatForJobs(%q, 4) error = %v, want ErrInvalidOptions", format, err)
+		}
+	}
+}
+
+func TestSupportsParallelRestore(t *testing.T) {
+	tests := []struct {
+		snapshot models.Snapshot
+		want     bool
+	}{
+		{models.Snapshot{Format: FormatCustom}, true},
+		{models.Snapshot{Format: FormatDirectory, Storage: StorageLocal}, true},
+		{models.Snapshot{Format: FormatCustom, Compression: CompressionNone}, true},
+		{models.Snapshot{}, false},
+		{models.Snapshot{Format: FormatTar}, false},
+		// Streamed snapshots cannot be read at random
+		{models.Snapshot{Format: FormatCustom, Compression: CompressionZstd}, false},
+		{models.Snapshot{Format: FormatCustom, Encryption: &models.SnapshotEncryption{}}, false},
+		{models.Snapshot{Format: FormatCustom, Storage: "s3"}, false},
+	}
+	for _, tt := range tests {
+		if got := supportsParallelRestore(&tt.snapshot); got != tt.want {
+			t.Errorf("supportsParallelRestore(%+v) = %v, want %v", tt.snapshot, got, tt.want)
+		}
+	}
+}
+
+func TestPathSize(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "shop.dump")
+	if err := os.WriteFile(file, make([]byte, 100), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "shop", "nested"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"toc.dat": 40, "3402.dat": 60, "nested/3403.dat": 5} {
+		if err := os.WriteFile(filepath.Join(dir, "shop", name), make([]byte, size), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, err := pathSize(file); err != nil || got != 100 {
+		t.Errorf("pathSize of a file = %d, %v, want 100", got, err)
+	}
+	if got, err := pathSize(filepath.Join(dir, "shop")); err != nil || got != 105 {
+		t.Errorf("pathSize of a directory = %d, %v, want 105", got, err)
+	}
+}
+
+func TestDatabaseStatementFilter(t *testing.T) {
+	dump := strings.Join([]string{
+		"SET statement_timeout = 0;",
+		"DROP DATABASE shop;",
+		"CREATE DATABASE shop WITH TEMPLATE = template0;",
+		"ALTER DATABASE shop OWNER TO postgres;",
+		"COMMENT ON DATABASE shop IS 'orders';",
+		`\connect shop`,
+		"CREATE TABLE public.notes (body text);",
+		"COPY public.notes (body) FROM stdin;",
+		"DROP DATABASE shop;",
+		`\connect shop`,
+		`\.`,
+		"ALTER TABLE public.notes OWNER TO postgres;",
+		"-- no newline at the end",
+	}, "\r\n")
+
+	got, err := io.ReadAll(newDatabaseStatementFilter(strings.NewReader(dump)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// COPY data is passed through even when it looks like a statement
+	want := strings.Join([]string{
+		"SET statement_timeout = 0;",
+		"CREATE TABLE public.notes (body text);",
+		"COPY public.notes (body) FROM stdin;",
+		"DROP DATABASE shop;",
+		`\connect shop`,
+		`\.`,
+		"ALTER TABLE public.notes OWNER TO postgres;",
+		"-- no newline at the end",
+	}, "\r\n")
+	if string(got) != want {
+		t.Errorf("filtered dump =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNormalizeMode(t *testing.T) {
+	for mode, want := range map[string]string{
+		"":             ModeFull,
+		ModeFull:       ModeFull,
+		ModeSchemaOnly: ModeSchemaOnly,
+		ModeDataOnly:   ModeDataOnly,
+	} {
+		if got, err := normalizeMode(mode); err != nil || got != want {
+			t.Errorf("normalizeMode(%q) = %q, %v, want %q", mode, got, err, want)
+		}
+	}
+	if _, err := normalizeMode("roles_only"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("normalizeMode(roles_only) error = %v, want ErrInvalidOptions", err)
+	}
+}
+
+func TestIsSchemaSource(t *testing.T) {
+	tests := []struct {
+		snapshot models.Snapshot
+		want     bool
+	}{
+		{models.Snapshot{Mode: ModeSchemaOnly}, true},
+		{models.Snapshot{Mode: ModeSchemaOnly, Format: FormatCustom}, true},
+		{models.Snapshot{Mode: ModeFull, Format: FormatCustom}, true},
+		{models.Snapshot{Format: FormatTar}, true},
+		// pg_restore cannot split the schema out of a plain SQL script
+		{models.Snapshot{}, false},
+		{models.Snapshot{Mode: ModeFull, Format: FormatPlain}, false},
+		{models.Snapshot{Mode: ModeDataOnly, Format: FormatCustom}, false},
+	}
+	for _, tt := range tests {
+		if got := isSchemaSource(&tt.snapshot); got != tt.want {
+			t.Errorf("isSchemaSource(mode %q, format %q) = %v, want %v", tt.snapshot.Mode, tt.snapshot.Format, got, tt.want)
+		}
+	}
+}
+
+func TestRestoreSchemaSource(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	for _, snapshot := range []*models.Snapshot{
+		{ID: "schema", Status: "completed", Mode: ModeSchemaOnly},
+		{ID: "full-custom", Status: "completed", Format: FormatCustom},
+		{ID: "full-plain", Status: "completed"},
+		{ID: "schema-failed", Status: "failed", Mode: ModeSchemaOnly},
+	} {
+		if err := ss.catalog.Create(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	full := &models.Snapshot{ID: "full"}
+	dataOnly := &models.Snapshot{ID: "data", Mode: ModeDataOnly}
+
+	tests := []struct {
+		snapshot       *models.Snapshot
+		schemaSnapshot string
+		want           string
+		wantErr        error
+	}{
+		{full, "", "", nil},
+		{full, "schema", "", ErrInvalidOptions},
+		{dataOnly, "", "", ErrInvalidOptions},
+		{dataOnly, "schema", "schema", nil},
+		{dataOnly, "full-custom", "full-custom", nil},
+		{dataOnly, "full-plain", "", ErrInvalidOptions},
+		{dataOnly, "schema-failed", "", ErrSnapshotNotRestorable},
+		{dataOnly, "missing", "", ErrSnapshotNotFound},
+	}
+	for _, tt := range tests {
+		got, err := ss.restoreSchemaSource(tt.snapshot, tt.schemaSnapshot)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("restoreSchemaSource(%s, %q) error = %v, want %v", tt.snapshot.ID, tt.schemaSnapshot, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("restoreSchemaSource(%s, %q): %v", tt.snapshot.ID, tt.schemaSnapshot, err)
+			continue
+		}
+		var gotID string
+		if got != nil {
+			gotID = got.ID
+		}
+		if gotID != tt.want {
+			t.Errorf("restoreSchemaSource(%s, %q) = %q, want %q", tt.snapshot.ID, tt.schemaSnapshot, gotID, tt.want)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package services
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"PGTimeMachine-Backend/internal/models"
+
+	"filippo.io/age"
+)
+
+// Encryption methods accepted in snapshot requests: the data key of each
+// snapshot is wrapped either by the server master key or for a list of age
+// X25519 recipients
+const (
+	EncryptionNone   = "none"
+	EncryptionMaster = "master"
+	EncryptionAge    = "age"
+)
+
+// snapshotCipher is the cipher recorded with encrypted snapshots
+const snapshotCipher = "aes-256-gcm"
+
+// encryptedExtension is appended to the path of encrypted snapshots
+const encryptedExtension = ".enc"
+
+// SnapshotKeys creates, wraps and unwraps the per-snapshot data keys of
+// encrypted snapshots
+type SnapshotKeys struct {
+	keyRing       *KeyRing
+	defaultMethod string
+	recipients    []string
+	identities    []age.Identity
+}
+
+// NewSnapshotKeys configures snapshot encryption from the environment:
+// SNAPSHOT_ENCRYPTION is the method used when a request names none,
+// AGE_RECIPIENTS the default recipients (comma separated) and
+// AGE_IDENTITY_FILE the age identities used to restore age-wrapped snapshots.
+func NewSnapshotKeys(keyRing *KeyRing) (*SnapshotKeys, error) {
+	sk := &SnapshotKeys{
+		keyRing:       keyRing,
+		defaultMethod: strings.TrimSpace(os.Getenv("SNAPSHOT_ENCRYPTION")),
+	}
+	if sk.defaultMethod == "" {
+		sk.defaultMethod = EncryptionNone
+	}
+
+	for _, recipient := range strings.Split(os.Getenv("AGE_RECIPIENTS"), ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			sk.recipients = append(sk.recipients, recipient)
+		}
+	}
+	if _, err := parseRecipients(sk.recipients); err != nil {
+		return nil, fmt.Errorf("invalid AGE_RECIPIENTS: %w", err)
+	}
+
+	switch sk.defaultMethod {
+	case EncryptionNone, EncryptionMaster:
+	case EncryptionAge:
+		if len(sk.recipients) == 0 {
+			return nil, errors.New("SNAPSHOT_ENCRYPTION=age requires AGE_RECIPIENTS")
+		}
+	default:
+		return nil, fmt.Errorf("invalid SNAPSHOT_ENCRYPTION: %s", sk.defaultMethod)
+	}
+
+	if path := os.Getenv("AGE_IDENTITY_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open AGE_IDENTITY_FILE: %w", err)
+		}
+		defer file.Close()
+		if sk.identities, err = age.ParseIdentities(file); err != nil {
+			return nil, fmt.Errorf("invalid AGE_IDENTITY_FILE: %w", err)
+		}
+	}
+
+	return sk, nil
+}
+
+// parseRecipients parses age X25519 recipients (age1...)
+func parseRecipients(recipients []string) ([]age.Recipient, error) {
+	parsed := make([]age.Recipient, 0, len(recipients))
+	for _, recipient := range recipients {
+		r, err := age.ParseX25519Recipient(recipient)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+// normalize resolves the encryption method and recipients of a snapshot
+// request, falling back to the server defaults. Like compression, encryption
+// streams pg_dump's output, which directory-format dumps do not have, so they
+// are only taken when the request or the server default asks for none.
+func (sk *SnapshotKeys) normalize(method string, recipients []string, format string) (string, []string, error) {
+	if method == "" {
+		method = sk.defaultMethod
+	}
+
+	switch method {
+	case EncryptionNone:
+		if len(recipients) > 0 {
+			return "", nil, fmt.Errorf("%w: age_recipients requires age encryption", ErrInvalidOptions)
+		}
+		return EncryptionNone, nil, nil
+	case EncryptionMaster:
+		if len(recipients) > 0 {
+			return "", nil, fmt.Errorf("%w: age_recipients requires age encryption", ErrInvalidOptions)
+		}
+	case EncryptionAge:
+		if len(recipients) == 0 {
+			recipients = sk.recipients
+		}
+		if len(recipients) == 0 {
+			return "", nil, fmt.Errorf("%w: age encryption requires age_recipients", ErrInvalidOptions)
+		}
+		if _, err := parseRecipients(recipients); err != nil {
+			return "", nil, fmt.Errorf("%w: invalid age recipient: %v", ErrInvalidOptions, err)
+		}
+	default:
+		return "", nil, fmt.Errorf("%w: unsupported encryption: %s", ErrInvalidOptions, method)
+	}
+
+	if format == FormatDirectory {
+		return "", nil, fmt.Errorf("%w: %s encryption is not supported for directory format snapshots (including parallel_jobs); request encryption \"none\" to take one unencrypted", ErrInvalidOptions, method)
+	}
+	return method, recipients, nil
+}
+
+// newDataKey generates a data key for one snapshot and wraps it with the
+// given method. The key IDs recorded with the snapshot name the master key or
+// the age recipients able to unwrap it.
+func (sk *SnapshotKeys) newDataKey(method string, recipients []string) ([]byte, *models.SnapshotEncryption, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	encryption := &models.SnapshotEncryption{Method: method, Cipher: snapshotCipher}
+	switch method {
+	case EncryptionMaster:
+		wrapped, err := sk.keyRing.Seal(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to wrap data key: %w", err)
+		}
+		encryption.WrappedKey = wrapped
+		encryption.KeyIDs = []string{sk.keyRing.CurrentKeyID()}
+	case EncryptionAge:
+		parsed, err := parseRecipients(recipients)
+		if err != nil {
+			return nil, nil, err
+		}
+		var wrapped bytes.Buffer
+		w, err := age.Encrypt(&wrapped, parsed...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to wrap data key: %w", err)
+		}
+		if _, err := w.Write(key); err != nil {
+			return nil, nil, fmt.Errorf("failed to wrap data key: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, nil, fmt.Errorf("failed to wrap data key: %w", err)
+		}
+		encryption.WrappedKey = base64.StdEncoding.EncodeToString(wrapped.Bytes())
+		encryption.KeyIDs = recipients
+	default:
+		return nil, nil, fmt.Errorf("unsupported encryption: %s", method)
+	}
+
+	return key, encryption, nil
+}
+
+// unwrap recovers the data key of an encrypted snapshot
+func (sk *SnapshotKeys) unwrap(encryption *models.SnapshotEncryption) ([]byte, error) {
+	switch encryption.Method {
+	case EncryptionMaster:
+		return sk.keyRing.Open(encryption.WrappedKey)
+	case EncryptionAge:
+		if len(sk.identities) == 0 {
+			return nil, errors.New("snapshot is encrypted with age but AGE_IDENTITY_FILE is not configured")
+		}
+		wrapped, err := base64.StdEncoding.DecodeString(encryption.WrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("malformed wrapped data key: %w", err)
+		}
+		r, err := age.Decrypt(bytes.NewReader(wrapped), sk.identities...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+		}
+		return io.ReadAll(r)
+	}
+	return nil, fmt.Errorf("unsupported encryption: %s", encryption.Method)
+}
+
+// rewrap wraps the data key of a master-key snapshot with the current master
+// key, so the key it was wrapped with can be retired without touching the
+// snapshot file. It reports whether anything changed.
+func (sk *SnapshotKeys) rewrap(encryption *models.SnapshotEncryption) (bool, error) {
+	if encryption.Method != EncryptionMaster || sealedKeyID(encryption.WrappedKey) == sk.keyRing.CurrentKeyID() {
+		return false, nil
+	}
+
+	key, err := sk.keyRing.Open(encryption.WrappedKey)
+	if err != nil {
+		return false, err
+	}
+	wrapped, err := sk.keyRing.Seal(key)
+	if err != nil {
+		return false, err
+	}
+	encryption.WrappedKey = wrapped
+	encryption.KeyIDs = []string{sk.keyRing.CurrentKeyID()}
+	return true, nil
+}
+
+// Encrypted snapshot files start with a magic string and a random nonce
+// prefix, followed by length-prefixed AES-256-GCM chunks. Each chunk's nonce
+// is the prefix followed by the chunk counter, and the last chunk is
+// authenticated as such so a truncated file fails to decrypt.
+const (
+	encryptedMagic      = "PGTMENC1"
+	encryptedPrefixSize = 4
+	encryptedChunkSize  = 64 * 1024
+)
+
+var (
+	chunkNotFinal = []byte{0}
+	chunkFinal    = []byte{1}
+)
+
+// encryptingWriter encrypts everything written to it into w
+type encryptingWriter struct {
+	w       io.Writer
+	gcm     cipher.AEAD
+	prefix  []byte
+	counter uint64
+	buf     []byte
+	header  bool
+}
+
+// newEncryptingWriter encrypts into w with the given data key; Close writes
+// the final chunk but does not close w
+func newEncryptingWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, encryptedPrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return &encryptingWriter{w: w, gcm: gcm, prefix: prefix, buf: make([]byte, 0, encryptedChunkSize)}, nil
+}
+
+func (ew *encryptingWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), encryptedChunkSize-len(ew.buf))
+		ew.buf = append(ew.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(ew.buf) == encryptedChunkSize {
+			if err := ew.writeChunk(chunkNotFinal); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the final chunk
+func (ew *encryptingWriter) Close() error {
+	return ew.writeChunk(chunkFinal)
+}
+
+// writeChunk encrypts the buffered plaintext as the next chunk
+func (ew *encryptingWriter) writeChunk(final []byte) error {
+	if !ew.header {
+		if _, err := io.WriteString(ew.w, encryptedMagic); err != nil {
+			return err
+		}
+		if _, err := ew.w.Write(ew.prefix); err != nil {
+			return err
+		}
+		ew.header = true
+	}
+
+	sealed := ew.gcm.Seal(nil, chunkNonce(ew.prefix, ew.counter), ew.buf, final)
+	ew.counter++
+	ew.buf = ew.buf[:0]
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+	if _, err := ew.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := ew.w.Write(sealed)
+	return err
+}
+
+// decryptingReader decrypts a stream written by encryptingWriter
+type decryptingReader struct {
+	r       io.Reader
+	gcm     cipher.AEAD
+	prefix  []byte
+	counter uint64
+	pending []byte
+	done    bool
+}
+
+// newDecryptingReader reads the header of an encrypted snapshot from r and
+// returns a reader of its plaintext
+func newDecryptingReader(r io.Reader, key []byte) (io.Reader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, len(encryptedMagic)+encryptedPrefixSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	if string(header[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, errors.New("snapshot file is not encrypted")
+	}
+	return &decryptingReader{r: r, gcm: gcm, prefix: header[len(encryptedMagic):]}, nil
+}
+
+func (dr *decryptingReader) Read(p []byte) (int, error) {
+	for len(dr.pending) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.pending)
+	dr.pending = dr.pending[n:]
+	return n, nil
+}
+
+// readChunk decrypts the next chunk into pending
+func (dr *decryptingReader) readChunk() error {
+	var length [4]byte
+	if _, err := io.ReadFull(dr.r, length[:]); err != nil {
+		if err == io.EOF {
+			return errors.New("encrypted snapshot is truncated")
+		}
+		return err
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if size > encryptedChunkSize+uint32(dr.gcm.Overhead()) {
+		return errors.New("encrypted snapshot is corrupt")
+	}
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(dr.r, sealed); err != nil {
+		return fmt.Errorf("encrypted snapshot is truncated: %w", err)
+	}
+
+	nonce := chunkNonce(dr.prefix, dr.counter)
+	plaintext, err := dr.gcm.Open(nil, nonce, sealed, chunkNotFinal)
+	if err != nil {
+		if plaintext, err = dr.gcm.Open(nil, nonce, sealed, chunkFinal); err != nil {
+			return errors.New("failed to decrypt snapshot: wrong key or corrupt file")
+		}
+		dr.done = true
+		// Nothing may follow the final chunk
+		if n, _ := dr.r.Read(length[:1]); n > 0 {
+			return errors.New("encrypted snapshot has trailing data")
+		}
+	}
+	dr.counter++
+	dr.pending = plaintext
+	return nil
+}
+
+// chunkNonce builds the nonce of a chunk from the stream prefix and its counter
+func chunkNonce(prefix []byte, counter uint64) []byte {
+	nonce := make([]byte, len(prefix)+8)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint64(nonce[len(prefix):], counter)
+	return nonce
+}
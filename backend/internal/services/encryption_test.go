@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func testDataKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// encryptForTest encrypts plaintext, handing it to the writer in writes of
+// at most writeSize bytes
+func encryptForTest(t *testing.T, key, plaintext []byte, writeSize int) []byte {
+	t.Helper()
+	var encrypted bytes.Buffer
+	w, err := newEncryptingWriter(&encrypted, key)
+	if err != nil {
+		t.Fatalf("newEncryptingWriter: %v", err)
+	}
+	for rest := plaintext; len(rest) > 0; {
+		n := min(len(rest), writeSize)
+		if written, err := w.Write(rest[:n]); err != nil || written != n {
+			t.Fatalf("Write = %d, %v, want %d", written, err, n)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return encrypted.Bytes()
+}
+
+func decryptForTest(key, encrypted []byte) ([]byte, error) {
+	r, err := newDecryptingReader(bytes.NewReader(encrypted), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	key := testDataKey(t)
+	sizes := []int{
+		0,
+		1,
+		encryptedChunkSize - 1,
+		encryptedChunkSize,
+		encryptedChunkSize + 1,
+		2*encryptedChunkSize - 1,
+		3 * encryptedChunkSize,
+		3*encryptedChunkSize + 12345,
+	}
+	writeSizes := []int{1 << 30, encryptedChunkSize, 1000, 7}
+
+	for _, size := range sizes {
+		plaintext := make([]byte, size)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+		for _, writeSize := range writeSizes {
+			if writeSize == 7 && size > 2*encryptedChunkSize {
+				continue
+			}
+			encrypted := encryptForTest(t, key, plaintext, writeSize)
+
+			// The header, then one chunk per full chunk of plaintext and a
+			// final chunk holding the rest, possibly nothing
+			chunks := size/encryptedChunkSize + 1
+			wantSize := len(encryptedMagic) + encryptedPrefixSize + size + chunks*(4+16)
+			if len(encrypted) != wantSize {
+				t.Errorf("size %d, writes of %d: encrypted to %d bytes, want %d", size, writeSize, len(encrypted), wantSize)
+			}
+
+			decrypted, err := decryptForTest(key, encrypted)
+			if err != nil {
+				t.Fatalf("size %d, writes of %d: decrypt: %v", size, writeSize, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("size %d, writes of %d: decrypted plaintext differs", size, writeSize)
+			}
+		}
+	}
+}
+
+func TestEncryptionUsesFreshNonces(t *testing.T) {
+	key := testDataKey(t)
+	plaintext := bytes.Repeat([]byte("same data "), 1000)
+	first := encryptForTest(t, key, plaintext, len(plaintext))
+	second := encryptForTest(t, key, plaintext, len(plaintext))
+	if bytes.Equal(first, second) {
+		t.Error("encrypting the same plaintext twice gave the same ciphertext")
+	}
+}
+
+func TestDecryptionRejectsTamperedCiphertext(t *testing.T) {
+	key := testDataKey(t)
+	plaintext := make([]byte, 2*encryptedChunkSize+100)
+	if _, err := rand.Read(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := encryptForTest(t, key, plaintext, len(plaintext))
+
+	header := len(encryptedMagic) + encryptedPrefixSize
+	fullChunk := 4 + encryptedChunkSize + 16
+	modified := func(change func([]byte) []byte) []byte {
+		return change(bytes.Clone(encrypted))
+	}
+	flip := func(offset int) []byte {
+		return modified(func(b []byte) []byte {
+			b[offset] ^= 0x01
+			return b
+		})
+	}
+
+	tests := []struct {
+		name      string
+		key       []byte
+		encrypted []byte
+	}{
+		{"wrong key", testDataKey(t), encrypted},
+		{"empty file", key, nil},
+		{"truncated header", key, encrypted[:header-1]},
+		{"header only", key, encrypted[:header]},
+		{"truncated length", key, encrypted[:header+2]},
+		{"truncated first chunk", key, encrypted[:header+fullChunk-1]},
+		{"final chunk dropped", key, encrypted[:header+2*fullChunk]},
+		{"truncated final chunk", key, encrypted[:len(encrypted)-1]},
+		{"trailing data", key, append(bytes.Clone(encrypted), 0)},
+		{"not encrypted", key, modified(func(b []byte) []byte { return append([]byte("PGDMP"), b...) })},
+		{"modified nonce prefix", key, flip(len(encryptedMagic))},
+		{"modified first chunk", key, flip(header + 4 + 10)},
+		{"modified tag", key, flip(header + fullChunk - 1)},
+		{"modified final chunk", key, flip(len(encrypted) - 20)},
+		{"oversized length", key, modified(func(b []byte) []byte {
+			binary.BigEndian.PutUint32(b[header:], encryptedChunkSize+17)
+			return b
+		})},
+		{"shortened length", key, modified(func(b []byte) []byte {
+			binary.BigEndian.PutUint32(b[header:], encryptedChunkSize+15)
+			return b
+		})},
+		{"chunks swapped", key, modified(func(b []byte) []byte {
+			first := bytes.Clone(b[header : header+fullChunk])
+			copy(b[header:], b[header+fullChunk:header+2*fullChunk])
+			copy(b[header+fullChunk:], first)
+			return b
+		})},
+		{"chunk repeated", key, modified(func(b []byte) []byte {
+			copy(b[header+fullChunk:], b[header:header+fullChunk])
+			return b
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decrypted, err := decryptForTest(tt.key, tt.encrypted)
+			if err == nil {
+				t.Fatalf("decrypted %d bytes, want an error", len(decrypted))
+			}
+		})
+	}
+}
+
+func TestNormalizeEncryptionDefault(t *testing.T) {
+	none := &SnapshotKeys{defaultMethod: EncryptionNone}
+	if method, _, err := none.normalize("", nil, FormatDirectory); err != nil || method != EncryptionNone {
+		t.Errorf("directory format with no default encryption = %q, %v, want none", method, err)
+	}
+
+	keys := &SnapshotKeys{defaultMethod: EncryptionMaster}
+	tests := []struct {
+		method, format string
+		want           string
+		invalid        bool
+	}{
+		{method: "", format: FormatCustom, want: EncryptionMaster},
+		{method: "", format: FormatPlain, want: EncryptionMaster},
+		// Directory-format dumps cannot be encrypted; they are refused rather
+		// than taken in plaintext unless the request asks for none
+		{method: "", format: FormatDirectory, invalid: true},
+		{method: EncryptionNone, format: FormatDirectory, want: EncryptionNone},
+		{method: EncryptionNone, format: FormatCustom, want: EncryptionNone},
+		{method: EncryptionMaster, format: FormatDirectory, invalid: true},
+	}
+	for _, tt := range tests {
+		method, _, err := keys.normalize(tt.method, nil, tt.format)
+		if tt.invalid {
+			if !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("normalize(%q, %q) error = %v, want ErrInvalidOptions", tt.method, tt.format, err)
+			}
+			continue
+		}
+		if err != nil || method != tt.want {
+			t.Errorf("normalize(%q, %q) = %q, %v, want %q", tt.method, tt.format, method, err, tt.want)
+		}
+	}
+}
+
+func TestMasterDataKeyRewrap(t *testing.T) {
+	original := &SnapshotKeys{keyRing: newTestKeyRing(t, testMasterKey, "")}
+	key, encryption, err := original.newDataKey(EncryptionMaster, nil)
+	if err != nil {
+		t.Fatalf("newDataKey: %v", err)
+	}
+	if len(key) != 32 || encryption.Cipher != snapshotCipher || !slices.Equal(encryption.KeyIDs, []string{original.keyRing.CurrentKeyID()}) {
+		t.Errorf("newDataKey = %d byte key, %+v", len(key), encryption)
+	}
+	if unwrapped, err := original.unwrap(encryption); err != nil || !bytes.Equal(unwrapped, key) {
+		t.Fatalf("unwrap = %x, %v, want %x", unwrapped, err, key)
+	}
+	if changed, err := original.rewrap(encryption); err != nil || changed {
+		t.Errorf("rewrap under the same key = %v, %v, want no change", changed, err)
+	}
+
+	// After rotation the data key is rewrapped and the old key can be dropped
+	rotated := &SnapshotKeys{keyRing: newTestKeyRing(t, testRotatedKey, testMasterKey)}
+	if changed, err := rotated.rewrap(encryption); err != nil || !changed {
+		t.Fatalf("rewrap after rotation = %v, %v, want a change", changed, err)
+	}
+	if !slices.Equal(encryption.KeyIDs, []string{rotated.keyRing.CurrentKeyID()}) {
+		t.Errorf("KeyIDs = %v, want the rotated key", encryption.KeyIDs)
+	}
+	retired := &SnapshotKeys{keyRing: newTestKeyRing(t, testRotatedKey, "")}
+	if unwrapped, err := retired.unwrap(encryption); err != nil || !bytes.Equal(unwrapped, key) {
+		t.Errorf("unwrap with only the rotated key = %x, %v, want %x", unwrapped, err, key)
+	}
+}
+
+func TestAgeDataKey(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients := []string{identity.Recipient().String()}
+
+	keys := &SnapshotKeys{identities: []age.Identity{identity}}
+	key, encryption, err := keys.newDataKey(EncryptionAge, recipients)
+	if err != nil {
+		t.Fatalf("newDataKey: %v", err)
+	}
+	if !slices.Equal(encryption.KeyIDs, recipients) {
+		t.Errorf("KeyIDs = %v, want the recipients %v", encryption.KeyIDs, recipients)
+	}
+	if unwrapped, err := keys.unwrap(encryption); err != nil || !bytes.Equal(unwrapped, key) {
+		t.Fatalf("unwrap = %x, %v, want %x", unwrapped, err, key)
+	}
+
+	// Age-wrapped keys are never rewrapped, and need a matching identity
+	if changed, err := keys.rewrap(encryption); err != nil || changed {
+		t.Errorf("rewrap of an age key = %v, %v, want no change", changed, err)
+	}
+	for name, keys := range map[string]*SnapshotKeys{
+		"no identity":    {},
+		"wrong identity": {identities: []age.Identity{other}},
+	} {
+		if _, err := keys.unwrap(encryption); err == nil {
+			t.Errorf("unwrap with %s succeeded", name)
+		}
+	}
+}
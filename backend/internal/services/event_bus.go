@@ -0,0 +1,74 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before further events are dropped for it
+const subscriberBuffer = 256
+
+type subscription struct {
+	jobID  string
+	events chan models.JobEvent
+}
+
+// EventBus fans out job events to any number of subscribers
+type EventBus struct {
+	mu          sync.Mutex
+	nextID      int
+	subscribers map[int]*subscription
+}
+
+// NewEventBus creates an empty event bus
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[int]*subscription)}
+}
+
+// Publish delivers an event to every matching subscriber without blocking
+func (b *EventBus) Publish(event models.JobEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.subscribers {
+		if sub.jobID != "" && sub.jobID != event.JobID {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// Subscriber is not keeping up; drop rather than stall the job
+		}
+	}
+}
+
+// Subscribe returns a channel of events for jobID, or for all jobs if jobID is
+// empty, and a function that ends the subscription
+func (b *EventBus) Subscribe(jobID string) (<-chan models.JobEvent, func()) {
+	sub := &subscription{
+		jobID:  jobID,
+		events: make(chan models.JobEvent, subscriberBuffer),
+	}
+
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = sub
+	b.mu.Unlock()
+
+	return sub.events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(sub.events)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// drain returns the events already buffered on ch
+func drain(ch <-chan models.JobEvent) []models.JobEvent {
+	var events []models.JobEvent
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventBusFiltersByJob(t *testing.T) {
+	bus := NewEventBus()
+	all, unsubscribeAll := bus.Subscribe("")
+	defer unsubscribeAll()
+	one, unsubscribeOne := bus.Subscribe("snap-1")
+	defer unsubscribeOne()
+
+	bus.Publish(models.JobEvent{Type: "state", JobID: "snap-1", Status: "running"})
+	bus.Publish(models.JobEvent{Type: "log", JobID: "snap-2", Line: "dumping"})
+
+	if got := drain(all); len(got) != 2 {
+		t.Errorf("subscriber to all jobs got %d events, want 2", len(got))
+	}
+	got := drain(one)
+	if len(got) != 1 || got[0].JobID != "snap-1" || got[0].Status != "running" {
+		t.Fatalf("subscriber to snap-1 got %+v, want its state event", got)
+	}
+	if got[0].Timestamp.IsZero() {
+		t.Error("published event has no timestamp")
+	}
+}
+
+func TestEventBusDropsForSlowSubscribers(t *testing.T) {
+	bus := NewEventBus()
+	events, unsubscribe := bus.Subscribe("")
+	defer unsubscribe()
+
+	// Publishing never blocks on a full subscriber
+	for i := 0; i < subscriberBuffer+10; i++ {
+		bus.Publish(models.JobEvent{Type: "progress", JobID: "snap-1"})
+	}
+	if got := len(drain(events)); got != subscriberBuffer {
+		t.Errorf("buffered %d events, want %d", got, subscriberBuffer)
+	}
+}
+
+func TestEventBusUnsubscribe(t *testing.T) {
+	bus := NewEventBus()
+	events, unsubscribe := bus.Subscribe("snap-1")
+	unsubscribe()
+	// A second call is harmless
+	unsubscribe()
+
+	if _, ok := <-events; ok {
+		t.Error("channel still open after unsubscribe")
+	}
+	bus.Publish(models.JobEvent{Type: "state", JobID: "snap-1"})
+}
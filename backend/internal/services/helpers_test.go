@@ -0,0 +1,38 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// newTestSnapshotService returns a snapshot service backed by a metadata
+// store and backup directory in a temporary directory
+func newTestSnapshotService(t *testing.T) (*SnapshotService, *MetadataStore) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("METADATA_DB_PATH", filepath.Join(dir, "metadata.db"))
+	t.Setenv("BACKUP_DIR", filepath.Join(dir, "backups"))
+	t.Setenv("MASTER_KEY", "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+	t.Setenv("S3_BUCKET", "")
+
+	store, err := NewMetadataStore()
+	if err != nil {
+		t.Fatalf("NewMetadataStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	keyRing, err := NewKeyRing()
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	storage, err := NewSnapshotStores()
+	if err != nil {
+		t.Fatalf("NewSnapshotStores: %v", err)
+	}
+	keys, err := NewSnapshotKeys(keyRing)
+	if err != nil {
+		t.Fatalf("NewSnapshotKeys: %v", err)
+	}
+	dbService := NewDatabaseService(store, keyRing)
+	return NewSnapshotService(dbService, store, storage, keys, NewJobManager(), NewEventBus()), store
+}
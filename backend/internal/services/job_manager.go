@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// ErrJobNotRunning is returned when cancelling a job that is neither queued nor running
+var ErrJobNotRunning = errors.New("job is not running")
+
+// Job is a unit of work run by the JobManager
+type Job struct {
+	ID          string
+	Kind        string // snapshot, restore, drill, base_backup, pitr_restore
+	Host        string // host:port of the database server the job talks to
+	Database    string // database the job works on; only one job per database runs at a time
+	Priority    int    // higher runs first
+	Connections int    // database connections the job opens, counted against the per-host limit
+	Run         func(ctx context.Context)
+	OnCancel    func() // called instead of Run when the job is cancelled while queued
+
+	enqueuedAt time.Time
+	seq        uint64
+}
+
+// databaseKey identifies a database across servers
+func (j *Job) databaseKey() string {
+	return j.Host + "/" + j.Database
+}
+
+type runningJob struct {
+	job       *Job
+	cancel    context.CancelFunc
+	startedAt time.Time
+}
+
+// JobManager runs snapshot and restore jobs on a bounded worker pool. Jobs wait
+// in a priority queue (FIFO within a priority) until a worker is free, their
+// database server is below its connection limit and no other job is active on
+// the same database.
+type JobManager struct {
+	mu        sync.Mutex
+	workers   int
+	perHost   int
+	seq       uint64
+	queue     []*Job
+	running   map[string]*runningJob
+	hostLoad  map[string]int
+	activeDBs map[string]string
+}
+
+// NewJobManager creates a job manager sized by JOB_WORKERS and JOB_MAX_PER_HOST
+func NewJobManager() *JobManager {
+	return &JobManager{
+		workers:   envInt("JOB_WORKERS", 4),
+		perHost:   envInt("JOB_MAX_PER_HOST", 2),
+		running:   make(map[string]*runningJob),
+		hostLoad:  make(map[string]int),
+		activeDBs: make(map[string]string),
+	}
+}
+
+// envInt reads a positive integer from the environment
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("Warning: Invalid %s=%q, using %d", name, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// envDuration reads a positive duration from the environment
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: Invalid %s=%q, using %s", name, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// Submit queues a job and starts it as soon as the limits allow
+func (jm *JobManager) Submit(job *Job) {
+	if job.Connections < 1 {
+		job.Connections = 1
+	}
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	jm.seq++
+	job.seq = jm.seq
+	job.enqueuedAt = time.Now()
+
+	// Keep the queue ordered by priority, then submission order
+	i := sort.Search(len(jm.queue), func(i int) bool {
+		queued := jm.queue[i]
+		if queued.Priority != job.Priority {
+			return queued.Priority < job.Priority
+		}
+		return queued.seq > job.seq
+	})
+	jm.queue = append(jm.queue, nil)
+	copy(jm.queue[i+1:], jm.queue[i:])
+	jm.queue[i] = job
+
+	jm.dispatchLocked()
+}
+
+// Cancel removes a queued job or stops a running one
+func (jm *JobManager) Cancel(id string) error {
+	jm.mu.Lock()
+
+	for i, job := range jm.queue {
+		if job.ID != id {
+			continue
+		}
+		jm.queue = append(jm.queue[:i], jm.queue[i+1:]...)
+		jm.mu.Unlock()
+		if job.OnCancel != nil {
+			job.OnCancel()
+		}
+		return nil
+	}
+
+	running, ok := jm.running[id]
+	jm.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotRunning, id)
+	}
+	running.cancel()
+	return nil
+}
+
+// QueuePosition returns the 1-based position of a queued job, or 0 if it is not queued
+func (jm *JobManager) QueuePosition(id string) int {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	for i, job := range jm.queue {
+		if job.ID == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// List returns the running jobs followed by the queued ones in queue order
+func (jm *JobManager) List() []models.JobInfo {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	jobs := make([]models.JobInfo, 0, len(jm.running)+len(jm.queue))
+	for _, running := range jm.running {
+		startedAt := running.startedAt
+		info := jobInfo(running.job, "running")
+		info.StartedAt = &startedAt
+		jobs = append(jobs, info)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.Before(*jobs[j].StartedAt)
+	})
+
+	for i, job := range jm.queue {
+		info := jobInfo(job, "queued")
+		info.QueuePosition = i + 1
+		jobs = append(jobs, info)
+	}
+
+	return jobs
+}
+
+// jobInfo describes a job for the API
+func jobInfo(job *Job, status string) models.JobInfo {
+	return models.JobInfo{
+		ID:          job.ID,
+		Kind:        job.Kind,
+		Status:      status,
+		Host:        job.Host,
+		Database:    job.Database,
+		Priority:    job.Priority,
+		Connections: job.Connections,
+		EnqueuedAt:  job.enqueuedAt,
+	}
+}
+
+// dispatchLocked starts every queued job that the limits allow; callers hold mu
+func (jm *JobManager) dispatchLocked() {
+	for len(jm.running) < jm.workers {
+		next := -1
+		for i, job := range jm.queue {
+			if jm.canStartLocked(job) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return
+		}
+
+		job := jm.queue[next]
+		jm.queue = append(jm.queue[:next], jm.queue[next+1:]...)
+		jm.startLocked(job)
+	}
+}
+
+// canStartLocked reports whether job fits within the per-host and per-database limits
+func (jm *JobManager) canStartLocked(job *Job) bool {
+	if _, busy := jm.activeDBs[job.databaseKey()]; busy {
+		return false
+	}
+	load := jm.hostLoad[job.Host]
+	// A job wider than the limit may still run on its own
+	return load == 0 || load+job.Connections <= jm.perHost
+}
+
+// startLocked runs job in its own goroutine; callers hold mu
+func (jm *JobManager) startLocked(job *Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	jm.running[job.ID] = &runningJob{job: job, cancel: cancel, startedAt: time.Now()}
+	jm.hostLoad[job.Host] += job.Connections
+	jm.activeDBs[job.databaseKey()] = job.ID
+
+	go func() {
+		defer jm.finish(job, cancel)
+		job.Run(ctx)
+	}()
+}
+
+// finish releases the resources held by a completed job and starts the next ones
+func (jm *JobManager) finish(job *Job, cancel context.CancelFunc) {
+	cancel()
+
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+
+	delete(jm.running, job.ID)
+	delete(jm.activeDBs, job.databaseKey())
+	jm.hostLoad[job.Host] -= job.Connections
+	if jm.hostLoad[job.Host] <= 0 {
+		delete(jm.hostLoad, job.Host)
+	}
+
+	jm.dispatchLocked()
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// testJob is a job that runs until it is released or cancelled
+type testJob struct {
+	*Job
+	started   chan struct{}
+	release   chan struct{}
+	done      chan struct{}
+	cancelled bool
+}
+
+func newTestJobManager(workers, perHost int) *JobManager {
+	return &JobManager{
+		workers:   workers,
+		perHost:   perHost,
+		running:   make(map[string]*runningJob),
+		hostLoad:  make(map[string]int),
+		activeDBs: make(map[string]string),
+	}
+}
+
+func newTestJob(id, host, database string, connections int) *testJob {
+	tj := &testJob{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	tj.Job = &Job{
+		ID:          id,
+		Host:        host,
+		Database:    database,
+		Connections: connections,
+		Run: func(ctx context.Context) {
+			defer close(tj.done)
+			close(tj.started)
+			select {
+			case <-tj.release:
+			case <-ctx.Done():
+				tj.cancelled = true
+			}
+		},
+	}
+	return tj
+}
+
+// waitFor fails the test if ch is not closed within a few seconds
+func waitFor(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+// isStarted reports whether the job has started running
+func (tj *testJob) isStarted() bool {
+	select {
+	case <-tj.started:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitIdle waits until the manager has released every finished job
+func waitIdle(t *testing.T, jm *JobManager) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		jm.mu.Lock()
+		running := len(jm.running)
+		jm.mu.Unlock()
+		if running == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d jobs still running", running)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestJobManagerCancel(t *testing.T) {
+	jm := newTestJobManager(1, 2)
+	running := newTestJob("running", "db:5432", "shop", 1)
+	jm.Submit(running.Job)
+	waitFor(t, running.started, "the first job to start")
+
+	// A queued job is dropped without running
+	queued := newTestJob("queued", "db:5432", "warehouse", 1)
+	onCancelCalled := false
+	queued.OnCancel = func() { onCancelCalled = true }
+	jm.Submit(queued.Job)
+	if got := jm.QueuePosition("queued"); got != 1 {
+		t.Fatalf("QueuePosition = %d, want 1", got)
+	}
+	if err := jm.Cancel("queued"); err != nil {
+		t.Fatalf("Cancel of a queued job: %v", err)
+	}
+	if !onCancelCalled {
+		t.Error("OnCancel was not called for the queued job")
+	}
+	if got := jm.QueuePosition("queued"); got != 0 {
+		t.Errorf("QueuePosition after Cancel = %d, want 0", got)
+	}
+
+	// A running job sees its context cancelled
+	if err := jm.Cancel("running"); err != nil {
+		t.Fatalf("Cancel of a running job: %v", err)
+	}
+	waitFor(t, running.done, "the running job to stop")
+	if !running.cancelled {
+		t.Error("the running job was not cancelled")
+	}
+	waitIdle(t, jm)
+	if queued.isStarted() {
+		t.Error("the cancelled queued job ran")
+	}
+
+	for _, id := range []string{"running", "missing"} {
+		if err := jm.Cancel(id); !errors.Is(err, ErrJobNotRunning) {
+			t.Errorf("Cancel(%q) error = %v, want ErrJobNotRunning", id, err)
+		}
+	}
+}
+
+func TestCancelUnknownOperation(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	if err := ss.CancelSnapshot("missing"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("CancelSnapshot error = %v, want ErrSnapshotNotFound", err)
+	}
+	if err := ss.CancelRestore("missing"); !errors.Is(err, ErrRestoreNotFound) {
+		t.Errorf("CancelRestore error = %v, want ErrRestoreNotFound", err)
+	}
+}
+
+func TestJobManagerLimits(t *testing.T) {
+	jm := newTestJobManager(4, 2)
+	shop := newTestJob("shop", "db:5432", "shop", 1)
+	warehouse := newTestJob("warehouse", "db:5432", "warehouse", 1)
+	shopAgain := newTestJob("shop-again", "other:5432", "shop", 1)
+	crm := newTestJob("crm", "db:5432", "crm", 1)
+	for _, tj := range []*testJob{shop, warehouse, shopAgain, crm} {
+		jm.Submit(tj.Job)
+	}
+	waitFor(t, shop.started, "shop to start")
+	waitFor(t, warehouse.started, "warehouse to start")
+	// The same database name on another server is a different database
+	waitFor(t, shopAgain.started, "shop on the other server to start")
+
+	// db:5432 is at its limit of two connections
+	if crm.isStarted() {
+		t.Fatal("crm started beyond the per-host limit")
+	}
+	if got := jm.QueuePosition("crm"); got != 1 {
+		t.Errorf("QueuePosition(crm) = %d, want 1", got)
+	}
+
+	// Only one job runs on a database at a time
+	shopRestore := newTestJob("shop-restore", "db:5432", "shop", 1)
+	jm.Submit(shopRestore.Job)
+	close(warehouse.release)
+	waitFor(t, crm.started, "crm to start once warehouse finished")
+	if shopRestore.isStarted() {
+		t.Fatal("a second job started on shop")
+	}
+	close(shop.release)
+	waitFor(t, shopRestore.started, "the shop restore to start once the snapshot finished")
+
+	for _, tj := range []*testJob{shopAgain, crm, shopRestore} {
+		close(tj.release)
+	}
+	waitIdle(t, jm)
+}
+
+func TestJobManagerWideJobRunsAlone(t *testing.T) {
+	jm := newTestJobManager(4, 2)
+	wide := newTestJob("wide", "db:5432", "shop", 4)
+	narrow := newTestJob("narrow", "db:5432", "warehouse", 1)
+	jm.Submit(wide.Job)
+	jm.Submit(narrow.Job)
+
+	waitFor(t, wide.started, "the wide job to start on an idle server")
+	if narrow.isStarted() {
+		t.Fatal("a job started next to one wider than the per-host limit")
+	}
+	close(wide.release)
+	waitFor(t, narrow.started, "the narrow job to start")
+	close(narrow.release)
+	waitIdle(t, jm)
+}
+
+func TestJobManagerQueueOrder(t *testing.T) {
+	jm := newTestJobManager(1, 2)
+	first := newTestJob("first", "db:5432", "a", 1)
+	jm.Submit(first.Job)
+	waitFor(t, first.started, "the first job to start")
+
+	jobs := map[string]*testJob{}
+	for _, queued := range []struct {
+		id       string
+		priority int
+	}{
+		{"low-1", 0},
+		{"high", 10},
+		{"low-2", 0},
+		{"mid", 5},
+	} {
+		tj := newTestJob(queued.id, "db:5432", queued.id, 1)
+		tj.Priority = queued.priority
+		jobs[queued.id] = tj
+		jm.Submit(tj.Job)
+	}
+
+	// Higher priority first, then submission order
+	want := []string{"high", "mid", "low-1", "low-2"}
+	list := jm.List()
+	if len(list) != 5 || list[0].ID != "first" || list[0].Status != "running" || list[0].StartedAt == nil {
+		t.Fatalf("List = %+v, want the running job first", list)
+	}
+	for i, id := range want {
+		info := list[i+1]
+		if info.ID != id || info.Status != "queued" || info.QueuePosition != i+1 {
+			t.Errorf("List[%d] = %s %s at %d, want %s queued at %d", i+1, info.ID, info.Status, info.QueuePosition, id, i+1)
+		}
+		if got := jm.QueuePosition(id); got != i+1 {
+			t.Errorf("QueuePosition(%s) = %d, want %d", id, got, i+1)
+		}
+	}
+
+	// Jobs start in queue order as the single worker frees up
+	close(first.release)
+	for i, id := range want {
+		tj := jobs[id]
+		waitFor(t, tj.started, id+" to start")
+		for _, later := range want[i+1:] {
+			if jobs[later].isStarted() {
+				t.Errorf("%s started before %s", later, id)
+			}
+		}
+		close(tj.release)
+	}
+	waitIdle(t, jm)
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const sealedPrefix = "v1"
+
+// KeyRing holds the server master keys used to encrypt secrets at rest.
+// The current key encrypts; every key in the ring can decrypt.
+type KeyRing struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+// NewKeyRing loads the master key from MASTER_KEY (base64, 32 bytes) or, if
+// unset, from MASTER_KEY_FILE, generating that file on first start.
+// MASTER_KEY_PREVIOUS may list retired keys (comma separated) that are still
+// needed to decrypt older secrets.
+func NewKeyRing() (*KeyRing, error) {
+	encoded := strings.TrimSpace(os.Getenv("MASTER_KEY"))
+	if encoded == "" {
+		path := os.Getenv("MASTER_KEY_FILE")
+		if path == "" {
+			path = "./data/master.key"
+		}
+		var err error
+		if encoded, err = loadOrCreateKeyFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	current, err := decodeMasterKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MASTER_KEY: %w", err)
+	}
+
+	kr := &KeyRing{keys: make(map[string][]byte)}
+	kr.currentID = kr.add(current)
+
+	for _, old := range strings.Split(os.Getenv("MASTER_KEY_PREVIOUS"), ",") {
+		if old = strings.TrimSpace(old); old == "" {
+			continue
+		}
+		key, err := decodeMasterKey(old)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MASTER_KEY_PREVIOUS entry: %w", err)
+		}
+		kr.add(key)
+	}
+
+	return kr, nil
+}
+
+// loadOrCreateKeyFile reads a base64 master key from path, creating one if missing
+func loadOrCreateKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read master key file: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate master key: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create master key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write master key file: %w", err)
+	}
+
+	log.Printf("Warning: MASTER_KEY not set, generated a new master key at %s - back it up, secrets cannot be decrypted without it", path)
+	return encoded, nil
+}
+
+// decodeMasterKey decodes a base64 encoded 256-bit key
+func decodeMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// add registers a key and returns its ID
+func (kr *KeyRing) add(key []byte) string {
+	sum := sha256.Sum256(key)
+	id := hex.EncodeToString(sum[:4])
+	kr.keys[id] = key
+	return id
+}
+
+// CurrentKeyID returns the ID of the key used for new encryptions
+func (kr *KeyRing) CurrentKeyID() string {
+	return kr.currentID
+}
+
+// Seal encrypts plaintext with the current master key using AES-256-GCM.
+// The result records the key ID so it can be opened after key rotation.
+func (kr *KeyRing) Seal(plaintext []byte) (string, error) {
+	gcm, err := newGCM(kr.keys[kr.currentID])
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(kr.currentID))
+	return strings.Join([]string{sealedPrefix, kr.currentID, base64.StdEncoding.EncodeToString(sealed)}, ":"), nil
+}
+
+// Open decrypts a value produced by Seal
+func (kr *KeyRing) Open(sealed string) ([]byte, error) {
+	parts := strings.SplitN(sealed, ":", 3)
+	if len(parts) != 3 || parts[0] != sealedPrefix {
+		return nil, errors.New("malformed encrypted value")
+	}
+
+	key, ok := kr.keys[parts[1]]
+	if !ok {
+		return nil, fmt.Errorf("master key %s is not available", parts[1])
+	}
+
+	data, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("malformed encrypted value")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(parts[1]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// newGCM creates an AES-GCM cipher for a 256-bit key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealedKeyID returns the ID of the master key a value produced by Seal was encrypted with
+func sealedKeyID(sealed string) string {
+	parts := strings.SplitN(sealed, ":", 3)
+	if len(parts) != 3 {
+		return ""
+	}
+	return parts[1]
+}
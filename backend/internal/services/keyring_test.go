@@ -0,0 +1,147 @@
+package services
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyRingSealOpen(t *testing.T) {
+	keyRing := newTestKeyRing(t, testMasterKey, "")
+
+	for _, plaintext := range []string{"", "password", strings.Repeat("long secret ", 100)} {
+		sealed, err := keyRing.Seal([]byte(plaintext))
+		if err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		if !strings.HasPrefix(sealed, sealedPrefix+":"+keyRing.CurrentKeyID()+":") {
+			t.Errorf("sealed value %q does not name the current key %s", sealed, keyRing.CurrentKeyID())
+		}
+		if plaintext != "" && strings.Contains(sealed, plaintext) {
+			t.Errorf("sealed value %q holds the plaintext", sealed)
+		}
+		opened, err := keyRing.Open(sealed)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		if string(opened) != plaintext {
+			t.Errorf("Open = %q, want %q", opened, plaintext)
+		}
+	}
+
+	first, _ := keyRing.Seal([]byte("same"))
+	second, _ := keyRing.Seal([]byte("same"))
+	if first == second {
+		t.Error("sealing the same value twice gave the same result")
+	}
+}
+
+func TestKeyRingOpenRejectsBadValues(t *testing.T) {
+	keyRing := newTestKeyRing(t, testMasterKey, "")
+	sealed, err := keyRing.Seal([]byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.SplitN(sealed, ":", 3)
+	data, _ := base64.StdEncoding.DecodeString(parts[2])
+	data[len(data)-1] ^= 0x01
+	tampered := parts[0] + ":" + parts[1] + ":" + base64.StdEncoding.EncodeToString(data)
+
+	otherKey, err := newTestKeyRing(t, testRotatedKey, "").Seal([]byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, sealed string
+	}{
+		{"empty", ""},
+		{"plaintext", "password"},
+		{"unknown version", "v0:" + parts[1] + ":" + parts[2]},
+		{"bad base64", parts[0] + ":" + parts[1] + ":!!!"},
+		{"too short", parts[0] + ":" + parts[1] + ":" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		{"tampered", tampered},
+		// The key ID is authenticated: a value cannot be moved to another key
+		{"relabelled key", parts[0] + ":" + strings.Repeat("0", len(parts[1])) + ":" + parts[2]},
+		{"key not in the ring", otherKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if opened, err := keyRing.Open(tt.sealed); err == nil {
+				t.Errorf("Open = %q, want an error", opened)
+			}
+		})
+	}
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	old := newTestKeyRing(t, testMasterKey, "")
+	sealed, err := old.Seal([]byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newTestKeyRing(t, testRotatedKey, " "+testMasterKey+" ,")
+	if rotated.CurrentKeyID() == old.CurrentKeyID() {
+		t.Fatal("rotated key ring kept the old current key")
+	}
+	opened, err := rotated.Open(sealed)
+	if err != nil || string(opened) != "password" {
+		t.Fatalf("Open with the previous key = %q, %v", opened, err)
+	}
+	resealed, err := rotated.Seal(opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealedKeyID(resealed) != rotated.CurrentKeyID() {
+		t.Errorf("new values are sealed with %s, want %s", sealedKeyID(resealed), rotated.CurrentKeyID())
+	}
+}
+
+func TestNewKeyRingKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "master.key")
+	t.Setenv("MASTER_KEY", "")
+	t.Setenv("MASTER_KEY_PREVIOUS", "")
+	t.Setenv("MASTER_KEY_FILE", path)
+
+	first, err := NewKeyRing()
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("key file was not created: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	second, err := NewKeyRing()
+	if err != nil {
+		t.Fatalf("NewKeyRing: %v", err)
+	}
+	if first.CurrentKeyID() != second.CurrentKeyID() {
+		t.Error("the key file was not reused")
+	}
+}
+
+func TestNewKeyRingRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name, current, previous string
+	}{
+		{"not base64", "not a key", ""},
+		{"too short", base64.StdEncoding.EncodeToString(make([]byte, 16)), ""},
+		{"invalid previous key", testMasterKey, "AAAA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MASTER_KEY", tt.current)
+			t.Setenv("MASTER_KEY_PREVIOUS", tt.previous)
+			if _, err := NewKeyRing(); err == nil {
+				t.Error("NewKeyRing succeeded")
+			}
+		})
+	}
+}
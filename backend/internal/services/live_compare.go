@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// CompareWithLive reports what changed in a live database since a snapshot:
+// the schema in the dump against a schema-only dump of the database, and the
+// row counts and table sizes recorded when the snapshot was taken against
+// exact counts and sizes read now. Tables the snapshot's filters leave out
+// are not compared.
+func (ss *SnapshotService) CompareWithLive(ctx context.Context, config *models.DatabaseConnection, snapshotID string) (*models.LiveComparison, error) {
+	snapshot, err := ss.catalog.Get(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch snapshot.Status {
+	case "completed":
+	case "queued", "creating":
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotBusy, snapshotID)
+	default:
+		return nil, fmt.Errorf("%w: snapshot %s has no dump to read (status: %s)", ErrInvalidOptions, snapshotID, snapshot.Status)
+	}
+
+	filters, err := compileFilters(snapshot.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &models.LiveComparison{
+		SnapshotID:        snapshot.ID,
+		Database:          config.Database,
+		SnapshotCreatedAt: snapshot.CreatedAt,
+	}
+
+	ctx, cancel := ss.inspect(ctx)
+	defer cancel()
+
+	// Data-only snapshots hold no schema to compare
+	if snapshotMode(snapshot) != ModeDataOnly {
+		snapshotObjects, err := ss.readSnapshotSchema(ctx, snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema of snapshot %s: %w", snapshot.ID, inspectionError(ctx, err))
+		}
+		liveObjects, err := ss.readLiveSchema(ctx, config, snapshot.Filters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema of %s: %w", config.Database, inspectionError(ctx, err))
+		}
+		comparison.Schema = diffSchemas(snapshotObjects, liveObjects)
+		comparison.Schema.FromSnapshotID = snapshot.ID
+	}
+
+	liveRows, liveSizes, err := ss.measureLiveTables(ctx, config, filters)
+	if err != nil {
+		return nil, inspectionError(ctx, err)
+	}
+	comparison.Tables = compareTables(snapshot, filters, liveRows, liveSizes)
+	comparison.ComparedAt = time.Now()
+	return comparison, nil
+}
+
+// readLiveSchema reads the schema objects of a live database from a
+// schema-only pg_dump limited by the same filters as the snapshot
+func (ss *SnapshotService) readLiveSchema(ctx context.Context, config *models.DatabaseConnection, filters *models.SnapshotFilters) (map[string]*schemaObject, error) {
+	args := []string{
+		fmt.Sprintf("--host=%s", config.Host),
+		fmt.Sprintf("--port=%d", config.Port),
+		fmt.Sprintf("--username=%s", config.Username),
+		fmt.Sprintf("--dbname=%s", config.Database),
+		"--schema-only",
+		"--no-password",
+	}
+	args = append(args, filterArgs(filters)...)
+
+	reader, writer := io.Pipe()
+	go func() {
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, ss.toolsService.GetPgDumpPath(), args...)
+		cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", config.Password))
+		cmd.Stdout = writer
+		cmd.Stderr = &stderr
+		setProcessGroup(cmd)
+		if err := cmd.Run(); err != nil {
+			writer.CloseWithError(fmt.Errorf("pg_dump failed: %w: %s", err, strings.TrimSpace(stderr.String())))
+			return
+		}
+		writer.Close()
+	}()
+
+	objects, err := readSchemaObjects(reader)
+	// Stop pg_dump if reading ended early
+	reader.CloseWithError(errors.New("pg_dump output was not read"))
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// measureLiveTables counts the rows of the tables a snapshot's filters keep,
+// inside one read-only transaction so the counts are consistent, and reads
+// their on-disk sizes
+func (ss *SnapshotService) measureLiveTables(ctx context.Context, config *models.DatabaseConnection, filters *dumpFilters) (map[tableKey]int64, map[tableKey]int64, error) {
+	db, err := ss.dbService.openConnection(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := countRows(ctx, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key := range rows {
+		if included, _ := filters.includesTable(key.schema, key.name); !included {
+			delete(rows, key)
+		}
+	}
+
+	tables, err := ss.dbService.GetTableStats(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rows, dumpedTableSizes(tables, filters), nil
+}
+
+// compareTables pairs the row counts and sizes recorded in a snapshot with
+// those of the live database. Tables dumped without their data have no
+// recorded row count to compare.
+func compareTables(snapshot *models.Snapshot, filters *dumpFilters, liveRows, liveSizes map[tableKey]int64) []models.TableDelta {
+	recorded := len(snapshot.RowCounts) > 0 || len(snapshot.TableSizes) > 0
+	snapshotRows := parseRecordedCounts(snapshot.RowCounts)
+	snapshotSizes := parseRecordedCounts(snapshot.TableSizes)
+
+	keys := map[tableKey]bool{}
+	for _, counts := range []map[tableKey]int64{snapshotRows, snapshotSizes, liveRows, liveSizes} {
+		for key := range counts {
+			keys[key] = true
+		}
+	}
+
+	deltas := []models.TableDelta{}
+	for key := range keys {
+		delta := models.TableDelta{
+			Schema:        key.schema,
+			Name:          key.name,
+			SnapshotRows:  lookupCount(snapshotRows, key),
+			LiveRows:      lookupCount(liveRows, key),
+			SnapshotBytes: lookupCount(snapshotSizes, key),
+			LiveBytes:     lookupCount(liveSizes, key),
+		}
+		inSnapshot := delta.SnapshotRows != nil || delta.SnapshotBytes != nil
+		inLive := delta.LiveRows != nil || delta.LiveBytes != nil
+		if _, withData := filters.includesTable(key.schema, key.name); !withData {
+			delta.SnapshotRows = nil
+		}
+		if delta.SnapshotRows != nil && delta.LiveRows != nil {
+			delta.RowDelta = *delta.LiveRows - *delta.SnapshotRows
+		}
+		if delta.SnapshotBytes != nil && delta.LiveBytes != nil {
+			delta.ByteDelta = *delta.LiveBytes - *delta.SnapshotBytes
+		}
+
+		switch {
+		case !recorded:
+			delta.Status = "unknown"
+		case !inSnapshot:
+			delta.Status = "added"
+		case !inLive:
+			delta.Status = "removed"
+		case delta.RowDelta != 0 || delta.ByteDelta != 0:
+			delta.Status = "changed"
+		default:
+			delta.Status = "unchanged"
+		}
+		deltas = append(deltas, delta)
+	}
+
+	sort.Slice(deltas, func(i, j int) bool {
+		if deltas[i].Schema != deltas[j].Schema {
+			return deltas[i].Schema < deltas[j].Schema
+		}
+		return deltas[i].Name < deltas[j].Name
+	})
+	return deltas
+}
+
+func lookupCount(counts map[tableKey]int64, key tableKey) *int64 {
+	if count, ok := counts[key]; ok {
+		return &count
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+func TestCompareTablesStatus(t *testing.T) {
+	filters, err := compileFilters(&models.SnapshotFilters{ExcludeTableData: []string{"public.audit"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := &models.Snapshot{
+		RowCounts: recordedCounts(map[tableKey]int64{
+			{"public", "orders"}:    10,
+			{"public", "customers"}: 5,
+			{"public", "legacy"}:    3,
+			{"public", "audit"}:     0,
+		}),
+		TableSizes: recordedCounts(map[tableKey]int64{
+			{"public", "orders"}:    1000,
+			{"public", "customers"}: 500,
+			{"public", "legacy"}:    300,
+			{"public", "audit"}:     8000,
+		}),
+	}
+	liveRows := map[tableKey]int64{
+		{"public", "orders"}:    12,
+		{"public", "customers"}: 5,
+		{"public", "audit"}:     150,
+		{"public", "invoices"}:  1,
+	}
+	liveSizes := map[tableKey]int64{
+		{"public", "orders"}:    1200,
+		{"public", "customers"}: 500,
+		{"public", "audit"}:     8000,
+		{"public", "invoices"}:  8,
+	}
+
+	tests := []struct {
+		name                string
+		status              string
+		rowDelta, byteDelta int64
+		snapshotRows        bool
+	}{
+		// Rows of a table dumped without data are not compared
+		{"audit", "unchanged", 0, 0, false},
+		{"customers", "unchanged", 0, 0, true},
+		{"invoices", "added", 0, 0, false},
+		{"legacy", "removed", 0, 0, true},
+		{"orders", "changed", 2, 200, true},
+	}
+	deltas := compareTables(snapshot, filters, liveRows, liveSizes)
+	if len(deltas) != len(tests) {
+		t.Fatalf("compared %d tables, want %d: %+v", len(deltas), len(tests), deltas)
+	}
+	for i, tt := range tests {
+		delta := deltas[i]
+		if delta.Name != tt.name || delta.Status != tt.status || delta.RowDelta != tt.rowDelta || delta.ByteDelta != tt.byteDelta {
+			t.Errorf("delta %d = %s %s %+d rows %+d bytes, want %s %s %+d rows %+d bytes", i, delta.Name, delta.Status, delta.RowDelta, delta.ByteDelta, tt.name, tt.status, tt.rowDelta, tt.byteDelta)
+		}
+		if (delta.SnapshotRows != nil) != tt.snapshotRows {
+			t.Errorf("%s: snapshot rows %v, want recorded %v", tt.name, delta.SnapshotRows, tt.snapshotRows)
+		}
+	}
+
+	// A bigger table with as many rows has changed too
+	liveSizes[tableKey{"public", "customers"}] = 600
+	for _, delta := range compareTables(snapshot, filters, liveRows, liveSizes) {
+		if delta.Name == "customers" && (delta.Status != "changed" || delta.ByteDelta != 100) {
+			t.Errorf("customers = %s %+d bytes, want changed +100 bytes", delta.Status, delta.ByteDelta)
+		}
+	}
+}
+
+func TestCompareTablesWithoutRecordedCounts(t *testing.T) {
+	filters, err := compileFilters(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Snapshots taken before counts were recorded cannot tell what changed
+	deltas := compareTables(&models.Snapshot{}, filters, map[tableKey]int64{{"public", "orders"}: 12}, nil)
+	if len(deltas) != 1 || deltas[0].Status != "unknown" || deltas[0].SnapshotRows != nil || *deltas[0].LiveRows != 12 {
+		t.Errorf("deltas = %+v, want orders unknown with 12 live rows", deltas)
+	}
+}
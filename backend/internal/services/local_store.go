@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps snapshots as files and directories below a root directory
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore creates a store rooted at dir
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{dir: dir}
+}
+
+// Dir returns the root directory of the store
+func (ls *LocalStore) Dir() string {
+	return ls.dir
+}
+
+// Path returns the filesystem path of the object at key, for tools such as
+// pg_dump --file and pg_restore that work on paths directly
+func (ls *LocalStore) Path(key string) string {
+	return filepath.Join(ls.dir, filepath.FromSlash(key))
+}
+
+// Location returns the filesystem path of the object at key
+func (ls *LocalStore) Location(key string) string {
+	return ls.Path(key)
+}
+
+// Put creates the file for the object at key
+func (ls *LocalStore) Put(_ context.Context, key string) (SnapshotWriter, error) {
+	path := ls.Path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	return &localWriter{file: file}, nil
+}
+
+// Get opens the file of the object at key
+func (ls *LocalStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(ls.Path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot file: %w", err)
+	}
+	return file, nil
+}
+
+// Stat returns the size of the object at key; for a directory-format dump,
+// the total size of its files
+func (ls *LocalStore) Stat(_ context.Context, key string) (int64, error) {
+	size, err := pathSize(ls.Path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return size, err
+}
+
+// List returns the top-level files and directories whose name starts with prefix
+func (ls *LocalStore) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	entries, err := os.ReadDir(ls.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	objects := []ObjectInfo{}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		size, err := pathSize(ls.Path(entry.Name()))
+		if err != nil {
+			continue
+		}
+		objects = append(objects, ObjectInfo{Key: entry.Name(), Size: size, LastModified: info.ModTime()})
+	}
+	return objects, nil
+}
+
+// Delete removes the file or directory of the object at key
+func (ls *LocalStore) Delete(_ context.Context, key string) error {
+	if err := os.RemoveAll(ls.Path(key)); err != nil {
+		return fmt.Errorf("failed to delete snapshot file: %w", err)
+	}
+	return nil
+}
+
+// localWriter writes a snapshot file, syncing it to disk on Close
+type localWriter struct {
+	file *os.File
+}
+
+func (lw *localWriter) Write(p []byte) (int, error) {
+	return lw.file.Write(p)
+}
+
+func (lw *localWriter) Close() error {
+	err := lw.file.Sync()
+	if closeErr := lw.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (lw *localWriter) Abort() {
+	lw.file.Close()
+	os.Remove(lw.file.Name())
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// putObject writes content to key through the store
+func putObject(t *testing.T, store SnapshotStore, key, content string) {
+	t.Helper()
+	w, err := store.Put(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Put(%s): %v", key, err)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close(%s): %v", key, err)
+	}
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocalStore(t.TempDir())
+
+	putObject(t, store, "shop_20261016_120000_0123abcd.sql", "-- dump")
+	putObject(t, store, "warehouse_20261016_120000_89abcdef.dump", "PGDMP")
+	for name, size := range map[string]int{"toc.dat": 10, "3402.dat.gz": 20} {
+		putObject(t, store, "shop_20261016_130000_fedcba98/"+name, string(make([]byte, size)))
+	}
+
+	r, err := store.Get(ctx, "shop_20261016_120000_0123abcd.sql")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	content, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(content) != "-- dump" {
+		t.Errorf("Get read %q, %v, want the written dump", content, err)
+	}
+	if size, err := store.Stat(ctx, "shop_20261016_130000_fedcba98"); err != nil || size != 30 {
+		t.Errorf("Stat of a directory dump = %d, %v, want 30", size, err)
+	}
+
+	objects, err := store.List(ctx, "shop_")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	slices.Sort(keys)
+	if want := []string{"shop_20261016_120000_0123abcd.sql", "shop_20261016_130000_fedcba98"}; !slices.Equal(keys, want) {
+		t.Errorf("List(shop_) = %v, want %v", keys, want)
+	}
+
+	// Deleting removes directory dumps whole, and missing objects are fine
+	for _, key := range []string{"shop_20261016_130000_fedcba98", "shop_20261016_130000_fedcba98", "missing.sql"} {
+		if err := store.Delete(ctx, key); err != nil {
+			t.Errorf("Delete(%s): %v", key, err)
+		}
+	}
+	if _, err := store.Get(ctx, "missing.sql"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Get of a missing object: error = %v, want ErrObjectNotFound", err)
+	}
+	if _, err := store.Stat(ctx, "shop_20261016_130000_fedcba98"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Stat after Delete: error = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestLocalStoreAbort(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+	w, err := store.Put(context.Background(), "partial.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, "-- cut"); err != nil {
+		t.Fatal(err)
+	}
+	w.Abort()
+	if _, err := os.Stat(filepath.Join(store.Dir(), "partial.sql")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("aborted object still on disk: %v", err)
+	}
+}
+
+func TestSnapshotStoresGet(t *testing.T) {
+	t.Setenv("BACKUP_DIR", t.TempDir())
+	t.Setenv("S3_BUCKET", "")
+	stores, err := NewSnapshotStores()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", StorageLocal} {
+		if store, err := stores.Get(name); err != nil || store != SnapshotStore(stores.Local()) {
+			t.Errorf("Get(%q) = %v, %v, want the local store", name, store, err)
+		}
+		if !isLocalStorage(name) {
+			t.Errorf("isLocalStorage(%q) = false", name)
+		}
+	}
+	if _, err := stores.Get(StorageS3); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("Get(s3) without S3_BUCKET: error = %v, want ErrInvalidOptions", err)
+	}
+	if isLocalStorage(StorageS3) {
+		t.Error("isLocalStorage(s3) = true")
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	snapshotsBucket   = "snapshots"
+	connectionsBucket = "connections"
+	restoresBucket    = "restores"
+	drillsBucket      = "drills"
+	schedulesBucket   = "schedules"
+	retentionBucket   = "retention"
+	contentsBucket    = "contents"
+	baseBackupsBucket = "base_backups"
+	walArchivesBucket = "wal_archives"
+	pitrBucket        = "pitr_restores"
+	metaBucket        = "meta"
+)
+
+// MetadataStore is the embedded key/value database that holds the server's own state
+type MetadataStore struct {
+	db *bolt.DB
+}
+
+// NewMetadataStore opens the metadata database configured by METADATA_DB_PATH
+func NewMetadataStore() (*MetadataStore, error) {
+	path := os.Getenv("METADATA_DB_PATH")
+	if path == "" {
+		path = "./data/pgtimemachine.db"
+	}
+	return OpenMetadataStore(path)
+}
+
+// OpenMetadataStore opens (or creates) the metadata database at the given path
+func OpenMetadataStore(path string) (*MetadataStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metadata store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{snapshotsBucket, connectionsBucket, restoresBucket, drillsBucket, schedulesBucket, retentionBucket, contentsBucket, baseBackupsBucket, walArchivesBucket, pitrBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize metadata store: %w", err)
+	}
+
+	return &MetadataStore{db: db}, nil
+}
+
+// Close closes the underlying database
+func (ms *MetadataStore) Close() error {
+	return ms.db.Close()
+}
+
+// put stores v as JSON under key in bucket
+func (ms *MetadataStore) put(bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ms.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Put([]byte(key), data)
+	})
+}
+
+// get decodes the value stored under key in bucket into v, reporting whether it exists
+func (ms *MetadataStore) get(bucket, key string, v interface{}) (bool, error) {
+	var data []byte
+	err := ms.db.View(func(tx *bolt.Tx) error {
+		if raw := tx.Bucket([]byte(bucket)).Get([]byte(key)); raw != nil {
+			data = append([]byte(nil), raw...)
+		}
+		return nil
+	})
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// exists reports whether key is present in bucket
+func (ms *MetadataStore) exists(bucket, key string) (bool, error) {
+	found := false
+	err := ms.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(bucket)).Get([]byte(key)) != nil
+		return nil
+	})
+	return found, err
+}
+
+// forEach calls fn with the raw JSON of every value in bucket
+func (ms *MetadataStore) forEach(bucket string, fn func(data []byte) error) error {
+	return ms.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(_, v []byte) error {
+			return fn(v)
+		})
+	})
+}
+
+// delete removes key from bucket
+func (ms *MetadataStore) delete(bucket, key string) error {
+	return ms.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Delete([]byte(key))
+	})
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// lineWriter collects the output of a command and hands every complete line
+// to onLine as it arrives
+type lineWriter struct {
+	mu      sync.Mutex
+	output  strings.Builder
+	partial bytes.Buffer
+	onLine  func(line string)
+}
+
+func newLineWriter(onLine func(line string)) *lineWriter {
+	return &lineWriter{onLine: onLine}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.output.Write(p)
+	w.partial.Write(p)
+	for {
+		i := bytes.IndexByte(w.partial.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimRight(string(w.partial.Next(i+1)), "\r\n")
+		w.onLine(line)
+	}
+	return len(p), nil
+}
+
+// String returns everything written so far, flushing any unterminated last line
+func (w *lineWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.partial.Len() > 0 {
+		w.onLine(w.partial.String())
+		w.partial.Reset()
+	}
+	return w.output.String()
+}
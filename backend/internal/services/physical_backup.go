@@ -0,0 +1,364 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrBaseBackupNotFound is returned when a base backup does not exist
+	ErrBaseBackupNotFound = errors.New("base backup not found")
+	// ErrBaseBackupBusy is returned when a base backup is still being taken or restored
+	ErrBaseBackupBusy = errors.New("base backup is in use")
+)
+
+// pg_basebackup reports the WAL range a backup needs in its verbose output
+var (
+	walStartPattern = regexp.MustCompile(`write-ahead log start point: ([0-9A-Fa-f]+/[0-9A-Fa-f]+) on timeline (\d+)`)
+	walEndPattern   = regexp.MustCompile(`write-ahead log end point: ([0-9A-Fa-f]+/[0-9A-Fa-f]+)`)
+)
+
+// PhysicalBackupService takes base backups of whole clusters with
+// pg_basebackup, archives their write-ahead log continuously with
+// pg_receivewal and recovers them to a point in time into new data
+// directories. Base backups and WAL are kept in the local backup directory
+// under physical/<connection ID>, so connections whose snapshots go to
+// remote storage are refused; recovered data directories are created under
+// PITR_DATA_DIR (default ./pitr).
+type PhysicalBackupService struct {
+	mu           sync.Mutex
+	store        *MetadataStore
+	dbService    *DatabaseService
+	toolsService *PostgreSQLToolsService
+	jobs         *JobManager
+	events       *EventBus
+	dir          string
+	dataDir      string
+	archivers    map[string]*walArchiver
+}
+
+// NewPhysicalBackupService creates the physical backup service and resumes
+// the WAL archiving that was running when the server stopped
+func NewPhysicalBackupService(store *MetadataStore, dbService *DatabaseService, storage *SnapshotStores, jobs *JobManager, events *EventBus) *PhysicalBackupService {
+	dataDir := os.Getenv("PITR_DATA_DIR")
+	if dataDir == "" {
+		dataDir = "./pitr"
+	}
+
+	ps := &PhysicalBackupService{
+		store:        store,
+		dbService:    dbService,
+		toolsService: NewPostgreSQLToolsService(),
+		jobs:         jobs,
+		events:       events,
+		dir:          filepath.Join(storage.Local().Dir(), "physical"),
+		dataDir:      dataDir,
+		archivers:    make(map[string]*walArchiver),
+	}
+	ps.failInterruptedBaseBackups()
+	ps.failInterruptedRestores()
+	ps.resumeWALArchives()
+
+	return ps
+}
+
+// walDir is where the WAL of a connection is archived
+func (ps *PhysicalBackupService) walDir(connectionID string) string {
+	return filepath.Join(ps.dir, connectionID, "wal")
+}
+
+// requireLocalStorage refuses physical backups of a connection whose storage
+// is remote: they could only be kept locally, where the connection does not
+// expect its backups to be
+func requireLocalStorage(config *models.DatabaseConnection) error {
+	if !isLocalStorage(config.Storage) {
+		return fmt.Errorf("%w: connection %s uses %s storage; base backups and WAL can only be kept in local storage", ErrInvalidOptions, config.ID, config.Storage)
+	}
+	return nil
+}
+
+// replicationArgs returns the connection switches of pg_basebackup and
+// pg_receivewal, which connect to the cluster rather than a database
+func replicationArgs(config *models.DatabaseConnection) []string {
+	return []string{
+		fmt.Sprintf("--host=%s", config.Host),
+		fmt.Sprintf("--port=%d", config.Port),
+		fmt.Sprintf("--username=%s", config.Username),
+		"--no-password",
+	}
+}
+
+// CreateBaseBackup queues a base backup of the cluster of a saved connection.
+// The connection's user needs the REPLICATION attribute and a replication
+// entry in pg_hba.conf.
+func (ps *PhysicalBackupService) CreateBaseBackup(connectionID string, request *models.BaseBackupRequest) (*models.BaseBackup, error) {
+	config, err := ps.dbService.ResolveConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireLocalStorage(config); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	backup := &models.BaseBackup{
+		ID:           uuid.New().String(),
+		ConnectionID: connectionID,
+		Host:         fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Label:        request.Label,
+		Status:       "queued",
+		CreatedAt:    now,
+	}
+	if backup.Label == "" {
+		backup.Label = fmt.Sprintf("PGTimeMachine %s", now.UTC().Format(time.RFC3339))
+	}
+	backup.Directory = filepath.Join(ps.dir, connectionID, "base", backup.ID)
+
+	if err := ps.saveBaseBackup(backup); err != nil {
+		return nil, err
+	}
+
+	// Queue the backup on a private copy; streaming WAL alongside the copy
+	// takes a second connection
+	record := *backup
+	ps.jobs.Submit(&Job{
+		ID:          backup.ID,
+		Kind:        "base_backup",
+		Host:        backup.Host,
+		Priority:    request.Priority,
+		Connections: 2,
+		Run: func(ctx context.Context) {
+			ps.performBaseBackup(ctx, config, &record)
+		},
+		OnCancel: func() {
+			ps.finishBaseBackup(&record, "cancelled", "Base backup was cancelled")
+		},
+	})
+	backup.QueuePosition = ps.jobs.QueuePosition(backup.ID)
+	ps.events.Publish(models.JobEvent{Type: "state", JobID: backup.ID, Kind: "base_backup", Status: "queued"})
+
+	return backup, nil
+}
+
+// performBaseBackup runs pg_basebackup, writing compressed tar files of the data
+// directory and of the WAL needed to make it consistent; cancelling ctx kills
+// pg_basebackup and removes the partial backup
+func (ps *PhysicalBackupService) performBaseBackup(ctx context.Context, config *models.DatabaseConnection, backup *models.BaseBackup) {
+	log.Printf("Starting base backup %s", backup.ID)
+	now := time.Now()
+	backup.Status = "running"
+	backup.StartedAt = &now
+	ps.recordBaseBackup(backup)
+
+	if err := os.MkdirAll(filepath.Dir(backup.Directory), 0755); err != nil {
+		ps.finishBaseBackup(backup, "failed", fmt.Sprintf("Failed to create backup directory: %v", err))
+		return
+	}
+
+	args := append(replicationArgs(config),
+		fmt.Sprintf("--pgdata=%s", backup.Directory),
+		"--format=tar",
+		"--gzip",
+		"--wal-method=stream",
+		"--checkpoint=fast",
+		fmt.Sprintf("--label=%s", backup.Label),
+		"--verbose",
+	)
+	cmd := exec.CommandContext(ctx, ps.toolsService.GetPgBasebackupPath(), args...)
+	setProcessGroup(cmd)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", config.Password))
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		ps.finishBaseBackup(backup, "failed", fmt.Sprintf("Failed to capture pg_basebackup output: %v", err))
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		ps.finishBaseBackup(backup, "failed", fmt.Sprintf("Failed to start pg_basebackup: %v", err))
+		log.Printf("Base backup %s failed: %v", backup.ID, err)
+		return
+	}
+
+	var verbose strings.Builder
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		verbose.WriteString(line)
+		verbose.WriteByte('\n')
+		ps.events.Publish(models.JobEvent{Type: "log", JobID: backup.ID, Kind: "base_backup", Line: line})
+		if match := walStartPattern.FindStringSubmatch(line); match != nil {
+			backup.StartLSN = match[1]
+			backup.Timeline, _ = strconv.Atoi(match[2])
+		} else if match := walEndPattern.FindStringSubmatch(line); match != nil {
+			backup.EndLSN = match[1]
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		os.RemoveAll(backup.Directory)
+		if ctx.Err() != nil {
+			ps.finishBaseBackup(backup, "cancelled", "Base backup was cancelled")
+			return
+		}
+		ps.finishBaseBackup(backup, "failed", fmt.Sprintf("pg_basebackup failed: %v\nOutput: %s", err, verbose.String()))
+		log.Printf("Base backup %s failed: %v", backup.ID, err)
+		return
+	}
+
+	if backup.Size, err = pathSize(backup.Directory); err != nil {
+		log.Printf("Could not measure base backup %s: %v", backup.ID, err)
+	}
+	ps.finishBaseBackup(backup, "completed", "")
+	log.Printf("Base backup %s completed (%.2f MB)", backup.ID, float64(backup.Size)/(1024*1024))
+}
+
+// finishBaseBackup records the final status of a base backup
+func (ps *PhysicalBackupService) finishBaseBackup(backup *models.BaseBackup, status, message string) {
+	backup.Status = status
+	backup.ErrorMessage = message
+	now := time.Now()
+	backup.CompletedAt = &now
+	ps.recordBaseBackup(backup)
+}
+
+// recordBaseBackup saves a base backup and announces its state to event subscribers
+func (ps *PhysicalBackupService) recordBaseBackup(backup *models.BaseBackup) {
+	if err := ps.saveBaseBackup(backup); err != nil {
+		log.Printf("Failed to record base backup %s: %v", backup.ID, err)
+	}
+	ps.events.Publish(models.JobEvent{
+		Type:    "state",
+		JobID:   backup.ID,
+		Kind:    "base_backup",
+		Status:  backup.Status,
+		Message: backup.ErrorMessage,
+	})
+}
+
+// CancelBaseBackup stops a base backup that is queued or still running
+func (ps *PhysicalBackupService) CancelBaseBackup(id string) error {
+	if _, err := ps.GetBaseBackup(id); err != nil {
+		return err
+	}
+	return ps.jobs.Cancel(id)
+}
+
+// ListBaseBackups returns the base backups of a connection, or all of them,
+// newest first
+func (ps *PhysicalBackupService) ListBaseBackups(connectionID string) ([]*models.BaseBackup, error) {
+	backups := []*models.BaseBackup{}
+	err := ps.store.forEach(baseBackupsBucket, func(data []byte) error {
+		var backup models.BaseBackup
+		if err := json.Unmarshal(data, &backup); err != nil {
+			return err
+		}
+		if connectionID != "" && backup.ConnectionID != connectionID {
+			return nil
+		}
+		backups = append(backups, &backup)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list base backups: %w", err)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// GetBaseBackup retrieves a base backup by ID
+func (ps *PhysicalBackupService) GetBaseBackup(id string) (*models.BaseBackup, error) {
+	var backup models.BaseBackup
+	found, err := ps.store.get(baseBackupsBucket, id, &backup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base backup: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrBaseBackupNotFound, id)
+	}
+	if backup.Status == "queued" {
+		backup.QueuePosition = ps.jobs.QueuePosition(backup.ID)
+	}
+	return &backup, nil
+}
+
+// DeleteBaseBackup removes a base backup and its files. Archived WAL is kept;
+// it is only useful from the oldest remaining base backup on.
+func (ps *PhysicalBackupService) DeleteBaseBackup(id string) error {
+	backup, err := ps.GetBaseBackup(id)
+	if err != nil {
+		return err
+	}
+	if backup.Status == "queued" || backup.Status == "running" {
+		return fmt.Errorf("%w: %s is still being taken", ErrBaseBackupBusy, id)
+	}
+
+	restores, err := ps.ListRestores(backup.ConnectionID)
+	if err != nil {
+		return err
+	}
+	for _, restore := range restores {
+		if restore.BaseBackupID == id && (restore.Status == "queued" || restore.Status == "restoring") {
+			return fmt.Errorf("%w: %s is being restored by %s", ErrBaseBackupBusy, id, restore.ID)
+		}
+	}
+
+	if err := os.RemoveAll(backup.Directory); err != nil {
+		return fmt.Errorf("failed to delete base backup files: %w", err)
+	}
+	if err := ps.store.delete(baseBackupsBucket, id); err != nil {
+		return fmt.Errorf("failed to delete base backup: %w", err)
+	}
+
+	log.Printf("Deleted base backup %s", id)
+	return nil
+}
+
+// saveBaseBackup persists a base backup
+func (ps *PhysicalBackupService) saveBaseBackup(backup *models.BaseBackup) error {
+	if err := ps.store.put(baseBackupsBucket, backup.ID, backup); err != nil {
+		return fmt.Errorf("failed to save base backup: %w", err)
+	}
+	return nil
+}
+
+// failInterruptedBaseBackups marks base backups left queued or running by a
+// previous run as failed and removes their partial files
+func (ps *PhysicalBackupService) failInterruptedBaseBackups() {
+	backups, err := ps.ListBaseBackups("")
+	if err != nil {
+		log.Printf("Warning: Failed to check for interrupted base backups: %v", err)
+		return
+	}
+
+	for _, backup := range backups {
+		if backup.Status != "queued" && backup.Status != "running" {
+			continue
+		}
+		os.RemoveAll(backup.Directory)
+		backup.Status = "failed"
+		backup.ErrorMessage = "Base backup was interrupted by a server restart"
+		if err := ps.saveBaseBackup(backup); err != nil {
+			log.Printf("Failed to update interrupted base backup %s: %v", backup.ID, err)
+		}
+	}
+}
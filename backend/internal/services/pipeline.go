@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// isStreamed reports whether a snapshot was written from pg_dump's stdout
+// through a compressor, an encryptor or a remote store, and so must be read
+// back as a stream rather than by path
+func isStreamed(snapshot *models.Snapshot) bool {
+	return isCompressed(snapshot.Compression) || snapshot.Encryption != nil || !isLocalStorage(snapshot.Storage)
+}
+
+// isLocalStorage reports whether a snapshot is kept in the local backup
+// directory; snapshots recorded before storage backends existed are
+func isLocalStorage(storage string) bool {
+	return storage == "" || storage == StorageLocal
+}
+
+// dumpOutput is the pipeline pg_dump's stdout goes through when a snapshot is
+// streamed: it counts the logical bytes, compresses and encrypts them, and
+// writes the result into the snapshot store
+type dumpOutput struct {
+	sink    SnapshotWriter
+	stages  []io.WriteCloser // compressor and encryptor, outermost first
+	counter *countingWriter  // bytes produced by pg_dump
+	stored  *countingWriter  // bytes written to the store
+	digest  hash.Hash        // SHA-256 of the bytes written to the store
+	closed  bool
+}
+
+// newDumpOutput builds the stages writing into sink; dataKey is nil for
+// unencrypted snapshots
+func newDumpOutput(sink SnapshotWriter, snapshot *models.Snapshot, dataKey []byte) (*dumpOutput, error) {
+	output := &dumpOutput{sink: sink, digest: sha256.New()}
+	output.stored = newCountingWriter(io.MultiWriter(sink, output.digest))
+	var w io.Writer = output.stored
+
+	if dataKey != nil {
+		encryptor, err := newEncryptingWriter(w, dataKey)
+		if err != nil {
+			return nil, err
+		}
+		output.stages = append(output.stages, encryptor)
+		w = encryptor
+	}
+
+	if isCompressed(snapshot.Compression) {
+		compressor, err := newCompressor(w, snapshot.Compression, snapshot.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		output.stages = append([]io.WriteCloser{compressor}, output.stages...)
+		w = compressor
+	}
+
+	output.counter = newCountingWriter(w)
+	return output, nil
+}
+
+func (o *dumpOutput) Write(p []byte) (int, error) {
+	return o.counter.Write(p)
+}
+
+// Sum returns the hex SHA-256 digest of the bytes written to the store
+func (o *dumpOutput) Sum() string {
+	return hex.EncodeToString(o.digest.Sum(nil))
+}
+
+// Close flushes every stage and commits the snapshot to the store; later
+// calls do nothing
+func (o *dumpOutput) Close() error {
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+
+	for _, stage := range o.stages {
+		if err := stage.Close(); err != nil {
+			o.sink.Abort()
+			return err
+		}
+	}
+	return o.sink.Close()
+}
+
+// Abort discards the snapshot unless it was already committed
+func (o *dumpOutput) Abort() {
+	if o.closed {
+		return
+	}
+	o.closed = true
+	o.sink.Abort()
+}
+
+// openSnapshotInput opens a snapshot in its store for reading, decrypting and
+// decompressing it on the fly. The returned function releases the object.
+func (ss *SnapshotService) openSnapshotInput(ctx context.Context, snapshot *models.Snapshot) (io.Reader, func(), error) {
+	store, key, err := ss.snapshotObject(snapshot)
+	if err != nil {
+		return nil, nil, err
+	}
+	object, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	closers := []io.Closer{object}
+	cleanup := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i].Close()
+		}
+	}
+
+	var r io.Reader = object
+	if snapshot.Encryption != nil {
+		key, err := ss.keys.unwrap(snapshot.Encryption)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		if r, err = newDecryptingReader(r, key); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+	}
+
+	if isCompressed(snapshot.Compression) {
+		decompressor, err := newDecompressor(r, snapshot.Compression)
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to read compressed snapshot: %w", err)
+		}
+		closers = append(closers, decompressor)
+		r = decompressor
+	}
+
+	return r, cleanup, nil
+}
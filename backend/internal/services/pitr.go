@@ -0,0 +1,684 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrPointInTimeRestoreNotFound is returned when a point-in-time restore does not exist
+var ErrPointInTimeRestoreNotFound = errors.New("point-in-time restore not found")
+
+var lsnPattern = regexp.MustCompile(`^[0-9A-Fa-f]{1,8}/[0-9A-Fa-f]{1,8}$`)
+
+// recoveryLogTail is how much of the server log a failed recovery keeps
+const recoveryLogTail = 8 * 1024
+
+// StartPointInTimeRestore queues the recovery of a connection's cluster to a
+// point in time. The base backup is the one named by the request or the
+// latest completed before the target; it is unpacked into a new data
+// directory set up to replay archived WAL up to the target and then promote.
+// With Start the cluster is started with pg_ctl and the restore completes
+// once recovery has finished; otherwise recovery runs when it is first started.
+func (ps *PhysicalBackupService) StartPointInTimeRestore(connectionID string, request *models.PointInTimeRestoreRequest) (*models.PointInTimeRestore, error) {
+	if _, err := ps.dbService.GetSavedConnection(connectionID); err != nil {
+		return nil, err
+	}
+	if err := validateRecoveryTarget(request.Target); err != nil {
+		return nil, err
+	}
+
+	backup, err := ps.recoveryBaseBackup(connectionID, request.BaseBackupID, request.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	// A base backup on its own only reaches its end point
+	if hasRecoveryTarget(request.Target) {
+		segments, err := listWALSegments(ps.walDir(connectionID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read WAL archive: %w", err)
+		}
+		if len(segments) == 0 {
+			return nil, fmt.Errorf("%w: no WAL has been archived for connection %s; start WAL archiving or restore without a target", ErrInvalidOptions, connectionID)
+		}
+	}
+
+	restore := &models.PointInTimeRestore{
+		ID:           uuid.New().String(),
+		ConnectionID: connectionID,
+		BaseBackupID: backup.ID,
+		Target:       request.Target,
+		DataDir:      request.DataDir,
+		Port:         request.Port,
+		Start:        request.Start,
+		Status:       "queued",
+		CreatedAt:    time.Now(),
+	}
+	if restore.DataDir == "" {
+		restore.DataDir = filepath.Join(ps.dataDir, restore.ID)
+	}
+	// pg_ctl and restore_command run from other directories
+	if restore.DataDir, err = filepath.Abs(restore.DataDir); err != nil {
+		return nil, fmt.Errorf("%w: invalid data_dir: %v", ErrInvalidOptions, err)
+	}
+	if entries, err := os.ReadDir(restore.DataDir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%w: data_dir %s is not empty", ErrInvalidOptions, restore.DataDir)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: data_dir %s cannot be used: %v", ErrInvalidOptions, restore.DataDir, err)
+	}
+
+	if err := ps.saveRestore(restore); err != nil {
+		return nil, err
+	}
+
+	// Queue the restore on a private copy; restores into the same data
+	// directory run one at a time
+	record := *restore
+	ps.jobs.Submit(&Job{
+		ID:       restore.ID,
+		Kind:     "pitr_restore",
+		Host:     "local",
+		Database: restore.DataDir,
+		Priority: request.Priority,
+		Run: func(ctx context.Context) {
+			ps.performRestore(ctx, &record, backup)
+		},
+		OnCancel: func() {
+			ps.finishRestore(&record, "cancelled", "Point-in-time restore was cancelled")
+		},
+	})
+	restore.QueuePosition = ps.jobs.QueuePosition(restore.ID)
+	ps.events.Publish(models.JobEvent{Type: "state", JobID: restore.ID, Kind: "pitr_restore", Status: "queued"})
+
+	return restore, nil
+}
+
+// validateRecoveryTarget checks that at most one kind of target is set and
+// that it can be reached
+func validateRecoveryTarget(target models.RecoveryTarget) error {
+	set := 0
+	for _, isSet := range []bool{target.Time != nil, target.LSN != "", target.Name != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("%w: set only one of target time, lsn and name", ErrInvalidOptions)
+	}
+	if target.Time != nil && target.Time.After(time.Now()) {
+		return fmt.Errorf("%w: target time %s is in the future", ErrInvalidOptions, target.Time.Format(time.RFC3339))
+	}
+	if target.LSN != "" && !lsnPattern.MatchString(target.LSN) {
+		return fmt.Errorf("%w: target lsn %q is not a WAL location such as 0/1A2B3C4", ErrInvalidOptions, target.LSN)
+	}
+	return nil
+}
+
+func hasRecoveryTarget(target models.RecoveryTarget) bool {
+	return target.Time != nil || target.LSN != "" || target.Name != ""
+}
+
+// recoveryBaseBackup picks the base backup to recover from: the one
+// requested, which must end before the target, or else the latest completed
+// one that does. A restore point's position is unknown, so a named target
+// uses the latest base backup.
+func (ps *PhysicalBackupService) recoveryBaseBackup(connectionID, backupID string, target models.RecoveryTarget) (*models.BaseBackup, error) {
+	var candidates []*models.BaseBackup
+	if backupID != "" {
+		backup, err := ps.GetBaseBackup(backupID)
+		if err != nil {
+			return nil, err
+		}
+		if backup.ConnectionID != connectionID {
+			return nil, fmt.Errorf("%w: base backup %s was not taken of connection %s", ErrInvalidOptions, backupID, connectionID)
+		}
+		if backup.Status != "completed" {
+			return nil, fmt.Errorf("%w: base backup %s is not restorable (status: %s)", ErrInvalidOptions, backupID, backup.Status)
+		}
+		candidates = []*models.BaseBackup{backup}
+	} else {
+		backups, err := ps.ListBaseBackups(connectionID)
+		if err != nil {
+			return nil, err
+		}
+		for _, backup := range backups {
+			if backup.Status == "completed" {
+				candidates = append(candidates, backup)
+			}
+		}
+	}
+
+	for _, backup := range candidates {
+		if endsBefore(backup, target) {
+			return backup, nil
+		}
+	}
+	if backupID != "" {
+		return nil, fmt.Errorf("%w: base backup %s ends after the recovery target", ErrInvalidOptions, backupID)
+	}
+	return nil, fmt.Errorf("%w: connection %s has no completed base backup from before the recovery target", ErrInvalidOptions, connectionID)
+}
+
+// endsBefore reports whether recovery from a base backup can stop at target:
+// the backup is only consistent once its end point has been replayed
+func endsBefore(backup *models.BaseBackup, target models.RecoveryTarget) bool {
+	switch {
+	case target.Time != nil:
+		return backup.CompletedAt != nil && !backup.CompletedAt.After(*target.Time)
+	case target.LSN != "":
+		end, err := parseLSN(backup.EndLSN)
+		if err != nil {
+			return false
+		}
+		stop, err := parseLSN(target.LSN)
+		return err == nil && end <= stop
+	}
+	return true
+}
+
+// parseLSN converts a WAL location such as 16/B374D848 to a number
+func parseLSN(lsn string) (uint64, error) {
+	high, low, ok := strings.Cut(lsn, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid WAL location %q", lsn)
+	}
+	h, err := strconv.ParseUint(high, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid WAL location %q", lsn)
+	}
+	l, err := strconv.ParseUint(low, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid WAL location %q", lsn)
+	}
+	return h<<32 | l, nil
+}
+
+// performRestore unpacks a base backup into the restore's data directory,
+// configures recovery and, if requested, starts the cluster and waits for
+// recovery to finish. A restore that fails or is cancelled removes what it
+// unpacked.
+func (ps *PhysicalBackupService) performRestore(ctx context.Context, restore *models.PointInTimeRestore, backup *models.BaseBackup) {
+	log.Printf("Starting point-in-time restore %s into %s", restore.ID, restore.DataDir)
+	now := time.Now()
+	restore.Status = "restoring"
+	restore.StartedAt = &now
+	ps.recordRestore(restore)
+
+	_, statErr := os.Stat(restore.DataDir)
+	created := errors.Is(statErr, os.ErrNotExist)
+	discard := func() {
+		if created {
+			os.RemoveAll(restore.DataDir)
+			return
+		}
+		entries, _ := os.ReadDir(restore.DataDir)
+		for _, entry := range entries {
+			os.RemoveAll(filepath.Join(restore.DataDir, entry.Name()))
+		}
+	}
+
+	// PostgreSQL refuses to start on a data directory others can read
+	if err := os.MkdirAll(restore.DataDir, 0700); err != nil {
+		ps.finishRestore(restore, "failed", fmt.Sprintf("Failed to create data directory: %v", err))
+		return
+	}
+	if err := os.Chmod(restore.DataDir, 0700); err != nil {
+		ps.finishRestore(restore, "failed", fmt.Sprintf("Failed to secure data directory: %v", err))
+		return
+	}
+
+	if err := unpackBaseBackup(ctx, backup.Directory, restore.DataDir); err != nil {
+		discard()
+		if ctx.Err() != nil {
+			ps.finishRestore(restore, "cancelled", "Point-in-time restore was cancelled")
+			return
+		}
+		ps.finishRestore(restore, "failed", fmt.Sprintf("Failed to unpack base backup %s: %v", backup.ID, err))
+		log.Printf("Point-in-time restore %s failed: %v", restore.ID, err)
+		return
+	}
+	if err := writeRecoveryConfig(restore, ps.walDir(restore.ConnectionID)); err != nil {
+		discard()
+		ps.finishRestore(restore, "failed", fmt.Sprintf("Failed to configure recovery: %v", err))
+		return
+	}
+
+	if !restore.Start {
+		ps.finishRestore(restore, "completed", "")
+		log.Printf("Point-in-time restore %s is ready in %s", restore.ID, restore.DataDir)
+		return
+	}
+
+	restore.Status = "recovering"
+	ps.recordRestore(restore)
+	if err := ps.recoverCluster(ctx, restore); err != nil {
+		ps.stopCluster(restore.DataDir, "immediate")
+		restore.Output = readLogTail(recoveryLogPath(restore.DataDir))
+		discard()
+		if ctx.Err() != nil {
+			restore.Output = ""
+			ps.finishRestore(restore, "cancelled", "Point-in-time restore was cancelled")
+			return
+		}
+		ps.finishRestore(restore, "failed", err.Error())
+		log.Printf("Point-in-time restore %s failed: %v", restore.ID, err)
+		return
+	}
+
+	restore.Running = true
+	ps.finishRestore(restore, "completed", "")
+	log.Printf("Point-in-time restore %s recovered and is running from %s", restore.ID, restore.DataDir)
+}
+
+// unpackBaseBackup extracts the data directory and WAL tar files written by
+// pg_basebackup into dataDir. Tablespaces other than the default ones come
+// as tar files of their own and are not supported.
+func unpackBaseBackup(ctx context.Context, backupDir, dataDir string) error {
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, entry := range entries {
+		name := entry.Name()
+		var target string
+		switch strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".tar") {
+		case "base":
+			target, found = dataDir, true
+		case "pg_wal":
+			target = filepath.Join(dataDir, "pg_wal")
+		case "backup_manifest":
+			continue
+		default:
+			return fmt.Errorf("%s holds a tablespace, which point-in-time restore does not support", name)
+		}
+		if err := extractTar(ctx, filepath.Join(backupDir, name), target); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if !found {
+		return fmt.Errorf("no base.tar.gz in %s", backupDir)
+	}
+	return nil
+}
+
+// extractTar extracts a tar file, gzip-compressed if its name ends in .gz,
+// into dir; entries may not point outside it
+func extractTar(ctx context.Context, path, dir string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var input io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		input = gz
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	archive := tar.NewReader(input)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if rel, err := filepath.Rel(dir, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("entry %s points outside the data directory", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, header.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, archive)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("entry %s has unsupported type %c", header.Name, header.Typeflag)
+		}
+	}
+}
+
+// writeRecoveryConfig sets a restored data directory up for targeted
+// recovery from the WAL archive. The settings go to postgresql.auto.conf,
+// whose later lines override the source's; archiving and replication are
+// switched off so the copy never writes into the source's archive or
+// follows its primary. Configuration files kept outside the source's data
+// directory are replaced by minimal ones.
+func writeRecoveryConfig(restore *models.PointInTimeRestore, walDir string) error {
+	dataDir := restore.DataDir
+	if err := os.Remove(filepath.Join(dataDir, "standby.signal")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "recovery.signal"), nil, 0600); err != nil {
+		return err
+	}
+
+	defaults := map[string]string{
+		"postgresql.conf": "# The source cluster kept its configuration outside the data directory\n",
+		"pg_hba.conf": "local   all   all                  peer\n" +
+			"host    all   all   127.0.0.1/32   scram-sha-256\n" +
+			"host    all   all   ::1/128        scram-sha-256\n",
+		"pg_ident.conf": "",
+	}
+	for name, content := range defaults {
+		path := filepath.Join(dataDir, name)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				return err
+			}
+		}
+	}
+
+	settings := [][2]string{
+		{"restore_command", restoreCommand(walDir)},
+	}
+	target := restore.Target
+	switch {
+	case target.Time != nil:
+		settings = append(settings, [2]string{"recovery_target_time", target.Time.Format("2006-01-02 15:04:05.999999-07:00")})
+	case target.LSN != "":
+		settings = append(settings, [2]string{"recovery_target_lsn", target.LSN})
+	case target.Name != "":
+		settings = append(settings, [2]string{"recovery_target_name", target.Name})
+	}
+	settings = append(settings,
+		[2]string{"recovery_target_action", "promote"},
+		[2]string{"archive_mode", "off"},
+		[2]string{"primary_conninfo", ""},
+		[2]string{"primary_slot_name", ""},
+		[2]string{"hba_file", filepath.Join(dataDir, "pg_hba.conf")},
+		[2]string{"ident_file", filepath.Join(dataDir, "pg_ident.conf")},
+	)
+	if restore.Port != 0 {
+		settings = append(settings, [2]string{"port", strconv.Itoa(restore.Port)})
+	}
+
+	var conf strings.Builder
+	fmt.Fprintf(&conf, "\n# Point-in-time restore %s by PGTimeMachine\n", restore.ID)
+	for _, setting := range settings {
+		fmt.Fprintf(&conf, "%s = %s\n", setting[0], quoteConfigValue(setting[1]))
+	}
+
+	file, err := os.OpenFile(filepath.Join(dataDir, "postgresql.auto.conf"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(conf.String()); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// quoteConfigValue quotes a string for a PostgreSQL configuration file, in
+// which backslashes start escape sequences
+func quoteConfigValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// restoreCommand copies a segment from the WAL archive. The segment
+// pg_receivewal is still writing has the .partial suffix, and is used when
+// no complete one exists, so recovery can reach the latest archived WAL.
+func restoreCommand(walDir string) string {
+	// PostgreSQL expands % in restore_command
+	walDir = strings.ReplaceAll(walDir, "%", "%%")
+	if runtime.GOOS == "windows" {
+		segment := filepath.Join(walDir, "%f")
+		return fmt.Sprintf(`copy "%s" "%%p" || copy "%s.partial" "%%p"`, segment, segment)
+	}
+	quote := func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+	segment := walDir + "/%f"
+	return fmt.Sprintf(`cp %s "%%p" || cp %s "%%p"`, quote(segment), quote(segment+".partial"))
+}
+
+// recoveryLogPath is the server log of a restored cluster started by the service
+func recoveryLogPath(dataDir string) string {
+	return filepath.Join(dataDir, "pitr_recovery.log")
+}
+
+// recoverCluster starts a restored cluster and waits until recovery has
+// reached its target and promoted the cluster, which removes recovery.signal.
+// The cluster stopping first means recovery failed, for instance because the
+// target lies beyond the archived WAL.
+func (ps *PhysicalBackupService) recoverCluster(ctx context.Context, restore *models.PointInTimeRestore) error {
+	// pg_ctl returns once the server accepts connections, which a recovering
+	// cluster does as soon as it is consistent
+	start := exec.CommandContext(ctx, ps.toolsService.GetPgCtlPath(), "start",
+		"-D", restore.DataDir,
+		"-l", recoveryLogPath(restore.DataDir),
+		"-w", "-t", "86400",
+	)
+	setProcessGroup(start)
+	if output, err := start.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start the restored cluster: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		if _, err := os.Stat(filepath.Join(restore.DataDir, "recovery.signal")); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if !ps.clusterRunning(restore.DataDir) {
+			return errors.New("the restored cluster stopped before recovery finished; see output for its log")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// clusterRunning reports whether a server is running on a data directory;
+// pg_ctl status exits with 3 when none is
+func (ps *PhysicalBackupService) clusterRunning(dataDir string) bool {
+	err := exec.Command(ps.toolsService.GetPgCtlPath(), "status", "-D", dataDir).Run()
+	var exitErr *exec.ExitError
+	return !(errors.As(err, &exitErr) && exitErr.ExitCode() == 3)
+}
+
+// stopCluster stops the server running on a data directory, if any
+func (ps *PhysicalBackupService) stopCluster(dataDir, mode string) error {
+	if !ps.clusterRunning(dataDir) {
+		return nil
+	}
+	output, err := exec.Command(ps.toolsService.GetPgCtlPath(), "stop", "-D", dataDir, "-m", mode, "-w").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to stop the restored cluster: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// readLogTail returns the end of a log file
+func readLogTail(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.Size() > recoveryLogTail {
+		file.Seek(info.Size()-recoveryLogTail, io.SeekStart)
+	}
+	tail, _ := io.ReadAll(file)
+	return string(tail)
+}
+
+// StopRestoredCluster stops the cluster a point-in-time restore left running.
+// The data directory is kept.
+func (ps *PhysicalBackupService) StopRestoredCluster(id string) (*models.PointInTimeRestore, error) {
+	restore, err := ps.GetRestore(id)
+	if err != nil {
+		return nil, err
+	}
+	if !restore.Running {
+		return nil, fmt.Errorf("%w: the cluster of point-in-time restore %s is not running", ErrInvalidOptions, id)
+	}
+	if err := ps.stopCluster(restore.DataDir, "fast"); err != nil {
+		return nil, err
+	}
+
+	restore.Running = false
+	ps.recordRestore(restore)
+	log.Printf("Stopped the cluster of point-in-time restore %s", id)
+	return restore, nil
+}
+
+// CancelRestore stops a point-in-time restore that is queued or still running
+func (ps *PhysicalBackupService) CancelRestore(id string) error {
+	if _, err := ps.GetRestore(id); err != nil {
+		return err
+	}
+	return ps.jobs.Cancel(id)
+}
+
+// finishRestore records the final status of a point-in-time restore
+func (ps *PhysicalBackupService) finishRestore(restore *models.PointInTimeRestore, status, message string) {
+	restore.Status = status
+	restore.ErrorMessage = message
+	now := time.Now()
+	restore.CompletedAt = &now
+	ps.recordRestore(restore)
+}
+
+// recordRestore saves a point-in-time restore and announces its state to event subscribers
+func (ps *PhysicalBackupService) recordRestore(restore *models.PointInTimeRestore) {
+	if err := ps.saveRestore(restore); err != nil {
+		log.Printf("Failed to record point-in-time restore %s: %v", restore.ID, err)
+	}
+	ps.events.Publish(models.JobEvent{
+		Type:    "state",
+		JobID:   restore.ID,
+		Kind:    "pitr_restore",
+		Status:  restore.Status,
+		Message: restore.ErrorMessage,
+	})
+}
+
+// ListRestores returns the point-in-time restores of a connection, or all of
+// them, newest first
+func (ps *PhysicalBackupService) ListRestores(connectionID string) ([]*models.PointInTimeRestore, error) {
+	restores := []*models.PointInTimeRestore{}
+	err := ps.store.forEach(pitrBucket, func(data []byte) error {
+		var restore models.PointInTimeRestore
+		if err := json.Unmarshal(data, &restore); err != nil {
+			return err
+		}
+		if connectionID != "" && restore.ConnectionID != connectionID {
+			return nil
+		}
+		restores = append(restores, &restore)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list point-in-time restores: %w", err)
+	}
+
+	sort.Slice(restores, func(i, j int) bool {
+		return restores[i].CreatedAt.After(restores[j].CreatedAt)
+	})
+	return restores, nil
+}
+
+// GetRestore retrieves a point-in-time restore by ID
+func (ps *PhysicalBackupService) GetRestore(id string) (*models.PointInTimeRestore, error) {
+	var restore models.PointInTimeRestore
+	found, err := ps.store.get(pitrBucket, id, &restore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read point-in-time restore: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrPointInTimeRestoreNotFound, id)
+	}
+	if restore.Status == "queued" {
+		restore.QueuePosition = ps.jobs.QueuePosition(restore.ID)
+	}
+	return &restore, nil
+}
+
+// saveRestore persists a point-in-time restore
+func (ps *PhysicalBackupService) saveRestore(restore *models.PointInTimeRestore) error {
+	if err := ps.store.put(pitrBucket, restore.ID, restore); err != nil {
+		return fmt.Errorf("failed to save point-in-time restore: %w", err)
+	}
+	return nil
+}
+
+// failInterruptedRestores marks point-in-time restores left unfinished by a
+// previous run as failed. Their data directories are left for inspection.
+func (ps *PhysicalBackupService) failInterruptedRestores() {
+	restores, err := ps.ListRestores("")
+	if err != nil {
+		log.Printf("Warning: Failed to check for interrupted point-in-time restores: %v", err)
+		return
+	}
+
+	for _, restore := range restores {
+		if restore.Status != "queued" && restore.Status != "restoring" && restore.Status != "recovering" {
+			continue
+		}
+		restore.Status = "failed"
+		restore.ErrorMessage = "Point-in-time restore was interrupted by a server restart"
+		if err := ps.saveRestore(restore); err != nil {
+			log.Printf("Failed to update interrupted point-in-time restore %s: %v", restore.ID, err)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+func TestParseLSN(t *testing.T) {
+	tests := []struct {
+		lsn  string
+		want uint64
+	}{
+		{"0/0", 0},
+		{"0/1A2B3C4", 0x1A2B3C4},
+		{"16/B374D848", 0x16_B374D848},
+		{"ffffffff/FFFFFFFF", 1<<64 - 1},
+	}
+	for _, tt := range tests {
+		if got, err := parseLSN(tt.lsn); err != nil || got != tt.want {
+			t.Errorf("parseLSN(%q) = %x, %v, want %x", tt.lsn, got, err, tt.want)
+		}
+	}
+	for _, lsn := range []string{"", "16", "16/", "/B374D848", "G/0", "100000000/0"} {
+		if _, err := parseLSN(lsn); err == nil {
+			t.Errorf("parseLSN(%q) succeeded", lsn)
+		}
+	}
+
+	// Locations compare as numbers, not strings
+	low, _ := parseLSN("0/FFFFFFFF")
+	high, _ := parseLSN("1/0")
+	if low >= high {
+		t.Errorf("0/FFFFFFFF = %x is not before 1/0 = %x", low, high)
+	}
+}
+
+func TestValidateRecoveryTarget(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name   string
+		target models.RecoveryTarget
+		valid  bool
+	}{
+		{"latest", models.RecoveryTarget{}, true},
+		{"time", models.RecoveryTarget{Time: &past}, true},
+		{"lsn", models.RecoveryTarget{LSN: "16/B374D848"}, true},
+		{"restore point", models.RecoveryTarget{Name: "before-migration"}, true},
+		{"future time", models.RecoveryTarget{Time: &future}, false},
+		{"malformed lsn", models.RecoveryTarget{LSN: "16-B374D848"}, false},
+		{"time and lsn", models.RecoveryTarget{Time: &past, LSN: "0/1"}, false},
+		{"lsn and name", models.RecoveryTarget{LSN: "0/1", Name: "x"}, false},
+	}
+	for _, tt := range tests {
+		err := validateRecoveryTarget(tt.target)
+		if tt.valid && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: error = %v, want ErrInvalidOptions", tt.name, err)
+		}
+	}
+}
+
+func TestRecoveryBaseBackup(t *testing.T) {
+	ps := &PhysicalBackupService{store: newTestStore(t), jobs: NewJobManager()}
+	base := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) *time.Time {
+		t := base.Add(time.Duration(hours) * time.Hour)
+		return &t
+	}
+	for _, backup := range []*models.BaseBackup{
+		{ID: "early", ConnectionID: "conn-a", Status: "completed", EndLSN: "0/100", CreatedAt: *at(0), CompletedAt: at(1)},
+		{ID: "late", ConnectionID: "conn-a", Status: "completed", EndLSN: "0/300", CreatedAt: *at(4), CompletedAt: at(5)},
+		{ID: "failed", ConnectionID: "conn-a", Status: "failed", CreatedAt: *at(6)},
+		{ID: "other", ConnectionID: "conn-b", Status: "completed", EndLSN: "0/50", CreatedAt: *at(0), CompletedAt: at(1)},
+	} {
+		if err := ps.saveBaseBackup(backup); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		backupID string
+		target   models.RecoveryTarget
+		want     string
+		wantErr  error
+	}{
+		{"latest", "", models.RecoveryTarget{}, "late", nil},
+		{"restore point", "", models.RecoveryTarget{Name: "before-migration"}, "late", nil},
+		{"time between backups", "", models.RecoveryTarget{Time: at(3)}, "early", nil},
+		{"time after both", "", models.RecoveryTarget{Time: at(5)}, "late", nil},
+		{"lsn between backups", "", models.RecoveryTarget{LSN: "0/200"}, "early", nil},
+		{"time before any backup", "", models.RecoveryTarget{Time: at(0)}, "", ErrInvalidOptions},
+		{"requested", "early", models.RecoveryTarget{Time: at(6)}, "early", nil},
+		{"requested ends after target", "late", models.RecoveryTarget{LSN: "0/200"}, "", ErrInvalidOptions},
+		{"requested failed", "failed", models.RecoveryTarget{}, "", ErrInvalidOptions},
+		{"requested of another connection", "other", models.RecoveryTarget{}, "", ErrInvalidOptions},
+		{"requested missing", "missing", models.RecoveryTarget{}, "", ErrBaseBackupNotFound},
+	}
+	for _, tt := range tests {
+		backup, err := ps.recoveryBaseBackup("conn-a", tt.backupID, tt.target)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || backup.ID != tt.want {
+			t.Errorf("%s: recoveryBaseBackup = %v, %v, want %s", tt.name, backup, err, tt.want)
+		}
+	}
+}
+
+// writeTestTar writes a gzip-compressed tar file with the given entries
+func writeTestTar(t *testing.T, path string, headers []*tar.Header, contents map[string]string) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	archive := tar.NewWriter(gz)
+	for _, header := range headers {
+		content := contents[header.Name]
+		header.Size = int64(len(content))
+		if header.Mode == 0 {
+			header.Mode = 0600
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractTar(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "base.tar.gz")
+	writeTestTar(t, path, []*tar.Header{
+		{Name: "PG_VERSION", Typeflag: tar.TypeReg},
+		{Name: "global/", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "global/pg_control", Typeflag: tar.TypeReg},
+		{Name: "base/1/1259", Typeflag: tar.TypeReg},
+	}, map[string]string{"PG_VERSION": "17\n", "global/pg_control": "control", "base/1/1259": "pg_class"})
+
+	dataDir := filepath.Join(dir, "data")
+	if err := extractTar(context.Background(), path, dataDir); err != nil {
+		t.Fatalf("extractTar: %v", err)
+	}
+	for name, want := range map[string]string{"PG_VERSION": "17\n", "global/pg_control": "control", "base/1/1259": "pg_class"} {
+		got, err := os.ReadFile(filepath.Join(dataDir, filepath.FromSlash(name)))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestExtractTarRejectsEscapingEntries(t *testing.T) {
+	for _, name := range []string{"../escaped", "base/../../escaped", "/../escaped"} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "base.tar.gz")
+		writeTestTar(t, path, []*tar.Header{{Name: name, Typeflag: tar.TypeReg}}, map[string]string{name: "x"})
+
+		err := extractTar(context.Background(), path, filepath.Join(dir, "data"))
+		if err == nil || !strings.Contains(err.Error(), "outside the data directory") {
+			t.Errorf("extracting %q: error = %v, want an entry outside the data directory", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "escaped")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("extracting %q wrote outside the data directory", name)
+		}
+	}
+}
+
+func TestWriteRecoveryConfig(t *testing.T) {
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, "standby.signal"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "postgresql.auto.conf"), []byte("archive_mode = 'on'\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	restore := &models.PointInTimeRestore{
+		ID:      "pitr-1",
+		DataDir: dataDir,
+		Port:    5499,
+		Target:  models.RecoveryTarget{Name: "before 'migration'"},
+	}
+	if err := writeRecoveryConfig(restore, filepath.Join(dataDir, "wal")); err != nil {
+		t.Fatalf("writeRecoveryConfig: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dataDir, "standby.signal")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("standby.signal was kept")
+	}
+	for _, name := range []string{"recovery.signal", "postgresql.conf", "pg_hba.conf", "pg_ident.conf"} {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); err != nil {
+			t.Errorf("%s was not written: %v", name, err)
+		}
+	}
+
+	conf, err := os.ReadFile(filepath.Join(dataDir, "postgresql.auto.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The source's settings come first and are overridden
+	for _, want := range []string{
+		"archive_mode = 'on'\n",
+		"recovery_target_name = 'before ''migration'''\n",
+		"recovery_target_action = 'promote'\n",
+		"archive_mode = 'off'\n",
+		"port = '5499'\n",
+	} {
+		if !strings.Contains(string(conf), want) {
+			t.Errorf("postgresql.auto.conf does not contain %q:\n%s", want, conf)
+		}
+	}
+	if strings.Index(string(conf), "archive_mode = 'off'") < strings.Index(string(conf), "archive_mode = 'on'") {
+		t.Errorf("archive_mode is not switched off after the source's setting:\n%s", conf)
+	}
+}
+
+func TestQuoteConfigValue(t *testing.T) {
+	tests := map[string]string{
+		"promote":               `'promote'`,
+		"it's":                  `'it''s'`,
+		`C:\pitr\wal\%f`:        `'C:\\pitr\\wal\\%f'`,
+		`cp '/wal/%f' "%p"`:     `'cp ''/wal/%f'' "%p"'`,
+		"2026-10-16 12:00:00+0": `'2026-10-16 12:00:00+0'`,
+	}
+	for value, want := range tests {
+		if got := quoteConfigValue(value); got != want {
+			t.Errorf("quoteConfigValue(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
 	"strings"
@@ -9,8 +10,9 @@ import (
 
 // PostgreSQLToolsService handles PostgreSQL client tools detection and validation
 type PostgreSQLToolsService struct {
-	pgDumpPath string
-	psqlPath   string
+	pgDumpPath    string
+	psqlPath      string
+	pgRestorePath string
 }
 
 // NewPostgreSQLToolsService creates a new PostgreSQL tools service
@@ -34,11 +36,26 @@ func (pts *PostgreSQLToolsService) ValidateTools() error {
 	}
 	pts.psqlPath = psqlPath
 
+	// Check for pg_restore
+	pgRestorePath, err := pts.findTool("pg_restore")
+	if err != nil {
+		return fmt.Errorf("pg_restore not found: %w\n\nPlease install PostgreSQL client tools:\n%s", err, pts.getInstallInstructions())
+	}
+	pts.pgRestorePath = pgRestorePath
+
 	return nil
 }
 
-// findTool attempts to locate a PostgreSQL tool in the system PATH
+// findTool attempts to locate a PostgreSQL tool, honouring an explicit
+// <TOOL>_PATH environment variable (e.g. PG_DUMP_PATH) before the system PATH
 func (pts *PostgreSQLToolsService) findTool(toolName string) (string, error) {
+	if override := os.Getenv(strings.ToUpper(toolName) + "_PATH"); override != "" {
+		if _, err := os.Stat(override); err != nil {
+			return "", fmt.Errorf("tool '%s' not found at %s", toolName, override)
+		}
+		return override, nil
+	}
+
 	// On Windows, try both with and without .exe extension
 	if runtime.GOOS == "windows" {
 		if !strings.HasSuffix(toolName, ".exe") {
@@ -99,6 +116,39 @@ func (pts *PostgreSQLToolsService) GetPsqlPath() string {
 	return "psql" // fallback to system PATH
 }
 
+// GetPgRestorePath returns the path to pg_restore
+func (pts *PostgreSQLToolsService) GetPgRestorePath() string {
+	if pts.pgRestorePath != "" {
+		return pts.pgRestorePath
+	}
+	return "pg_restore" // fallback to system PATH
+}
+
+// GetPgBasebackupPath returns the path to pg_basebackup. Like pg_receivewal
+// and pg_ctl it is only needed for physical backups, so it is looked up when
+// used rather than validated at start.
+func (pts *PostgreSQLToolsService) GetPgBasebackupPath() string {
+	return pts.serverToolPath("pg_basebackup")
+}
+
+// GetPgReceivewalPath returns the path to pg_receivewal
+func (pts *PostgreSQLToolsService) GetPgReceivewalPath() string {
+	return pts.serverToolPath("pg_receivewal")
+}
+
+// GetPgCtlPath returns the path to pg_ctl
+func (pts *PostgreSQLToolsService) GetPgCtlPath() string {
+	return pts.serverToolPath("pg_ctl")
+}
+
+// serverToolPath locates an optional tool, falling back to the system PATH
+func (pts *PostgreSQLToolsService) serverToolPath(toolName string) string {
+	if path, err := pts.findTool(toolName); err == nil {
+		return path
+	}
+	return toolName
+}
+
 // TestToolVersions gets version information for debugging
 func (pts *PostgreSQLToolsService) TestToolVersions() (map[string]string, error) {
 	versions := make(map[string]string)
@@ -121,5 +171,14 @@ func (pts *PostgreSQLToolsService) TestToolVersions() (map[string]string, error)
 		}
 	}
 
+	// Test pg_restore version
+	if pgRestoreCmd := exec.Command(pts.GetPgRestorePath(), "--version"); pgRestoreCmd != nil {
+		if output, err := pgRestoreCmd.Output(); err == nil {
+			versions["pg_restore"] = strings.TrimSpace(string(output))
+		} else {
+			versions["pg_restore"] = fmt.Sprintf("Error: %v", err)
+		}
+	}
+
 	return versions, nil
 }
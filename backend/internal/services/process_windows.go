@@ -0,0 +1,23 @@
+//go:build windows
+
+package services
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup arranges for cancelling cmd to kill the process; Windows has
+// no process groups to signal, and the PostgreSQL tools do not fork children
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+}
+
+// killProcessGroup terminates the process started by cmd
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// pg_dump --verbose announces each table as it starts copying its data, e.g.
+// `pg_dump: dumping contents of table "public.users"` (older releases omit the
+// schema and quotes)
+var dumpTablePattern = regexp.MustCompile(`dumping contents of table "?(.+?)"?$`)
+
+// With --jobs the leader confirms each table copied by a worker, e.g.
+// `pg_dump: finished item 3287 TABLE DATA users` (the tag omits the schema)
+var dumpFinishedTablePattern = regexp.MustCompile(`finished item \d+ TABLE DATA (.+)$`)
+
+// Once data has started, a "creating ..." line means pg_dump has moved on to
+// post-data objects such as indexes and constraints
+var dumpPostDataPattern = regexp.MustCompile(`: creating `)
+
+// tableOverheadBytes is added to every table's weight so that many small
+// tables still move the progress bar
+const tableOverheadBytes = 8192
+
+// Share of the progress bar before the first table and after the last one,
+// when pg_dump reads the catalog and writes indexes and constraints
+const (
+	dumpSchemaPercent = 5
+	dumpFinishPercent = 95
+)
+
+// dumpProgress tracks a running pg_dump by parsing its verbose output against
+// the table sizes of the source database
+type dumpProgress struct {
+	mu            sync.Mutex
+	filePath      string
+	output        *dumpOutput // pipeline of a streamed dump, if any
+	parallel      bool
+	startedAt     time.Time
+	weights       map[string]int64
+	totalWeight   int64
+	doneWeight    int64
+	tablesTotal   int
+	tablesDone    int
+	estimated     int64
+	active        []activeTable
+	dataStartedAt time.Time
+}
+
+// activeTable is a table whose data is being copied
+type activeTable struct {
+	name   string
+	weight int64
+}
+
+// newDumpProgress creates a tracker for a dump written to filePath. A serial
+// dump copies one table at a time, so each new table finishes the previous
+// one; a parallel dump copies several and reports each as it finishes.
+func newDumpProgress(filePath string, tables []models.TableStats, parallel bool) *dumpProgress {
+	p := &dumpProgress{
+		filePath:    filePath,
+		parallel:    parallel,
+		startedAt:   time.Now(),
+		weights:     make(map[string]int64),
+		tablesTotal: len(tables),
+	}
+	for _, table := range tables {
+		weight := table.SizeBytes + tableOverheadBytes
+		p.weights[table.Schema+"."+table.Name] = weight
+		// Older pg_dump releases report the bare table name
+		if _, exists := p.weights[table.Name]; !exists {
+			p.weights[table.Name] = weight
+		}
+		p.totalWeight += weight
+		p.estimated += table.SizeBytes
+	}
+	return p
+}
+
+// observe consumes one line of pg_dump stderr and reports whether the dump
+// moved on to another table
+func (p *dumpProgress) observe(line string) bool {
+	line = strings.TrimSpace(line)
+	matches := dumpTablePattern.FindStringSubmatch(line)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if matches == nil {
+		if finished := dumpFinishedTablePattern.FindStringSubmatch(line); finished != nil {
+			return p.finishTable(finished[1])
+		}
+		if !p.dataStartedAt.IsZero() && len(p.active) > 0 && dumpPostDataPattern.MatchString(line) {
+			p.finishActiveTables()
+			return true
+		}
+		return false
+	}
+
+	if !p.parallel {
+		p.finishActiveTables()
+	}
+	if p.dataStartedAt.IsZero() {
+		p.dataStartedAt = time.Now()
+	}
+	weight := p.weights[matches[1]]
+	if weight == 0 {
+		weight = tableOverheadBytes
+	}
+	p.active = append(p.active, activeTable{name: matches[1], weight: weight})
+	return true
+}
+
+// finishTable credits the active table with the given name, with or without
+// its schema, as done; callers hold mu
+func (p *dumpProgress) finishTable(name string) bool {
+	for i, table := range p.active {
+		if table.name != name && !strings.HasSuffix(table.name, "."+name) {
+			continue
+		}
+		p.doneWeight += table.weight
+		p.tablesDone++
+		p.active = append(p.active[:i], p.active[i+1:]...)
+		return true
+	}
+	return false
+}
+
+// finishActiveTables credits every table being dumped as done; callers hold mu
+func (p *dumpProgress) finishActiveTables() {
+	for _, table := range p.active {
+		p.doneWeight += table.weight
+		p.tablesDone++
+	}
+	p.active = nil
+}
+
+// activeNames lists the tables being dumped; callers hold mu
+func (p *dumpProgress) activeNames() string {
+	names := make([]string, len(p.active))
+	for i, table := range p.active {
+		names[i] = table.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// report builds the progress of the dump as seen so far
+func (p *dumpProgress) report(snapshotID string) *models.SnapshotProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	startedAt := p.startedAt
+	progress := &models.SnapshotProgress{
+		SnapshotID:     snapshotID,
+		Status:         "in_progress",
+		StartedAt:      &startedAt,
+		CurrentTable:   p.activeNames(),
+		TablesDone:     p.tablesDone,
+		TablesTotal:    p.tablesTotal,
+		EstimatedBytes: p.estimated,
+	}
+	if size, err := pathSize(p.filePath); err == nil {
+		progress.BytesWritten = size
+		progress.FileSize = size
+	}
+	// Streamed dumps may not be on local disk; compare their output before
+	// compression with the table sizes
+	if p.output != nil {
+		progress.BytesWritten = p.output.counter.Count()
+		progress.FileSize = p.output.stored.Count()
+	}
+
+	switch {
+	case p.dataStartedAt.IsZero():
+		progress.Progress = 1
+		progress.Message = "Reading database schema..."
+	case p.totalWeight == 0:
+		progress.Progress = dumpSchemaPercent
+		progress.Message = "Dumping table data..."
+		if len(p.active) == 1 {
+			progress.Message = fmt.Sprintf("Dumping table %s", progress.CurrentTable)
+		} else if len(p.active) > 1 {
+			progress.Message = fmt.Sprintf("Dumping tables %s", progress.CurrentTable)
+		}
+	default:
+		// Count the current tables as half done so large tables don't stall the bar
+		done := float64(p.doneWeight)
+		for _, table := range p.active {
+			done += float64(table.weight) / 2
+		}
+		fraction := done / float64(p.totalWeight)
+		if fraction > 1 {
+			fraction = 1
+		}
+		progress.Progress = dumpSchemaPercent + int(fraction*(dumpFinishPercent-dumpSchemaPercent))
+
+		switch len(p.active) {
+		case 0:
+			progress.Message = "Writing indexes and constraints..."
+		case 1:
+			progress.Message = fmt.Sprintf("Dumping table %s (%d of %d)", progress.CurrentTable, p.tablesDone+1, p.tablesTotal)
+		default:
+			progress.Message = fmt.Sprintf("Dumping tables %s (%d of %d done)", progress.CurrentTable, p.tablesDone, p.tablesTotal)
+		}
+
+		if done > 0 {
+			elapsed := time.Since(p.dataStartedAt).Seconds()
+			eta := int64(elapsed * (float64(p.totalWeight) - done) / done)
+			progress.ETASeconds = &eta
+		}
+	}
+
+	return progress
+}
+
+// progressTracker holds the trackers of the dumps currently running
+type progressTracker struct {
+	mu    sync.Mutex
+	dumps map[string]*dumpProgress
+}
+
+func newProgressTracker() *progressTracker {
+	return &progressTracker{dumps: make(map[string]*dumpProgress)}
+}
+
+func (t *progressTracker) start(snapshotID string, p *dumpProgress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dumps[snapshotID] = p
+}
+
+func (t *progressTracker) get(snapshotID string) *dumpProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dumps[snapshotID]
+}
+
+func (t *progressTracker) finish(snapshotID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.dumps, snapshotID)
+}
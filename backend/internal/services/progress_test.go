@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// progressTables weigh 1,000,000, 8,192 and 100,000 with the table overhead
+var progressTables = []models.TableStats{
+	{Schema: "public", Name: "big", SizeBytes: 1000000 - tableOverheadBytes},
+	{Schema: "public", Name: "small", SizeBytes: 0},
+	{Schema: "audit", Name: "events", SizeBytes: 100000 - tableOverheadBytes},
+}
+
+type progressStep struct {
+	line       string
+	moved      bool
+	progress   int
+	tablesDone int
+	current    string
+	message    string
+}
+
+func runProgressSteps(t *testing.T, p *dumpProgress, steps []progressStep) {
+	t.Helper()
+	for _, step := range steps {
+		if moved := p.observe(step.line); moved != step.moved {
+			t.Errorf("observe(%q) = %v, want %v", step.line, moved, step.moved)
+		}
+		report := p.report("snap")
+		if report.Progress != step.progress || report.TablesDone != step.tablesDone || report.CurrentTable != step.current || report.Message != step.message {
+			t.Errorf("after %q: progress %d, %d done, current %q, message %q; want %d, %d, %q, %q",
+				step.line, report.Progress, report.TablesDone, report.CurrentTable, report.Message,
+				step.progress, step.tablesDone, step.current, step.message)
+		}
+		if report.TablesTotal != 3 || report.EstimatedBytes != 1108192-3*tableOverheadBytes {
+			t.Errorf("after %q: %d tables, %d bytes estimated", step.line, report.TablesTotal, report.EstimatedBytes)
+		}
+	}
+}
+
+func TestDumpProgressSerial(t *testing.T) {
+	p := newDumpProgress("", progressTables, false)
+	runProgressSteps(t, p, []progressStep{
+		{line: "pg_dump: reading schemas", progress: 1, message: "Reading database schema..."},
+		{line: "pg_dump: creating TABLE \"public.big\"", progress: 1, message: "Reading database schema..."},
+		// The current table counts as half done
+		{line: `pg_dump: dumping contents of table "public.big"`, moved: true, progress: 45, current: "public.big", message: "Dumping table public.big (1 of 3)"},
+		{line: `pg_dump: dumping contents of table "public.small"`, moved: true, progress: 86, tablesDone: 1, current: "public.small", message: "Dumping table public.small (2 of 3)"},
+		// Older releases report the bare name
+		{line: "pg_dump: dumping contents of table events", moved: true, progress: 90, tablesDone: 2, current: "events", message: "Dumping table events (3 of 3)"},
+		{line: "pg_dump: creating INDEX \"public.big_idx\"", moved: true, progress: 95, tablesDone: 3, message: "Writing indexes and constraints..."},
+		{line: "pg_dump: creating CONSTRAINT \"public.big_pkey\"", progress: 95, tablesDone: 3, message: "Writing indexes and constraints..."},
+	})
+}
+
+func TestDumpProgressParallel(t *testing.T) {
+	p := newDumpProgress("", progressTables, true)
+	runProgressSteps(t, p, []progressStep{
+		{line: `pg_dump: dumping contents of table "public.big"`, moved: true, progress: 45, current: "public.big", message: "Dumping table public.big (1 of 3)"},
+		{line: `pg_dump: dumping contents of table "audit.events"`, moved: true, progress: 49, current: "public.big, audit.events", message: "Dumping tables public.big, audit.events (0 of 3 done)"},
+		// Workers finish in any order; the leader names tables without schema
+		{line: "pg_dump: finished item 3290 TABLE DATA events", moved: true, progress: 53, tablesDone: 1, current: "public.big", message: "Dumping table public.big (2 of 3)"},
+		{line: "pg_dump: finished item 3291 TABLE DATA unknown", progress: 53, tablesDone: 1, current: "public.big", message: "Dumping table public.big (2 of 3)"},
+		{line: `pg_dump: dumping contents of table "public.small"`, moved: true, progress: 54, tablesDone: 1, current: "public.big, public.small", message: "Dumping tables public.big, public.small (1 of 3 done)"},
+		{line: "pg_dump: finished item 3287 TABLE DATA big", moved: true, progress: 94, tablesDone: 2, current: "public.small", message: "Dumping table public.small (3 of 3)"},
+		{line: "pg_dump: finished item 3288 TABLE DATA small", moved: true, progress: 95, tablesDone: 3, message: "Writing indexes and constraints..."},
+	})
+}
+
+func TestDumpProgressWithoutTableSizes(t *testing.T) {
+	p := newDumpProgress("", nil, false)
+	runSteps := []struct {
+		line    string
+		message string
+	}{
+		{"pg_dump: reading schemas", "Reading database schema..."},
+		{`pg_dump: dumping contents of table "public.orders"`, "Dumping table public.orders"},
+	}
+	for _, step := range runSteps {
+		p.observe(step.line)
+		if report := p.report("snap"); report.Message != step.message || report.ETASeconds != nil {
+			t.Errorf("after %q: message %q, eta %v; want %q and no eta", step.line, report.Message, report.ETASeconds, step.message)
+		}
+	}
+}
@@ -0,0 +1,552 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrSnapshotNotRestorable is returned when a restore names a snapshot that
+// has not completed
+var ErrSnapshotNotRestorable = errors.New("snapshot is not restorable")
+
+// RestoreSnapshot restores a database from a snapshot using psql or pg_restore
+func (ss *SnapshotService) RestoreSnapshot(config *models.DatabaseConnection, request *models.RestoreRequest) (*models.RestoreOperation, error) {
+	snapshot, err := ss.catalog.Get(request.SnapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Status != "completed" {
+		return nil, fmt.Errorf("%w: snapshot %s has status %s", ErrSnapshotNotRestorable, snapshot.ID, snapshot.Status)
+	}
+	if request.ParallelJobs > 1 && !supportsParallelRestore(snapshot) {
+		return nil, fmt.Errorf("%w: parallel_jobs requires an uncompressed, unencrypted custom or directory format snapshot", ErrInvalidOptions)
+	}
+	mode := request.Mode
+	if mode == "" {
+		mode = RestoreModeNew
+	}
+	replaced := request.TargetDBName
+	if replaced == "" {
+		replaced = config.Database
+	}
+	if mode == RestoreModeReplace {
+		if err := validateReplace(request, replaced); err != nil {
+			return nil, err
+		}
+		if err := ss.requireDatabase(config, replaced); err != nil {
+			return nil, err
+		}
+	}
+	objects, err := restoreObjects(snapshot, request)
+	if err != nil {
+		return nil, err
+	}
+	schemaSnapshot, err := ss.restoreSchemaSource(snapshot, request.SchemaSnapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	operation := &models.RestoreOperation{
+		ID:             uuid.New().String(),
+		SnapshotID:     request.SnapshotID,
+		DatabaseID:     request.DatabaseID,
+		ParallelJobs:   request.ParallelJobs,
+		Objects:        objects,
+		ExistingTarget: request.ExistingTarget,
+		Mode:           mode,
+		Status:         "queued",
+		CreatedAt:      time.Now(),
+	}
+	if schemaSnapshot != nil {
+		operation.SchemaSnapshotID = schemaSnapshot.ID
+	}
+
+	// Set target database name; a replace restore loads a staging database
+	// that takes the target's name once it is complete
+	if mode == RestoreModeReplace {
+		timestamp := time.Now().Format("20060102_150405")
+		operation.TargetDBName = replaced
+		operation.StagingDBName = replaced + "_staging_" + timestamp
+		operation.SafetyDBName = replaced + "_pre_restore_" + timestamp
+	} else if request.TargetDBName != "" {
+		operation.TargetDBName = request.TargetDBName
+	} else if request.ExistingTarget {
+		operation.TargetDBName = config.Database
+	} else {
+		operation.TargetDBName = config.Database + "_restored_" + time.Now().Format("20060102_150405")
+	}
+
+	if err := ss.restores.Save(operation); err != nil {
+		return nil, err
+	}
+
+	// Queue the restore on a private copy
+	record := *operation
+	ss.jobs.Submit(&Job{
+		ID:       operation.ID,
+		Kind:     "restore",
+		Host:     fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Database: operation.TargetDBName,
+		Priority: request.Priority,
+		// pg_restore -j opens one connection per job
+		Connections: max(operation.ParallelJobs, 1),
+		Run: func(ctx context.Context) {
+			ss.performRestore(ctx, config, &record, snapshot, schemaSnapshot)
+		},
+		OnCancel: func() {
+			ss.cancelRestore(config, &record, false)
+		},
+	})
+	operation.QueuePosition = ss.jobs.QueuePosition(operation.ID)
+	ss.events.Publish(models.JobEvent{Type: "state", JobID: operation.ID, Kind: "restore", Status: "queued"})
+
+	return operation, nil
+}
+
+// restoreObjects checks the objects of a selective restore. Only custom and
+// directory archives have a table of contents to pick entries from, and a
+// restore into an existing database runs in a single transaction, so it
+// cannot use parallel jobs.
+func restoreObjects(snapshot *models.Snapshot, request *models.RestoreRequest) (*models.RestoreObjects, error) {
+	var objects *models.RestoreObjects
+	if request.Objects != nil {
+		objects = &models.RestoreObjects{
+			Schemas: normalizePatterns(request.Objects.Schemas),
+			Tables:  normalizePatterns(request.Objects.Tables),
+		}
+		if len(objects.Schemas)+len(objects.Tables) == 0 {
+			objects = nil
+		}
+	}
+
+	if objects == nil {
+		if request.ExistingTarget {
+			return nil, fmt.Errorf("%w: existing_target requires objects to restore", ErrInvalidOptions)
+		}
+		return nil, nil
+	}
+	if format := snapshotFormat(snapshot.Format); format != FormatCustom && format != FormatDirectory {
+		return nil, fmt.Errorf("%w: selective restores need a custom or directory format snapshot", ErrInvalidOptions)
+	}
+	if snapshotMode(snapshot) == ModeDataOnly {
+		return nil, fmt.Errorf("%w: selective restores need a snapshot with table definitions", ErrInvalidOptions)
+	}
+	if request.ExistingTarget && request.ParallelJobs > 1 {
+		return nil, fmt.Errorf("%w: parallel_jobs cannot be used to restore into an existing database", ErrInvalidOptions)
+	}
+	for _, pattern := range objects.Schemas {
+		if _, err := compileNamePattern(pattern, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, pattern := range objects.Tables {
+		if _, err := compileNamePattern(pattern, true); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// restoreSchemaSource checks the schema snapshot named by a restore request.
+// Restores always target a new, empty database, so a data-only snapshot needs
+// a snapshot to create its schema from first; other snapshots bring their own.
+func (ss *SnapshotService) restoreSchemaSource(snapshot *models.Snapshot, schemaSnapshotID string) (*models.Snapshot, error) {
+	if snapshotMode(snapshot) != ModeDataOnly {
+		if schemaSnapshotID != "" {
+			return nil, fmt.Errorf("%w: schema_snapshot_id only applies to data_only snapshots", ErrInvalidOptions)
+		}
+		return nil, nil
+	}
+	if schemaSnapshotID == "" {
+		return nil, fmt.Errorf("%w: snapshot %s is data_only and cannot be restored into a new empty database without schema_snapshot_id", ErrInvalidOptions, snapshot.ID)
+	}
+
+	schemaSnapshot, err := ss.catalog.Get(schemaSnapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if schemaSnapshot.Status != "completed" {
+		return nil, fmt.Errorf("%w: snapshot %s has status %s", ErrSnapshotNotRestorable, schemaSnapshot.ID, schemaSnapshot.Status)
+	}
+	if !isSchemaSource(schemaSnapshot) {
+		return nil, fmt.Errorf("%w: schema snapshot %s must be schema_only or a full custom, directory or tar snapshot", ErrInvalidOptions, schemaSnapshot.ID)
+	}
+	return schemaSnapshot, nil
+}
+
+// performRestore loads the snapshot into the target database, after the
+// schema of schemaSnapshot if one is given; cancelling ctx kills the restore
+// tool and drops the half-restored target database unless it existed before
+func (ss *SnapshotService) performRestore(ctx context.Context, config *models.DatabaseConnection, operation *models.RestoreOperation, snapshot, schemaSnapshot *models.Snapshot) {
+	log.Printf("Starting restore for operation %s", operation.ID)
+	operation.Status = "in_progress"
+	startedAt := time.Now()
+	operation.StartedAt = &startedAt
+	ss.saveRestore(operation)
+
+	if err := ss.checkSnapshotObject(ctx, snapshot); err != nil {
+		ss.failRestore(operation, fmt.Sprintf("Snapshot file not found for ID: %s: %v", snapshot.ID, err), "")
+		log.Printf("Restore failed for operation %s: snapshot file not found", operation.ID)
+		return
+	}
+	if schemaSnapshot != nil {
+		if err := ss.checkSnapshotObject(ctx, schemaSnapshot); err != nil {
+			ss.failRestore(operation, fmt.Sprintf("Snapshot file not found for ID: %s: %v", schemaSnapshot.ID, err), "")
+			log.Printf("Restore failed for operation %s: schema snapshot file not found", operation.ID)
+			return
+		}
+	}
+
+	if ctx.Err() != nil {
+		ss.cancelRestore(config, operation, false)
+		return
+	}
+
+	// A selective restore loads only the entries picked from the snapshot's
+	// table of contents, into an existing database in one transaction
+	var selection []string
+	if operation.Objects != nil {
+		listPath, cleanup, err := ss.restoreListFile(ctx, operation, snapshot)
+		if err != nil {
+			if ctx.Err() != nil {
+				ss.cancelRestore(config, operation, false)
+				return
+			}
+			ss.failRestore(operation, fmt.Sprintf("Failed to select objects to restore: %v", err), "")
+			log.Printf("Restore failed for operation %s: %v", operation.ID, err)
+			return
+		}
+		defer cleanup()
+		selection = append(selection, fmt.Sprintf("--use-list=%s", listPath))
+		if operation.ExistingTarget {
+			selection = append(selection, "--single-transaction")
+		}
+	}
+
+	// First, create the target database
+	if !operation.ExistingTarget {
+		if err := ss.createDatabase(config, restoreDatabaseName(operation)); err != nil {
+			ss.failRestore(operation, fmt.Sprintf("Failed to create target database: %v", err), "")
+			log.Printf("Restore failed for operation %s: %v", operation.ID, err)
+			return
+		}
+	}
+
+	// Load the schema first when the snapshot holds only data, streaming the
+	// output of both steps to event subscribers
+	output := newLineWriter(func(line string) {
+		ss.events.Publish(models.JobEvent{Type: "log", JobID: operation.ID, Kind: "restore", Line: line})
+	})
+	if schemaSnapshot != nil {
+		if !ss.runRestoreStep(ctx, config, operation, schemaSnapshot, output, "--schema-only") {
+			return
+		}
+	}
+	if !ss.runRestoreStep(ctx, config, operation, snapshot, output, selection...) {
+		return
+	}
+
+	// A replace restore is complete once the staging database has taken the
+	// target's place; a swap that has started is not cancelled
+	if operation.Mode == RestoreModeReplace {
+		if ctx.Err() != nil {
+			ss.cancelRestore(config, operation, true)
+			return
+		}
+		operation.Status = "swapping"
+		ss.saveRestore(operation)
+		if err := ss.swapInRestore(config, operation); err != nil {
+			ss.dropFailedTarget(config, operation)
+			ss.failRestore(operation, fmt.Sprintf("Failed to swap in the restored database: %v", err), "")
+			log.Printf("Restore failed for operation %s: %v", operation.ID, err)
+			return
+		}
+	}
+
+	// Update operation status
+	operation.Status = "completed"
+	now := time.Now()
+	operation.CompletedAt = &now
+	ss.saveRestore(operation)
+
+	log.Printf("Restore completed for operation %s", operation.ID)
+}
+
+// runRestoreStep runs the restore tool for one snapshot of a restore operation
+// whose target database is ready, with extra pg_restore arguments. On failure
+// it records the operation as failed or cancelled, dropping a target it
+// created, and returns false.
+func (ss *SnapshotService) runRestoreStep(ctx context.Context, config *models.DatabaseConnection, operation *models.RestoreOperation, snapshot *models.Snapshot, output *lineWriter, extra ...string) bool {
+	cmd, tool, cleanup, err := ss.restoreCommand(ctx, config, operation, snapshot, extra...)
+	if err != nil {
+		ss.dropFailedTarget(config, operation)
+		ss.failRestore(operation, fmt.Sprintf("Failed to prepare restore: %v", err), "")
+		log.Printf("Restore failed for operation %s: %v", operation.ID, err)
+		return false
+	}
+	defer cleanup()
+
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			ss.cancelRestore(config, operation, !operation.ExistingTarget)
+			return false
+		}
+		// The staging database of a replace restore was named by the server
+		// and is of no use half loaded
+		if operation.Mode == RestoreModeReplace {
+			ss.dropFailedTarget(config, operation)
+		}
+		ss.failRestore(operation, fmt.Sprintf("%s restore failed: %v", tool, err), output.String())
+		log.Printf("Restore failed for operation %s: %v", operation.ID, err)
+		return false
+	}
+	return true
+}
+
+// restoreCommand builds the command that loads a snapshot into the target
+// database of operation: psql for plain SQL dumps, pg_restore for archive
+// formats. Both stop at the first error so a partial restore is reported as
+// failed instead of completed. extra arguments are passed to pg_restore, such
+// as --schema-only to load the schema of an archive under a data-only snapshot.
+func (ss *SnapshotService) restoreCommand(ctx context.Context, config *models.DatabaseConnection, operation *models.RestoreOperation, snapshot *models.Snapshot, extra ...string) (*exec.Cmd, string, func(), error) {
+	args := []string{
+		fmt.Sprintf("--host=%s", config.Host),
+		fmt.Sprintf("--port=%d", config.Port),
+		fmt.Sprintf("--username=%s", config.Username),
+		fmt.Sprintf("--dbname=%s", restoreDatabaseName(operation)),
+		"--no-password",
+	}
+
+	var cmd *exec.Cmd
+	tool := "psql"
+	cleanup := func() {}
+
+	// Streamed snapshots and plain dumps are fed to the tool's stdin, decrypted
+	// and decompressed on the way; other archives are read by pg_restore directly
+	var input io.Reader
+	if isStreamed(snapshot) || !isArchiveFormat(snapshot.Format) {
+		var err error
+		if input, cleanup, err = ss.openSnapshotInput(ctx, snapshot); err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	if isArchiveFormat(snapshot.Format) {
+		tool = "pg_restore"
+		args = append(args, "--verbose", "--exit-on-error")
+		if operation.ParallelJobs > 1 && supportsParallelRestore(snapshot) {
+			args = append(args, fmt.Sprintf("--jobs=%d", operation.ParallelJobs))
+		}
+		args = append(args, extra...)
+		if input == nil {
+			args = append(args, snapshot.FilePath)
+		}
+		cmd = exec.CommandContext(ctx, ss.toolsService.GetPgRestorePath(), args...)
+		cmd.Stdin = input
+	} else {
+		args = append(args, "--echo-errors", "--set=ON_ERROR_STOP=1")
+		cmd = exec.CommandContext(ctx, ss.toolsService.GetPsqlPath(), args...)
+		// Older plain dumps were taken with --create; strip their database-level
+		// statements so they cannot touch the source database
+		cmd.Stdin = newDatabaseStatementFilter(input)
+	}
+
+	setProcessGroup(cmd)
+
+	// Set password via environment variable
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", config.Password))
+
+	return cmd, tool, cleanup, nil
+}
+
+// restoreListFile picks the entries of a selective restore from the table of
+// contents of snapshot and writes them to a list file for pg_restore
+func (ss *SnapshotService) restoreListFile(ctx context.Context, operation *models.RestoreOperation, snapshot *models.Snapshot) (string, func(), error) {
+	entries, err := ss.readRestoreList(ctx, snapshot)
+	if err != nil {
+		return "", nil, err
+	}
+	picked, err := selectRestoreEntries(entries, operation.Objects, operation.ExistingTarget)
+	if err != nil {
+		return "", nil, err
+	}
+	log.Printf("Restore %s selected %d of %d entries of snapshot %s", operation.ID, len(picked), len(entries), snapshot.ID)
+	return writeRestoreList(picked)
+}
+
+// checkSnapshotObject confirms that the dump of a snapshot is present in its store
+func (ss *SnapshotService) checkSnapshotObject(ctx context.Context, snapshot *models.Snapshot) error {
+	store, key, err := ss.snapshotObject(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = store.Stat(ctx, key)
+	return err
+}
+
+// dropFailedTarget drops the target database of a restore that could not
+// start, unless the database existed before
+func (ss *SnapshotService) dropFailedTarget(config *models.DatabaseConnection, operation *models.RestoreOperation) {
+	if operation.ExistingTarget {
+		return
+	}
+	if err := ss.dropDatabase(config, restoreDatabaseName(operation)); err != nil {
+		log.Printf("Failed to drop target database %s: %v", restoreDatabaseName(operation), err)
+	}
+}
+
+// saveRestore records the current state of a restore operation and announces it to event subscribers
+func (ss *SnapshotService) saveRestore(operation *models.RestoreOperation) {
+	if err := ss.restores.Save(operation); err != nil {
+		log.Printf("Failed to record restore operation %s: %v", operation.ID, err)
+	}
+	ss.events.Publish(models.JobEvent{
+		Type:    "state",
+		JobID:   operation.ID,
+		Kind:    "restore",
+		Status:  operation.Status,
+		Message: operation.ErrorMessage,
+	})
+}
+
+// failRestore records a restore operation as failed along with the tool output
+func (ss *SnapshotService) failRestore(operation *models.RestoreOperation, message, output string) {
+	operation.Status = "failed"
+	operation.ErrorMessage = message
+	operation.Output = output
+	now := time.Now()
+	operation.CompletedAt = &now
+	ss.saveRestore(operation)
+}
+
+// cancelRestore records a restore operation as cancelled, dropping the target
+// database if this operation created it
+func (ss *SnapshotService) cancelRestore(config *models.DatabaseConnection, operation *models.RestoreOperation, createdTarget bool) {
+	if createdTarget {
+		if err := ss.dropDatabase(config, restoreDatabaseName(operation)); err != nil {
+			log.Printf("Failed to drop partially restored database %s: %v", restoreDatabaseName(operation), err)
+		}
+	}
+
+	operation.Status = "cancelled"
+	operation.ErrorMessage = "Restore was cancelled"
+	now := time.Now()
+	operation.CompletedAt = &now
+	ss.saveRestore(operation)
+
+	log.Printf("Restore cancelled for operation %s", operation.ID)
+}
+
+// CancelRestore stops a restore operation that is queued or still running
+func (ss *SnapshotService) CancelRestore(operationID string) error {
+	if _, err := ss.restores.Get(operationID); err != nil {
+		return err
+	}
+	return ss.jobs.Cancel(operationID)
+}
+
+// failInterruptedRestores marks restores left running by a previous run as failed
+func (ss *SnapshotService) failInterruptedRestores() {
+	operations, err := ss.restores.List(RestoreFilter{})
+	if err != nil {
+		log.Printf("Warning: Failed to check for interrupted restores: %v", err)
+		return
+	}
+
+	for _, operation := range operations {
+		switch operation.Status {
+		case "queued", "in_progress":
+			ss.failRestore(operation, "Restore was interrupted by a server restart", "")
+		case "swapping":
+			// The renames are one transaction, so either name holds the
+			// original database
+			ss.failRestore(operation, fmt.Sprintf("Restore was interrupted by a server restart while swapping databases; the original database is %s or %s", operation.TargetDBName, operation.SafetyDBName), "")
+		}
+	}
+}
+
+// ListRestores returns the restore operations matching filter, newest first
+func (ss *SnapshotService) ListRestores(filter RestoreFilter) ([]*models.RestoreOperation, error) {
+	operations, err := ss.restores.List(filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, operation := range operations {
+		if operation.Status == "queued" {
+			operation.QueuePosition = ss.jobs.QueuePosition(operation.ID)
+		}
+	}
+	return operations, nil
+}
+
+// GetRestore retrieves a restore operation by ID
+func (ss *SnapshotService) GetRestore(operationID string) (*models.RestoreOperation, error) {
+	operation, err := ss.restores.Get(operationID)
+	if err != nil {
+		return nil, err
+	}
+	if operation.Status == "queued" {
+		operation.QueuePosition = ss.jobs.QueuePosition(operation.ID)
+	}
+	return operation, nil
+}
+
+// createDatabase creates a new database
+func (ss *SnapshotService) createDatabase(config *models.DatabaseConnection, dbName string) error {
+	// Connect to postgres database to create new database
+	adminConfig := *config
+	adminConfig.Database = "postgres"
+
+	db, err := ss.dbService.openConnection(&adminConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	// Create database
+	query := fmt.Sprintf("CREATE DATABASE %s", pq.QuoteIdentifier(dbName))
+	_, err = db.Exec(query)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+
+	return nil
+}
+
+// dropDatabase disconnects all sessions from a database and drops it
+func (ss *SnapshotService) dropDatabase(config *models.DatabaseConnection, dbName string) error {
+	adminConfig := *config
+	adminConfig.Database = "postgres"
+
+	db, err := ss.dbService.openConnection(&adminConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	terminate := `SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()`
+	if _, err := db.Exec(terminate, dbName); err != nil {
+		return fmt.Errorf("failed to terminate sessions: %w", err)
+	}
+
+	query := fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(dbName))
+	if _, err := db.Exec(query); err != nil {
+		return fmt.Errorf("failed to drop database: %w", err)
+	}
+
+	return nil
+}
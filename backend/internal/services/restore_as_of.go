@@ -0,0 +1,253 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// ErrNoRecoverySource is returned when nothing can restore a database to the
+// requested moment
+var ErrNoRecoverySource = errors.New("no recovery source")
+
+// Sources of a restore to a point in time
+const (
+	SourceAuto     = "auto"
+	SourceSnapshot = "snapshot"
+	SourcePITR     = "pitr"
+)
+
+// RestoreAsOfService restores a saved connection's database as it was at a
+// wall-clock time, from whichever snapshot or base backup gets closest
+type RestoreAsOfService struct {
+	dbService       *DatabaseService
+	snapshotService *SnapshotService
+	physicalService *PhysicalBackupService
+}
+
+// NewRestoreAsOfService creates the service choosing recovery sources
+func NewRestoreAsOfService(dbService *DatabaseService, snapshotService *SnapshotService, physicalService *PhysicalBackupService) *RestoreAsOfService {
+	return &RestoreAsOfService{
+		dbService:       dbService,
+		snapshotService: snapshotService,
+		physicalService: physicalService,
+	}
+}
+
+// RestoreAsOf picks how to bring back a connection's database as it was at
+// request.Time and, unless the request is a dry run, starts that restore.
+// The latest full snapshot from before the time is restored into a new
+// database and loses what changed after it was taken; a base backup with WAL
+// archived up to the time recovers the cluster to exactly that moment, so the
+// automatic choice prefers it when it is available.
+func (rs *RestoreAsOfService) RestoreAsOf(databaseID string, request *models.RestoreAsOfRequest) (*models.RestoreAsOfPlan, error) {
+	config, err := rs.dbService.ResolveConnection(databaseID)
+	if err != nil {
+		return nil, err
+	}
+	if request.Time.After(time.Now()) {
+		return nil, fmt.Errorf("%w: time %s is in the future", ErrInvalidOptions, request.Time.Format(time.RFC3339))
+	}
+	source := request.Source
+	if source == "" {
+		source = SourceAuto
+	}
+
+	snapshotOption, snapshot, err := rs.snapshotSource(databaseID, request.Time)
+	if err != nil {
+		return nil, err
+	}
+	pitrOption, err := rs.pitrSource(databaseID, request.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &models.RestoreAsOfPlan{
+		DatabaseID:    databaseID,
+		RequestedTime: request.Time,
+		Considered:    []models.RecoverySource{*snapshotOption, *pitrOption},
+		DryRun:        request.DryRun,
+	}
+	switch {
+	case source == SourceSnapshot || (source == SourceAuto && !pitrOption.Usable):
+		plan.Chosen = snapshotOption
+	default:
+		plan.Chosen = pitrOption
+	}
+	if !plan.Chosen.Usable {
+		if source == SourceAuto {
+			return nil, fmt.Errorf("%w: nothing restores database %s to %s: %s; %s", ErrNoRecoverySource, databaseID,
+				request.Time.Format(time.RFC3339), snapshotOption.Reason, pitrOption.Reason)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNoRecoverySource, plan.Chosen.Reason)
+	}
+
+	if plan.Chosen.Source == SourceSnapshot {
+		plan.Explanation = fmt.Sprintf("Snapshot %s (%s) reflects %s at %s. %s",
+			snapshot.ID, snapshot.Name, config.Database, plan.Chosen.RecoveredTo.Format(time.RFC3339), dataLossSentence(plan.Chosen))
+		if pitrOption.Usable {
+			plan.Explanation += " A point-in-time restore would lose nothing but recovers the whole cluster into a new data directory."
+		}
+	} else {
+		plan.Explanation = fmt.Sprintf("Base backup %s with the archived WAL recovers the cluster to exactly %s, so no committed change from before then is lost. The cluster is recovered into a new data directory.",
+			plan.Chosen.BaseBackupID, request.Time.Format(time.RFC3339))
+		if snapshotOption.Usable {
+			plan.Explanation += fmt.Sprintf(" The latest snapshot, %s, would have lost %s.", snapshot.ID, formatLoss(snapshotOption.DataLossSeconds))
+		}
+	}
+	if request.DryRun {
+		return plan, nil
+	}
+
+	if plan.Chosen.Source == SourceSnapshot {
+		plan.Restore, err = rs.snapshotService.RestoreSnapshot(config, &models.RestoreRequest{
+			SnapshotID:   snapshot.ID,
+			DatabaseID:   databaseID,
+			TargetDBName: request.TargetDBName,
+			ParallelJobs: request.ParallelJobs,
+			Priority:     request.Priority,
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan.Explanation += fmt.Sprintf(" It is being restored into the new database %s.", plan.Restore.TargetDBName)
+		return plan, nil
+	}
+
+	target := request.Time
+	plan.PointInTimeRestore, err = rs.physicalService.StartPointInTimeRestore(databaseID, &models.PointInTimeRestoreRequest{
+		Target:       models.RecoveryTarget{Time: &target},
+		BaseBackupID: plan.Chosen.BaseBackupID,
+		DataDir:      request.DataDir,
+		Port:         request.Port,
+		Start:        request.Start,
+		Priority:     request.Priority,
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan.Explanation += fmt.Sprintf(" It is being recovered into %s.", plan.PointInTimeRestore.DataDir)
+	return plan, nil
+}
+
+// snapshotSource finds the latest completed snapshot of a whole database
+// taken at or before asOf. A snapshot reflects the moment pg_dump's snapshot
+// was exported; when that was not recorded its completion is used instead,
+// which may overstate the loss but never restores changes made after asOf.
+func (rs *RestoreAsOfService) snapshotSource(databaseID string, asOf time.Time) (*models.RecoverySource, *models.Snapshot, error) {
+	snapshots, err := rs.snapshotService.ListSnapshots(databaseID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var best *models.Snapshot
+	var bestAt time.Time
+	for _, snapshot := range snapshots {
+		// Partial snapshots cannot bring back the whole database
+		if snapshot.DatabaseID != databaseID || snapshot.Status != "completed" ||
+			snapshotMode(snapshot) != ModeFull || snapshot.Filters != nil {
+			continue
+		}
+		at := snapshotTakenAt(snapshot)
+		if at.After(asOf) {
+			continue
+		}
+		if best == nil || at.After(bestAt) {
+			best, bestAt = snapshot, at
+		}
+	}
+
+	option := &models.RecoverySource{Source: SourceSnapshot}
+	if best == nil {
+		option.Reason = "no completed full snapshot of the whole database was taken at or before the requested time"
+		return option, nil, nil
+	}
+	option.SnapshotID = best.ID
+	option.RecoveredTo = &bestAt
+	option.DataLossSeconds = asOf.Sub(bestAt).Seconds()
+	option.Usable = true
+	option.Reason = "latest full snapshot taken at or before the requested time"
+	if best.ConsistentAt == nil {
+		option.Reason += "; when its data was captured was not recorded, so its completion time is used and the loss may be smaller"
+	}
+	return option, best, nil
+}
+
+// snapshotTakenAt returns the moment a snapshot's data reflects, or its
+// completion when that moment was not recorded
+func snapshotTakenAt(snapshot *models.Snapshot) time.Time {
+	if snapshot.ConsistentAt != nil {
+		return *snapshot.ConsistentAt
+	}
+	if snapshot.CompletedAt != nil {
+		return *snapshot.CompletedAt
+	}
+	return snapshot.CreatedAt
+}
+
+// pitrSource finds the latest base backup completed at or before asOf from
+// which archived WAL reaches asOf. The WAL archive must have been running when
+// the backup started, or the WAL between the two is missing.
+func (rs *RestoreAsOfService) pitrSource(databaseID string, asOf time.Time) (*models.RecoverySource, error) {
+	option := &models.RecoverySource{Source: SourcePITR}
+
+	backups, err := rs.physicalService.ListBaseBackups(databaseID)
+	if err != nil {
+		return nil, err
+	}
+	target := models.RecoveryTarget{Time: &asOf}
+	var candidates []*models.BaseBackup
+	for _, backup := range backups {
+		if backup.Status == "completed" && endsBefore(backup, target) {
+			candidates = append(candidates, backup)
+		}
+	}
+	if len(candidates) == 0 {
+		option.Reason = "no completed base backup was taken at or before the requested time"
+		return option, nil
+	}
+
+	archive, err := rs.physicalService.GetWALArchive(databaseID)
+	if errors.Is(err, ErrWALArchiveNotFound) {
+		option.Reason = "WAL of this connection is not archived"
+		return option, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if archive.LatestWriteAt == nil || archive.LatestWriteAt.Before(asOf) {
+		option.Reason = "the WAL archive holds nothing written at or after the requested time"
+		return option, nil
+	}
+
+	for _, backup := range candidates {
+		startedAt := backup.CreatedAt
+		if backup.StartedAt != nil {
+			startedAt = *backup.StartedAt
+		}
+		if archive.StartedAt.After(startedAt) {
+			continue
+		}
+		option.BaseBackupID = backup.ID
+		option.RecoveredTo = &asOf
+		option.Usable = true
+		option.Reason = "latest base backup completed at or before the requested time, with WAL archived since it started"
+		return option, nil
+	}
+	option.Reason = fmt.Sprintf("WAL archiving last started at %s, after every base backup from before the requested time", archive.StartedAt.Format(time.RFC3339))
+	return option, nil
+}
+
+// dataLossSentence describes what a restore from source does not bring back
+func dataLossSentence(source *models.RecoverySource) string {
+	if source.DataLossSeconds == 0 {
+		return "Nothing committed before the requested time is lost."
+	}
+	return fmt.Sprintf("Changes committed in the %s after that are not restored.", formatLoss(source.DataLossSeconds))
+}
+
+func formatLoss(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// asOfBase is the start of the day the restore-as-of tests take place on;
+// the tests restore to asOfBase+10h
+var asOfBase = time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+
+func asOfHour(hours float64) *time.Time {
+	at := asOfBase.Add(time.Duration(hours * float64(time.Hour)))
+	return &at
+}
+
+func newTestRestoreAsOfService(t *testing.T) *RestoreAsOfService {
+	t.Helper()
+	ss, store := newTestSnapshotService(t)
+	ps := &PhysicalBackupService{store: store, jobs: ss.jobs, events: ss.events, archivers: make(map[string]*walArchiver)}
+	if err := ss.dbService.storeConnection(&models.DatabaseConnection{ID: "conn-a", Name: "shop", Database: "shop", Password: testConnectionPass}); err != nil {
+		t.Fatal(err)
+	}
+	return NewRestoreAsOfService(ss.dbService, ss, ps)
+}
+
+// addBaseBackups records base backups of conn-a started and completed at the given hours
+func addBaseBackups(t *testing.T, rs *RestoreAsOfService, backups map[string][2]float64) {
+	t.Helper()
+	for id, hours := range backups {
+		backup := &models.BaseBackup{ID: id, ConnectionID: "conn-a", Status: "completed", CreatedAt: *asOfHour(hours[0]), StartedAt: asOfHour(hours[0]), CompletedAt: asOfHour(hours[1])}
+		if err := rs.physicalService.saveBaseBackup(backup); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// archiveWAL records a WAL archive of conn-a started at startedAt whose
+// latest segment was written at writtenAt
+func archiveWAL(t *testing.T, rs *RestoreAsOfService, startedAt, writtenAt float64) {
+	t.Helper()
+	dir := t.TempDir()
+	segment := filepath.Join(dir, "000000010000000000000003.partial")
+	if err := os.WriteFile(segment, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(segment, *asOfHour(writtenAt), *asOfHour(writtenAt)); err != nil {
+		t.Fatal(err)
+	}
+	archive := &models.WALArchive{ConnectionID: "conn-a", Directory: dir, Enabled: true, StartedAt: *asOfHour(startedAt)}
+	if err := rs.physicalService.saveWALArchive(archive); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotSource(t *testing.T) {
+	rs := newTestRestoreAsOfService(t)
+	catalog := rs.snapshotService.catalog
+	for _, snapshot := range []*models.Snapshot{
+		{ID: "old", DatabaseID: "conn-a", Status: "completed", ConsistentAt: asOfHour(2), CompletedAt: asOfHour(3)},
+		{ID: "best", DatabaseID: "conn-a", Status: "completed", CreatedAt: *asOfHour(7), CompletedAt: asOfHour(8)},
+		{ID: "after", DatabaseID: "conn-a", Status: "completed", ConsistentAt: asOfHour(11)},
+		// Consistent before the time although completed after it
+		{ID: "slow", DatabaseID: "conn-a", Status: "completed", ConsistentAt: asOfHour(7.5), CompletedAt: asOfHour(12)},
+		{ID: "filtered", DatabaseID: "conn-a", Status: "completed", ConsistentAt: asOfHour(9), Filters: &models.SnapshotFilters{Schemas: []string{"sales"}}},
+		{ID: "schema", DatabaseID: "conn-a", Status: "completed", Mode: ModeSchemaOnly, ConsistentAt: asOfHour(9)},
+		{ID: "failed", DatabaseID: "conn-a", Status: "failed", ConsistentAt: asOfHour(9.5)},
+		{ID: "other", DatabaseID: "conn-b", Status: "completed", ConsistentAt: asOfHour(9)},
+		{ID: "imported", Status: "completed", ConsistentAt: asOfHour(9)},
+	} {
+		if err := catalog.Create(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	option, snapshot, err := rs.snapshotSource("conn-a", *asOfHour(10))
+	if err != nil {
+		t.Fatalf("snapshotSource: %v", err)
+	}
+	if snapshot == nil || snapshot.ID != "best" || !option.Usable || option.SnapshotID != "best" {
+		t.Fatalf("snapshotSource = %+v, %+v, want the snapshot completed at 08:00", option, snapshot)
+	}
+	if option.DataLossSeconds != 7200 || !option.RecoveredTo.Equal(*asOfHour(8)) {
+		t.Errorf("recovers to %s losing %vs, want 08:00 losing 7200s", option.RecoveredTo, option.DataLossSeconds)
+	}
+	if !strings.Contains(option.Reason, "completion time is used") {
+		t.Errorf("reason %q does not say the completion time is used", option.Reason)
+	}
+
+	if option, _, err := rs.snapshotSource("conn-a", *asOfHour(7.75)); err != nil || option.SnapshotID != "slow" || option.DataLossSeconds != 900 {
+		t.Errorf("snapshotSource at 07:45 = %+v, %v, want slow losing 900s", option, err)
+	}
+	if option, snapshot, err := rs.snapshotSource("conn-a", *asOfHour(1)); err != nil || option.Usable || snapshot != nil {
+		t.Errorf("snapshotSource before any snapshot = %+v, %v, %v, want none usable", option, snapshot, err)
+	}
+}
+
+func TestPITRSource(t *testing.T) {
+	tests := []struct {
+		name                  string
+		archive               bool
+		archiveStarted, wrote float64
+		wantBackup            string
+		wantReason            string
+	}{
+		{name: "not archived", wantReason: "not archived"},
+		{name: "archived", archive: true, archiveStarted: 0.5, wrote: 12, wantBackup: "late"},
+		// Only backups started after the archive have all the WAL they need
+		{name: "archive started between backups", archive: true, archiveStarted: 3, wrote: 12, wantBackup: "late"},
+		{name: "archive started after both", archive: true, archiveStarted: 6.5, wrote: 12, wantReason: "after every base backup"},
+		{name: "archive stopped before the time", archive: true, archiveStarted: 0.5, wrote: 9, wantReason: "holds nothing written"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := newTestRestoreAsOfService(t)
+			addBaseBackups(t, rs, map[string][2]float64{
+				"early":  {1, 2},
+				"late":   {6, 7},
+				"recent": {10.5, 11},
+			})
+			if tt.archive {
+				archiveWAL(t, rs, tt.archiveStarted, tt.wrote)
+			}
+
+			option, err := rs.pitrSource("conn-a", *asOfHour(10))
+			if err != nil {
+				t.Fatalf("pitrSource: %v", err)
+			}
+			if option.BaseBackupID != tt.wantBackup || option.Usable != (tt.wantBackup != "") {
+				t.Errorf("pitrSource = %+v, want base backup %q", option, tt.wantBackup)
+			}
+			if option.Usable && !option.RecoveredTo.Equal(*asOfHour(10)) {
+				t.Errorf("recovers to %s, want exactly the requested time", option.RecoveredTo)
+			}
+			if !strings.Contains(option.Reason, tt.wantReason) {
+				t.Errorf("reason %q does not contain %q", option.Reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestRestoreAsOfChoosesSource(t *testing.T) {
+	rs := newTestRestoreAsOfService(t)
+	if err := rs.snapshotService.catalog.Create(&models.Snapshot{ID: "nightly", DatabaseID: "conn-a", Status: "completed", ConsistentAt: asOfHour(8)}); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := func(source string, hour float64) (*models.RestoreAsOfPlan, error) {
+		return rs.RestoreAsOf("conn-a", &models.RestoreAsOfRequest{Time: *asOfHour(hour), Source: source, DryRun: true})
+	}
+
+	// Without WAL only the snapshot can be used
+	if got, err := plan("", 10); err != nil || got.Chosen.Source != SourceSnapshot || len(got.Considered) != 2 {
+		t.Fatalf("auto without WAL = %+v, %v, want the snapshot", got, err)
+	}
+	if _, err := plan(SourcePITR, 10); !errors.Is(err, ErrNoRecoverySource) {
+		t.Errorf("pitr without WAL: error = %v, want ErrNoRecoverySource", err)
+	}
+
+	// With WAL the exact recovery is preferred unless the snapshot is asked for
+	addBaseBackups(t, rs, map[string][2]float64{"base": {1, 2}})
+	archiveWAL(t, rs, 0.5, 12)
+	got, err := plan(SourceAuto, 10)
+	if err != nil || got.Chosen.Source != SourcePITR || got.Chosen.BaseBackupID != "base" {
+		t.Fatalf("auto with WAL = %+v, %v, want the base backup", got, err)
+	}
+	if !strings.Contains(got.Explanation, "would have lost 2h0m0s") {
+		t.Errorf("explanation %q does not mention what the snapshot would lose", got.Explanation)
+	}
+	if got, err := plan(SourceSnapshot, 10); err != nil || got.Chosen.SnapshotID != "nightly" || got.Restore != nil {
+		t.Errorf("snapshot with WAL = %+v, %v, want the snapshot without starting it", got, err)
+	}
+
+	if _, err := plan("", 0.25); !errors.Is(err, ErrNoRecoverySource) {
+		t.Errorf("before any source: error = %v, want ErrNoRecoverySource", err)
+	}
+	if _, err := rs.RestoreAsOf("conn-a", &models.RestoreAsOfRequest{Time: time.Now().Add(time.Hour), DryRun: true}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("future time: error = %v, want ErrInvalidOptions", err)
+	}
+}
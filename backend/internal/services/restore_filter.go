@@ -0,0 +1,73 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// databaseStatementPrefixes start the database-level statements that plain
+// dumps made with --create contain. Restores always target a database the
+// service created itself, so these must not run: they would drop and recreate
+// the source database and \connect to it.
+var databaseStatementPrefixes = [][]byte{
+	[]byte("DROP DATABASE "),
+	[]byte("CREATE DATABASE "),
+	[]byte("ALTER DATABASE "),
+	[]byte("COMMENT ON DATABASE "),
+	[]byte("\\connect "),
+}
+
+// databaseStatementFilter strips database-level statements from a plain SQL
+// dump while passing COPY data through untouched
+type databaseStatementFilter struct {
+	src     *bufio.Reader
+	pending []byte
+	inCopy  bool
+	err     error
+}
+
+func newDatabaseStatementFilter(src io.Reader) io.Reader {
+	return &databaseStatementFilter{src: bufio.NewReaderSize(src, 64*1024)}
+}
+
+func (f *databaseStatementFilter) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		line, err := f.src.ReadBytes('\n')
+		f.err = err
+		if f.keep(line) {
+			f.pending = line
+		}
+	}
+
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+// keep reports whether a line belongs in the restored stream
+func (f *databaseStatementFilter) keep(line []byte) bool {
+	trimmed := bytes.TrimRight(line, "\r\n")
+
+	if f.inCopy {
+		if bytes.Equal(trimmed, []byte("\\.")) {
+			f.inCopy = false
+		}
+		return true
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("COPY ")) && bytes.HasSuffix(trimmed, []byte("FROM stdin;")) {
+		f.inCopy = true
+		return true
+	}
+
+	for _, prefix := range databaseStatementPrefixes {
+		if bytes.HasPrefix(trimmed, prefix) {
+			return false
+		}
+	}
+	return true
+}
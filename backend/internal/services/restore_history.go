@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// ErrRestoreNotFound is returned when a restore operation is not present in the history
+var ErrRestoreNotFound = errors.New("restore operation not found")
+
+// RestoreFilter narrows a restore or drill history listing; empty fields match everything
+type RestoreFilter struct {
+	SnapshotID string
+	DatabaseID string
+}
+
+// RestoreHistory persists restore operations across their lifecycle
+type RestoreHistory interface {
+	Save(operation *models.RestoreOperation) error
+	Get(id string) (*models.RestoreOperation, error)
+	List(filter RestoreFilter) ([]*models.RestoreOperation, error)
+}
+
+type boltRestoreHistory struct {
+	store *MetadataStore
+}
+
+// NewRestoreHistory creates a restore history backed by the metadata store
+func NewRestoreHistory(store *MetadataStore) RestoreHistory {
+	return &boltRestoreHistory{store: store}
+}
+
+// Save records the current state of a restore operation
+func (h *boltRestoreHistory) Save(operation *models.RestoreOperation) error {
+	if err := h.store.put(restoresBucket, operation.ID, operation); err != nil {
+		return fmt.Errorf("failed to record restore operation: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a restore operation by ID
+func (h *boltRestoreHistory) Get(id string) (*models.RestoreOperation, error) {
+	var operation models.RestoreOperation
+	found, err := h.store.get(restoresBucket, id, &operation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read restore operation: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrRestoreNotFound, id)
+	}
+	return &operation, nil
+}
+
+// List returns the restore operations matching filter, newest first
+func (h *boltRestoreHistory) List(filter RestoreFilter) ([]*models.RestoreOperation, error) {
+	operations := []*models.RestoreOperation{}
+	err := h.store.forEach(restoresBucket, func(data []byte) error {
+		var operation models.RestoreOperation
+		if err := json.Unmarshal(data, &operation); err != nil {
+			return err
+		}
+		if filter.SnapshotID != "" && operation.SnapshotID != filter.SnapshotID {
+			return nil
+		}
+		if filter.DatabaseID != "" && operation.DatabaseID != filter.DatabaseID {
+			return nil
+		}
+		operations = append(operations, &operation)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list restore operations: %w", err)
+	}
+
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].CreatedAt.After(operations[j].CreatedAt)
+	})
+
+	return operations, nil
+}
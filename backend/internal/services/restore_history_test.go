@@ -0,0 +1,119 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+func TestRestoreHistory(t *testing.T) {
+	history := NewRestoreHistory(newTestStore(t))
+	now := time.Now()
+	for i, operation := range []*models.RestoreOperation{
+		{ID: "r1", SnapshotID: "snap-a", DatabaseID: "conn-a", Status: "completed"},
+		{ID: "r2", SnapshotID: "snap-b", DatabaseID: "conn-a", Status: "failed"},
+		{ID: "r3", SnapshotID: "snap-a", DatabaseID: "conn-b", Status: "queued"},
+	} {
+		operation.CreatedAt = now.Add(time.Duration(i) * time.Minute)
+		if err := history.Save(operation); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	// Saving again records the new state
+	operation, err := history.Get("r3")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	operation.Status = "in_progress"
+	if err := history.Save(operation); err != nil {
+		t.Fatal(err)
+	}
+	if operation, err = history.Get("r3"); err != nil || operation.Status != "in_progress" {
+		t.Errorf("Get after Save = %+v, %v, want status in_progress", operation, err)
+	}
+	if _, err := history.Get("missing"); !errors.Is(err, ErrRestoreNotFound) {
+		t.Errorf("Get of a missing restore: error = %v, want ErrRestoreNotFound", err)
+	}
+
+	tests := []struct {
+		filter RestoreFilter
+		want   []string
+	}{
+		{RestoreFilter{}, []string{"r3", "r2", "r1"}},
+		{RestoreFilter{SnapshotID: "snap-a"}, []string{"r3", "r1"}},
+		{RestoreFilter{DatabaseID: "conn-a"}, []string{"r2", "r1"}},
+		{RestoreFilter{SnapshotID: "snap-a", DatabaseID: "conn-a"}, []string{"r1"}},
+		{RestoreFilter{SnapshotID: "snap-c"}, nil},
+	}
+	for _, tt := range tests {
+		operations, err := history.List(tt.filter)
+		if err != nil {
+			t.Fatalf("List(%+v): %v", tt.filter, err)
+		}
+		var got []string
+		for _, operation := range operations {
+			got = append(got, operation.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("List(%+v) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestFailInterruptedRestores(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	for _, operation := range []*models.RestoreOperation{
+		{ID: "queued", Status: "queued"},
+		{ID: "running", Status: "in_progress"},
+		{ID: "swapping", Status: "swapping", TargetDBName: "shop", SafetyDBName: "shop_pre_restore_20261016_120000"},
+		{ID: "done", Status: "completed"},
+	} {
+		if err := ss.restores.Save(operation); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ss.failInterruptedRestores()
+
+	for id, want := range map[string]string{"queued": "failed", "running": "failed", "swapping": "failed", "done": "completed"} {
+		operation, err := ss.restores.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if operation.Status != want {
+			t.Errorf("restore %s: status %q, want %q", id, operation.Status, want)
+		}
+		if want == "failed" && operation.CompletedAt == nil {
+			t.Errorf("restore %s has no completion time", id)
+		}
+	}
+	swapping, _ := ss.restores.Get("swapping")
+	if !strings.Contains(swapping.ErrorMessage, "shop_pre_restore_20261016_120000") {
+		t.Errorf("interrupted swap message %q does not name the safety copy", swapping.ErrorMessage)
+	}
+}
+
+func TestRestoreRefusesUnfinishedSnapshots(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	for _, status := range []string{"queued", "creating", "failed", "corrupt"} {
+		if err := ss.catalog.Create(&models.Snapshot{ID: status, Status: status}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ss.RestoreSnapshot(&models.DatabaseConnection{Database: "shop"}, &models.RestoreRequest{SnapshotID: status})
+		if !errors.Is(err, ErrSnapshotNotRestorable) {
+			t.Errorf("restore of a %s snapshot: error = %v, want ErrSnapshotNotRestorable", status, err)
+		}
+	}
+	operations, err := ss.restores.List(RestoreFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 0 {
+		t.Errorf("refused restores were recorded: %d", len(operations))
+	}
+}
@@ -0,0 +1,410 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// tocEntry is one entry of an archive's table of contents
+type tocEntry struct {
+	id     int
+	desc   string // object type, such as TABLE, INDEX or TABLE DATA
+	schema string // "-" for objects outside a schema
+	tag    string // object name; constraints and triggers are prefixed by their table
+	deps   []int
+	line   string // the entry's line in pg_restore -l output
+}
+
+// dependentDescs are the kinds of objects restored along with the tables
+// they belong to
+var dependentDescs = map[string]bool{
+	"INDEX":             true,
+	"INDEX ATTACH":      true,
+	"CONSTRAINT":        true,
+	"CHECK CONSTRAINT":  true,
+	"FK CONSTRAINT":     true,
+	"DEFAULT":           true,
+	"SEQUENCE":          true,
+	"SEQUENCE OWNED BY": true,
+	"TRIGGER":           true,
+	"RULE":              true,
+	"POLICY":            true,
+	"ROW SECURITY":      true,
+	"STATISTICS":        true,
+	"COMMENT":           true,
+	"SECURITY LABEL":    true,
+	"ACL":               true,
+}
+
+// relationDescs are the kinds of objects a new database can only have if
+// they are restored too; dependents of other kinds bring their prerequisites
+// along, dependents on a missing relation are left out
+var relationDescs = map[string]bool{
+	"TABLE":             true,
+	"FOREIGN TABLE":     true,
+	"VIEW":              true,
+	"MATERIALIZED VIEW": true,
+	"INDEX":             true,
+	"CONSTRAINT":        true,
+	"FK CONSTRAINT":     true,
+}
+
+// readRestoreList reads the table of contents of an archive snapshot with its
+// dependencies: `pg_restore -l` lists every entry in restore order, and a
+// verbose schema-only script names each schema entry and the entries it
+// depends on
+func (ss *SnapshotService) readRestoreList(ctx context.Context, snapshot *models.Snapshot) ([]*tocEntry, error) {
+	list, err := ss.runPgRestore(ctx, snapshot, "--list")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshot contents: %w", err)
+	}
+	script, err := ss.runPgRestore(ctx, snapshot, "--schema-only", "--verbose", "--file=-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot dependencies: %w", err)
+	}
+
+	return parseRestoreList(list, script), nil
+}
+
+// parseRestoreList combines the entries of `pg_restore -l` output with the
+// exact names and dependencies a verbose script gives for schema entries
+func parseRestoreList(list, script []byte) []*tocEntry {
+	entries := parseTocList(list)
+	byID := make(map[int]*tocEntry, len(entries))
+	for _, entry := range entries {
+		byID[entry.id] = entry
+	}
+	for _, described := range parseTocScript(script) {
+		if entry, ok := byID[described.id]; ok {
+			entry.desc, entry.schema, entry.tag = described.desc, described.schema, described.tag
+			entry.deps = described.deps
+		}
+	}
+	return entries
+}
+
+// runPgRestore runs pg_restore on a snapshot without a target database and
+// returns what it writes to stdout
+func (ss *SnapshotService) runPgRestore(ctx context.Context, snapshot *models.Snapshot, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	if err := ss.pipePgRestore(ctx, snapshot, &stdout, args...); err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// readPgRestore runs pg_restore on a snapshot without a target database and
+// hands its output to read as it is produced
+func (ss *SnapshotService) readPgRestore(ctx context.Context, snapshot *models.Snapshot, read func(io.Reader) error, args ...string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(ss.pipePgRestore(ctx, snapshot, writer, args...))
+	}()
+	err := read(reader)
+	// Stop pg_restore if reading ended early
+	reader.CloseWithError(errors.New("pg_restore output was not read"))
+	return err
+}
+
+// pipePgRestore runs pg_restore on a snapshot without a target database,
+// writing its output to stdout
+func (ss *SnapshotService) pipePgRestore(ctx context.Context, snapshot *models.Snapshot, stdout io.Writer, args ...string) error {
+	var input io.Reader
+	if isStreamed(snapshot) {
+		var cleanup func()
+		var err error
+		if input, cleanup, err = ss.openSnapshotInput(ctx, snapshot); err != nil {
+			return err
+		}
+		defer cleanup()
+	} else {
+		args = append(args, snapshot.FilePath)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ss.toolsService.GetPgRestorePath(), args...)
+	cmd.Stdin = input
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// multiWordDescs are the object types in pg_restore -l output that consist of
+// several words, longest first where one starts another
+var multiWordDescs = []string{
+	"MATERIALIZED VIEW DATA", "MATERIALIZED VIEW",
+	"PUBLICATION TABLES IN SCHEMA", "PUBLICATION TABLE",
+	"SEQUENCE OWNED BY", "SEQUENCE SET",
+	"TEXT SEARCH CONFIGURATION", "TEXT SEARCH DICTIONARY", "TEXT SEARCH PARSER", "TEXT SEARCH TEMPLATE",
+	"FOREIGN DATA WRAPPER", "FOREIGN TABLE",
+	"OPERATOR CLASS", "OPERATOR FAMILY",
+	"TABLE DATA", "TABLE ATTACH",
+	"BLOB METADATA", "LARGE OBJECT",
+	"CHECK CONSTRAINT", "FK CONSTRAINT",
+	"DATABASE PROPERTIES", "DEFAULT ACL", "INDEX ATTACH", "ROW SECURITY",
+	"ACCESS METHOD", "EVENT TRIGGER", "PROCEDURAL LANGUAGE", "SECURITY LABEL",
+	"SHELL TYPE", "STATISTICS DATA", "SUBSCRIPTION TABLE", "USER MAPPING",
+}
+
+// parseTocList parses `pg_restore -l` output. Lines look like
+// "215; 1259 16386 TABLE public users postgres": the catalog and object IDs,
+// then the object type, schema, name and owner. Names may contain spaces, so
+// the verbose script gives the exact names of schema entries.
+func parseTocList(list []byte) []*tocEntry {
+	var entries []*tocEntry
+	scanner := bufio.NewScanner(bytes.NewReader(list))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		idText, rest, ok := strings.Cut(line, ";")
+		if !ok || strings.HasPrefix(line, ";") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(idText))
+		if err != nil {
+			continue
+		}
+		entry := &tocEntry{id: id, line: line}
+
+		// Skip the catalog and object IDs
+		fields := strings.SplitN(strings.TrimSpace(rest), " ", 3)
+		if len(fields) == 3 {
+			desc, names, _ := strings.Cut(fields[2], " ")
+			for _, multi := range multiWordDescs {
+				if after, ok := strings.CutPrefix(fields[2], multi+" "); ok {
+					desc, names = multi, after
+					break
+				}
+			}
+			// schema, tag and owner, which may be empty
+			parts := strings.Split(names, " ")
+			if len(parts) >= 3 {
+				entry.desc = desc
+				entry.schema = parts[0]
+				entry.tag = strings.Join(parts[1:len(parts)-1], " ")
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// parseTocScript reads the entries of a verbose pg_restore script from the
+// comment block before each of them:
+//
+//	-- TOC entry 3187 (class 1259 OID 16400)
+//	-- Dependencies: 215
+//	-- Name: users_email_idx; Type: INDEX; Schema: public; Owner: postgres
+func parseTocScript(script []byte) []*tocEntry {
+	var entries []*tocEntry
+	var current *tocEntry
+	scanner := bufio.NewScanner(bytes.NewReader(script))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "-- TOC entry "):
+			current = nil
+			idText, _, _ := strings.Cut(strings.TrimPrefix(line, "-- TOC entry "), " ")
+			if id, err := strconv.Atoi(idText); err == nil {
+				current = &tocEntry{id: id}
+			}
+		case current == nil:
+		case strings.HasPrefix(line, "-- Dependencies:"):
+			for _, dep := range strings.Fields(strings.TrimPrefix(line, "-- Dependencies:")) {
+				if id, err := strconv.Atoi(dep); err == nil {
+					current.deps = append(current.deps, id)
+				}
+			}
+		case strings.HasPrefix(line, "-- Name: "):
+			if name, desc, schema, ok := parseScriptHeader(strings.TrimPrefix(line, "-- Name: ")); ok {
+				current.tag, current.desc, current.schema = name, desc, schema
+				entries = append(entries, current)
+			}
+			current = nil
+		}
+	}
+	return entries
+}
+
+// selectRestoreEntries picks the entries of a selective restore: the requested
+// tables and whole schemas, the indexes, constraints, sequences and other
+// objects that belong to them, and their rows. A new database also gets the
+// schemas, types and functions they need; an existing one is assumed to have
+// them already.
+func selectRestoreEntries(entries []*tocEntry, objects *models.RestoreObjects, existingTarget bool) ([]*tocEntry, error) {
+	var schemaPatterns, tablePatterns []namePattern
+	for _, pattern := range objects.Schemas {
+		p, err := compileNamePattern(pattern, false)
+		if err != nil {
+			return nil, err
+		}
+		schemaPatterns = append(schemaPatterns, p)
+	}
+	for _, pattern := range objects.Tables {
+		p, err := compileNamePattern(pattern, true)
+		if err != nil {
+			return nil, err
+		}
+		tablePatterns = append(tablePatterns, p)
+	}
+
+	byID := make(map[int]*tocEntry, len(entries))
+	for _, entry := range entries {
+		byID[entry.id] = entry
+	}
+
+	// The requested objects, each pattern matching at least one
+	requested := map[int]bool{}
+	for _, p := range schemaPatterns {
+		found := false
+		for _, entry := range entries {
+			if (entry.desc == "SCHEMA" && p.matches("", entry.tag)) || (entry.schema != "-" && entry.schema != "" && p.matches("", entry.schema)) {
+				requested[entry.id] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: schema pattern %q matches no schema in the snapshot", ErrInvalidOptions, p.text)
+		}
+	}
+	for _, p := range tablePatterns {
+		found := false
+		for _, entry := range entries {
+			if entry.desc == "TABLE" && p.matches(entry.schema, entry.tag) {
+				requested[entry.id] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: table pattern %q matches no table in the snapshot", ErrInvalidOptions, p.text)
+		}
+	}
+
+	selected := map[int]bool{}
+	var addPrerequisites func(id int)
+	addPrerequisites = func(id int) {
+		if selected[id] {
+			return
+		}
+		selected[id] = true
+		if entry, ok := byID[id]; ok && !existingTarget {
+			for _, dep := range entry.deps {
+				addPrerequisites(dep)
+			}
+		}
+	}
+	for id := range requested {
+		addPrerequisites(id)
+	}
+
+	// Add dependents until none is left: objects that depend on something
+	// requested, or on a dependent added before. A serial column's sequence
+	// only depends on its schema; the default using it brings it along, even
+	// into an existing database, with its ownership and privileges.
+	owners := maps.Clone(requested)
+	for changed := true; changed; {
+		changed = false
+		for _, entry := range entries {
+			if selected[entry.id] || !dependentDescs[entry.desc] || !dependsOnAny(entry, owners) {
+				continue
+			}
+			if !existingTarget && dependsOnMissingRelation(entry, byID, selected) {
+				continue
+			}
+			owners[entry.id] = true
+			addPrerequisites(entry.id)
+			if entry.desc == "DEFAULT" {
+				for _, dep := range entry.deps {
+					if target, ok := byID[dep]; ok && target.desc == "SEQUENCE" && !owners[dep] {
+						owners[dep] = true
+						addPrerequisites(dep)
+					}
+				}
+			}
+			changed = true
+		}
+	}
+
+	// Rows of the requested tables and values of the selected sequences
+	restored := map[string]bool{}
+	for id := range selected {
+		if entry, ok := byID[id]; ok && (requested[id] && entry.desc == "TABLE" || entry.desc == "SEQUENCE") {
+			restored[entry.desc+" "+entry.schema+"."+entry.tag] = true
+		}
+	}
+	for _, entry := range entries {
+		if (entry.desc == "TABLE DATA" && restored["TABLE "+entry.schema+"."+entry.tag]) ||
+			(entry.desc == "SEQUENCE SET" && restored["SEQUENCE "+entry.schema+"."+entry.tag]) {
+			selected[entry.id] = true
+		}
+	}
+
+	var picked []*tocEntry
+	for _, entry := range entries {
+		if selected[entry.id] {
+			picked = append(picked, entry)
+		}
+	}
+	return picked, nil
+}
+
+func dependsOnAny(entry *tocEntry, ids map[int]bool) bool {
+	for _, dep := range entry.deps {
+		if ids[dep] {
+			return true
+		}
+	}
+	return false
+}
+
+// dependsOnMissingRelation reports whether an entry needs a table, view,
+// index or constraint that is not being restored
+func dependsOnMissingRelation(entry *tocEntry, byID map[int]*tocEntry, selected map[int]bool) bool {
+	for _, dep := range entry.deps {
+		if target, ok := byID[dep]; ok && relationDescs[target.desc] && !selected[dep] {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRestoreList writes the entries to a temporary file for pg_restore
+// --use-list and returns its path and a function that removes it
+func writeRestoreList(entries []*tocEntry) (string, func(), error) {
+	file, err := os.CreateTemp("", "pgtm-restore-*.list")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create restore list: %w", err)
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+
+	writer := bufio.NewWriter(file)
+	for _, entry := range entries {
+		fmt.Fprintln(writer, entry.line)
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write restore list: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write restore list: %w", err)
+	}
+	return file.Name(), cleanup, nil
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// sampleRestoreList is `pg_restore -l` output of a small database
+const sampleRestoreList = `;
+; Archive created at 2026-10-16 12:00:00 UTC
+;     dbname: shop
+;     TOC Entries: 27
+;     Format: CUSTOM
+;
+; Selected TOC Entries:
+;
+5; 2615 16385 SCHEMA - sales postgres
+6; 2615 16386 SCHEMA - audit postgres
+2; 3079 16387 EXTENSION - pgcrypto
+3400; 0 0 COMMENT - EXTENSION pgcrypto
+210; 1247 16400 TYPE sales order_status postgres
+211; 1255 16410 FUNCTION sales touch_updated_at() postgres
+215; 1259 16420 TABLE public customers postgres
+216; 1259 16430 TABLE sales orders postgres
+217; 1259 16428 SEQUENCE sales orders_id_seq postgres
+3401; 0 0 SEQUENCE OWNED BY sales orders_id_seq postgres
+220; 1259 16460 TABLE public Order Items postgres
+218; 1259 16440 TABLE audit events postgres
+219; 1259 16450 VIEW public order_totals postgres
+3200; 2604 16431 DEFAULT sales orders id postgres
+3402; 0 16420 TABLE DATA public customers postgres
+3403; 0 16430 TABLE DATA sales orders postgres
+3409; 0 16460 TABLE DATA public Order Items postgres
+3404; 0 16440 TABLE DATA audit events postgres
+3405; 0 0 SEQUENCE SET sales orders_id_seq postgres
+3250; 2606 16435 CONSTRAINT public customers customers_pkey postgres
+3251; 2606 16436 CONSTRAINT sales orders orders_pkey postgres
+3300; 1259 16437 INDEX sales orders_customer_idx postgres
+3350; 2620 16438 TRIGGER sales orders orders_touch postgres
+3360; 2606 16439 FK CONSTRAINT sales orders orders_customer_fkey postgres
+3406; 0 0 COMMENT sales TABLE orders postgres
+3407; 0 0 ACL - SCHEMA sales postgres
+3408; 0 0 ACL sales SEQUENCE orders_id_seq postgres
+`
+
+// sampleRestoreScript is the verbose schema-only script of the same archive,
+// reduced to the comment blocks that name entries and their dependencies
+const sampleRestoreScript = `--
+-- PostgreSQL database dump
+--
+
+--
+-- TOC entry 5 (class 2615 OID 16385)
+-- Name: sales; Type: SCHEMA; Schema: -; Owner: postgres
+--
+
+--
+-- TOC entry 6 (class 2615 OID 16386)
+-- Name: audit; Type: SCHEMA; Schema: -; Owner: postgres
+--
+
+--
+-- TOC entry 2 (class 3079 OID 16387)
+-- Name: pgcrypto; Type: EXTENSION; Schema: -; Owner: -
+--
+
+--
+-- TOC entry 3400 (class 0 OID 0)
+-- Dependencies: 2
+-- Name: EXTENSION pgcrypto; Type: COMMENT; Schema: -; Owner:
+--
+
+--
+-- TOC entry 210 (class 1247 OID 16400)
+-- Dependencies: 5
+-- Name: order_status; Type: TYPE; Schema: sales; Owner: postgres
+--
+
+--
+-- TOC entry 211 (class 1255 OID 16410)
+-- Dependencies: 5
+-- Name: touch_updated_at(); Type: FUNCTION; Schema: sales; Owner: postgres
+--
+
+--
+-- TOC entry 215 (class 1259 OID 16420)
+-- Name: customers; Type: TABLE; Schema: public; Owner: postgres
+--
+
+--
+-- TOC entry 216 (class 1259 OID 16430)
+-- Dependencies: 5 210
+-- Name: orders; Type: TABLE; Schema: sales; Owner: postgres
+--
+
+--
+-- TOC entry 217 (class 1259 OID 16428)
+-- Dependencies: 5
+-- Name: orders_id_seq; Type: SEQUENCE; Schema: sales; Owner: postgres
+--
+
+--
+-- TOC entry 3401 (class 0 OID 0)
+-- Dependencies: 217
+-- Name: orders_id_seq; Type: SEQUENCE OWNED BY; Schema: sales; Owner: postgres
+--
+
+--
+-- TOC entry 220 (class 1259 OID 16460)
+-- Name: Order Items; Type: TABLE; Schema: public; Owner: postgres
+--
+
+--
+-- TOC entry 218 (class 1259 OID 16440)
+-- Dependencies: 6
+-- Name: events; Type: TABLE; Schema: audit; Owner: postgres
+--
+
+--
+-- TOC entry 219 (class 1259 OID 16450)
+-- Dependencies: 215 216
+-- Name: order_totals; Type: VIEW; Schema: public; Owner: postgres
+--
+
+--
+-- TOC entry 3200 (class 2604 OID 16431)
+-- Dependencies: 216 217
+-- Name: orders id; Type: DEFAULT; Schema: sales; Owner: postgres
+--
+
+--
+-- TOC entry 3250 (class 2606 OID 16435)
+-- Dependencies: 215
+-- Name: customers customers_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+--
+-- TOC entry 3251 (class 2606 OID 16436)
+-- Dependencies: 216
+-- Name: orders orders_pkey; Type: CONSTRAINT; Schema: sales; Owner: postgres
+--
+
+--
+-- TOC entry 3300 (class 1259 OID 16437)
+-- Dependencies: 216
+-- Name: orders_customer_idx; Type: INDEX; Schema: sales; Owner: postgres
+--
+
+--
+-- TOC entry 3350 (class 2620 OID 16438)
+-- Dependencies: 216 211
+-- Name: orders orders_touch; Type: TRIGGER; Schema: sales; Owner: postgres
+--
+
+--
+-- TOC entry 3360 (class 2606 OID 16439)
+-- Dependencies: 216 3250
+-- Name: orders orders_customer_fkey; Type: FK CONSTRAINT; Schema: sales; Owner: postgres
+--
+
+--
+-- TOC entry 3406 (class 0 OID 0)
+-- Dependencies: 216
+-- Name: TABLE orders; Type: COMMENT; Schema: sales; Owner: postgres
+--
+
+--
+-- TOC entry 3407 (class 0 OID 0)
+-- Dependencies: 5
+-- Name: SCHEMA sales; Type: ACL; Schema: -; Owner: postgres
+--
+
+--
+-- TOC entry 3408 (class 0 OID 0)
+-- Dependencies: 217
+-- Name: SEQUENCE orders_id_seq; Type: ACL; Schema: sales; Owner: postgres
+--
+`
+
+func sampleRestoreEntries() []*tocEntry {
+	return parseRestoreList([]byte(sampleRestoreList), []byte(sampleRestoreScript))
+}
+
+func TestParseRestoreList(t *testing.T) {
+	entries := sampleRestoreEntries()
+	if len(entries) != 27 {
+		t.Fatalf("parsed %d entries, want 27", len(entries))
+	}
+
+	tests := []struct {
+		id                 int
+		desc, schema, name string
+		deps               []int
+	}{
+		{id: 5, desc: "SCHEMA", schema: "-", name: "sales"},
+		{id: 3400, desc: "COMMENT", schema: "-", name: "EXTENSION pgcrypto", deps: []int{2}},
+		{id: 211, desc: "FUNCTION", schema: "sales", name: "touch_updated_at()", deps: []int{5}},
+		{id: 216, desc: "TABLE", schema: "sales", name: "orders", deps: []int{5, 210}},
+		{id: 3401, desc: "SEQUENCE OWNED BY", schema: "sales", name: "orders_id_seq", deps: []int{217}},
+		{id: 220, desc: "TABLE", schema: "public", name: "Order Items"},
+		{id: 3200, desc: "DEFAULT", schema: "sales", name: "orders id", deps: []int{216, 217}},
+		// Data entries are not in the schema-only script
+		{id: 3409, desc: "TABLE DATA", schema: "public", name: "Order Items"},
+		{id: 3405, desc: "SEQUENCE SET", schema: "sales", name: "orders_id_seq"},
+		{id: 3360, desc: "FK CONSTRAINT", schema: "sales", name: "orders orders_customer_fkey", deps: []int{216, 3250}},
+	}
+	byID := map[int]*tocEntry{}
+	for _, entry := range entries {
+		byID[entry.id] = entry
+	}
+	for _, tt := range tests {
+		entry := byID[tt.id]
+		if entry == nil {
+			t.Errorf("entry %d is missing", tt.id)
+			continue
+		}
+		if entry.desc != tt.desc || entry.schema != tt.schema || entry.tag != tt.name || !slices.Equal(entry.deps, tt.deps) {
+			t.Errorf("entry %d = %q %q %q %v, want %q %q %q %v", tt.id, entry.desc, entry.schema, entry.tag, entry.deps, tt.desc, tt.schema, tt.name, tt.deps)
+		}
+	}
+	if entries[0].line != "5; 2615 16385 SCHEMA - sales postgres" {
+		t.Errorf("entry 5 keeps line %q", entries[0].line)
+	}
+}
+
+func TestSelectRestoreEntries(t *testing.T) {
+	tests := []struct {
+		name           string
+		objects        models.RestoreObjects
+		existingTarget bool
+		want           []int // in restore order
+	}{
+		{
+			// The foreign key to customers and the view over both tables
+			// need relations that are not restored
+			name:    "table with its dependents and prerequisites",
+			objects: models.RestoreObjects{Tables: []string{"sales.orders"}},
+			want:    []int{5, 210, 211, 216, 217, 3401, 3200, 3403, 3405, 3251, 3300, 3350, 3406, 3408},
+		},
+		{
+			name:    "foreign key between restored tables",
+			objects: models.RestoreObjects{Tables: []string{"sales.orders", "customers"}},
+			want:    []int{5, 210, 211, 215, 216, 217, 3401, 3200, 3402, 3403, 3405, 3250, 3251, 3300, 3350, 3360, 3406, 3408},
+		},
+		{
+			name:    "quoted table name",
+			objects: models.RestoreObjects{Tables: []string{`public."Order Items"`}},
+			want:    []int{220, 3409},
+		},
+		{
+			name:    "wildcards",
+			objects: models.RestoreObjects{Tables: []string{"*.CUST*"}},
+			want:    []int{215, 3402, 3250},
+		},
+		{
+			name:    "schema",
+			objects: models.RestoreObjects{Schemas: []string{"audit"}},
+			want:    []int{6, 218, 3404},
+		},
+		{
+			// The foreign key brings the table it references, but only the
+			// rows of the requested schema are restored
+			name:    "schema whose foreign key references another schema",
+			objects: models.RestoreObjects{Schemas: []string{"sales"}},
+			want:    []int{5, 210, 211, 215, 216, 217, 3401, 3200, 3403, 3405, 3250, 3251, 3300, 3350, 3360, 3406, 3407, 3408},
+		},
+		{
+			// An existing database is assumed to have the schemas, types,
+			// functions and referenced tables already
+			name:           "table into an existing database",
+			objects:        models.RestoreObjects{Tables: []string{"sales.orders"}},
+			existingTarget: true,
+			want:           []int{216, 217, 3401, 3200, 3403, 3405, 3251, 3300, 3350, 3360, 3406, 3408},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picked, err := selectRestoreEntries(sampleRestoreEntries(), &tt.objects, tt.existingTarget)
+			if err != nil {
+				t.Fatalf("selectRestoreEntries: %v", err)
+			}
+			var got []int
+			for _, entry := range picked {
+				got = append(got, entry.id)
+			}
+			if !slices.Equal(got, restoreOrder(tt.want)) {
+				t.Errorf("picked %v, want %v", got, restoreOrder(tt.want))
+			}
+		})
+	}
+}
+
+func TestSelectRestoreEntriesRejectsUnmatchedPatterns(t *testing.T) {
+	for _, objects := range []models.RestoreObjects{
+		{Tables: []string{"sales.missing"}},
+		{Tables: []string{"sales.orders", "public.order_totals"}},
+		{Schemas: []string{"nowhere"}},
+		{Tables: []string{`"sales.orders"`}},
+		{Tables: []string{`public."order items"`}},
+	} {
+		if _, err := selectRestoreEntries(sampleRestoreEntries(), &objects, false); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("objects %+v: error = %v, want ErrInvalidOptions", objects, err)
+		}
+	}
+}
+
+// restoreOrder sorts entry IDs by their position in the sample listing
+func restoreOrder(ids []int) []int {
+	position := map[int]int{}
+	for i, entry := range sampleRestoreEntries() {
+		position[entry.id] = i
+	}
+	sorted := slices.Clone(ids)
+	slices.SortFunc(sorted, func(a, b int) int { return position[a] - position[b] })
+	return sorted
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrNoSafetyCopy is returned when a restore has no database set aside to
+// roll back to or discard
+var ErrNoSafetyCopy = errors.New("restore has no safety copy")
+
+// Restore modes
+const (
+	RestoreModeNew     = "new"     // restore into a new database
+	RestoreModeReplace = "replace" // restore into a staging database and swap it in for the target
+)
+
+// The replaced database is kept as <target>_pre_restore_<timestamp>, which
+// must fit PostgreSQL's 63-byte limit on names
+const maxReplacedNameLength = 63 - len("_pre_restore_20060102_150405")
+
+// How long a swap waits for the sessions it terminated to end
+const swapSessionTimeout = 10 * time.Second
+
+// databaseRename renames one database of a swap
+type databaseRename struct {
+	from, to string
+}
+
+// validateReplace checks a restore that replaces target. The swap renames
+// databases from the admin database, which therefore cannot be replaced.
+func validateReplace(request *models.RestoreRequest, target string) error {
+	if request.ExistingTarget || request.Objects != nil {
+		return fmt.Errorf("%w: mode replace restores a whole snapshot and cannot be combined with objects or existing_target", ErrInvalidOptions)
+	}
+	if target == "postgres" {
+		return fmt.Errorf("%w: the postgres database cannot be replaced", ErrInvalidOptions)
+	}
+	if len(target) > maxReplacedNameLength {
+		return fmt.Errorf("%w: database name %q is too long to keep a safety copy of; mode replace needs names of at most %d bytes", ErrInvalidOptions, target, maxReplacedNameLength)
+	}
+	return nil
+}
+
+// requireDatabase checks that the database a replace restore would swap out
+// exists before anything is loaded
+func (ss *SnapshotService) requireDatabase(config *models.DatabaseConnection, name string) error {
+	adminConfig := *config
+	adminConfig.Database = "postgres"
+
+	db, err := ss.dbService.openConnection(&adminConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", name).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up database %s: %w", name, err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: database %s does not exist and cannot be replaced", ErrInvalidOptions, name)
+	}
+	return nil
+}
+
+// restoreDatabaseName returns the database a restore loads the snapshot into:
+// the staging database of a replace restore, otherwise its target
+func restoreDatabaseName(operation *models.RestoreOperation) string {
+	if operation.StagingDBName != "" {
+		return operation.StagingDBName
+	}
+	return operation.TargetDBName
+}
+
+// swapInRestore puts the staging database of a replace restore in place of
+// its target, which is kept as the safety copy
+func (ss *SnapshotService) swapInRestore(config *models.DatabaseConnection, operation *models.RestoreOperation) error {
+	ss.swapMu.Lock()
+	defer ss.swapMu.Unlock()
+
+	err := ss.renameDatabases(config, []databaseRename{
+		{from: operation.TargetDBName, to: operation.SafetyDBName},
+		{from: operation.StagingDBName, to: operation.TargetDBName},
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	operation.SwapStatus = "swapped"
+	operation.SwappedAt = &now
+	log.Printf("Restore %s swapped %s in; the replaced database is kept as %s", operation.ID, operation.TargetDBName, operation.SafetyDBName)
+	return nil
+}
+
+// RollbackRestore swaps the database a replace restore set aside back in: the
+// safety copy takes the target's name again and the restored database returns
+// to its staging name. config defaults to the saved connection the restore
+// was made through.
+func (ss *SnapshotService) RollbackRestore(config *models.DatabaseConnection, operationID string) (*models.RestoreOperation, error) {
+	ss.swapMu.Lock()
+	defer ss.swapMu.Unlock()
+
+	operation, err := ss.restores.Get(operationID)
+	if err != nil {
+		return nil, err
+	}
+	if operation.SwapStatus != "swapped" {
+		return nil, fmt.Errorf("%w: restore %s cannot be rolled back (swap status: %s)", ErrNoSafetyCopy, operation.ID, swapStatus(operation))
+	}
+	if config, err = ss.swapConnection(config, operation); err != nil {
+		return nil, err
+	}
+
+	err = ss.renameDatabases(config, []databaseRename{
+		{from: operation.TargetDBName, to: operation.StagingDBName},
+		{from: operation.SafetyDBName, to: operation.TargetDBName},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to roll back restore %s: %w", operation.ID, err)
+	}
+
+	now := time.Now()
+	operation.SwapStatus = "rolled_back"
+	operation.RolledBackAt = &now
+	ss.saveRestore(operation)
+	log.Printf("Restore %s rolled back; the restored database is kept as %s", operation.ID, operation.StagingDBName)
+	return operation, nil
+}
+
+// DiscardSafetyCopy drops the database a replace restore set aside: the
+// replaced database after a swap, which ends the chance to roll back, or the
+// restored database after a rollback
+func (ss *SnapshotService) DiscardSafetyCopy(config *models.DatabaseConnection, operationID string) (*models.RestoreOperation, error) {
+	ss.swapMu.Lock()
+	defer ss.swapMu.Unlock()
+
+	operation, err := ss.restores.Get(operationID)
+	if err != nil {
+		return nil, err
+	}
+	var discarded string
+	switch operation.SwapStatus {
+	case "swapped":
+		discarded = operation.SafetyDBName
+	case "rolled_back":
+		discarded = operation.StagingDBName
+	default:
+		return nil, fmt.Errorf("%w: restore %s has nothing to discard (swap status: %s)", ErrNoSafetyCopy, operation.ID, swapStatus(operation))
+	}
+	if config, err = ss.swapConnection(config, operation); err != nil {
+		return nil, err
+	}
+
+	if err := ss.dropDatabase(config, discarded); err != nil {
+		return nil, fmt.Errorf("failed to discard %s: %w", discarded, err)
+	}
+
+	operation.SwapStatus = "discarded"
+	ss.saveRestore(operation)
+	log.Printf("Restore %s discarded database %s", operation.ID, discarded)
+	return operation, nil
+}
+
+func swapStatus(operation *models.RestoreOperation) string {
+	if operation.SwapStatus == "" {
+		return "none"
+	}
+	return operation.SwapStatus
+}
+
+// swapConnection returns config, or when it is nil the saved connection a
+// restore was made through
+func (ss *SnapshotService) swapConnection(config *models.DatabaseConnection, operation *models.RestoreOperation) (*models.DatabaseConnection, error) {
+	if config != nil {
+		return config, nil
+	}
+	config, err := ss.dbService.ResolveConnection(operation.DatabaseID)
+	if err != nil {
+		return nil, fmt.Errorf("restore %s was not made through a saved connection, pass connection_id or database_config: %w", operation.ID, err)
+	}
+	return config, nil
+}
+
+// renameDatabases applies renames in a single transaction, so that either all
+// of them happen or none do. A database that is being accessed cannot be
+// renamed: new connections to the databases are refused and their sessions
+// terminated first, and connections are allowed again afterwards.
+func (ss *SnapshotService) renameDatabases(config *models.DatabaseConnection, renames []databaseRename) error {
+	adminConfig := *config
+	adminConfig.Database = "postgres"
+
+	// Not cached: the pool is only needed for the swap
+	db, err := ss.dbService.openConnection(&adminConfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to admin database: %w", err)
+	}
+	defer db.Close()
+
+	var names []string
+	for _, rename := range renames {
+		names = append(names, rename.from)
+	}
+	closed, err := closeDatabases(db, names)
+	if err != nil {
+		reopenDatabases(db, closed)
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		reopenDatabases(db, closed)
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	for _, rename := range renames {
+		query := fmt.Sprintf("ALTER DATABASE %s RENAME TO %s", pq.QuoteIdentifier(rename.from), pq.QuoteIdentifier(rename.to))
+		if _, err := tx.Exec(query); err != nil {
+			tx.Rollback()
+			reopenDatabases(db, closed)
+			return fmt.Errorf("failed to rename %s to %s: %w", rename.from, rename.to, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		reopenDatabases(db, closed)
+		return fmt.Errorf("failed to commit renames: %w", err)
+	}
+
+	// Every database closed above now has one of the new names
+	var renamed []string
+	for _, rename := range renames {
+		renamed = append(renamed, rename.to)
+	}
+	reopenDatabases(db, renamed)
+	return nil
+}
+
+// closeDatabases refuses new connections to the named databases and ends
+// their sessions, returning the databases it closed
+func closeDatabases(db *sql.DB, names []string) ([]string, error) {
+	var closed []string
+	for _, name := range names {
+		if _, err := db.Exec(fmt.Sprintf("ALTER DATABASE %s ALLOW_CONNECTIONS false", pq.QuoteIdentifier(name))); err != nil {
+			return closed, fmt.Errorf("failed to refuse connections to %s: %w", name, err)
+		}
+		closed = append(closed, name)
+	}
+
+	// pg_terminate_backend only signals the sessions; wait for them to exit
+	deadline := time.Now().Add(swapSessionTimeout)
+	for {
+		var sessions int
+		err := db.QueryRow(`
+			SELECT count(pg_terminate_backend(pid))
+			FROM pg_stat_activity
+			WHERE datname = ANY($1) AND pid <> pg_backend_pid()`, pq.Array(names)).Scan(&sessions)
+		if err != nil {
+			return closed, fmt.Errorf("failed to terminate sessions: %w", err)
+		}
+		if sessions == 0 {
+			return closed, nil
+		}
+		if time.Now().After(deadline) {
+			return closed, fmt.Errorf("%d sessions were still connected after %s", sessions, swapSessionTimeout)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// reopenDatabases allows connections to the named databases again
+func reopenDatabases(db *sql.DB, names []string) {
+	for _, name := range names {
+		if _, err := db.Exec(fmt.Sprintf("ALTER DATABASE %s ALLOW_CONNECTIONS true", pq.QuoteIdentifier(name))); err != nil {
+			log.Printf("Failed to allow connections to %s again: %v", name, err)
+		}
+	}
+}
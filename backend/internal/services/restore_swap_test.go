@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// unreachableConfig points at a port nothing listens on, so every statement
+// of a swap fails
+var unreachableConfig = &models.DatabaseConnection{Host: "127.0.0.1", Port: 1, Database: "shop", Username: "app", SSLMode: "disable"}
+
+func TestValidateReplace(t *testing.T) {
+	tests := []struct {
+		name    string
+		request models.RestoreRequest
+		target  string
+		valid   bool
+	}{
+		{"whole snapshot", models.RestoreRequest{}, "shop", true},
+		{"longest name", models.RestoreRequest{}, strings.Repeat("s", maxReplacedNameLength), true},
+		{"name too long for the safety copy", models.RestoreRequest{}, strings.Repeat("s", maxReplacedNameLength+1), false},
+		{"admin database", models.RestoreRequest{}, "postgres", false},
+		{"existing target", models.RestoreRequest{ExistingTarget: true}, "shop", false},
+		{"selected objects", models.RestoreRequest{Objects: &models.RestoreObjects{Tables: []string{"public.orders"}}}, "shop", false},
+	}
+	for _, tt := range tests {
+		err := validateReplace(&tt.request, tt.target)
+		if tt.valid && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: error = %v, want ErrInvalidOptions", tt.name, err)
+		}
+	}
+}
+
+func TestRestoreDatabaseName(t *testing.T) {
+	replace := &models.RestoreOperation{TargetDBName: "shop", StagingDBName: "shop_staging_20261016_120000"}
+	if got := restoreDatabaseName(replace); got != "shop_staging_20261016_120000" {
+		t.Errorf("replace restore loads %s, want the staging database", got)
+	}
+	if got := restoreDatabaseName(&models.RestoreOperation{TargetDBName: "shop_restored"}); got != "shop_restored" {
+		t.Errorf("new restore loads %s, want its target", got)
+	}
+}
+
+func TestSwapRequiresSafetyCopy(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	for id, status := range map[string]string{
+		"restore-none":        "",
+		"restore-rolled_back": "rolled_back",
+		"restore-discarded":   "discarded",
+	} {
+		if err := ss.restores.Save(&models.RestoreOperation{ID: id, SwapStatus: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"restore-none", "restore-rolled_back", "restore-discarded"} {
+		if _, err := ss.RollbackRestore(unreachableConfig, id); !errors.Is(err, ErrNoSafetyCopy) {
+			t.Errorf("RollbackRestore(%s) error = %v, want ErrNoSafetyCopy", id, err)
+		}
+	}
+	for _, id := range []string{"restore-none", "restore-discarded"} {
+		if _, err := ss.DiscardSafetyCopy(unreachableConfig, id); !errors.Is(err, ErrNoSafetyCopy) {
+			t.Errorf("DiscardSafetyCopy(%s) error = %v, want ErrNoSafetyCopy", id, err)
+		}
+	}
+	if _, err := ss.RollbackRestore(unreachableConfig, "missing"); !errors.Is(err, ErrRestoreNotFound) {
+		t.Errorf("RollbackRestore of a missing restore: error = %v, want ErrRestoreNotFound", err)
+	}
+}
+
+func TestFailedRollbackKeepsSwap(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	swapped := &models.RestoreOperation{
+		ID:            "restore-1",
+		DatabaseID:    "conn-unsaved",
+		Mode:          RestoreModeReplace,
+		Status:        "completed",
+		TargetDBName:  "shop",
+		StagingDBName: "shop_staging_20261016_120000",
+		SafetyDBName:  "shop_pre_restore_20261016_120000",
+		SwapStatus:    "swapped",
+	}
+	if err := ss.restores.Save(swapped); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a config the saved connection is needed
+	if _, err := ss.RollbackRestore(nil, "restore-1"); !errors.Is(err, ErrConnectionNotFound) {
+		t.Errorf("RollbackRestore without a connection: error = %v, want ErrConnectionNotFound", err)
+	}
+	if _, err := ss.RollbackRestore(unreachableConfig, "restore-1"); err == nil {
+		t.Error("RollbackRestore succeeded without a server")
+	}
+	if _, err := ss.DiscardSafetyCopy(unreachableConfig, "restore-1"); err == nil {
+		t.Error("DiscardSafetyCopy succeeded without a server")
+	}
+
+	// Nothing was renamed or dropped, so the restore can still be rolled back
+	recorded, err := ss.restores.Get("restore-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.SwapStatus != "swapped" || recorded.RolledBackAt != nil {
+		t.Errorf("swap status after failures = %s, rolled back at %v, want swapped", recorded.SwapStatus, recorded.RolledBackAt)
+	}
+}
+
+func TestReplaceRestoreValidatedBeforeConnecting(t *testing.T) {
+	ss, _ := newTestSnapshotService(t)
+	if err := ss.catalog.Create(&models.Snapshot{ID: "snap-1", Status: "completed", Format: FormatCustom}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, request := range []*models.RestoreRequest{
+		{SnapshotID: "snap-1", Mode: RestoreModeReplace, TargetDBName: "postgres"},
+		{SnapshotID: "snap-1", Mode: RestoreModeReplace, ExistingTarget: true},
+	} {
+		if _, err := ss.RestoreSnapshot(unreachableConfig, request); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("RestoreSnapshot(%+v) error = %v, want ErrInvalidOptions", request, err)
+		}
+	}
+	// A target that cannot be checked is not replaced
+	if _, err := ss.RestoreSnapshot(unreachableConfig, &models.RestoreRequest{SnapshotID: "snap-1", Mode: RestoreModeReplace}); err == nil {
+		t.Error("RestoreSnapshot replaced a database it could not check")
+	}
+	if operations, err := ss.restores.List(RestoreFilter{}); err != nil || len(operations) != 0 {
+		t.Errorf("recorded %d restores, %v, want none", len(operations), err)
+	}
+}
@@ -0,0 +1,390 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// ErrRetentionPolicyNotFound is returned when a connection has no retention policy
+var ErrRetentionPolicyNotFound = errors.New("retention policy not found")
+
+// Actions of a retention decision
+const (
+	RetentionKeep   = "keep"
+	RetentionDelete = "delete"
+)
+
+// RetentionService stores per-connection retention policies and prunes the
+// snapshots they no longer keep, both on demand and from a background loop
+// every RETENTION_INTERVAL (a Go duration, default 1h)
+type RetentionService struct {
+	mu              sync.Mutex
+	store           *MetadataStore
+	dbService       *DatabaseService
+	snapshotService *SnapshotService
+}
+
+// NewRetentionService creates the retention service and starts its pruner
+func NewRetentionService(store *MetadataStore, dbService *DatabaseService, snapshotService *SnapshotService) *RetentionService {
+	rs := &RetentionService{
+		store:           store,
+		dbService:       dbService,
+		snapshotService: snapshotService,
+	}
+
+	interval := time.Hour
+	if value := os.Getenv("RETENTION_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Warning: Invalid RETENTION_INTERVAL=%q, using %s", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+	go rs.run(interval)
+
+	return rs
+}
+
+// run prunes every connection with a policy once per interval
+func (rs *RetentionService) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		rs.PruneAll()
+	}
+}
+
+// GetPolicy returns the retention policy of a connection
+func (rs *RetentionService) GetPolicy(connectionID string) (*models.RetentionPolicy, error) {
+	var policy models.RetentionPolicy
+	found, err := rs.store.get(retentionBucket, connectionID, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retention policy: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrRetentionPolicyNotFound, connectionID)
+	}
+	return &policy, nil
+}
+
+// SetPolicy validates and saves the retention policy of a saved connection,
+// replacing any existing one. Pruning happens on the next pruner run.
+func (rs *RetentionService) SetPolicy(connectionID string, policy *models.RetentionPolicy) (*models.RetentionPolicy, error) {
+	if _, err := rs.dbService.GetSavedConnection(connectionID); err != nil {
+		return nil, err
+	}
+	policy.ConnectionID = connectionID
+	if err := validateRetentionPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	// Keep the record of the last prune across edits
+	if current, err := rs.GetPolicy(connectionID); err == nil {
+		policy.LastPrunedAt = current.LastPrunedAt
+		policy.LastDeleted = current.LastDeleted
+		policy.LastError = current.LastError
+	}
+	policy.UpdatedAt = time.Now()
+
+	if err := rs.storePolicy(policy); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Saved retention policy for connection %s", connectionID)
+	return policy, nil
+}
+
+// DeletePolicy removes the retention policy of a connection; its snapshots
+// are then kept until deleted by hand
+func (rs *RetentionService) DeletePolicy(connectionID string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, err := rs.GetPolicy(connectionID); err != nil {
+		return err
+	}
+	if err := rs.store.delete(retentionBucket, connectionID); err != nil {
+		return fmt.Errorf("failed to delete retention policy: %w", err)
+	}
+
+	log.Printf("Deleted retention policy for connection %s", connectionID)
+	return nil
+}
+
+// DryRun evaluates a retention policy against the snapshots of a connection
+// without deleting anything. A nil policy evaluates the saved one.
+func (rs *RetentionService) DryRun(connectionID string, policy *models.RetentionPolicy) (*models.RetentionPlan, error) {
+	if policy == nil {
+		var err error
+		if policy, err = rs.GetPolicy(connectionID); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := rs.dbService.GetSavedConnection(connectionID); err != nil {
+			return nil, err
+		}
+		policy.ConnectionID = connectionID
+		if err := validateRetentionPolicy(policy); err != nil {
+			return nil, err
+		}
+	}
+
+	snapshots, err := rs.snapshotService.ListSnapshots(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	return planRetention(policy, snapshots, time.Now()), nil
+}
+
+// PruneAll prunes the snapshots of every connection that has a retention policy
+func (rs *RetentionService) PruneAll() {
+	var policies []*models.RetentionPolicy
+	err := rs.store.forEach(retentionBucket, func(data []byte) error {
+		var policy models.RetentionPolicy
+		if err := json.Unmarshal(data, &policy); err != nil {
+			return err
+		}
+		policies = append(policies, &policy)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to list retention policies: %v", err)
+		return
+	}
+
+	for _, policy := range policies {
+		if _, err := rs.Prune(policy.ConnectionID); err != nil {
+			log.Printf("Failed to prune snapshots of connection %s: %v", policy.ConnectionID, err)
+		}
+	}
+}
+
+// Prune deletes the snapshots of a connection that its retention policy no
+// longer keeps and returns the plan it carried out
+func (rs *RetentionService) Prune(connectionID string) (*models.RetentionPlan, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	policy, err := rs.GetPolicy(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := rs.snapshotService.ListSnapshots(connectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := planRetention(policy, snapshots, time.Now())
+
+	deleted := 0
+	var failures []error
+	for i := range plan.Decisions {
+		decision := &plan.Decisions[i]
+		if decision.Action != RetentionDelete {
+			continue
+		}
+		err := rs.snapshotService.DeleteSnapshot(decision.SnapshotID)
+		if errors.Is(err, ErrSnapshotBusy) {
+			// Left for a later run once the restore or drill reading it is done
+			log.Printf("Retention skipped snapshot %s: %v", decision.SnapshotID, err)
+			decision.Action = RetentionKeep
+			decision.Reasons = []string{err.Error()}
+			plan.KeptBytes += decision.FileSize
+			continue
+		}
+		if err != nil {
+			failures = append(failures, fmt.Errorf("snapshot %s: %w", decision.SnapshotID, err))
+			continue
+		}
+		log.Printf("Retention deleted snapshot %s (%s)", decision.SnapshotID, decision.Reasons[0])
+		deleted++
+	}
+
+	prunedAt := time.Now()
+	policy.LastPrunedAt = &prunedAt
+	policy.LastDeleted = deleted
+	policy.LastError = ""
+	if err := errors.Join(failures...); err != nil {
+		policy.LastError = err.Error()
+	}
+	if err := rs.storePolicy(policy); err != nil {
+		log.Printf("Failed to record retention run for connection %s: %v", connectionID, err)
+	}
+
+	return plan, nil
+}
+
+// storePolicy persists a retention policy
+func (rs *RetentionService) storePolicy(policy *models.RetentionPolicy) error {
+	if err := rs.store.put(retentionBucket, policy.ConnectionID, policy); err != nil {
+		return fmt.Errorf("failed to save retention policy: %w", err)
+	}
+	return nil
+}
+
+// validateRetentionPolicy rejects policies that would keep nothing and unknown timezones
+func validateRetentionPolicy(policy *models.RetentionPolicy) error {
+	if policy.KeepLast < 0 || policy.KeepDaily < 0 || policy.KeepWeekly < 0 || policy.KeepMonthly < 0 || policy.MaxBytes < 0 {
+		return fmt.Errorf("%w: retention counts must not be negative", ErrInvalidOptions)
+	}
+	if policy.KeepLast == 0 && policy.KeepDaily == 0 && policy.KeepWeekly == 0 && policy.KeepMonthly == 0 {
+		return fmt.Errorf("%w: a retention policy needs keep_last, keep_daily, keep_weekly or keep_monthly", ErrInvalidOptions)
+	}
+	if policy.Timezone == "" {
+		policy.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(policy.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidOptions, policy.Timezone)
+	}
+	return nil
+}
+
+// retentionPeriod is one of the calendar rules of a policy: the newest
+// snapshot of each period is kept for the given number of periods
+type retentionPeriod struct {
+	name  string
+	count int
+	key   func(t time.Time) string
+	start func(t time.Time) time.Time // start of the period containing t
+	back  func(t time.Time, n int) time.Time
+}
+
+// planRetention decides which of a connection's snapshots a policy keeps.
+// Only completed snapshots taken of the policy's connection are considered;
+// anything still running, failed or flagged by verification, and snapshots of
+// other databases or with no recorded database, are left alone.
+func planRetention(policy *models.RetentionPolicy, snapshots []*models.Snapshot, now time.Time) *models.RetentionPlan {
+	loc, err := time.LoadLocation(policy.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	now = now.In(loc)
+
+	var candidates []*models.Snapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Status == "completed" && snapshot.DatabaseID == policy.ConnectionID {
+			candidates = append(candidates, snapshot)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt.After(candidates[j].CreatedAt)
+	})
+
+	reasons := make([][]string, len(candidates))
+	for i, snapshot := range candidates {
+		if snapshot.Pinned {
+			reasons[i] = append(reasons[i], "pinned")
+		}
+		if i < policy.KeepLast {
+			reasons[i] = append(reasons[i], fmt.Sprintf("one of the last %d snapshots", policy.KeepLast))
+		}
+	}
+
+	periods := []retentionPeriod{
+		{
+			name:  "day",
+			count: policy.KeepDaily,
+			key:   func(t time.Time) string { return t.Format("2006-01-02") },
+			start: func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc) },
+			back:  func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -n) },
+		},
+		{
+			name:  "week",
+			count: policy.KeepWeekly,
+			key: func(t time.Time) string {
+				year, week := t.ISOWeek()
+				return fmt.Sprintf("%d-W%02d", year, week)
+			},
+			start: func(t time.Time) time.Time {
+				// ISO weeks start on Monday
+				offset := (int(t.Weekday()) + 6) % 7
+				return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+			},
+			back: func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -7*n) },
+		},
+		{
+			name:  "month",
+			count: policy.KeepMonthly,
+			key:   func(t time.Time) string { return t.Format("2006-01") },
+			start: func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc) },
+			back:  func(t time.Time, n int) time.Time { return t.AddDate(0, -n, 0) },
+		},
+	}
+	for _, period := range periods {
+		if period.count == 0 {
+			continue
+		}
+		// The current period counts as the first of the window
+		cutoff := period.back(period.start(now), period.count-1)
+		seen := map[string]bool{}
+		for i, snapshot := range candidates {
+			created := snapshot.CreatedAt.In(loc)
+			if created.Before(cutoff) {
+				break
+			}
+			key := period.key(created)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			reasons[i] = append(reasons[i], fmt.Sprintf("newest of %s %s (keeping %d)", period.name, key, period.count))
+		}
+	}
+
+	plan := &models.RetentionPlan{
+		ConnectionID: policy.ConnectionID,
+		Policy:       policy,
+		EvaluatedAt:  now,
+		Decisions:    make([]models.RetentionDecision, len(candidates)),
+	}
+	for i, snapshot := range candidates {
+		decision := models.RetentionDecision{
+			SnapshotID: snapshot.ID,
+			Name:       snapshot.Name,
+			CreatedAt:  snapshot.CreatedAt,
+			FileSize:   snapshot.FileSize,
+			Action:     RetentionKeep,
+			Reasons:    reasons[i],
+		}
+		if len(decision.Reasons) == 0 {
+			decision.Action = RetentionDelete
+			decision.Reasons = []string{"not kept by any rule"}
+		} else {
+			plan.KeptBytes += snapshot.FileSize
+		}
+		plan.Decisions[i] = decision
+	}
+
+	// Cap the total size by deleting the oldest kept snapshots, sparing pinned
+	// ones and the newest snapshot so there is always something to restore
+	if policy.MaxBytes > 0 {
+		for i := len(plan.Decisions) - 1; i > 0 && plan.KeptBytes > policy.MaxBytes; i-- {
+			decision := &plan.Decisions[i]
+			if decision.Action != RetentionKeep || candidates[i].Pinned {
+				continue
+			}
+			decision.Action = RetentionDelete
+			decision.Reasons = []string{fmt.Sprintf("kept snapshots total %d bytes, over max_bytes of %d", plan.KeptBytes, policy.MaxBytes)}
+			plan.KeptBytes -= decision.FileSize
+		}
+	}
+
+	for _, decision := range plan.Decisions {
+		if decision.Action == RetentionDelete {
+			plan.FreedBytes += decision.FileSize
+		}
+	}
+	return plan
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+func TestDryRunOnlyConsidersSnapshotsOfTheConnection(t *testing.T) {
+	snapshotService, store := newTestSnapshotService(t)
+	rs := &RetentionService{store: store, dbService: snapshotService.dbService, snapshotService: snapshotService}
+
+	policy := &models.RetentionPolicy{ConnectionID: "conn-a", KeepLast: 1, Timezone: "UTC"}
+	if err := rs.storePolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i, snapshot := range []*models.Snapshot{
+		{ID: "own-new", DatabaseID: "conn-a"},
+		{ID: "own-old", DatabaseID: "conn-a"},
+		{ID: "foreign", DatabaseID: "conn-b"},
+		{ID: "legacy", DatabaseID: ""},
+	} {
+		snapshot.Status = "completed"
+		snapshot.CreatedAt = now.Add(-time.Duration(i) * time.Hour)
+		if err := snapshotService.catalog.Create(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan, err := rs.DryRun("conn-a", nil)
+	if err != nil {
+		t.Fatalf("DryRun: %v", err)
+	}
+
+	actions := map[string]string{}
+	for _, decision := range plan.Decisions {
+		actions[decision.SnapshotID] = decision.Action
+	}
+	want := map[string]string{"own-new": RetentionKeep, "own-old": RetentionDelete}
+	if len(actions) != len(want) {
+		t.Fatalf("decisions = %v, want %v", actions, want)
+	}
+	for id, action := range want {
+		if actions[id] != action {
+			t.Errorf("snapshot %s: action %q, want %q", id, actions[id], action)
+		}
+	}
+}
+
+func TestPlanRetention(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	completed := func(id, createdAt string) *models.Snapshot {
+		return &models.Snapshot{ID: id, DatabaseID: "conn", Status: "completed", CreatedAt: at(createdAt), FileSize: 100}
+	}
+	with := func(snapshot *models.Snapshot, change func(*models.Snapshot)) *models.Snapshot {
+		change(snapshot)
+		return snapshot
+	}
+	pinned := func(snapshot *models.Snapshot) { snapshot.Pinned = true }
+
+	// 2026-10-16 is a Friday; its ISO week started on Monday the 12th
+	friday := "2026-10-16T12:00:00Z"
+
+	tests := []struct {
+		name      string
+		policy    models.RetentionPolicy
+		now       string
+		snapshots []*models.Snapshot
+		keep      []string // every other completed snapshot is deleted
+	}{
+		{
+			name:   "no rules",
+			policy: models.RetentionPolicy{},
+			now:    friday,
+			snapshots: []*models.Snapshot{
+				completed("a", "2026-10-16T11:00:00Z"),
+				completed("b", "2026-10-16T10:00:00Z"),
+			},
+		},
+		{
+			name:   "keep last",
+			policy: models.RetentionPolicy{KeepLast: 2},
+			now:    friday,
+			snapshots: []*models.Snapshot{
+				completed("c", "2026-10-16T09:00:00Z"),
+				completed("a", "2026-10-16T11:00:00Z"),
+				completed("b", "2026-10-16T10:00:00Z"),
+			},
+			keep: []string{"a", "b"},
+		},
+		{
+			name:   "daily buckets",
+			policy: models.RetentionPolicy{KeepDaily: 3},
+			now:    friday,
+			snapshots: []*models.Snapshot{
+				completed("today", "2026-10-16T10:00:00Z"),
+				completed("today-earlier", "2026-10-16T08:00:00Z"),
+				completed("yesterday", "2026-10-15T20:00:00Z"),
+				completed("two-days-ago", "2026-10-14T00:00:00Z"),
+				completed("three-days-ago", "2026-10-13T23:59:00Z"),
+			},
+			keep: []string{"today", "yesterday", "two-days-ago"},
+		},
+		{
+			name:   "weekly buckets",
+			policy: models.RetentionPolicy{KeepWeekly: 2},
+			now:    friday,
+			snapshots: []*models.Snapshot{
+				completed("thursday", "2026-10-15T10:00:00Z"),
+				completed("monday", "2026-10-12T01:00:00Z"),
+				completed("last-sunday", "2026-10-11T23:00:00Z"),
+				completed("last-monday", "2026-10-05T00:00:00Z"),
+				completed("two-weeks-ago", "2026-10-04T23:00:00Z"),
+			},
+			keep: []string{"thursday", "last-sunday"},
+		},
+		{
+			name:   "monthly buckets",
+			policy: models.RetentionPolicy{KeepMonthly: 2},
+			now:    friday,
+			snapshots: []*models.Snapshot{
+				completed("october", "2026-10-10T10:00:00Z"),
+				completed("october-first", "2026-10-01T00:00:00Z"),
+				completed("september-end", "2026-09-30T23:00:00Z"),
+				completed("september-start", "2026-09-01T00:00:00Z"),
+				completed("august", "2026-08-31T23:00:00Z"),
+			},
+			keep: []string{"october", "september-end"},
+		},
+		{
+			name:   "rules combine",
+			policy: models.RetentionPolicy{KeepLast: 1, KeepDaily: 2, KeepMonthly: 2},
+			now:    friday,
+			snapshots: []*models.Snapshot{
+				completed("latest", "2026-10-16T11:00:00Z"),
+				completed("today", "2026-10-16T10:00:00Z"),
+				completed("yesterday", "2026-10-15T10:00:00Z"),
+				completed("last-week", "2026-10-08T10:00:00Z"),
+				completed("september", "2026-09-20T10:00:00Z"),
+				completed("september-earlier", "2026-09-10T10:00:00Z"),
+			},
+			keep: []string{"latest", "yesterday", "september"},
+		},
+		{
+			name:   "pinned snapshots are kept",
+			policy: models.RetentionPolicy{KeepLast: 1},
+			now:    friday,
+			snapshots: []*models.Snapshot{
+				completed("latest", "2026-10-16T11:00:00Z"),
+				completed("old", "2026-10-01T00:00:00Z"),
+				with(completed("pinned", "2025-01-01T00:00:00Z"), pinned),
+			},
+			keep: []string{"latest", "pinned"},
+		},
+		{
+			// 03:00 UTC on the 16th is still the 15th in New York
+			name:   "days begin in the policy's timezone",
+			policy: models.RetentionPolicy{KeepDaily: 2, Timezone: "America/New_York"},
+			now:    "2026-10-16T03:00:00Z",
+			snapshots: []*models.Snapshot{
+				completed("evening", "2026-10-16T02:00:00Z"),
+				completed("morning", "2026-10-15T05:00:00Z"),
+				completed("day-before", "2026-10-15T03:00:00Z"),
+			},
+			keep: []string{"evening", "day-before"},
+		},
+		{
+			name:   "days begin at midnight UTC by default",
+			policy: models.RetentionPolicy{KeepDaily: 2},
+			now:    "2026-10-16T03:00:00Z",
+			snapshots: []*models.Snapshot{
+				completed("evening", "2026-10-16T02:00:00Z"),
+				completed("morning", "2026-10-15T05:00:00Z"),
+				completed("day-before", "2026-10-15T03:00:00Z"),
+			},
+			keep: []string{"evening", "morning"},
+		},
+		{
+			name:   "only completed snapshots are considered",
+			policy: models.RetentionPolicy{KeepLast: 1},
+			now:    friday,
+			snapshots: []*models.Snapshot{
+				with(completed("running", "2026-10-16T11:30:00Z"), func(s *models.Snapshot) { s.Status = "running" }),
+				with(completed("failed", "2026-10-16T11:00:00Z"), func(s *models.Snapshot) { s.Status = "failed" }),
+				with(completed("cancelled", "2026-10-16T10:30:00Z"), func(s *models.Snapshot) { s.Status = "cancelled" }),
+				completed("newest-completed", "2026-10-16T10:00:00Z"),
+				completed("older", "2026-10-16T09:00:00Z"),
+			},
+			keep: []string{"newest-completed"},
+		},
+		{
+			name:   "max bytes spares the newest and pinned snapshots",
+			policy: models.RetentionPolicy{KeepLast: 4, MaxBytes: 150},
+			now:    friday,
+			snapshots: []*models.Snapshot{
+				completed("newest", "2026-10-16T11:00:00Z"),
+				completed("second", "2026-10-16T10:00:00Z"),
+				with(completed("pinned", "2026-10-16T09:00:00Z"), pinned),
+				completed("fourth", "2026-10-16T08:00:00Z"),
+			},
+			keep: []string{"newest", "pinned"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := tt.policy
+			policy.ConnectionID = "conn"
+			plan := planRetention(&policy, tt.snapshots, at(tt.now))
+
+			keep := map[string]bool{}
+			for _, id := range tt.keep {
+				keep[id] = true
+			}
+			want := map[string]string{}
+			for _, snapshot := range tt.snapshots {
+				if snapshot.Status != "completed" {
+					continue
+				}
+				want[snapshot.ID] = RetentionDelete
+				if keep[snapshot.ID] {
+					want[snapshot.ID] = RetentionKeep
+				}
+			}
+
+			if len(plan.Decisions) != len(want) {
+				t.Fatalf("got %d decisions, want %d: %+v", len(plan.Decisions), len(want), plan.Decisions)
+			}
+			var keptBytes, freedBytes int64
+			for i, decision := range plan.Decisions {
+				if i > 0 && decision.CreatedAt.After(plan.Decisions[i-1].CreatedAt) {
+					t.Errorf("decisions are not newest first: %s after %s", decision.SnapshotID, plan.Decisions[i-1].SnapshotID)
+				}
+				if decision.Action != want[decision.SnapshotID] {
+					t.Errorf("snapshot %s: action %q (%v), want %q", decision.SnapshotID, decision.Action, decision.Reasons, want[decision.SnapshotID])
+				}
+				if len(decision.Reasons) == 0 {
+					t.Errorf("snapshot %s has no reason", decision.SnapshotID)
+				}
+				if decision.Action == RetentionKeep {
+					keptBytes += decision.FileSize
+				} else {
+					freedBytes += decision.FileSize
+				}
+			}
+			if plan.KeptBytes != keptBytes || plan.FreedBytes != freedBytes {
+				t.Errorf("kept, freed bytes = %d, %d, want %d, %d", plan.KeptBytes, plan.FreedBytes, keptBytes, freedBytes)
+			}
+		})
+	}
+}
+
+func TestPruneSkipsSnapshotsInUse(t *testing.T) {
+	snapshotService, store := newTestSnapshotService(t)
+	rs := &RetentionService{store: store, dbService: snapshotService.dbService, snapshotService: snapshotService}
+
+	policy := &models.RetentionPolicy{ConnectionID: "conn-a", KeepLast: 1, Timezone: "UTC"}
+	if err := rs.storePolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, id := range []string{"newest", "restoring", "old"} {
+		snapshot := &models.Snapshot{ID: id, DatabaseID: "conn-a", Status: "completed", CreatedAt: now.Add(-time.Duration(i) * time.Hour)}
+		if err := snapshotService.catalog.Create(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	restore := &models.RestoreOperation{ID: "restore-1", SnapshotID: "restoring", Status: "in_progress"}
+	if err := snapshotService.restores.Save(restore); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := rs.Prune("conn-a")
+	if err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	actions := map[string]string{}
+	for _, decision := range plan.Decisions {
+		actions[decision.SnapshotID] = decision.Action
+	}
+	want := map[string]string{"newest": RetentionKeep, "restoring": RetentionKeep, "old": RetentionDelete}
+	for id, action := range want {
+		if actions[id] != action {
+			t.Errorf("snapshot %s: action %q, want %q", id, actions[id], action)
+		}
+	}
+
+	for id, kept := range map[string]bool{"newest": true, "restoring": true, "old": false} {
+		_, err := snapshotService.catalog.Get(id)
+		if kept && err != nil {
+			t.Errorf("snapshot %s was deleted: %v", id, err)
+		}
+		if !kept && err == nil {
+			t.Errorf("snapshot %s was kept", id)
+		}
+	}
+	saved, err := rs.GetPolicy("conn-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.LastDeleted != 1 || saved.LastError != "" {
+		t.Errorf("recorded %d deletions with error %q, want 1 and none", saved.LastDeleted, saved.LastError)
+	}
+}
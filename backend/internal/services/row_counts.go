@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"PGTimeMachine-Backend/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// tableKey names a table by schema and name, either of which may contain dots
+type tableKey struct {
+	schema, name string
+}
+
+// String formats a key as snapshots record row counts and table sizes:
+// schema.table, with a part double-quoted when it holds a dot or a quote
+func (k tableKey) String() string {
+	return quoteKeyPart(k.schema) + "." + quoteKeyPart(k.name)
+}
+
+func quoteKeyPart(part string) string {
+	if !strings.ContainsAny(part, `."`) {
+		return part
+	}
+	return `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+}
+
+// parseTableKey reads a key formatted by tableKey.String. Snapshots recorded
+// before parts were quoted are read as a schema up to the first dot.
+func parseTableKey(key string) tableKey {
+	schema, rest := readKeyPart(key, true)
+	name, _ := readKeyPart(strings.TrimPrefix(rest, "."), false)
+	return tableKey{schema: schema, name: name}
+}
+
+// readKeyPart reads a quoted part, or an unquoted one up to the next dot when
+// more parts follow, and returns it with the rest of the key
+func readKeyPart(key string, more bool) (string, string) {
+	if !strings.HasPrefix(key, `"`) {
+		if !more {
+			return key, ""
+		}
+		part, rest, _ := strings.Cut(key, ".")
+		return part, "." + rest
+	}
+	var part strings.Builder
+	for i := 1; i < len(key); i++ {
+		if key[i] != '"' {
+			part.WriteByte(key[i])
+			continue
+		}
+		if i+1 < len(key) && key[i+1] == '"' {
+			part.WriteByte('"')
+			i++
+			continue
+		}
+		return part.String(), key[i+1:]
+	}
+	return part.String(), ""
+}
+
+// recordedCounts converts counts keyed by table into the form snapshots
+// record, or nil when there are none
+func recordedCounts(counts map[tableKey]int64) map[string]int64 {
+	if counts == nil {
+		return nil
+	}
+	recorded := make(map[string]int64, len(counts))
+	for key, count := range counts {
+		recorded[key.String()] = count
+	}
+	return recorded
+}
+
+// parseRecordedCounts reads counts recorded with a snapshot
+func parseRecordedCounts(recorded map[string]int64) map[tableKey]int64 {
+	if recorded == nil {
+		return nil
+	}
+	counts := make(map[tableKey]int64, len(recorded))
+	for key, count := range recorded {
+		counts[parseTableKey(key)] = count
+	}
+	return counts
+}
+
+// sqlQueryer is satisfied by both *sql.DB and *sql.Tx
+type sqlQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// exportDumpSnapshot opens a read-only repeatable read transaction on the
+// source database and exports its snapshot for pg_dump --snapshot, so that
+// anything read in the transaction sees exactly the data being dumped. The
+// transaction must stay open until pg_dump has finished; release ends it and
+// closes its connection.
+func (ss *SnapshotService) exportDumpSnapshot(ctx context.Context, config *models.DatabaseConnection) (tx *sql.Tx, name string, release func(), err error) {
+	db, err := ss.dbService.openConnection(config)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	tx, err = db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		db.Close()
+		return nil, "", nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	if err := tx.QueryRowContext(ctx, `SELECT pg_export_snapshot()`).Scan(&name); err != nil {
+		tx.Rollback()
+		db.Close()
+		return nil, "", nil, fmt.Errorf("failed to export snapshot: %w", err)
+	}
+	release = func() {
+		tx.Rollback()
+		db.Close()
+	}
+	return tx, name, release, nil
+}
+
+// countRows returns the exact number of rows of every user table
+func countRows(ctx context.Context, db sqlQueryer) (map[tableKey]int64, error) {
+	tables, err := listTables(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[tableKey]int64, len(tables))
+	for _, table := range tables {
+		var count int64
+		query := fmt.Sprintf("SELECT count(*) FROM %s.%s", pq.QuoteIdentifier(table.schema), pq.QuoteIdentifier(table.name))
+		if err := db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count rows of %s: %w", table, err)
+		}
+		counts[table] = count
+	}
+	return counts, nil
+}
+
+// listTables lists the user tables of the database
+func listTables(ctx context.Context, db sqlQueryer) ([]tableKey, error) {
+	query := `
+		SELECT n.nspname, c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'r'
+		  AND n.nspname NOT IN ('information_schema', 'pg_catalog')
+		  AND n.nspname NOT LIKE 'pg_toast%'
+		  AND n.nspname NOT LIKE 'pg_temp%'
+		ORDER BY n.nspname, c.relname
+	`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	var tables []tableKey
+	for rows.Next() {
+		var table tableKey
+		if err := rows.Scan(&table.schema, &table.name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	return tables, nil
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"maps"
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+func TestTableKeyRoundTrip(t *testing.T) {
+	tests := []struct {
+		key       tableKey
+		formatted string
+	}{
+		{tableKey{"public", "orders"}, "public.orders"},
+		{tableKey{"public", "Order Items"}, "public.Order Items"},
+		{tableKey{"sales.eu", "orders"}, `"sales.eu".orders`},
+		{tableKey{"public", "orders.2025"}, `public."orders.2025"`},
+		{tableKey{"a.b", "c.d"}, `"a.b"."c.d"`},
+		{tableKey{`say "hi"`, "t"}, `"say ""hi""".t`},
+	}
+	for _, tt := range tests {
+		if got := tt.key.String(); got != tt.formatted {
+			t.Errorf("%#v formats as %q, want %q", tt.key, got, tt.formatted)
+		}
+		if got := parseTableKey(tt.formatted); got != tt.key {
+			t.Errorf("parseTableKey(%q) = %#v, want %#v", tt.formatted, got, tt.key)
+		}
+	}
+
+	// Keys recorded before parts were quoted split at the first dot
+	if got, want := parseTableKey("public.orders.2025"), (tableKey{"public", "orders.2025"}); got != want {
+		t.Errorf("parseTableKey of an unquoted key = %#v, want %#v", got, want)
+	}
+}
+
+func TestFilterRowCountsWithDottedSchema(t *testing.T) {
+	filters, err := compileFilters(&models.SnapshotFilters{
+		Schemas:          []string{`"sales.eu"`},
+		ExcludeTableData: []string{`"sales.eu".audit`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[tableKey]int64{
+		{"sales.eu", "orders"}: 10,
+		{"sales.eu", "audit"}:  5,
+		{"sales", "eu.orders"}: 7,
+	}
+	filterRowCounts(counts, filters)
+
+	want := map[tableKey]int64{
+		{"sales.eu", "orders"}: 10,
+		{"sales.eu", "audit"}:  0,
+	}
+	if !maps.Equal(counts, want) {
+		t.Errorf("filtered counts = %v, want %v", counts, want)
+	}
+}
+
+func TestCompareTablesWithDottedNames(t *testing.T) {
+	filters, err := compileFilters(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := &models.Snapshot{
+		RowCounts: recordedCounts(map[tableKey]int64{
+			{"sales.eu", "orders"}: 10,
+			{"sales", "eu.orders"}: 3,
+		}),
+	}
+	live := map[tableKey]int64{
+		{"sales.eu", "orders"}: 12,
+		{"sales", "eu.orders"}: 3,
+	}
+
+	deltas := compareTables(snapshot, filters, live, nil)
+	if len(deltas) != 2 {
+		t.Fatalf("compared %d tables, want 2: %+v", len(deltas), deltas)
+	}
+	tests := []struct {
+		schema, name, status string
+		rowDelta             int64
+	}{
+		{"sales", "eu.orders", "unchanged", 0},
+		{"sales.eu", "orders", "changed", 2},
+	}
+	for i, tt := range tests {
+		delta := deltas[i]
+		if delta.Schema != tt.schema || delta.Name != tt.name || delta.Status != tt.status || delta.RowDelta != tt.rowDelta {
+			t.Errorf("delta %d = %s.%s %s %d, want %s.%s %s %d", i, delta.Schema, delta.Name, delta.Status, delta.RowDelta, tt.schema, tt.name, tt.status, tt.rowDelta)
+		}
+	}
+}
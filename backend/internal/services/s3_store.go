@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3PartSize is the size of the parts a snapshot is uploaded in; with the
+// 10,000 part limit of S3 it allows objects of up to ~640 GB
+const s3PartSize = 64 * 1024 * 1024
+
+// errUploadAborted stops an upload whose snapshot failed or was cancelled
+var errUploadAborted = errors.New("upload aborted")
+
+// S3Store keeps snapshots as objects in a bucket of an S3-compatible service
+// such as AWS S3 or MinIO
+type S3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3StoreFromEnv connects to the bucket named by S3_BUCKET at S3_ENDPOINT
+// (host:port, default s3.amazonaws.com) with S3_ACCESS_KEY_ID and
+// S3_SECRET_ACCESS_KEY. S3_REGION, S3_USE_SSL (default true) and S3_PREFIX
+// are optional.
+func NewS3StoreFromEnv() (*S3Store, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+
+	useSSL := true
+	if value := os.Getenv("S3_USE_SSL"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_USE_SSL: %w", err)
+		}
+		useSSL = parsed
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(os.Getenv("S3_ACCESS_KEY_ID"), os.Getenv("S3_SECRET_ACCESS_KEY"), ""),
+		Secure: useSSL,
+		Region: os.Getenv("S3_REGION"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewS3Store(client, os.Getenv("S3_BUCKET"), os.Getenv("S3_PREFIX")), nil
+}
+
+// NewS3Store creates a store keeping objects in bucket below prefix
+func NewS3Store(client *minio.Client, bucket, prefix string) *S3Store {
+	return &S3Store{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}
+}
+
+// objectName returns the name of the object at key within the bucket
+func (s *S3Store) objectName(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return path.Join(s.prefix, key)
+}
+
+// Location returns the s3:// URL of the object at key
+func (s *S3Store) Location(key string) string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, s.objectName(key))
+}
+
+// Put starts a multipart upload fed by the returned writer, so the snapshot
+// never has to be staged locally
+func (s *S3Store) Put(ctx context.Context, key string) (SnapshotWriter, error) {
+	reader, writer := io.Pipe()
+	upload := &s3Writer{pipe: writer, done: make(chan error, 1)}
+
+	go func() {
+		_, err := s.client.PutObject(ctx, s.bucket, s.objectName(key), reader, -1, minio.PutObjectOptions{
+			ContentType: "application/octet-stream",
+			PartSize:    s3PartSize,
+		})
+		// Unblock the writer if the upload stopped early
+		reader.CloseWithError(err)
+		upload.done <- err
+	}()
+
+	return upload, nil
+}
+
+// Get streams the object at key
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, s.objectName(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.mapError(key, err)
+	}
+	// GetObject is lazy; stat it so a missing object is reported here
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, s.mapError(key, err)
+	}
+	return object, nil
+}
+
+// Stat returns the size of the object at key
+func (s *S3Store) Stat(ctx context.Context, key string) (int64, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, s.objectName(key), minio.StatObjectOptions{})
+	if err != nil {
+		return 0, s.mapError(key, err)
+	}
+	return info.Size, nil
+}
+
+// List returns the objects whose key starts with prefix
+func (s *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects := []ObjectInfo{}
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.objectName(prefix),
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list snapshot objects: %w", object.Err)
+		}
+		key := object.Key
+		if s.prefix != "" {
+			key = strings.TrimPrefix(key, s.prefix+"/")
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: object.Size, LastModified: object.LastModified})
+	}
+	return objects, nil
+}
+
+// Delete removes the object at key
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, s.objectName(key), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete snapshot object: %w", err)
+	}
+	return nil
+}
+
+// mapError turns a missing object into ErrObjectNotFound
+func (s *S3Store) mapError(key string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return fmt.Errorf("failed to read snapshot object: %w", err)
+}
+
+// s3Writer feeds an upload running in the background
+type s3Writer struct {
+	pipe     *io.PipeWriter
+	done     chan error
+	finished bool
+	err      error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pipe.Write(p)
+}
+
+// Close finishes the upload and waits for the object to be committed
+func (w *s3Writer) Close() error {
+	w.pipe.Close()
+	if err := w.wait(); err != nil {
+		return fmt.Errorf("failed to upload snapshot: %w", err)
+	}
+	return nil
+}
+
+// Abort fails the upload; minio-go then aborts the multipart upload so no
+// partial object is left behind
+func (w *s3Writer) Abort() {
+	w.pipe.CloseWithError(errUploadAborted)
+	w.wait()
+}
+
+// wait returns the result of the upload once it has stopped
+func (w *s3Writer) wait() error {
+	if !w.finished {
+		w.err = <-w.done
+		w.finished = true
+	}
+	return w.err
+}
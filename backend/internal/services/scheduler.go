@@ -0,0 +1,377 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+
+	"github.com/google/uuid"
+
+	// Schedules name their timezone; embed the zone database for hosts without one
+	_ "time/tzdata"
+)
+
+// ErrScheduleNotFound is returned when a schedule does not exist
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// What a schedule does with runs that fell due while the server was down
+const (
+	MissedRunsRunOnce = "run_once" // take one snapshot as soon as the server is back
+	MissedRunsSkip    = "skip"     // wait for the next scheduled time
+)
+
+const (
+	// scheduleTick is how often the scheduler looks for schedules that are due
+	scheduleTick = 15 * time.Second
+	// missedRunGrace is how late a run may start before it counts as missed
+	missedRunGrace = 2 * time.Minute
+)
+
+// ScheduleService stores snapshot schedules and runs them: a background loop
+// queues a snapshot through SnapshotService whenever a schedule falls due
+type ScheduleService struct {
+	mu              sync.Mutex
+	store           *MetadataStore
+	dbService       *DatabaseService
+	snapshotService *SnapshotService
+}
+
+// NewScheduleService creates the schedule service and starts its scheduler loop
+func NewScheduleService(store *MetadataStore, dbService *DatabaseService, snapshotService *SnapshotService) *ScheduleService {
+	s := &ScheduleService{
+		store:           store,
+		dbService:       dbService,
+		snapshotService: snapshotService,
+	}
+	go s.run()
+	return s
+}
+
+// run checks for due schedules every scheduleTick; runs missed while the
+// server was down are found on the first check
+func (s *ScheduleService) run() {
+	s.runDue(time.Now())
+
+	ticker := time.NewTicker(scheduleTick)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.runDue(now)
+	}
+}
+
+// runDue queues a snapshot for every enabled schedule whose next run time has
+// passed and moves it on to its following run time. Several missed runs
+// collapse into at most one snapshot.
+func (s *ScheduleService) runDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules, err := s.loadSchedules("")
+	if err != nil {
+		log.Printf("Warning: Failed to check schedules: %v", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		if !schedule.Enabled || schedule.NextRunAt == nil || now.Before(*schedule.NextRunAt) {
+			continue
+		}
+
+		dueAt := *schedule.NextRunAt
+		if now.Sub(dueAt) > missedRunGrace && schedule.MissedRuns == MissedRunsSkip {
+			log.Printf("Schedule %s skipped the run due at %s", schedule.ID, dueAt.Format(time.RFC3339))
+			schedule.LastError = fmt.Sprintf("Run due at %s was missed while the server was down and skipped", dueAt.Format(time.RFC3339))
+		} else {
+			s.takeSnapshot(schedule, now)
+		}
+
+		if err := s.setNextRun(schedule, now); err != nil {
+			schedule.LastError = err.Error()
+		}
+		if err := s.storeSchedule(schedule); err != nil {
+			log.Printf("Failed to record schedule %s: %v", schedule.ID, err)
+		}
+	}
+}
+
+// takeSnapshot queues a snapshot for a schedule, recording the outcome on it
+func (s *ScheduleService) takeSnapshot(schedule *models.Schedule, now time.Time) {
+	ranAt := now
+	schedule.LastRunAt = &ranAt
+
+	config, err := s.dbService.ResolveConnection(schedule.ConnectionID)
+	if err != nil {
+		schedule.LastError = err.Error()
+		log.Printf("Schedule %s could not run: %v", schedule.ID, err)
+		return
+	}
+
+	options := schedule.Snapshot
+	description := options.Description
+	if description == "" {
+		description = fmt.Sprintf("Taken by schedule %s", schedule.Name)
+	}
+	snapshot, err := s.snapshotService.CreateSnapshot(config, &models.SnapshotRequest{
+		DatabaseID:       schedule.ConnectionID,
+		Name:             fmt.Sprintf("%s %s", schedule.Name, now.In(scheduleLocation(schedule)).Format("2006-01-02 15:04")),
+		Description:      description,
+		Format:           options.Format,
+		Mode:             options.Mode,
+		Priority:         options.Priority,
+		ParallelJobs:     options.ParallelJobs,
+		Compression:      options.Compression,
+		CompressionLevel: options.CompressionLevel,
+		Encryption:       options.Encryption,
+		AgeRecipients:    options.AgeRecipients,
+		Filters:          options.Filters,
+		CountRows:        options.CountRows,
+		ScheduleID:       schedule.ID,
+	})
+	if err != nil {
+		schedule.LastError = err.Error()
+		log.Printf("Schedule %s could not run: %v", schedule.ID, err)
+		return
+	}
+
+	schedule.LastSnapshotID = snapshot.ID
+	schedule.LastError = ""
+	log.Printf("Schedule %s queued snapshot %s", schedule.ID, snapshot.ID)
+}
+
+// setNextRun computes the next run time of a schedule after now; disabled
+// schedules have none
+func (s *ScheduleService) setNextRun(schedule *models.Schedule, now time.Time) error {
+	schedule.NextRunAt = nil
+	if !schedule.Enabled {
+		return nil
+	}
+
+	cron, err := parseCron(schedule.Cron)
+	if err != nil {
+		return err
+	}
+	next := cron.next(now.In(scheduleLocation(schedule)))
+	if next.IsZero() {
+		return fmt.Errorf("%w: cron expression %q never matches", ErrInvalidOptions, schedule.Cron)
+	}
+	next = next.UTC()
+	schedule.NextRunAt = &next
+	return nil
+}
+
+// scheduleLocation returns the timezone of a schedule, validated when it was saved
+func scheduleLocation(schedule *models.Schedule) *time.Location {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// validateSchedule checks the cron expression, timezone, missed run policy
+// and snapshot options of a schedule before it is saved
+func (s *ScheduleService) validateSchedule(schedule *models.Schedule) error {
+	if _, err := parseCron(schedule.Cron); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidOptions, schedule.Timezone)
+	}
+	if schedule.MissedRuns != MissedRunsRunOnce && schedule.MissedRuns != MissedRunsSkip {
+		return fmt.Errorf("%w: missed_runs must be %s or %s, got %q", ErrInvalidOptions, MissedRunsRunOnce, MissedRunsSkip, schedule.MissedRuns)
+	}
+
+	options := schedule.Snapshot
+	format, err := dumpFormatForJobs(options.Format, options.ParallelJobs)
+	if err != nil {
+		return err
+	}
+	if _, err := normalizeMode(options.Mode); err != nil {
+		return err
+	}
+	// Filters are checked against the live database each time the schedule runs
+	if _, err := compileFilters(normalizeFilters(options.Filters)); err != nil {
+		return err
+	}
+	if _, err := normalizeCompression(options.Compression, options.CompressionLevel, format); err != nil {
+		return err
+	}
+	if _, _, err := s.snapshotService.keys.normalize(options.Encryption, options.AgeRecipients, format); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateSchedule validates and saves a new schedule for a saved connection
+func (s *ScheduleService) CreateSchedule(request *models.ScheduleRequest) (*models.Schedule, error) {
+	if _, err := s.dbService.GetSavedConnection(request.ConnectionID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	schedule := &models.Schedule{
+		ID:           uuid.New().String(),
+		Name:         request.Name,
+		ConnectionID: request.ConnectionID,
+		Cron:         request.Cron,
+		Timezone:     request.Timezone,
+		Enabled:      true,
+		MissedRuns:   request.MissedRuns,
+		Snapshot:     request.Snapshot,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+	if schedule.MissedRuns == "" {
+		schedule.MissedRuns = MissedRunsRunOnce
+	}
+	if request.Enabled != nil {
+		schedule.Enabled = *request.Enabled
+	}
+
+	if err := s.validateSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.setNextRun(schedule, now); err != nil {
+		return nil, err
+	}
+	if err := s.storeSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Created schedule %s (%s)", schedule.Name, schedule.Cron)
+	return schedule, nil
+}
+
+// ListSchedules returns the schedules, optionally only those of one connection
+func (s *ScheduleService) ListSchedules(connectionID string) ([]*models.Schedule, error) {
+	return s.loadSchedules(connectionID)
+}
+
+// GetSchedule retrieves a schedule by ID
+func (s *ScheduleService) GetSchedule(id string) (*models.Schedule, error) {
+	return s.loadSchedule(id)
+}
+
+// UpdateSchedule applies a partial update to a schedule. Changing its timing
+// or enabling it computes the next run time afresh, so runs that would have
+// fallen in the past are not made up.
+func (s *ScheduleService) UpdateSchedule(id string, update *models.ScheduleUpdate) (*models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, err := s.loadSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		schedule.Name = *update.Name
+	}
+	if update.Cron != nil {
+		schedule.Cron = *update.Cron
+	}
+	if update.Timezone != nil {
+		schedule.Timezone = *update.Timezone
+		if schedule.Timezone == "" {
+			schedule.Timezone = "UTC"
+		}
+	}
+	if update.Enabled != nil {
+		schedule.Enabled = *update.Enabled
+	}
+	if update.MissedRuns != nil && *update.MissedRuns != "" {
+		schedule.MissedRuns = *update.MissedRuns
+	}
+	if update.Snapshot != nil {
+		schedule.Snapshot = *update.Snapshot
+	}
+	schedule.UpdatedAt = time.Now()
+
+	if err := s.validateSchedule(schedule); err != nil {
+		return nil, err
+	}
+	if err := s.setNextRun(schedule, schedule.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := s.storeSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Updated schedule %s", schedule.ID)
+	return schedule, nil
+}
+
+// DeleteSchedule removes a schedule; snapshots it already took are kept
+func (s *ScheduleService) DeleteSchedule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.loadSchedule(id); err != nil {
+		return err
+	}
+	if err := s.store.delete(schedulesBucket, id); err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+
+	log.Printf("Deleted schedule %s", id)
+	return nil
+}
+
+// storeSchedule persists a schedule
+func (s *ScheduleService) storeSchedule(schedule *models.Schedule) error {
+	if err := s.store.put(schedulesBucket, schedule.ID, schedule); err != nil {
+		return fmt.Errorf("failed to save schedule: %w", err)
+	}
+	return nil
+}
+
+// loadSchedule reads a schedule by ID
+func (s *ScheduleService) loadSchedule(id string) (*models.Schedule, error) {
+	var schedule models.Schedule
+	found, err := s.store.get(schedulesBucket, id, &schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrScheduleNotFound, id)
+	}
+	return &schedule, nil
+}
+
+// loadSchedules reads all schedules, or those of one connection, by name
+func (s *ScheduleService) loadSchedules(connectionID string) ([]*models.Schedule, error) {
+	schedules := []*models.Schedule{}
+	err := s.store.forEach(schedulesBucket, func(data []byte) error {
+		var schedule models.Schedule
+		if err := json.Unmarshal(data, &schedule); err != nil {
+			return err
+		}
+		if connectionID != "" && schedule.ConnectionID != connectionID {
+			return nil
+		}
+		schedules = append(schedules, &schedule)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+
+	return schedules, nil
+}
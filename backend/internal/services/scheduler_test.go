@@ -0,0 +1,49 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+func TestScheduleMissedRunsMustBeKnown(t *testing.T) {
+	snapshotService, store := newTestSnapshotService(t)
+	s := &ScheduleService{store: store, dbService: snapshotService.dbService, snapshotService: snapshotService}
+	if err := s.dbService.storeConnection(&models.DatabaseConnection{ID: "conn-a", Name: "shop"}); err != nil {
+		t.Fatal(err)
+	}
+	request := func(missedRuns string) *models.ScheduleRequest {
+		return &models.ScheduleRequest{Name: "nightly", ConnectionID: "conn-a", Cron: "0 2 * * *", MissedRuns: missedRuns}
+	}
+
+	for _, missedRuns := range []string{"skipp", "RUN_ONCE", "never"} {
+		if _, err := s.CreateSchedule(request(missedRuns)); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("CreateSchedule with missed_runs %q: error = %v, want ErrInvalidOptions", missedRuns, err)
+		}
+	}
+
+	defaulted, err := s.CreateSchedule(request(""))
+	if err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+	if defaulted.MissedRuns != MissedRunsRunOnce {
+		t.Errorf("missed_runs defaulted to %q, want %q", defaulted.MissedRuns, MissedRunsRunOnce)
+	}
+
+	schedule, err := s.CreateSchedule(request(MissedRunsSkip))
+	if err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+	typo := "skipp"
+	if _, err := s.UpdateSchedule(schedule.ID, &models.ScheduleUpdate{MissedRuns: &typo}); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("UpdateSchedule with missed_runs %q: error = %v, want ErrInvalidOptions", typo, err)
+	}
+	stored, err := s.loadSchedule(schedule.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.MissedRuns != MissedRunsSkip {
+		t.Errorf("missed_runs after a rejected update = %q, want %q", stored.MissedRuns, MissedRunsSkip)
+	}
+}
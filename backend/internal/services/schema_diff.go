@@ -0,0 +1,489 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// schemaObjectKinds groups pg_dump object types into the kinds a schema diff
+// reports; other types are reported under their own name in lower case
+var schemaObjectKinds = map[string]string{
+	"TABLE":             "table",
+	"FOREIGN TABLE":     "table",
+	"TYPE":              "type",
+	"DOMAIN":            "type",
+	"DEFAULT":           "default",
+	"CONSTRAINT":        "constraint",
+	"CHECK CONSTRAINT":  "constraint",
+	"FK CONSTRAINT":     "constraint",
+	"INDEX":             "index",
+	"VIEW":              "view",
+	"MATERIALIZED VIEW": "view",
+	"FUNCTION":          "function",
+	"PROCEDURE":         "function",
+	"AGGREGATE":         "function",
+	"ACL":               "grant",
+	"SEQUENCE":          "sequence",
+	"TRIGGER":           "trigger",
+	"SCHEMA":            "schema",
+	"EXTENSION":         "extension",
+}
+
+// tableScopedDescs are the object types whose pg_dump name is "table name"
+var tableScopedDescs = map[string]bool{
+	"CONSTRAINT":       true,
+	"CHECK CONSTRAINT": true,
+	"FK CONSTRAINT":    true,
+	"DEFAULT":          true,
+	"TRIGGER":          true,
+	"RULE":             true,
+	"POLICY":           true,
+}
+
+// diffContextLines is the number of unchanged lines shown around a change
+const diffContextLines = 3
+
+// schemaObject is an object of a snapshot's schema with its definition
+// normalised to the statements pg_dump wrote for it, without comments and
+// blank lines
+type schemaObject struct {
+	kind       string
+	schema     string
+	table      string
+	name       string
+	definition []string
+}
+
+func (o *schemaObject) key() string {
+	return o.kind + "\x00" + o.schema + "\x00" + o.table + "\x00" + o.name
+}
+
+// DiffSnapshots compares the schemas of two snapshots and reports the objects
+// added, removed and changed from the first to the second
+func (ss *SnapshotService) DiffSnapshots(ctx context.Context, fromID, toID string) (*models.SnapshotDiff, error) {
+	from, err := ss.schemaSnapshot(fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := ss.schemaSnapshot(toID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := ss.inspect(ctx)
+	defer cancel()
+
+	fromObjects, err := ss.readSnapshotSchema(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema of snapshot %s: %w", from.ID, inspectionError(ctx, err))
+	}
+	toObjects, err := ss.readSnapshotSchema(ctx, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema of snapshot %s: %w", to.ID, inspectionError(ctx, err))
+	}
+
+	diff := diffSchemas(fromObjects, toObjects)
+	diff.FromSnapshotID = from.ID
+	diff.ToSnapshotID = to.ID
+	return diff, nil
+}
+
+// schemaSnapshot loads a snapshot whose schema can be read
+func (ss *SnapshotService) schemaSnapshot(snapshotID string) (*models.Snapshot, error) {
+	snapshot, err := ss.catalog.Get(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch snapshot.Status {
+	case "completed":
+	case "queued", "creating":
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotBusy, snapshotID)
+	default:
+		return nil, fmt.Errorf("%w: snapshot %s has no dump to read (status: %s)", ErrInvalidOptions, snapshotID, snapshot.Status)
+	}
+	if snapshotMode(snapshot) == ModeDataOnly {
+		return nil, fmt.Errorf("%w: snapshot %s is data_only and holds no schema", ErrInvalidOptions, snapshotID)
+	}
+	return snapshot, nil
+}
+
+// readSnapshotSchema reads the schema objects of a snapshot: archives through
+// pg_restore's schema-only script, plain dumps directly
+func (ss *SnapshotService) readSnapshotSchema(ctx context.Context, snapshot *models.Snapshot) (map[string]*schemaObject, error) {
+	var objects map[string]*schemaObject
+	read := func(r io.Reader) error {
+		var err error
+		objects, err = readSchemaObjects(r)
+		return err
+	}
+
+	if isArchiveFormat(snapshot.Format) {
+		if err := ss.readPgRestore(ctx, snapshot, read, "--schema-only", "--file=-"); err != nil {
+			return nil, err
+		}
+		return objects, nil
+	}
+
+	input, cleanup, err := ss.openSnapshotInput(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	if err := read(input); err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// readSchemaObjects collects the statements under each "-- Name:" comment of
+// a SQL script written by pg_dump or pg_restore, skipping table data. Tables
+// are split into the table itself and its columns and inline constraints.
+func readSchemaObjects(r io.Reader) (map[string]*schemaObject, error) {
+	objects := map[string]*schemaObject{}
+	var current *schemaObject
+	var tableScoped []*schemaObject
+	inCopy := false
+
+	err := scanDumpLines(r, func(line string, size int64, long bool) {
+		switch {
+		case inCopy:
+			if !long && line == `\.` {
+				inCopy = false
+			}
+		case long:
+		case strings.HasPrefix(line, "-- Data for Name: "):
+			current = nil
+		case strings.HasPrefix(line, "-- Name: "):
+			current = nil
+			name, desc, schema, ok := parseScriptHeader(strings.TrimPrefix(line, "-- Name: "))
+			if !ok || desc == "SEQUENCE SET" {
+				return
+			}
+			object := &schemaObject{kind: schemaObjectKinds[desc], schema: schema, name: name}
+			if object.kind == "" {
+				object.kind = strings.ToLower(desc)
+			}
+			// Objects sharing a name, such as grants split across entries, are merged
+			if existing, ok := objects[object.key()]; ok {
+				object = existing
+			} else if tableScopedDescs[desc] {
+				tableScoped = append(tableScoped, object)
+			}
+			objects[object.key()] = object
+			current = object
+		case isCopyStart(line):
+			inCopy = true
+		case current == nil, strings.TrimSpace(line) == "", strings.HasPrefix(line, "--"):
+		default:
+			current.definition = append(current.definition, strings.TrimRight(line, " \t"))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The name of a table-scoped object is its table's name and its own,
+	// unquoted, so either may contain spaces; the tables read tell where the
+	// table's name ends
+	tables := map[string]bool{}
+	for _, object := range objects {
+		if object.kind == "table" {
+			tables[object.schema+"\x00"+object.name] = true
+		}
+	}
+	for _, object := range tableScoped {
+		delete(objects, object.key())
+		object.table, object.name = splitTableScopedName(object.schema, object.name, tables)
+		if existing, ok := objects[object.key()]; ok {
+			existing.definition = append(existing.definition, object.definition...)
+			continue
+		}
+		objects[object.key()] = object
+	}
+
+	for _, object := range objects {
+		if object.kind == "table" {
+			for _, member := range splitTableMembers(object) {
+				objects[member.key()] = member
+			}
+		}
+	}
+	return objects, nil
+}
+
+// splitTableScopedName splits "table name" at the end of the longest table
+// name of schema it starts with, or at its first space when it names no
+// table read
+func splitTableScopedName(schema, name string, tables map[string]bool) (string, string) {
+	table, rest, _ := strings.Cut(name, " ")
+	for i := len(name) - 1; i > 0; i-- {
+		if name[i] == ' ' && tables[schema+"\x00"+name[:i]] {
+			return name[:i], name[i+1:]
+		}
+	}
+	return table, rest
+}
+
+// splitTableMembers takes the column and constraint lines out of a table's
+// CREATE TABLE statement and returns them as objects of their own, so a
+// changed column is reported as such rather than as a changed table
+func splitTableMembers(table *schemaObject) []*schemaObject {
+	var members []*schemaObject
+	var definition []string
+	inBody := false
+
+	for _, line := range table.definition {
+		switch {
+		case !inBody && strings.HasPrefix(line, "CREATE ") && strings.HasSuffix(line, "("):
+			inBody = true
+			definition = append(definition, line)
+		case inBody && strings.HasPrefix(line, ")"):
+			inBody = false
+			definition = append(definition, line)
+		case inBody:
+			member := strings.TrimSuffix(strings.TrimSpace(line), ",")
+			object := &schemaObject{kind: "column", schema: table.schema, table: table.name, definition: []string{member}}
+			if rest, ok := strings.CutPrefix(member, "CONSTRAINT "); ok {
+				object.kind = "constraint"
+				object.name, _ = splitIdentifier(rest)
+			} else {
+				object.name, _ = splitIdentifier(member)
+			}
+			members = append(members, object)
+		default:
+			definition = append(definition, line)
+		}
+	}
+
+	table.definition = definition
+	return members
+}
+
+// splitIdentifier splits the leading, possibly double-quoted, identifier off
+// a line and returns it unquoted
+func splitIdentifier(line string) (string, string) {
+	if !strings.HasPrefix(line, `"`) {
+		name, rest, _ := strings.Cut(line, " ")
+		return name, rest
+	}
+
+	var name strings.Builder
+	for i := 1; i < len(line); i++ {
+		if line[i] != '"' {
+			name.WriteByte(line[i])
+			continue
+		}
+		if i+1 < len(line) && line[i+1] == '"' {
+			name.WriteByte('"')
+			i++
+			continue
+		}
+		return name.String(), strings.TrimPrefix(line[i+1:], " ")
+	}
+	return name.String(), ""
+}
+
+// diffSchemas compares two sets of schema objects
+func diffSchemas(from, to map[string]*schemaObject) *models.SnapshotDiff {
+	diff := &models.SnapshotDiff{
+		Added:   []models.SchemaChange{},
+		Removed: []models.SchemaChange{},
+		Changed: []models.SchemaChange{},
+	}
+
+	for key, before := range from {
+		after, ok := to[key]
+		if !ok {
+			change := schemaChange(before)
+			change.FromDefinition = strings.Join(before.definition, "\n")
+			diff.Removed = append(diff.Removed, change)
+			continue
+		}
+
+		fromDefinition := strings.Join(before.definition, "\n")
+		toDefinition := strings.Join(after.definition, "\n")
+		if fromDefinition == toDefinition {
+			continue
+		}
+		change := schemaChange(before)
+		change.FromDefinition = fromDefinition
+		change.ToDefinition = toDefinition
+		change.Diff = unifiedDiff(before.definition, after.definition, "from/"+schemaObjectPath(before), "to/"+schemaObjectPath(after))
+		diff.Changed = append(diff.Changed, change)
+	}
+	for key, after := range to {
+		if _, ok := from[key]; !ok {
+			change := schemaChange(after)
+			change.ToDefinition = strings.Join(after.definition, "\n")
+			diff.Added = append(diff.Added, change)
+		}
+	}
+
+	for _, changes := range [][]models.SchemaChange{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(changes, func(i, j int) bool {
+			a, b := changes[i], changes[j]
+			if a.Schema != b.Schema {
+				return a.Schema < b.Schema
+			}
+			if a.Table != b.Table {
+				return a.Table < b.Table
+			}
+			if a.Kind != b.Kind {
+				return a.Kind < b.Kind
+			}
+			return a.Name < b.Name
+		})
+	}
+	return diff
+}
+
+func schemaChange(object *schemaObject) models.SchemaChange {
+	return models.SchemaChange{
+		Kind:   object.kind,
+		Schema: object.schema,
+		Table:  object.table,
+		Name:   object.name,
+	}
+}
+
+// schemaObjectPath names an object in the headers of its diff
+func schemaObjectPath(object *schemaObject) string {
+	parts := []string{object.kind, object.schema}
+	if object.table != "" {
+		parts = append(parts, object.table)
+	}
+	return strings.Join(append(parts, object.name), "/")
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed or '+' added
+type diffOp struct {
+	op   byte
+	line string
+}
+
+// unifiedDiff returns the differences between two texts in unified diff
+// format with diffContextLines lines of context
+func unifiedDiff(from, to []string, fromName, toName string) string {
+	ops := diffLines(from, to)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	for i := 0; i < len(ops); {
+		if ops[i].op == ' ' {
+			i++
+			continue
+		}
+
+		// Grow the hunk while the next change is close enough to share context
+		start := max(i-diffContextLines, 0)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].op == ' ' {
+				continue
+			}
+			if j-end > 2*diffContextLines {
+				break
+			}
+			end = j
+		}
+		end = min(end+diffContextLines, len(ops)-1)
+
+		fromLine, toLine := 0, 0
+		for _, op := range ops[:start] {
+			if op.op != '+' {
+				fromLine++
+			}
+			if op.op != '-' {
+				toLine++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, op := range ops[start : end+1] {
+			if op.op != '+' {
+				fromCount++
+			}
+			if op.op != '-' {
+				toCount++
+			}
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount))
+		for _, op := range ops[start : end+1] {
+			out.WriteByte(op.op)
+			out.WriteString(op.line)
+			out.WriteByte('\n')
+		}
+		i = end + 1
+	}
+	return out.String()
+}
+
+// hunkRange formats the line range of a hunk; an empty range names the line
+// before it
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// diffLines computes an edit script between two texts from their longest
+// common subsequence of lines. Definitions are short; texts too large for the
+// table are reported as replaced entirely.
+func diffLines(from, to []string) []diffOp {
+	var ops []diffOp
+	if len(from)*len(to) > 4_000_000 {
+		for _, line := range from {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range to {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the length of the common subsequence of from[i:] and to[j:]
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(from) && j < len(to) {
+		switch {
+		case from[i] == to[j]:
+			ops = append(ops, diffOp{' ', from[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', from[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', to[j]})
+			j++
+		}
+	}
+	for ; i < len(from); i++ {
+		ops = append(ops, diffOp{'-', from[i]})
+	}
+	for ; j < len(to); j++ {
+		ops = append(ops, diffOp{'+', to[j]})
+	}
+	return ops
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+const schemaDiffFrom = `--
+-- PostgreSQL database dump
+--
+
+SET statement_timeout = 0;
+
+--
+-- Name: sales; Type: SCHEMA; Schema: -; Owner: postgres
+--
+
+CREATE SCHEMA sales;
+
+--
+-- Name: customers; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.customers (
+    id integer NOT NULL,
+    name text,
+    email text,
+    CONSTRAINT customers_name_check CHECK ((name <> ''::text))
+);
+
+--
+-- Name: legacy; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.legacy (
+    id integer
+);
+
+--
+-- Name: Order Items; Type: TABLE; Schema: sales; Owner: postgres
+--
+
+CREATE TABLE sales."Order Items" (
+    "Item Id" integer NOT NULL,
+    "Qty" integer
+);
+
+--
+-- Data for Name: customers; Type: TABLE DATA; Schema: public; Owner: postgres
+--
+
+COPY public.customers (id, name, email) FROM stdin;
+1	Ada	ada@example.com
+\.
+
+--
+-- Name: customers customers_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.customers
+    ADD CONSTRAINT customers_pkey PRIMARY KEY (id);
+
+--
+-- Name: Order Items Order Items_pkey; Type: CONSTRAINT; Schema: sales; Owner: postgres
+--
+
+ALTER TABLE ONLY sales."Order Items"
+    ADD CONSTRAINT "Order Items_pkey" PRIMARY KEY ("Item Id");
+
+--
+-- Name: customers_email_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX customers_email_idx ON public.customers USING btree (email);
+
+--
+-- Name: legacy_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX legacy_id_idx ON public.legacy USING btree (id);
+
+--
+-- PostgreSQL database dump complete
+--
+`
+
+const schemaDiffTo = `--
+-- PostgreSQL database dump
+--
+
+SET statement_timeout = 0;
+
+--
+-- Name: sales; Type: SCHEMA; Schema: -; Owner: postgres
+--
+
+CREATE SCHEMA sales;
+
+--
+-- Name: customers; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.customers (
+    id integer NOT NULL,
+    name text NOT NULL,
+    "Created At" timestamp with time zone,
+    CONSTRAINT customers_name_check CHECK ((length(name) > 0))
+);
+
+--
+-- Name: invoices; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.invoices (
+    id integer
+);
+
+--
+-- Name: Order Items; Type: TABLE; Schema: sales; Owner: postgres
+--
+
+CREATE TABLE sales."Order Items" (
+    "Item Id" integer NOT NULL,
+    "Qty" bigint,
+    customer_id integer
+);
+
+--
+-- Data for Name: customers; Type: TABLE DATA; Schema: public; Owner: postgres
+--
+
+COPY public.customers (id, name, "Created At") FROM stdin;
+1	Ada	2026-10-16 12:00:00+00
+2	Grace	\N
+\.
+
+--
+-- Name: customers customers_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.customers
+    ADD CONSTRAINT customers_pkey PRIMARY KEY (id);
+
+--
+-- Name: Order Items Order Items_pkey; Type: CONSTRAINT; Schema: sales; Owner: postgres
+--
+
+ALTER TABLE ONLY sales."Order Items"
+    ADD CONSTRAINT "Order Items_pkey" PRIMARY KEY ("Item Id", "Qty");
+
+--
+-- Name: customers_name_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX customers_name_idx ON public.customers USING btree (name);
+
+--
+-- Name: Order Items Order Items_customer_fkey; Type: FK CONSTRAINT; Schema: sales; Owner: postgres
+--
+
+ALTER TABLE ONLY sales."Order Items"
+    ADD CONSTRAINT "Order Items_customer_fkey" FOREIGN KEY (customer_id) REFERENCES public.customers(id);
+
+--
+-- PostgreSQL database dump complete
+--
+`
+
+func readSchemaFixture(t *testing.T, script string) map[string]*schemaObject {
+	t.Helper()
+	objects, err := readSchemaObjects(strings.NewReader(script))
+	if err != nil {
+		t.Fatalf("readSchemaObjects: %v", err)
+	}
+	return objects
+}
+
+// describeChanges lists changes as "kind schema.table.name"
+func describeChanges(changes []models.SchemaChange) []string {
+	described := []string{}
+	for _, change := range changes {
+		name := change.Schema + "."
+		if change.Table != "" {
+			name += change.Table + "."
+		}
+		described = append(described, change.Kind+" "+name+change.Name)
+	}
+	return described
+}
+
+func TestReadSchemaObjects(t *testing.T) {
+	objects := readSchemaFixture(t, schemaDiffFrom)
+
+	tests := []struct {
+		object     schemaObject
+		definition string
+	}{
+		{schemaObject{kind: "schema", schema: "-", name: "sales"}, "CREATE SCHEMA sales;"},
+		{schemaObject{kind: "table", schema: "public", name: "customers"}, "CREATE TABLE public.customers (\n);"},
+		{schemaObject{kind: "column", schema: "public", table: "customers", name: "name"}, "name text"},
+		{schemaObject{kind: "constraint", schema: "public", table: "customers", name: "customers_name_check"}, "CONSTRAINT customers_name_check CHECK ((name <> ''::text))"},
+		{schemaObject{kind: "column", schema: "sales", table: "Order Items", name: "Item Id"}, `"Item Id" integer NOT NULL`},
+		{schemaObject{kind: "constraint", schema: "public", table: "customers", name: "customers_pkey"}, "ALTER TABLE ONLY public.customers\n    ADD CONSTRAINT customers_pkey PRIMARY KEY (id);"},
+		{schemaObject{kind: "constraint", schema: "sales", table: "Order Items", name: "Order Items_pkey"}, "ALTER TABLE ONLY sales.\"Order Items\"\n    ADD CONSTRAINT \"Order Items_pkey\" PRIMARY KEY (\"Item Id\");"},
+		{schemaObject{kind: "index", schema: "public", name: "legacy_id_idx"}, "CREATE INDEX legacy_id_idx ON public.legacy USING btree (id);"},
+	}
+	for _, tt := range tests {
+		object, ok := objects[tt.object.key()]
+		if !ok {
+			t.Errorf("%s is missing", schemaObjectPath(&tt.object))
+			continue
+		}
+		if definition := strings.Join(object.definition, "\n"); definition != tt.definition {
+			t.Errorf("%s = %q, want %q", schemaObjectPath(&tt.object), definition, tt.definition)
+		}
+	}
+
+	// Rows are not part of the schema
+	for _, object := range objects {
+		for _, line := range object.definition {
+			if strings.Contains(line, "ada@example.com") {
+				t.Errorf("%s holds table data: %q", schemaObjectPath(object), line)
+			}
+		}
+	}
+	if len(objects) != 15 {
+		var keys []string
+		for _, object := range objects {
+			keys = append(keys, schemaObjectPath(object))
+		}
+		slices.Sort(keys)
+		t.Errorf("read %d objects, want 15: %v", len(objects), keys)
+	}
+}
+
+func TestDiffSchemas(t *testing.T) {
+	diff := diffSchemas(readSchemaFixture(t, schemaDiffFrom), readSchemaFixture(t, schemaDiffTo))
+
+	tests := []struct {
+		name    string
+		changes []models.SchemaChange
+		want    []string
+	}{
+		{"added", diff.Added, []string{
+			"index public.customers_name_idx",
+			"table public.invoices",
+			"column public.customers.Created At",
+			"column public.invoices.id",
+			"column sales.Order Items.customer_id",
+			"constraint sales.Order Items.Order Items_customer_fkey",
+		}},
+		{"removed", diff.Removed, []string{
+			"index public.customers_email_idx",
+			"index public.legacy_id_idx",
+			"table public.legacy",
+			"column public.customers.email",
+			"column public.legacy.id",
+		}},
+		{"changed", diff.Changed, []string{
+			"column public.customers.name",
+			"constraint public.customers.customers_name_check",
+			"column sales.Order Items.Qty",
+			"constraint sales.Order Items.Order Items_pkey",
+		}},
+	}
+	for _, tt := range tests {
+		if got := describeChanges(tt.changes); !slices.Equal(got, tt.want) {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	for _, change := range diff.Changed {
+		if change.Name != "Order Items_pkey" {
+			continue
+		}
+		wantDiff := `--- from/constraint/sales/Order Items/Order Items_pkey
++++ to/constraint/sales/Order Items/Order Items_pkey
+@@ -1,2 +1,2 @@
+ ALTER TABLE ONLY sales."Order Items"
+-    ADD CONSTRAINT "Order Items_pkey" PRIMARY KEY ("Item Id");
++    ADD CONSTRAINT "Order Items_pkey" PRIMARY KEY ("Item Id", "Qty");
+`
+		if change.Diff != wantDiff {
+			t.Errorf("diff of Order Items_pkey = %q, want %q", change.Diff, wantDiff)
+		}
+	}
+	for _, change := range diff.Removed {
+		if change.Kind == "column" && change.Name == "email" && change.FromDefinition != "email text" {
+			t.Errorf("removed column email has definition %q", change.FromDefinition)
+		}
+	}
+}
+
+func TestDiffSchemasOfTheSameSchema(t *testing.T) {
+	diff := diffSchemas(readSchemaFixture(t, schemaDiffFrom), readSchemaFixture(t, schemaDiffFrom))
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed) != 0 {
+		t.Errorf("diff of a schema with itself = %+v, want no changes", diff)
+	}
+}
+
+func TestSplitIdentifier(t *testing.T) {
+	tests := []struct {
+		line, name, rest string
+	}{
+		{"id integer NOT NULL", "id", "integer NOT NULL"},
+		{`"Item Id" integer`, "Item Id", "integer"},
+		{`"say ""hi""" text`, `say "hi"`, "text"},
+		{`"trailing"`, "trailing", ""},
+		{"bare", "bare", ""},
+	}
+	for _, tt := range tests {
+		name, rest := splitIdentifier(tt.line)
+		if name != tt.name || rest != tt.rest {
+			t.Errorf("splitIdentifier(%q) = %q, %q, want %q, %q", tt.line, name, rest, tt.name, tt.rest)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	from := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}
+	to := []string{"a", "B", "c", "d", "e", "f", "g", "h", "i", "j", "l", "m"}
+	want := `--- from
++++ to
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -8,5 +8,5 @@
+ h
+ i
+ j
+-k
+ l
++m
+`
+	if got := unifiedDiff(from, to, "from", "to"); got != want {
+		t.Errorf("unifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSplitTableScopedName(t *testing.T) {
+	tables := map[string]bool{
+		"public\x00orders":      true,
+		"public\x00Order":       true,
+		"public\x00Order Items": true,
+	}
+	tests := []struct {
+		schema, name, table, object string
+	}{
+		{"public", "orders orders_pkey", "orders", "orders_pkey"},
+		{"public", "Order Items Order Items_pkey", "Order Items", "Order Items_pkey"},
+		{"public", "Order order_check", "Order", "order_check"},
+		{"public", "missing missing_pkey", "missing", "missing_pkey"},
+		{"sales", "Order Items Order Items_pkey", "Order", "Items Order Items_pkey"},
+	}
+	for _, tt := range tests {
+		table, object := splitTableScopedName(tt.schema, tt.name, tables)
+		if table != tt.table || object != tt.object {
+			t.Errorf("splitTableScopedName(%q, %q) = %q, %q, want %q, %q", tt.schema, tt.name, table, object, tt.table, tt.object)
+		}
+	}
+}
@@ -1,12 +1,15 @@
 package services
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"PGTimeMachine-Backend/internal/models"
@@ -15,22 +18,22 @@ import (
 )
 
 type SnapshotService struct {
-	dbService    *DatabaseService
-	toolsService *PostgreSQLToolsService
-	backupDir    string
+	dbService      *DatabaseService
+	toolsService   *PostgreSQLToolsService
+	catalog        SnapshotCatalog
+	keys           *SnapshotKeys
+	restores       RestoreHistory
+	drills         DrillHistory
+	contents       *contentsCache
+	progress       *progressTracker
+	jobs           *JobManager
+	events         *EventBus
+	storage        *SnapshotStores
+	swapMu         sync.Mutex    // serializes the database swaps of replace restores
+	inspectTimeout time.Duration // bounds reading a snapshot within a request
 }
 
-func NewSnapshotService(dbService *DatabaseService) *SnapshotService {
-	backupDir := os.Getenv("BACKUP_DIR")
-	if backupDir == "" {
-		backupDir = "./backups"
-	}
-
-	// Create backup directory if it doesn't exist
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		log.Printf("Warning: Failed to create backup directory: %v", err)
-	}
-
+func NewSnapshotService(dbService *DatabaseService, store *MetadataStore, storage *SnapshotStores, keys *SnapshotKeys, jobs *JobManager, events *EventBus) *SnapshotService {
 	// Initialize PostgreSQL tools service
 	toolsService := NewPostgreSQLToolsService()
 	if err := toolsService.ValidateTools(); err != nil {
@@ -38,38 +41,193 @@ func NewSnapshotService(dbService *DatabaseService) *SnapshotService {
 		// Continue execution - tools might still work from PATH
 	}
 
-	return &SnapshotService{
-		dbService:    dbService,
-		toolsService: toolsService,
-		backupDir:    backupDir,
+	// Adopt backup files written before the catalog existed
+	catalog := NewSnapshotCatalog(store)
+	if err := ImportLegacySnapshots(store, catalog, storage.Local().Dir()); err != nil {
+		log.Printf("Warning: Failed to import existing backup files: %v", err)
+	}
+
+	ss := &SnapshotService{
+		dbService:      dbService,
+		toolsService:   toolsService,
+		catalog:        catalog,
+		keys:           keys,
+		restores:       NewRestoreHistory(store),
+		drills:         NewDrillHistory(store),
+		contents:       &contentsCache{store: store},
+		progress:       newProgressTracker(),
+		jobs:           jobs,
+		events:         events,
+		storage:        storage,
+		inspectTimeout: envDuration("INSPECT_TIMEOUT", 10*time.Minute),
+	}
+	ss.failInterruptedSnapshots()
+	ss.failInterruptedRestores()
+	ss.failInterruptedDrills()
+	ss.rewrapSnapshotKeys()
+
+	return ss
+}
+
+// failInterruptedSnapshots marks snapshots left queued or running by a previous run as failed
+func (ss *SnapshotService) failInterruptedSnapshots() {
+	snapshots, err := ss.catalog.List("")
+	if err != nil {
+		log.Printf("Warning: Failed to check for interrupted snapshots: %v", err)
+		return
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.Status != "queued" && snapshot.Status != "creating" {
+			continue
+		}
+		snapshot.Status = "failed"
+		snapshot.ErrorMessage = "Backup was interrupted by a server restart"
+		if err := ss.catalog.Update(snapshot); err != nil {
+			log.Printf("Failed to update interrupted snapshot %s: %v", snapshot.ID, err)
+		}
+	}
+}
+
+// rewrapSnapshotKeys moves the data keys of encrypted snapshots onto the
+// current master key, so retired keys are only needed until the next start
+func (ss *SnapshotService) rewrapSnapshotKeys() {
+	snapshots, err := ss.catalog.List("")
+	if err != nil {
+		log.Printf("Warning: Failed to check snapshot keys: %v", err)
+		return
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.Encryption == nil {
+			continue
+		}
+		changed, err := ss.keys.rewrap(snapshot.Encryption)
+		if err != nil {
+			log.Printf("Warning: Failed to rewrap data key of snapshot %s: %v", snapshot.ID, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := ss.catalog.Update(snapshot); err != nil {
+			log.Printf("Failed to update data key of snapshot %s: %v", snapshot.ID, err)
+		}
 	}
 }
 
 // CreateSnapshot creates a new database snapshot using pg_dump
 func (ss *SnapshotService) CreateSnapshot(config *models.DatabaseConnection, request *models.SnapshotRequest) (*models.Snapshot, error) {
+	format, err := dumpFormatForJobs(request.Format, request.ParallelJobs)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := normalizeMode(request.Mode)
+	if err != nil {
+		return nil, err
+	}
+	compression, err := normalizeCompression(request.Compression, request.CompressionLevel, format)
+	if err != nil {
+		return nil, err
+	}
+	encryption, recipients, err := ss.keys.normalize(request.Encryption, request.AgeRecipients, format)
+	if err != nil {
+		return nil, err
+	}
+	store, err := ss.storage.Get(config.Storage)
+	if err != nil {
+		return nil, err
+	}
+	// Only pg_dump itself can write a directory-format dump, and only to a local path
+	if format == FormatDirectory && !isLocalStorage(config.Storage) {
+		return nil, fmt.Errorf("%w: directory format snapshots can only be kept in local storage", ErrInvalidOptions)
+	}
+	filters := normalizeFilters(request.Filters)
+	if filters != nil {
+		if err := ss.validateFilters(config, filters); err != nil {
+			return nil, err
+		}
+	}
+
 	snapshot := &models.Snapshot{
-		ID:          uuid.New().String(),
-		DatabaseID:  request.DatabaseID,
-		Name:        request.Name,
-		Description: request.Description,
-		Status:      "creating",
-		CreatedAt:   time.Now(),
+		ID:               uuid.New().String(),
+		DatabaseID:       request.DatabaseID,
+		DatabaseName:     config.Database,
+		Name:             request.Name,
+		Description:      request.Description,
+		Format:           format,
+		Mode:             mode,
+		Filters:          filters,
+		Storage:          StorageLocal,
+		ParallelJobs:     request.ParallelJobs,
+		Compression:      compression,
+		CompressionLevel: request.CompressionLevel,
+		ScheduleID:       request.ScheduleID,
+		CountRows:        request.CountRows,
+		Status:           "queued",
+		CreatedAt:        time.Now(),
+	}
+
+	extension := dumpFormatExtensions[format] + compressionExtensions[compression]
+	if encryption != EncryptionNone {
+		// Only the wrapped data key is kept; performBackup unwraps it again
+		if _, snapshot.Encryption, err = ss.keys.newDataKey(encryption, recipients); err != nil {
+			return nil, err
+		}
+		extension += encryptedExtension
 	}
 
 	// Generate filename
 	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("%s_%s_%s.sql", strings.ReplaceAll(config.Database, " ", "_"), timestamp, snapshot.ID[:8])
-	snapshot.FilePath = filepath.Join(ss.backupDir, filename)
-
-	// Start backup process in goroutine
-	go ss.performBackup(config, snapshot)
+	filename := fmt.Sprintf("%s_%s_%s%s", strings.ReplaceAll(config.Database, " ", "_"), timestamp, snapshot.ID[:8], extension)
+	if config.Storage != "" {
+		snapshot.Storage = config.Storage
+	}
+	snapshot.StorageKey = filename
+	snapshot.FilePath = store.Location(filename)
+
+	if err := ss.catalog.Create(snapshot); err != nil {
+		return nil, err
+	}
+
+	// Queue the backup on a private copy
+	record := *snapshot
+	ss.jobs.Submit(&Job{
+		ID:       snapshot.ID,
+		Kind:     "snapshot",
+		Host:     fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Database: config.Database,
+		Priority: request.Priority,
+		// pg_dump -j holds one connection per worker on top of the leader's
+		Connections: dumpConnections(snapshot.ParallelJobs),
+		Run: func(ctx context.Context) {
+			ss.performBackup(ctx, config, &record)
+		},
+		OnCancel: func() {
+			ss.cancelSnapshot(&record)
+		},
+	})
+	snapshot.QueuePosition = ss.jobs.QueuePosition(snapshot.ID)
+	ss.events.Publish(models.JobEvent{Type: "state", JobID: snapshot.ID, Kind: "snapshot", Status: "queued"})
 
 	return snapshot, nil
 }
 
-// performBackup executes the actual pg_dump command
-func (ss *SnapshotService) performBackup(config *models.DatabaseConnection, snapshot *models.Snapshot) {
+// dumpConnections returns the number of connections a dump run with the given
+// number of parallel jobs opens
+func dumpConnections(jobs int) int {
+	if jobs <= 1 {
+		return 1
+	}
+	return jobs + 1
+}
+
+// performBackup executes the actual pg_dump command; cancelling ctx kills pg_dump
+// and removes the partial dump
+func (ss *SnapshotService) performBackup(ctx context.Context, config *models.DatabaseConnection, snapshot *models.Snapshot) {
 	log.Printf("Starting backup for snapshot %s", snapshot.ID)
+	snapshot.Status = "creating"
+	ss.saveSnapshot(snapshot)
 
 	// Build pg_dump command
 	args := []string{
@@ -77,331 +235,406 @@ func (ss *SnapshotService) performBackup(config *models.DatabaseConnection, snap
 		fmt.Sprintf("--port=%d", config.Port),
 		fmt.Sprintf("--username=%s", config.Username),
 		fmt.Sprintf("--dbname=%s", config.Database),
+		fmt.Sprintf("--format=%s", snapshotFormat(snapshot.Format)),
 		"--verbose",
-		"--clean",
-		"--if-exists",
-		"--create",
 		"--no-password",
-		fmt.Sprintf("--file=%s", snapshot.FilePath),
 	}
 
-	cmd := exec.Command(ss.toolsService.GetPgDumpPath(), args...)
-
-	// Set password via environment variable
-	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", config.Password))
-
-	// Execute the command
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		snapshot.Status = "failed"
-		snapshot.ErrorMessage = fmt.Sprintf("pg_dump failed: %v\nOutput: %s", err, string(output))
-		log.Printf("Backup failed for snapshot %s: %v", snapshot.ID, err)
-		return
+	// Compressed, encrypted and remotely stored snapshots are read from
+	// pg_dump's stdout and written through the pipeline; custom archives being
+	// compressed then skip pg_dump's own compression
+	streamed := isStreamed(snapshot)
+	if !streamed {
+		args = append(args, fmt.Sprintf("--file=%s", snapshot.FilePath))
+	} else if snapshot.Format == FormatCustom && isCompressed(snapshot.Compression) {
+		args = append(args, "--compress=0")
 	}
 
-	// Get file size
-	fileInfo, err := os.Stat(snapshot.FilePath)
+	if flag := dumpModeFlags[snapshotMode(snapshot)]; flag != "" {
+		args = append(args, flag)
+	}
+	args = append(args, filterArgs(snapshot.Filters)...)
+	// Filters were checked when the snapshot was requested
+	filters, err := compileFilters(snapshot.Filters)
 	if err != nil {
-		snapshot.Status = "failed"
-		snapshot.ErrorMessage = fmt.Sprintf("Failed to get file info: %v", err)
-		log.Printf("Failed to get file info for snapshot %s: %v", snapshot.ID, err)
+		ss.failSnapshot(snapshot, err.Error())
 		return
 	}
 
-	// Update snapshot status
-	snapshot.FileSize = fileInfo.Size()
-	snapshot.Status = "completed"
-	now := time.Now()
-	snapshot.CompletedAt = &now
+	// Plain dumps carry their own DROP ... IF EXISTS statements so they can be
+	// replayed over an existing schema. --create is deliberately not used: the
+	// restore always targets a database created by the service. Data-only
+	// dumps have no objects to drop.
+	if !isArchiveFormat(snapshot.Format) && snapshotMode(snapshot) != ModeDataOnly {
+		args = append(args, "--clean", "--if-exists")
+	}
+	if snapshot.ParallelJobs > 1 {
+		args = append(args, fmt.Sprintf("--jobs=%d", snapshot.ParallelJobs))
+	}
 
-	log.Printf("Backup completed for snapshot %s (%.2f MB)", snapshot.ID, float64(snapshot.FileSize)/(1024*1024))
-}
+	// Size up the source tables so pg_dump's verbose output can be turned into a percentage
+	tables, err := ss.dbService.GetTableStats(config)
+	if err != nil {
+		log.Printf("Could not read table sizes for snapshot %s, progress will be approximate: %v", snapshot.ID, err)
+	}
+	snapshot.TableSizes = recordedCounts(dumpedTableSizes(tables, filters))
+	tables = slices.DeleteFunc(tables, func(table models.TableStats) bool {
+		_, withData := filters.includesTable(table.Schema, table.Name)
+		return !withData
+	})
+	progress := newDumpProgress(snapshot.FilePath, tables, snapshot.ParallelJobs > 1)
+
+	// Dump from an exported snapshot and, when asked to, count rows inside it
+	// so restore drills can compare against exactly what the dump contains;
+	// schema-only dumps hold no rows to compare
+	if tx, name, release, err := ss.exportDumpSnapshot(ctx, config); err != nil {
+		log.Printf("Could not export a snapshot for snapshot %s, row counts will not be recorded: %v", snapshot.ID, err)
+	} else {
+		defer release()
+		args = append(args, fmt.Sprintf("--snapshot=%s", name))
+		consistentAt := time.Now()
+		snapshot.ConsistentAt = &consistentAt
+		if snapshot.CountRows && snapshotMode(snapshot) != ModeSchemaOnly {
+			counts, err := countRows(ctx, tx)
+			if err != nil {
+				log.Printf("Could not count rows for snapshot %s: %v", snapshot.ID, err)
+			}
+			filterRowCounts(counts, filters)
+			snapshot.RowCounts = recordedCounts(counts)
+		}
+	}
 
-// RestoreSnapshot restores a database from a snapshot using psql
-func (ss *SnapshotService) RestoreSnapshot(config *models.DatabaseConnection, request *models.RestoreRequest) (*models.RestoreOperation, error) {
-	operation := &models.RestoreOperation{
-		ID:         uuid.New().String(),
-		SnapshotID: request.SnapshotID,
-		DatabaseID: request.DatabaseID,
-		Status:     "pending",
-		CreatedAt:  time.Now(),
+	var output *dumpOutput
+	if streamed {
+		output, err = ss.openDumpOutput(ctx, snapshot)
+		if err != nil {
+			ss.failSnapshot(snapshot, err.Error())
+			log.Printf("Backup failed for snapshot %s: %v", snapshot.ID, err)
+			return
+		}
+		// Discard the partial object unless the dump completes
+		defer output.Abort()
+		progress.output = output
 	}
 
-	// Set target database name
-	if request.TargetDBName != "" {
-		operation.TargetDBName = request.TargetDBName
-	} else {
-		operation.TargetDBName = config.Database + "_restored_" + time.Now().Format("20060102_150405")
+	ss.progress.start(snapshot.ID, progress)
+	defer ss.progress.finish(snapshot.ID)
+	stopReports := ss.reportProgress(snapshot.ID, progress)
+	defer stopReports()
+
+	if ctx.Err() != nil {
+		ss.cancelSnapshot(snapshot)
+		return
 	}
 
-	// Start restore process in goroutine
-	go ss.performRestore(config, operation, request.SnapshotID)
+	cmd := exec.CommandContext(ctx, ss.toolsService.GetPgDumpPath(), args...)
+	setProcessGroup(cmd)
 
-	return operation, nil
-}
+	// Set password via environment variable
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", config.Password))
+	if output != nil {
+		cmd.Stdout = output
+	}
 
-// performRestore executes the actual psql restore command
-func (ss *SnapshotService) performRestore(config *models.DatabaseConnection, operation *models.RestoreOperation, snapshotID string) {
-	log.Printf("Starting restore for operation %s", operation.ID)
-	operation.Status = "in_progress"
-
-	// Find snapshot file (in a real app, you'd query from database)
-	snapshotFile := ss.findSnapshotFile(snapshotID)
-	if snapshotFile == "" {
-		operation.Status = "failed"
-		operation.ErrorMessage = fmt.Sprintf("Snapshot file not found for ID: %s", snapshotID)
-		log.Printf("Restore failed for operation %s: snapshot file not found", operation.ID)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		ss.failSnapshot(snapshot, fmt.Sprintf("Failed to capture pg_dump output: %v", err))
 		return
 	}
 
-	// First, create the target database
-	if err := ss.createDatabase(config, operation.TargetDBName); err != nil {
-		operation.Status = "failed"
-		operation.ErrorMessage = fmt.Sprintf("Failed to create target database: %v", err)
-		log.Printf("Restore failed for operation %s: %v", operation.ID, err)
+	if err := cmd.Start(); err != nil {
+		ss.failSnapshot(snapshot, fmt.Sprintf("Failed to start pg_dump: %v", err))
+		log.Printf("Backup failed for snapshot %s: %v", snapshot.ID, err)
 		return
 	}
 
-	// Build psql command to restore
-	args := []string{
-		fmt.Sprintf("--host=%s", config.Host),
-		fmt.Sprintf("--port=%d", config.Port),
-		fmt.Sprintf("--username=%s", config.Username),
-		fmt.Sprintf("--dbname=%s", operation.TargetDBName),
-		"--verbose",
-		"--no-password",
-		fmt.Sprintf("--file=%s", snapshotFile),
+	// Stream verbose output line by line into the progress tracker
+	var verbose strings.Builder
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		verbose.WriteString(line)
+		verbose.WriteByte('\n')
+		ss.events.Publish(models.JobEvent{Type: "log", JobID: snapshot.ID, Kind: "snapshot", Line: line})
+		if progress.observe(line) {
+			ss.publishProgress(snapshot.ID, progress)
+		}
 	}
 
-	cmd := exec.Command(ss.toolsService.GetPsqlPath(), args...)
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			ss.cancelSnapshot(snapshot)
+			return
+		}
+		ss.failSnapshot(snapshot, fmt.Sprintf("pg_dump failed: %v\nOutput: %s", err, verbose.String()))
+		log.Printf("Backup failed for snapshot %s: %v", snapshot.ID, err)
+		return
+	}
 
-	// Set password via environment variable
-	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", config.Password))
+	if output != nil {
+		if err := output.Close(); err != nil {
+			ss.failSnapshot(snapshot, fmt.Sprintf("Failed to write snapshot file: %v", err))
+			log.Printf("Backup failed for snapshot %s: %v", snapshot.ID, err)
+			return
+		}
+	}
 
-	// Execute the command
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		operation.Status = "failed"
-		operation.ErrorMessage = fmt.Sprintf("psql restore failed: %v\nOutput: %s", err, string(output))
-		log.Printf("Restore failed for operation %s: %v", operation.ID, err)
+	// Record the digest and length of what was stored: streamed dumps were
+	// hashed on their way out, files written by pg_dump are read back
+	var digest string
+	var fileSize int64
+	if output != nil {
+		digest, fileSize = output.Sum(), output.stored.Count()
+	} else if digest, fileSize, err = ss.hashSnapshotObject(ctx, snapshot); err != nil {
+		ss.failSnapshot(snapshot, fmt.Sprintf("Failed to checksum snapshot file: %v", err))
+		log.Printf("Failed to checksum snapshot %s: %v", snapshot.ID, err)
 		return
 	}
 
-	// Update operation status
-	operation.Status = "completed"
+	// Update snapshot status
+	snapshot.SHA256 = digest
+	snapshot.FileSize = fileSize
+	snapshot.LogicalSize = fileSize
+	if output != nil {
+		snapshot.LogicalSize = output.counter.Count()
+	}
+	snapshot.Status = "completed"
 	now := time.Now()
-	operation.CompletedAt = &now
+	snapshot.CompletedAt = &now
+	ss.saveSnapshot(snapshot)
 
-	log.Printf("Restore completed for operation %s", operation.ID)
+	log.Printf("Backup completed for snapshot %s (%.2f MB)", snapshot.ID, float64(snapshot.FileSize)/(1024*1024))
 }
 
-// createDatabase creates a new database
-func (ss *SnapshotService) createDatabase(config *models.DatabaseConnection, dbName string) error {
-	// Connect to postgres database to create new database
-	adminConfig := *config
-	adminConfig.Database = "postgres"
-
-	db, err := ss.dbService.EstablishConnection(&adminConfig)
-	if err != nil {
-		return fmt.Errorf("failed to connect to admin database: %w", err)
+// openDumpOutput creates the pipeline a streamed snapshot is written through
+func (ss *SnapshotService) openDumpOutput(ctx context.Context, snapshot *models.Snapshot) (*dumpOutput, error) {
+	var dataKey []byte
+	if snapshot.Encryption != nil {
+		var err error
+		if dataKey, err = ss.keys.unwrap(snapshot.Encryption); err != nil {
+			return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+		}
 	}
 
-	// Create database
-	query := fmt.Sprintf("CREATE DATABASE %s", dbName)
-	_, err = db.Exec(query)
+	store, key, err := ss.snapshotObject(snapshot)
 	if err != nil {
-		return fmt.Errorf("failed to create database: %w", err)
+		return nil, err
 	}
-
-	return nil
-}
-
-// findSnapshotFile finds the snapshot file by ID (simplified implementation)
-func (ss *SnapshotService) findSnapshotFile(snapshotID string) string {
-	files, err := filepath.Glob(filepath.Join(ss.backupDir, "*_"+snapshotID[:8]+".sql"))
-	if err != nil || len(files) == 0 {
-		return ""
+	sink, err := store.Put(ctx, key)
+	if err != nil {
+		return nil, err
 	}
-	return files[0]
-}
-
-// ListSnapshots returns a list of snapshots (simplified implementation)
-func (ss *SnapshotService) ListSnapshots(databaseID string) ([]*models.Snapshot, error) {
-	var snapshots []*models.Snapshot
-
-	// Read the backup directory
-	files, err := os.ReadDir(ss.backupDir)
+	output, err := newDumpOutput(sink, snapshot, dataKey)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// Directory doesn't exist, return empty list
-			return snapshots, nil
-		}
-		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+		sink.Abort()
+		return nil, err
 	}
+	return output, nil
+}
 
-	// Process each .sql file
-	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".sql") {
-			continue
-		}
-
-		filePath := filepath.Join(ss.backupDir, file.Name())
-		fileInfo, err := file.Info()
-		if err != nil {
-			log.Printf("Failed to get file info for %s: %v", file.Name(), err)
-			continue
-		}
-
-		// Parse filename to extract information
-		// Expected format: database_timestamp_snapshotID.sql
-		parts := strings.Split(strings.TrimSuffix(file.Name(), ".sql"), "_")
-		if len(parts) < 3 {
-			log.Printf("Skipping file with unexpected format: %s", file.Name())
-			continue
+// progressReportInterval is how often a running dump publishes its progress
+// between table changes, so subscribers see bytes written grow
+const progressReportInterval = 2 * time.Second
+
+// reportProgress publishes the progress of a dump periodically until the returned function is called
+func (ss *SnapshotService) reportProgress(snapshotID string, progress *dumpProgress) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(progressReportInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ss.publishProgress(snapshotID, progress)
+			case <-done:
+				return
+			}
 		}
+	}()
+	return func() { close(done) }
+}
 
-		snapshotID := parts[len(parts)-1]                   // Last part is snapshot ID
-		database := strings.Join(parts[:len(parts)-2], "_") // All parts except timestamp and ID
-		timestamp := parts[len(parts)-2]                    // Second to last is timestamp
+// publishProgress announces the current progress of a dump to event subscribers
+func (ss *SnapshotService) publishProgress(snapshotID string, progress *dumpProgress) {
+	report := progress.report(snapshotID)
+	ss.events.Publish(models.JobEvent{
+		Type:     "progress",
+		JobID:    snapshotID,
+		Kind:     "snapshot",
+		Status:   report.Status,
+		Message:  report.Message,
+		Progress: report,
+	})
+}
 
-		// Parse timestamp for created_at
-		createdAt, err := time.Parse("20060102_150405", timestamp)
-		if err != nil {
-			// Fallback to file modification time
-			createdAt = fileInfo.ModTime()
-		}
+// saveSnapshot records the current state of a snapshot and announces it to event subscribers
+func (ss *SnapshotService) saveSnapshot(snapshot *models.Snapshot) {
+	if err := ss.catalog.Update(snapshot); err != nil {
+		log.Printf("Failed to record snapshot %s: %v", snapshot.ID, err)
+	}
+	ss.events.Publish(models.JobEvent{
+		Type:    "state",
+		JobID:   snapshot.ID,
+		Kind:    "snapshot",
+		Status:  snapshot.Status,
+		Message: snapshot.ErrorMessage,
+	})
+}
 
-		// Determine status based on file size and age
-		status := "completed"
-		errorMessage := ""
+// failSnapshot records a snapshot as failed in the catalog
+func (ss *SnapshotService) failSnapshot(snapshot *models.Snapshot, message string) {
+	snapshot.Status = "failed"
+	snapshot.ErrorMessage = message
+	ss.saveSnapshot(snapshot)
+}
 
-		// If file was modified very recently, it might still be creating
-		if time.Since(fileInfo.ModTime()) < time.Minute*2 && fileInfo.Size() < 1024 {
-			status = "creating"
-		}
+// cancelSnapshot removes the partial dump and records the snapshot as cancelled
+func (ss *SnapshotService) cancelSnapshot(snapshot *models.Snapshot) {
+	if err := ss.deleteSnapshotObject(snapshot); err != nil {
+		log.Printf("Failed to remove partial dump of snapshot %s: %v", snapshot.ID, err)
+	}
 
-		// Check if file seems corrupted (too small for a real backup)
-		if fileInfo.Size() < 100 && time.Since(fileInfo.ModTime()) > time.Minute*5 {
-			status = "failed"
-			errorMessage = "Backup file appears to be incomplete or corrupted"
-		}
+	snapshot.Status = "cancelled"
+	snapshot.ErrorMessage = "Backup was cancelled"
+	ss.saveSnapshot(snapshot)
 
-		snapshot := &models.Snapshot{
-			ID:           snapshotID,
-			DatabaseID:   databaseID,
-			Name:         fmt.Sprintf("Backup of %s", database),
-			Description:  fmt.Sprintf("Created on %s", createdAt.Format("2006-01-02 15:04:05")),
-			FilePath:     filePath,
-			FileSize:     fileInfo.Size(),
-			Status:       status,
-			ErrorMessage: errorMessage,
-			CreatedAt:    createdAt,
-		}
+	log.Printf("Backup cancelled for snapshot %s", snapshot.ID)
+}
 
-		// Set completion time if completed
-		if status == "completed" {
-			completedAt := fileInfo.ModTime()
-			snapshot.CompletedAt = &completedAt
-		}
+// deleteSnapshotObject removes the dump of a snapshot from its store
+func (ss *SnapshotService) deleteSnapshotObject(snapshot *models.Snapshot) error {
+	store, key, err := ss.snapshotObject(snapshot)
+	if err != nil {
+		return err
+	}
+	return store.Delete(context.Background(), key)
+}
 
-		snapshots = append(snapshots, snapshot)
+// CancelSnapshot stops a snapshot that is queued or still being created
+func (ss *SnapshotService) CancelSnapshot(snapshotID string) error {
+	if _, err := ss.catalog.Get(snapshotID); err != nil {
+		return err
 	}
+	return ss.jobs.Cancel(snapshotID)
+}
 
-	// Sort by creation date (newest first)
-	for i := 0; i < len(snapshots)-1; i++ {
-		for j := i + 1; j < len(snapshots); j++ {
-			if snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt) {
-				snapshots[i], snapshots[j] = snapshots[j], snapshots[i]
-			}
+// ListSnapshots returns the snapshots recorded for a database, newest first
+func (ss *SnapshotService) ListSnapshots(databaseID string) ([]*models.Snapshot, error) {
+	snapshots, err := ss.catalog.List(databaseID)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Status == "queued" {
+			snapshot.QueuePosition = ss.jobs.QueuePosition(snapshot.ID)
 		}
 	}
-
 	return snapshots, nil
 }
 
 // GetSnapshot retrieves a specific snapshot by ID
 func (ss *SnapshotService) GetSnapshot(snapshotID string) (*models.Snapshot, error) {
-	// Find the snapshot file
-	snapshotFile := ss.findSnapshotFile(snapshotID)
-	if snapshotFile == "" {
-		return nil, fmt.Errorf("snapshot not found: %s", snapshotID)
+	snapshot, err := ss.catalog.Get(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Status == "queued" {
+		snapshot.QueuePosition = ss.jobs.QueuePosition(snapshot.ID)
 	}
+	return snapshot, nil
+}
 
-	// Get file info
-	fileInfo, err := os.Stat(snapshotFile)
+// DeleteSnapshot deletes a snapshot and its associated file
+func (ss *SnapshotService) DeleteSnapshot(snapshotID string) error {
+	snapshot, err := ss.catalog.Get(snapshotID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get snapshot file info: %w", err)
+		return err
 	}
 
-	// Parse filename to extract information
-	fileName := filepath.Base(snapshotFile)
-	parts := strings.Split(strings.TrimSuffix(fileName, ".sql"), "_")
-	if len(parts) < 3 {
-		return nil, fmt.Errorf("invalid snapshot filename format: %s", fileName)
+	if snapshot.Status == "queued" || snapshot.Status == "creating" {
+		return fmt.Errorf("%w: %s", ErrSnapshotBusy, snapshotID)
 	}
-
-	database := strings.Join(parts[:len(parts)-2], "_")
-	timestamp := parts[len(parts)-2]
-
-	// Parse timestamp
-	createdAt, err := time.Parse("20060102_150405", timestamp)
+	reader, err := ss.snapshotReader(snapshotID)
 	if err != nil {
-		createdAt = fileInfo.ModTime()
+		return err
+	}
+	if reader != "" {
+		return fmt.Errorf("%w: %s is being read by %s", ErrSnapshotBusy, snapshotID, reader)
 	}
 
-	// Determine status
-	status := "completed"
-	errorMessage := ""
+	if snapshot.FilePath != "" {
+		if err := ss.deleteSnapshotObject(snapshot); err != nil {
+			return err
+		}
+	}
 
-	if time.Since(fileInfo.ModTime()) < time.Minute*2 && fileInfo.Size() < 1024 {
-		status = "creating"
+	if err := ss.catalog.Delete(snapshotID); err != nil {
+		return err
+	}
+	if err := ss.contents.Delete(snapshotID); err != nil {
+		log.Printf("Failed to forget contents of snapshot %s: %v", snapshotID, err)
 	}
 
-	if fileInfo.Size() < 100 && time.Since(fileInfo.ModTime()) > time.Minute*5 {
-		status = "failed"
-		errorMessage = "Backup file appears to be incomplete or corrupted"
+	log.Printf("Deleted snapshot %s", snapshotID)
+	return nil
+}
+
+// snapshotReader names a queued or running restore or drill that reads a
+// snapshot, either as its source or as the schema of a data-only restore, or
+// returns "" when there is none
+func (ss *SnapshotService) snapshotReader(snapshotID string) (string, error) {
+	restores, err := ss.restores.List(RestoreFilter{})
+	if err != nil {
+		return "", err
+	}
+	for _, operation := range restores {
+		if operation.SnapshotID != snapshotID && operation.SchemaSnapshotID != snapshotID {
+			continue
+		}
+		switch operation.Status {
+		case "queued", "in_progress", "swapping":
+			return "restore " + operation.ID, nil
+		}
 	}
 
-	snapshot := &models.Snapshot{
-		ID:           snapshotID,
-		DatabaseID:   "", // We don't have database ID from filename
-		Name:         fmt.Sprintf("Backup of %s", database),
-		Description:  fmt.Sprintf("Created on %s", createdAt.Format("2006-01-02 15:04:05")),
-		FilePath:     snapshotFile,
-		FileSize:     fileInfo.Size(),
-		Status:       status,
-		ErrorMessage: errorMessage,
-		CreatedAt:    createdAt,
+	drills, err := ss.drills.List(RestoreFilter{SnapshotID: snapshotID})
+	if err != nil {
+		return "", err
+	}
+	for _, drill := range drills {
+		if drill.Status == "queued" || drill.Status == "running" {
+			return "drill " + drill.ID, nil
+		}
 	}
+	return "", nil
+}
 
-	if status == "completed" {
-		completedAt := fileInfo.ModTime()
-		snapshot.CompletedAt = &completedAt
+// SetSnapshotPinned pins a snapshot, exempting it from retention pruning, or unpins it
+func (ss *SnapshotService) SetSnapshotPinned(snapshotID string, pinned bool) (*models.Snapshot, error) {
+	snapshot, err := ss.catalog.Get(snapshotID)
+	if err != nil {
+		return nil, err
 	}
 
-	return snapshot, nil
-}
+	// The running job would overwrite the flag when it records the result
+	if snapshot.Status == "queued" || snapshot.Status == "creating" {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotBusy, snapshotID)
+	}
 
-// DeleteSnapshot deletes a snapshot and its associated file
-func (ss *SnapshotService) DeleteSnapshot(snapshotID string) error {
-	// Find and delete the snapshot file
-	snapshotFile := ss.findSnapshotFile(snapshotID)
-	if snapshotFile != "" {
-		if err := os.Remove(snapshotFile); err != nil {
-			return fmt.Errorf("failed to delete snapshot file: %w", err)
-		}
+	snapshot.Pinned = pinned
+	if err := ss.catalog.Update(snapshot); err != nil {
+		return nil, err
 	}
 
-	// In a real application, you would also delete from database
-	log.Printf("Deleted snapshot %s", snapshotID)
-	return nil
+	log.Printf("Snapshot %s pinned: %t", snapshotID, pinned)
+	return snapshot, nil
 }
 
 // GetSnapshotProgress returns the current progress of a snapshot operation
 func (ss *SnapshotService) GetSnapshotProgress(snapshotID string) (*models.SnapshotProgress, error) {
-	// Find the snapshot file
-	snapshotFile := ss.findSnapshotFile(snapshotID)
-	if snapshotFile == "" {
+	snapshot, err := ss.catalog.Get(snapshotID)
+	if err != nil {
 		return &models.SnapshotProgress{
 			SnapshotID: snapshotID,
 			Status:     "not_found",
@@ -410,43 +643,46 @@ func (ss *SnapshotService) GetSnapshotProgress(snapshotID string) (*models.Snaps
 		}, nil
 	}
 
-	// Get file stats to estimate progress
-	stat, err := os.Stat(snapshotFile)
-	if err != nil {
-		// File doesn't exist yet, might be starting
+	switch snapshot.Status {
+	case "queued":
+		position := ss.jobs.QueuePosition(snapshotID)
 		return &models.SnapshotProgress{
 			SnapshotID: snapshotID,
-			Status:     "in_progress",
-			Progress:   5,
-			Message:    "Initializing backup...",
+			Status:     "queued",
+			Progress:   0,
+			Message:    fmt.Sprintf("Waiting in queue (position %d)", position),
+			StartedAt:  &snapshot.CreatedAt,
 		}, nil
-	}
-
-	// Estimate progress based on file size and time
-	fileSize := stat.Size()
-	modTime := stat.ModTime()
-
-	// Simple progress estimation based on time elapsed
-	elapsed := time.Since(modTime)
-	if elapsed < time.Minute*1 {
-		// First minute - show growing progress
-		progress := int(elapsed.Seconds() * 100 / 60) // 0-100% over 1 minute
-		if progress > 95 {
-			progress = 95 // Cap at 95% until completion
-		}
+	case "completed":
+		return &models.SnapshotProgress{
+			SnapshotID:   snapshotID,
+			Status:       "completed",
+			Progress:     100,
+			Message:      fmt.Sprintf("Backup completed (%d bytes)", snapshot.FileSize),
+			FileSize:     snapshot.FileSize,
+			BytesWritten: snapshot.FileSize,
+			StartedAt:    &snapshot.CreatedAt,
+		}, nil
+	case "failed", "cancelled":
 		return &models.SnapshotProgress{
 			SnapshotID: snapshotID,
-			Status:     "in_progress",
-			Progress:   progress,
-			Message:    fmt.Sprintf("Creating backup... (%d bytes)", fileSize),
+			Status:     snapshot.Status,
+			Progress:   0,
+			Message:    snapshot.ErrorMessage,
+			StartedAt:  &snapshot.CreatedAt,
 		}, nil
 	}
 
-	// If file hasn't been modified recently, assume it's complete
+	if progress := ss.progress.get(snapshotID); progress != nil {
+		return progress.report(snapshotID), nil
+	}
+
+	// The dump has been accepted but pg_dump has not started yet
 	return &models.SnapshotProgress{
 		SnapshotID: snapshotID,
-		Status:     "completed",
-		Progress:   100,
-		Message:    fmt.Sprintf("Backup completed (%d bytes)", fileSize),
+		Status:     "in_progress",
+		Progress:   0,
+		Message:    "Initializing backup...",
+		StartedAt:  &snapshot.CreatedAt,
 	}, nil
 }
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+func TestDeleteSnapshotRefusesSnapshotsBeingRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		restore *models.RestoreOperation
+		drill   *models.RestoreDrill
+		busy    bool
+	}{
+		{name: "queued restore", restore: &models.RestoreOperation{SnapshotID: "snap", Status: "queued"}, busy: true},
+		{name: "running restore", restore: &models.RestoreOperation{SnapshotID: "snap", Status: "in_progress"}, busy: true},
+		{name: "swapping restore", restore: &models.RestoreOperation{SnapshotID: "snap", Status: "swapping"}, busy: true},
+		{name: "schema of a data-only restore", restore: &models.RestoreOperation{SnapshotID: "data", SchemaSnapshotID: "snap", Status: "in_progress"}, busy: true},
+		{name: "finished restore", restore: &models.RestoreOperation{SnapshotID: "snap", Status: "completed"}},
+		{name: "restore of another snapshot", restore: &models.RestoreOperation{SnapshotID: "other", Status: "in_progress"}},
+		{name: "queued drill", drill: &models.RestoreDrill{SnapshotID: "snap", Status: "queued"}, busy: true},
+		{name: "running drill", drill: &models.RestoreDrill{SnapshotID: "snap", Status: "running"}, busy: true},
+		{name: "failed drill", drill: &models.RestoreDrill{SnapshotID: "snap", Status: "failed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss, _ := newTestSnapshotService(t)
+			if err := ss.catalog.Create(&models.Snapshot{ID: "snap", Status: "completed", CreatedAt: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.restore != nil {
+				tt.restore.ID = "restore-1"
+				if err := ss.restores.Save(tt.restore); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.drill != nil {
+				tt.drill.ID = "drill-1"
+				if err := ss.drills.Save(tt.drill); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := ss.DeleteSnapshot("snap")
+			if tt.busy {
+				if !errors.Is(err, ErrSnapshotBusy) {
+					t.Fatalf("DeleteSnapshot error = %v, want ErrSnapshotBusy", err)
+				}
+				if _, err := ss.catalog.Get("snap"); err != nil {
+					t.Errorf("snapshot is gone after a refused delete: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DeleteSnapshot: %v", err)
+			}
+			if _, err := ss.catalog.Get("snap"); !errors.Is(err, ErrSnapshotNotFound) {
+				t.Errorf("snapshot after delete: error = %v, want ErrSnapshotNotFound", err)
+			}
+		})
+	}
+}
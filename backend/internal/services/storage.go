@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// ErrObjectNotFound is returned when a snapshot object is not present in its store
+var ErrObjectNotFound = errors.New("snapshot object not found")
+
+// Storage backends a connection can select
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// ObjectInfo describes an object held by a SnapshotStore
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// SnapshotWriter streams a snapshot into a store: Close commits the object
+// and Abort discards whatever was written
+type SnapshotWriter interface {
+	io.Writer
+	Close() error
+	Abort()
+}
+
+// SnapshotStore holds snapshot objects under keys relative to the store root
+type SnapshotStore interface {
+	// Put starts writing the object at key, replacing any existing one
+	Put(ctx context.Context, key string) (SnapshotWriter, error)
+	// Get streams the object at key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat returns the size of the object at key
+	Stat(ctx context.Context, key string) (int64, error)
+	// List returns the objects whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Delete removes the object at key, and for directory-shaped snapshots
+	// everything under it; a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// Location describes where the object at key lives, for display
+	Location(key string) string
+}
+
+// SnapshotStores holds the configured storage backends by name. The local
+// backend, rooted at BACKUP_DIR, is always present; the S3-compatible one is
+// present when S3_BUCKET is set.
+type SnapshotStores struct {
+	local  *LocalStore
+	stores map[string]SnapshotStore
+}
+
+// NewSnapshotStores configures the storage backends from the environment
+func NewSnapshotStores() (*SnapshotStores, error) {
+	backupDir := os.Getenv("BACKUP_DIR")
+	if backupDir == "" {
+		backupDir = "./backups"
+	}
+
+	// Create backup directory if it doesn't exist
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		log.Printf("Warning: Failed to create backup directory: %v", err)
+	}
+
+	local := NewLocalStore(backupDir)
+	stores := &SnapshotStores{
+		local:  local,
+		stores: map[string]SnapshotStore{StorageLocal: local},
+	}
+
+	if os.Getenv("S3_BUCKET") != "" {
+		s3, err := NewS3StoreFromEnv()
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure S3 storage: %w", err)
+		}
+		stores.stores[StorageS3] = s3
+	}
+
+	return stores, nil
+}
+
+// Local returns the local filesystem backend
+func (s *SnapshotStores) Local() *LocalStore {
+	return s.local
+}
+
+// Get returns the backend with the given name; an empty name selects local
+func (s *SnapshotStores) Get(name string) (SnapshotStore, error) {
+	if name == "" {
+		name = StorageLocal
+	}
+	store, ok := s.stores[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: storage backend %s is not configured", ErrInvalidOptions, name)
+	}
+	return store, nil
+}
+
+// snapshotObject returns the store and key holding a snapshot; snapshots
+// recorded before storage backends existed are files in the backup directory
+func (ss *SnapshotService) snapshotObject(snapshot *models.Snapshot) (SnapshotStore, string, error) {
+	store, err := ss.storage.Get(snapshot.Storage)
+	if err != nil {
+		return nil, "", err
+	}
+	key := snapshot.StorageKey
+	if key == "" {
+		key = filepath.Base(snapshot.FilePath)
+	}
+	return store, key, nil
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"PGTimeMachine-Backend/internal/models"
+)
+
+// ErrWALArchiveNotFound is returned when a connection's WAL is not archived
+var ErrWALArchiveNotFound = errors.New("WAL archive not found")
+
+// How long an archiver waits before restarting pg_receivewal after it exits;
+// the delay doubles with every failure in a row
+const (
+	walRestartMin = 5 * time.Second
+	walRestartMax = time.Minute
+)
+
+var (
+	slotNamePattern   = regexp.MustCompile(`^[a-z0-9_]{1,63}$`)
+	walSegmentPattern = regexp.MustCompile(`^[0-9A-F]{24}(\.partial)?$`)
+)
+
+// walArchiver supervises the pg_receivewal of one connection
+type walArchiver struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	running atomic.Bool
+}
+
+// walSegment is a WAL file in an archive; the segment being received has
+// the .partial suffix until it is complete
+type walSegment struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// StartWALArchiving starts archiving the WAL of a saved connection's cluster.
+// pg_receivewal streams it through a replication slot, created if needed,
+// so the server keeps WAL the archive has not received yet; it is restarted
+// whenever it exits, and again when the server starts. Starting an archive
+// that is already enabled returns it unchanged.
+func (ps *PhysicalBackupService) StartWALArchiving(connectionID string, request *models.WALArchiveRequest) (*models.WALArchive, error) {
+	config, err := ps.dbService.GetSavedConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireLocalStorage(config); err != nil {
+		return nil, err
+	}
+
+	slot := request.SlotName
+	if slot == "" {
+		slot = "pgtm_" + strings.ReplaceAll(strings.ToLower(connectionID), "-", "_")
+		slot = slot[:min(len(slot), 63)]
+	}
+	if !slotNamePattern.MatchString(slot) {
+		return nil, fmt.Errorf("%w: slot_name must be 1 to 63 lower case letters, digits and underscores", ErrInvalidOptions)
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if archive, err := ps.loadWALArchive(connectionID); err == nil && archive.Enabled {
+		return ps.describeWALArchiveLocked(archive), nil
+	} else if err != nil && !errors.Is(err, ErrWALArchiveNotFound) {
+		return nil, err
+	}
+
+	archive := &models.WALArchive{
+		ConnectionID: connectionID,
+		SlotName:     slot,
+		Directory:    ps.walDir(connectionID),
+		Enabled:      true,
+		StartedAt:    time.Now(),
+	}
+	if err := os.MkdirAll(archive.Directory, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create WAL archive directory: %w", err)
+	}
+	if err := ps.saveWALArchive(archive); err != nil {
+		return nil, err
+	}
+	ps.startArchiverLocked(*archive)
+
+	log.Printf("Started archiving WAL of connection %s into %s", connectionID, archive.Directory)
+	return ps.describeWALArchiveLocked(archive), nil
+}
+
+// StopWALArchiving stops archiving a connection's WAL and drops its
+// replication slot, so the server no longer keeps WAL for it. The archived
+// WAL is kept; archiving started again later leaves a gap that recovery
+// cannot cross.
+func (ps *PhysicalBackupService) StopWALArchiving(connectionID string) (*models.WALArchive, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	archive, err := ps.loadWALArchive(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if archiver, ok := ps.archivers[connectionID]; ok {
+		archiver.cancel()
+		<-archiver.done
+		delete(ps.archivers, connectionID)
+	}
+
+	archive.Enabled = false
+	if err := ps.saveWALArchive(archive); err != nil {
+		return nil, err
+	}
+	log.Printf("Stopped archiving WAL of connection %s", connectionID)
+
+	config, err := ps.dbService.ResolveConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("archiving stopped but replication slot %s was not dropped: %w", archive.SlotName, err)
+	}
+	args := append(replicationArgs(config), fmt.Sprintf("--slot=%s", archive.SlotName), "--drop-slot")
+	cmd := exec.Command(ps.toolsService.GetPgReceivewalPath(), args...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", config.Password))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("archiving stopped but replication slot %s was not dropped: %w: %s", archive.SlotName, err, strings.TrimSpace(string(output)))
+	}
+
+	return ps.describeWALArchiveLocked(archive), nil
+}
+
+// GetWALArchive returns the state of a connection's WAL archive and the
+// segments it holds
+func (ps *PhysicalBackupService) GetWALArchive(connectionID string) (*models.WALArchive, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	archive, err := ps.loadWALArchive(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	return ps.describeWALArchiveLocked(archive), nil
+}
+
+// describeWALArchiveLocked fills in whether pg_receivewal is running and what
+// the archive holds; callers hold mu
+func (ps *PhysicalBackupService) describeWALArchiveLocked(archive *models.WALArchive) *models.WALArchive {
+	if archiver, ok := ps.archivers[archive.ConnectionID]; ok {
+		archive.Running = archiver.running.Load()
+	}
+
+	segments, err := listWALSegments(archive.Directory)
+	if err != nil {
+		log.Printf("Could not list WAL archive of connection %s: %v", archive.ConnectionID, err)
+		return archive
+	}
+	archive.Segments = len(segments)
+	archive.ArchivedBytes = 0
+	for _, segment := range segments {
+		archive.ArchivedBytes += segment.size
+	}
+	if len(segments) > 0 {
+		latest := segments[len(segments)-1]
+		archive.LatestSegment = latest.name
+		archive.LatestWriteAt = &latest.modTime
+	}
+	return archive
+}
+
+// resumeWALArchives restarts the archivers of enabled archives
+func (ps *PhysicalBackupService) resumeWALArchives() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	err := ps.store.forEach(walArchivesBucket, func(data []byte) error {
+		var archive models.WALArchive
+		if err := json.Unmarshal(data, &archive); err != nil {
+			return err
+		}
+		if archive.Enabled {
+			ps.startArchiverLocked(archive)
+			log.Printf("Resumed archiving WAL of connection %s", archive.ConnectionID)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to resume WAL archiving: %v", err)
+	}
+}
+
+// startArchiverLocked runs the archiver of a connection in the background;
+// callers hold mu
+func (ps *PhysicalBackupService) startArchiverLocked(archive models.WALArchive) {
+	ctx, cancel := context.WithCancel(context.Background())
+	archiver := &walArchiver{cancel: cancel, done: make(chan struct{})}
+	ps.archivers[archive.ConnectionID] = archiver
+
+	go func() {
+		defer close(archiver.done)
+		ps.runArchiver(ctx, archiver, &archive)
+	}()
+}
+
+// runArchiver keeps pg_receivewal running until ctx is cancelled
+func (ps *PhysicalBackupService) runArchiver(ctx context.Context, archiver *walArchiver, archive *models.WALArchive) {
+	delay := walRestartMin
+	for {
+		startedAt := time.Now()
+		err := ps.receiveWAL(ctx, archiver, archive)
+		archiver.running.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// A run that lasted a while was healthy; start backing off afresh
+		if time.Since(startedAt) > walRestartMax {
+			delay = walRestartMin
+		}
+		log.Printf("pg_receivewal for connection %s exited, restarting in %s: %v", archive.ConnectionID, delay, err)
+		ps.recordArchiverExit(archive.ConnectionID, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, walRestartMax)
+	}
+}
+
+// receiveWAL creates the archive's replication slot if it is missing and runs
+// pg_receivewal until it exits
+func (ps *PhysicalBackupService) receiveWAL(ctx context.Context, archiver *walArchiver, archive *models.WALArchive) error {
+	config, err := ps.dbService.ResolveConnection(archive.ConnectionID)
+	if err != nil {
+		return err
+	}
+	env := append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", config.Password))
+	slot := fmt.Sprintf("--slot=%s", archive.SlotName)
+
+	// With --create-slot pg_receivewal only creates the slot and exits
+	create := exec.CommandContext(ctx, ps.toolsService.GetPgReceivewalPath(), append(replicationArgs(config), slot, "--create-slot", "--if-not-exists")...)
+	create.Env = env
+	if output, err := create.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create replication slot %s: %w: %s", archive.SlotName, err, strings.TrimSpace(string(output)))
+	}
+
+	args := append(replicationArgs(config),
+		slot,
+		fmt.Sprintf("--directory=%s", archive.Directory),
+		"--no-loop",
+		"--verbose",
+	)
+	cmd := exec.CommandContext(ctx, ps.toolsService.GetPgReceivewalPath(), args...)
+	setProcessGroup(cmd)
+	cmd.Env = env
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to capture pg_receivewal output: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start pg_receivewal: %w", err)
+	}
+	archiver.running.Store(true)
+
+	// Keep the last line pg_receivewal wrote, which explains why it stopped
+	var last string
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			last = line
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("pg_receivewal failed: %w: %s", err, last)
+	}
+	return fmt.Errorf("pg_receivewal stopped: %s", last)
+}
+
+// recordArchiverExit counts a restart of an archive's pg_receivewal and keeps
+// the reason it exited
+func (ps *PhysicalBackupService) recordArchiverExit(connectionID string, cause error) {
+	archive, err := ps.loadWALArchive(connectionID)
+	if err != nil {
+		log.Printf("Failed to record WAL archive of connection %s: %v", connectionID, err)
+		return
+	}
+	archive.Restarts++
+	archive.LastError = cause.Error()
+	if err := ps.saveWALArchive(archive); err != nil {
+		log.Printf("Failed to record WAL archive of connection %s: %v", connectionID, err)
+	}
+}
+
+// listWALSegments returns the WAL segments in an archive directory in WAL
+// order; a missing directory holds none
+func listWALSegments(dir string) ([]walSegment, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []walSegment
+	for _, entry := range entries {
+		if !walSegmentPattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		segments = append(segments, walSegment{name: entry.Name(), size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].name < segments[j].name
+	})
+	return segments, nil
+}
+
+// saveWALArchive persists the state of a WAL archive
+func (ps *PhysicalBackupService) saveWALArchive(archive *models.WALArchive) error {
+	if err := ps.store.put(walArchivesBucket, archive.ConnectionID, archive); err != nil {
+		return fmt.Errorf("failed to save WAL archive: %w", err)
+	}
+	return nil
+}
+
+// loadWALArchive reads the WAL archive of a connection
+func (ps *PhysicalBackupService) loadWALArchive(connectionID string) (*models.WALArchive, error) {
+	var archive models.WALArchive
+	found, err := ps.store.get(walArchivesBucket, connectionID, &archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAL archive: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrWALArchiveNotFound, connectionID)
+	}
+	return &archive, nil
+}
@@ -22,7 +22,10 @@ func main() {
 	}
 
 	// Initialize and start the server
-	srv := server.NewServer()
+	srv, err := server.NewServer()
+	if err != nil {
+		log.Fatal("Failed to initialize server:", err)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -9,6 +9,8 @@ interface SnapshotProgress {
   message: string;
   file_size?: number;
   started_at?: string;
+  current_table?: string;
+  eta_seconds?: number;
 }
 
 interface ProgressTrackerProps {
@@ -24,22 +26,25 @@ export default function ProgressTracker({ snapshotId, onComplete, onError }: Pro
   useEffect(() => {
     if (!isTracking || !snapshotId) return;
 
-    const pollProgress = async () => {
+    const handleProgress = (progressData: SnapshotProgress) => {
+      setProgress(progressData);
+
+      if (progressData.status === 'completed') {
+        setIsTracking(false);
+        onComplete?.();
+      } else if (progressData.status === 'failed' || progressData.status === 'cancelled') {
+        setIsTracking(false);
+        onError?.(progressData.message || 'Snapshot operation failed');
+      }
+    };
+
+    const loadProgress = async () => {
       try {
         const response = await fetch(`http://localhost:8080/api/v1/snapshots/${snapshotId}/progress`);
         const result = await response.json();
 
         if (result.success) {
-          const progressData = result.data;
-          setProgress(progressData);
-
-          if (progressData.status === 'completed') {
-            setIsTracking(false);
-            onComplete?.();
-          } else if (progressData.status === 'failed') {
-            setIsTracking(false);
-            onError?.(progressData.message || 'Snapshot operation failed');
-          }
+          handleProgress(result.data);
         } else {
           onError?.(result.error || 'Failed to get progress');
           setIsTracking(false);
@@ -50,12 +55,22 @@ export default function ProgressTracker({ snapshotId, onComplete, onError }: Pro
       }
     };
 
-    // Poll immediately, then every 2 seconds
-    pollProgress();
-    const interval = setInterval(pollProgress, 2000);
+    // Subscribe to live updates, then load the current state in case the
+    // snapshot moved on before the stream was open
+    const events = new EventSource(`http://localhost:8080/api/v1/jobs/${snapshotId}/events`);
+    events.addEventListener('progress', (event) => {
+      const data = JSON.parse((event as MessageEvent).data);
+      if (data.progress) {
+        handleProgress(data.progress);
+      }
+    });
+    events.addEventListener('state', () => {
+      loadProgress();
+    });
+    loadProgress();
 
     return () => {
-      clearInterval(interval);
+      events.close();
     };
   }, [isTracking, snapshotId, onComplete, onError]);
 